@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// authorComment matches the author comments PoC writers leave above the
+// YAML, such as "# author: alice" or "# @author alice".
+var authorComment = regexp.MustCompile(`(?i)^\s*#\s*@?(?:author|authors|written by)\s*[:：]?\s+(.+?)\s*$`)
+
+// notCommitted is the address git blame gives lines not committed yet.
+const notCommitted = "not.committed.yet"
+
+// pocAttribution names the authors of one file of a duplicate group.
+type pocAttribution struct {
+	File string `json:"file"`
+	// Declared are the authors the PoC names: detail.author, author or an
+	// author comment.
+	Declared []string `json:"declared,omitempty"`
+	// Git are the authors git blame credits with the file's lines, most
+	// lines first.
+	Git []gitAuthor `json:"git,omitempty"`
+}
+
+type gitAuthor struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+	Lines int    `json:"lines"`
+}
+
+// attributeGroups sets the attribution of every group. Git authors are only
+// looked up when root is inside a git work tree.
+func attributeGroups(report *scanReport, root string) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		abs = root
+	}
+	blame := true
+	if out, err := git(abs, nil, "rev-parse", "--is-inside-work-tree"); err != nil || strings.TrimSpace(out) != "true" {
+		slog.Debug("not in a git work tree, attributing by declared authors only", "dir", root)
+		blame = false
+	}
+	cache := make(map[string]pocAttribution)
+	for i := range report.Duplicates {
+		group := &report.Duplicates[i]
+		group.Attribution = nil
+		seen := make(map[string]bool)
+		for _, entry := range group.Entries {
+			if seen[entry.FilePath] {
+				continue
+			}
+			seen[entry.FilePath] = true
+			attr, ok := cache[entry.FilePath]
+			if !ok {
+				attr = attributeFile(abs, entry, blame)
+				cache[entry.FilePath] = attr
+			}
+			group.Attribution = append(group.Attribution, attr)
+		}
+	}
+}
+
+func attributeFile(root string, entry pocEntry, blame bool) pocAttribution {
+	attr := pocAttribution{File: entry.FilePath}
+	if entry.Detail != nil && entry.Detail.Author != "" {
+		attr.Declared = append(attr.Declared, entry.Detail.Author)
+	}
+	for _, author := range commentAuthors(entry.FilePath) {
+		attr.Declared = appendUnique(attr.Declared, author)
+	}
+	if blame {
+		authors, err := blameAuthors(root, entry.FilePath)
+		if err != nil {
+			slog.Debug("git blame", "file", entry.FilePath, "err", err)
+		}
+		attr.Git = authors
+	}
+	return attr
+}
+
+// commentAuthors returns the authors named in the comments of a YAML file.
+func commentAuthors(file string) []string {
+	if isJSONFile(file) {
+		return nil
+	}
+	f, err := os.Open(longPath(file))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var authors []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if m := authorComment.FindStringSubmatch(scanner.Text()); m != nil {
+			authors = appendUnique(authors, m[1])
+		}
+	}
+	return authors
+}
+
+// blameAuthors counts the lines git blame credits to each author of file,
+// leaving out lines not committed yet. An untracked file has none.
+func blameAuthors(root, file string) ([]gitAuthor, error) {
+	out, err := git(root, nil, "blame", "--line-porcelain", "-w", "--", file)
+	if err != nil {
+		return nil, err
+	}
+	lines := make(map[gitAuthor]int)
+	var current gitAuthor
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "author "):
+			current = gitAuthor{Name: strings.TrimPrefix(line, "author ")}
+		case strings.HasPrefix(line, "author-mail "):
+			current.Email = strings.Trim(strings.TrimPrefix(line, "author-mail "), "<>")
+		case strings.HasPrefix(line, "\t"):
+			if current.Email != notCommitted {
+				lines[current]++
+			}
+		}
+	}
+	authors := make([]gitAuthor, 0, len(lines))
+	for author, n := range lines {
+		author.Lines = n
+		authors = append(authors, author)
+	}
+	sort.Slice(authors, func(i, j int) bool {
+		if authors[i].Lines != authors[j].Lines {
+			return authors[i].Lines > authors[j].Lines
+		}
+		return authors[i].Name < authors[j].Name
+	})
+	return authors, nil
+}
+
+// describeAttribution is the one-line form of an attribution in the text
+// and markdown reports.
+func describeAttribution(attr pocAttribution) string {
+	var parts []string
+	if len(attr.Declared) > 0 {
+		parts = append(parts, tr("declared: ")+strings.Join(attr.Declared, ", "))
+	}
+	if len(attr.Git) > 0 {
+		authors := make([]string, len(attr.Git))
+		for i, author := range attr.Git {
+			authors[i] = author.Name
+			if author.Email != "" {
+				authors[i] += " <" + author.Email + ">"
+			}
+			authors[i] += " (" + strconv.Itoa(author.Lines) + tr(" lines") + ")"
+		}
+		parts = append(parts, "git: "+strings.Join(authors, ", "))
+	}
+	if len(parts) == 0 {
+		return tr("unknown")
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Inside a -backup archive the manifest sits next to a files/ directory
+// holding each backed-up file at its path relative to -dir, so
+//
+//	tar xzf backup.tar.gz -C ./pocs --strip-components=1 files
+//
+// puts every deleted or cut file back as it was.
+const (
+	backupManifestName = "manifest.json"
+	backupFilesDir     = "files"
+)
+
+// writeBackup writes a timestamped tar.gz into dir holding, before plan is
+// carried out, every file it deletes or removes documents from, and the plan
+// as the manifest: what happens to each file, the PoCs kept in its place and
+// the sha256 of each file. It returns the archive's path.
+func writeBackup(dir string, plan *dedupePlan) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, "repeaterxraypoc-backup-"+time.Now().UTC().Format("20060102-150405")+".tar.gz")
+	if _, err := os.Stat(name); err == nil {
+		return "", fmt.Errorf("%s already exists", name)
+	}
+	f, err := os.CreateTemp(dir, ".backup-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if err := writeBackupArchive(f, plan); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func writeBackupArchive(f *os.File, plan *dedupePlan) error {
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	manifest, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifest = append(manifest, '\n')
+	if err := tw.WriteHeader(&tar.Header{Name: backupManifestName, Mode: 0o644, Size: int64(len(manifest)), ModTime: plan.Created}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+	for _, a := range plan.Actions {
+		path := filepath.Join(plan.Root, filepath.FromSlash(a.File))
+		raw, err := os.ReadFile(longPath(path))
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(longPath(path))
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: backupFilesDir + "/" + a.File, Mode: int64(info.Mode().Perm()), Size: int64(len(raw)), ModTime: info.ModTime().Truncate(time.Second)}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("back up %s: %w", a.File, err)
+		}
+		if _, err := tw.Write(raw); err != nil {
+			return fmt.Errorf("back up %s: %w", a.File, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
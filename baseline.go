@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+const baselineVersion = 1
+
+// baselineFile records accepted duplicate groups. Files are stored relative
+// to the scanned root so the baseline can be committed next to the corpus.
+type baselineFile struct {
+	Version     int             `json:"version"`
+	ToolVersion string          `json:"tool_version,omitempty"`
+	Strategy    string          `json:"strategy"`
+	Duplicates  []baselineGroup `json:"duplicates"`
+}
+
+type baselineGroup struct {
+	Key   string   `json:"key"`
+	Files []string `json:"files"`
+}
+
+func loadBaseline(path string) (*baselineFile, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b baselineFile
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if b.Version != baselineVersion {
+		return nil, fmt.Errorf("%s: unsupported baseline version %d", path, b.Version)
+	}
+	return &b, nil
+}
+
+func newBaseline(opts scanOptions, duplicates []duplicateGroup) *baselineFile {
+	b := &baselineFile{Version: baselineVersion, ToolVersion: toolVersion(), Strategy: opts.Strategy, Duplicates: []baselineGroup{}}
+	for _, group := range duplicates {
+		bg := baselineGroup{Key: group.Key}
+		for _, entry := range group.Entries {
+			bg.Files = append(bg.Files, relativeTo(opts.Root, entry.unit()))
+		}
+		sort.Strings(bg.Files)
+		b.Duplicates = append(b.Duplicates, bg)
+	}
+	return b
+}
+
+func (b *baselineFile) write(path string) error {
+	raw, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(raw, '\n'), 0o644)
+}
+
+// filter drops duplicate groups whose files were all part of the same group
+// in the baseline. A group that gained a file is reported in full.
+func (b *baselineFile) filter(opts scanOptions, duplicates []duplicateGroup) (fresh []duplicateGroup, suppressed int) {
+	known := make(map[string]map[string]bool, len(b.Duplicates))
+	for _, bg := range b.Duplicates {
+		files := make(map[string]bool, len(bg.Files))
+		for _, file := range bg.Files {
+			files[fileKey(file)] = true
+		}
+		known[bg.Key] = files
+	}
+	for _, group := range duplicates {
+		files, ok := known[group.Key]
+		accepted := ok
+		for _, entry := range group.Entries {
+			if !accepted {
+				break
+			}
+			accepted = files[fileKey(relativeTo(opts.Root, entry.unit()))]
+		}
+		if accepted {
+			suppressed++
+			continue
+		}
+		fresh = append(fresh, group)
+	}
+	return fresh, suppressed
+}
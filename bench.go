@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+)
+
+const benchUsage = `
+Usage:
+  go run . bench -dir <path-to-pocs> [-n <runs>] [-warmup <runs>] [-cpuprofile <file>] [-memprofile <file>] [-format text|json]
+
+Runs the scan pipeline (reading and parsing the PoCs, grouping them and
+finding duplicates) -n times over -dir, under the scan flags and config
+file given, and reports throughput in files and MB per second, allocations
+per run, and the time spent in each stage. Nothing is written to -dir.
+-warmup runs go first and are not counted, so the file cache is warm.
+-cpuprofile writes a pprof CPU profile of the counted runs and -memprofile
+an allocation profile, for go tool pprof -top <file> to show the hot
+functions. Compare the median of two builds on the same corpus to catch
+parser regressions.
+
+Flags:
+`
+
+// benchStages are the stages of the pipeline bench times, in order.
+var benchStages = []string{"collect", "sort", "duplicates"}
+
+// benchRun is one counted run of the pipeline.
+type benchRun struct {
+	Duration   time.Duration            `json:"duration_ns"`
+	Stages     map[string]time.Duration `json:"stages_ns"`
+	Allocs     uint64                   `json:"allocs"`
+	AllocBytes uint64                   `json:"alloc_bytes"`
+	GCs        uint32                   `json:"gcs"`
+}
+
+type benchReport struct {
+	ToolVersion string `json:"tool_version"`
+	Root        string `json:"root"`
+	GoVersion   string `json:"go_version"`
+	CPUs        int    `json:"cpus"`
+	Files       int    `json:"files"`
+	Bytes       int64  `json:"bytes"`
+	PoCs        int    `json:"pocs"`
+	Groups      int    `json:"duplicate_groups"`
+	// Median is the median run; throughput is computed from it.
+	Median      time.Duration `json:"median_ns"`
+	Min         time.Duration `json:"min_ns"`
+	Max         time.Duration `json:"max_ns"`
+	FilesPerSec float64       `json:"files_per_sec"`
+	MBPerSec    float64       `json:"mb_per_sec"`
+	Runs        []benchRun    `json:"runs"`
+}
+
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	runsFlag := fs.Int("n", 5, "Number of counted runs")
+	warmupFlag := fs.Int("warmup", 1, "Number of runs before the counted ones")
+	cpuProfileFlag := fs.String("cpuprofile", "", "Write a CPU profile of the counted runs to this file")
+	memProfileFlag := fs.String("memprofile", "", "Write an allocation profile to this file")
+	formatFlag := fs.String("format", formatText, "Output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(benchUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	format := strings.ToLower(strings.TrimSpace(*formatFlag))
+	if format != formatText && format != formatJSON {
+		slog.Error("unsupported format (want text or json)", "format", *formatFlag)
+		return exitError
+	}
+	if *runsFlag < 1 || *warmupFlag < 0 {
+		slog.Error("-n must be at least 1 and -warmup not negative")
+		return exitUsage
+	}
+
+	report := benchReport{ToolVersion: toolVersion(), Root: opts.Root, GoVersion: runtime.Version(), CPUs: runtime.GOMAXPROCS(0)}
+	err = walkPoCFiles(opts, func(path string) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		report.Files++
+		report.Bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		slog.Error("listing PoCs", "err", err)
+		return exitError
+	}
+	for i := 0; i < *warmupFlag; i++ {
+		if _, err := benchPipeline(opts, &report); err != nil {
+			slog.Error("warmup run", "err", err)
+			return exitError
+		}
+	}
+
+	if *cpuProfileFlag != "" {
+		f, err := os.Create(*cpuProfileFlag)
+		if err != nil {
+			slog.Error("creating CPU profile", "err", err)
+			return exitError
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			slog.Error("starting CPU profile", "err", err)
+			return exitError
+		}
+	}
+	for i := 0; i < *runsFlag; i++ {
+		run, err := benchPipeline(opts, &report)
+		if err != nil {
+			pprof.StopCPUProfile()
+			slog.Error("benchmark run", "run", i+1, "err", err)
+			return exitError
+		}
+		report.Runs = append(report.Runs, run)
+		slog.Debug("benchmark run", "run", i+1, "duration", run.Duration)
+	}
+	if *cpuProfileFlag != "" {
+		pprof.StopCPUProfile()
+	}
+	if *memProfileFlag != "" {
+		if err := writeMemProfile(*memProfileFlag); err != nil {
+			slog.Error("writing memory profile", "err", err)
+			return exitError
+		}
+	}
+	report.summarize()
+
+	if format == formatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else if !*sf.quiet {
+		printBenchReport(report)
+	}
+	if err != nil {
+		slog.Error("writing report", "format", format, "err", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// benchPipeline runs the pipeline once and measures it. The corpus counts
+// are recorded in report.
+func benchPipeline(opts scanOptions, report *benchReport) (benchRun, error) {
+	run := benchRun{Stages: make(map[string]time.Duration, len(benchStages))}
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	corpus, err := collectCorpus(context.Background(), opts, nil)
+	if err != nil {
+		return run, err
+	}
+	run.Stages["collect"] = time.Since(start)
+	mark := time.Now()
+	sortGroups(corpus.groups, opts)
+	run.Stages["sort"] = time.Since(mark)
+	mark = time.Now()
+	duplicates := findDuplicates(corpus.groups, opts)
+	run.Stages["duplicates"] = time.Since(mark)
+
+	run.Duration = time.Since(start)
+	runtime.ReadMemStats(&after)
+	run.Allocs = after.Mallocs - before.Mallocs
+	run.AllocBytes = after.TotalAlloc - before.TotalAlloc
+	run.GCs = after.NumGC - before.NumGC
+	report.PoCs, report.Groups = len(corpus.units), len(duplicates)
+	return run, nil
+}
+
+func writeMemProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	runtime.GC()
+	return pprof.Lookup("allocs").WriteTo(f, 0)
+}
+
+func (r *benchReport) summarize() {
+	durations := make([]time.Duration, len(r.Runs))
+	for i, run := range r.Runs {
+		durations[i] = run.Duration
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	r.Min, r.Max = durations[0], durations[len(durations)-1]
+	r.Median = medianDuration(durations)
+	if secs := r.Median.Seconds(); secs > 0 {
+		r.FilesPerSec = float64(r.Files) / secs
+		r.MBPerSec = float64(r.Bytes) / (1 << 20) / secs
+	}
+}
+
+// medianDuration is the median of sorted durations.
+func medianDuration(sorted []time.Duration) time.Duration {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+func printBenchReport(r benchReport) {
+	fmt.Printf("Benchmarked %d runs over %d files (%s, %d PoCs, %d duplicate groups) with %s on %d CPUs.\n",
+		len(r.Runs), r.Files, humanBytes(r.Bytes), r.PoCs, r.Groups, r.GoVersion, r.CPUs)
+	fmt.Printf("\nTime per run:  median %s, min %s, max %s\n", r.Median.Round(time.Microsecond), r.Min.Round(time.Microsecond), r.Max.Round(time.Microsecond))
+	fmt.Printf("Throughput:    %.0f files/sec, %.2f MB/sec\n", r.FilesPerSec, r.MBPerSec)
+
+	var allocs, allocBytes, gcs uint64
+	for _, run := range r.Runs {
+		allocs += run.Allocs
+		allocBytes += run.AllocBytes
+		gcs += uint64(run.GCs)
+	}
+	n := uint64(len(r.Runs))
+	fmt.Printf("Allocations:   %d allocs/run, %s/run, %.1f GCs/run\n", allocs/n, humanBytes(int64(allocBytes/n)), float64(gcs)/float64(n))
+
+	fmt.Println("\nStages (median):")
+	for _, stage := range benchStages {
+		times := make([]time.Duration, len(r.Runs))
+		for i, run := range r.Runs {
+			times[i] = run.Stages[stage]
+		}
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+		median := medianDuration(times)
+		share := 0.0
+		if r.Median > 0 {
+			share = 100 * float64(median) / float64(r.Median)
+		}
+		fmt.Printf("  %-11s %12s  %5.1f%%\n", stage, median.Round(time.Microsecond), share)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// pluginNamePattern finds plugin names on a line of a plugin list, whatever
+// surrounds them: xray prints them with log prefixes and descriptions.
+var pluginNamePattern = regexp.MustCompile(`\bpoc-[a-z]+-[A-Za-z0-9_.-]+`)
+
+// builtinDuplicate is a local PoC that duplicates a built-in plugin.
+type builtinDuplicate struct {
+	Name    string `json:"name"`
+	File    string `json:"file"`
+	Builtin string `json:"builtin"`
+	Reason  string `json:"reason"`
+}
+
+type builtinReport struct {
+	ToolVersion string             `json:"tool_version"`
+	Root        string             `json:"root"`
+	Files       int                `json:"files"`
+	Plugins     int                `json:"plugins"`
+	Duplicates  []builtinDuplicate `json:"duplicates"`
+	Skipped     []skippedFile      `json:"skipped"`
+}
+
+func runBuiltinsReport(fs *flag.FlagSet, sf *scanFlags, formatFlag *string, args []string) int {
+	pluginsFlag := fs.String("plugins", "", "File listing xray's built-in plugins, e.g. the output of xray ws --list (- for stdin)")
+	builtinDirFlag := fs.String("builtin-dir", "", "Directory with the YAML of xray's built-in PoCs, compared by detection fingerprint")
+	failOnFlag := fs.String("fail-on", failOnNone, "Exit non-zero when findings exist: duplicates (PoCs duplicating a built-in plugin), invalid or none")
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	format := strings.ToLower(strings.TrimSpace(*formatFlag))
+	if format != formatText && format != formatJSON {
+		slog.Error("unsupported format (want text or json)", "format", *formatFlag)
+		return exitError
+	}
+	policy, err := parseFailOn(*failOnFlag)
+	if err != nil {
+		slog.Error("invalid -fail-on", "err", err)
+		return exitError
+	}
+	if *pluginsFlag == "" && *builtinDirFlag == "" {
+		slog.Error("report builtins needs -plugins or -builtin-dir")
+		return exitUsage
+	}
+	builtins := make(map[string]string)
+	if *pluginsFlag != "" {
+		if err := loadPluginList(*pluginsFlag, builtins); err != nil {
+			slog.Error("loading plugin list", "err", err)
+			return exitError
+		}
+	}
+	fingerprints := make(map[string]string)
+	if *builtinDirFlag != "" {
+		if err := loadBuiltinPoCs(*builtinDirFlag, opts, builtins, fingerprints); err != nil {
+			slog.Error("reading built-in PoCs", "dir", *builtinDirFlag, "err", err)
+			return exitError
+		}
+	}
+
+	entries, skipped, err := collectPoCs(context.Background(), opts, nil)
+	if err != nil {
+		slog.Error("collecting PoCs", "err", err)
+		return exitError
+	}
+	report := buildBuiltinReport(opts, entries, skipped, builtins, fingerprints)
+
+	if format == formatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else if !*sf.quiet {
+		printBuiltinReport(report)
+	}
+	if err != nil {
+		slog.Error("writing report", "format", format, "err", err)
+		return exitError
+	}
+	return policy.exitCode(len(report.Duplicates), len(report.Skipped))
+}
+
+// pluginKey is the form plugin names are compared in: case and the
+// poc-yaml- prefix do not matter.
+func pluginKey(name string) string {
+	return strings.TrimPrefix(normalizedStem(name), pocNamePrefix)
+}
+
+// loadPluginList adds the plugins listed in path, or on stdin for "-", to
+// builtins, keyed by pluginKey. A line without a poc-... name is taken as a
+// name when it is a single word; # starts a comment.
+func loadPluginList(path string, builtins map[string]string) error {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		names := pluginNamePattern.FindAllString(line, -1)
+		if fields := strings.Fields(line); len(names) == 0 && len(fields) == 1 {
+			names = fields
+		}
+		for _, name := range names {
+			if key := pluginKey(name); key != "" {
+				builtins[key] = name
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// loadBuiltinPoCs adds the names of the PoCs under dir to builtins and their
+// detection fingerprints to fingerprints.
+func loadBuiltinPoCs(dir string, opts scanOptions, builtins, fingerprints map[string]string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isSupportedExt(path) {
+			return err
+		}
+		pf, err := readPoCFile(path)
+		if err != nil {
+			slog.Warn("skipping built-in PoC", "file", path, "err", err)
+			return nil
+		}
+		for _, doc := range pf.Docs {
+			name := findFirstScalar(&doc.Node, "name")
+			if name == "" {
+				name = fileStem(path)
+			}
+			if key := pluginKey(name); key != "" {
+				builtins[key] = name
+			}
+			if fp, err := detectionFingerprint(&doc.Node, opts.Normalize); err == nil {
+				fingerprints[fp] = name
+			}
+		}
+		return nil
+	})
+}
+
+func buildBuiltinReport(opts scanOptions, entries []pocEntry, skipped []skippedFile, builtins, fingerprints map[string]string) builtinReport {
+	report := builtinReport{ToolVersion: toolVersion(), Root: opts.Root, Plugins: len(builtins), Duplicates: []builtinDuplicate{}, Skipped: skipped}
+	if report.Skipped == nil {
+		report.Skipped = []skippedFile{}
+	}
+	seen := make(map[string]bool)
+	files := make(map[string]*pocFile)
+	for _, entry := range entries {
+		if seen[entry.unit()] {
+			continue
+		}
+		seen[entry.unit()] = true
+		if entry.Doc == 0 {
+			report.Files++
+		}
+		dup := builtinDuplicate{Name: entry.Name, File: entry.unit()}
+		if builtin, ok := builtins[pluginKey(entry.Name)]; ok && entry.HasName {
+			dup.Builtin, dup.Reason = builtin, "same name"
+			report.Duplicates = append(report.Duplicates, dup)
+			continue
+		}
+		if len(fingerprints) == 0 {
+			continue
+		}
+		pf, ok := files[entry.FilePath]
+		if !ok {
+			var err error
+			if pf, err = readPoCFile(entry.FilePath); err != nil {
+				slog.Warn("cannot fingerprint PoC", "file", entry.FilePath, "err", err)
+			}
+			files[entry.FilePath] = pf
+		}
+		if pf == nil || entry.Doc >= len(pf.Docs) {
+			continue
+		}
+		fp, err := detectionFingerprint(&pf.Docs[entry.Doc].Node, opts.Normalize)
+		if err != nil {
+			continue
+		}
+		if builtin, ok := fingerprints[fp]; ok {
+			dup.Builtin, dup.Reason = builtin, "same fingerprint"
+			report.Duplicates = append(report.Duplicates, dup)
+		}
+	}
+	sort.Slice(report.Duplicates, func(i, j int) bool { return report.Duplicates[i].File < report.Duplicates[j].File })
+	return report
+}
+
+func printBuiltinReport(report builtinReport) {
+	fmt.Printf("Compared %d PoC files with %d built-in plugins.\n", report.Files, report.Plugins)
+	if len(report.Duplicates) == 0 {
+		fmt.Println("No PoC duplicates a built-in plugin.")
+	} else {
+		fmt.Printf("\n%d PoCs duplicate a built-in plugin:\n", len(report.Duplicates))
+		for _, dup := range report.Duplicates {
+			fmt.Printf("  - %s (name=%q): %s as %s\n", dup.File, dup.Name, dup.Reason, dup.Builtin)
+		}
+	}
+	printSkippedReport(report.Skipped)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// contentHash is the sha256 of the canonical form of a parsed PoC: the
+// values it denotes, whether written as YAML or JSON, and regardless of
+// comments, quoting, indentation, key order and anchors. A foo.yml and a
+// foo.json with the same content hash the same. A document that has no
+// canonical form falls back to the hash of raw. The fields -mark adds are
+// left out, so a marked copy still hashes like the PoC it names. With eol
+// set, CRLF in string values counts as LF.
+func contentHash(root *yaml.Node, raw []byte, eol bool) string {
+	value := canonicalValue(root)
+	if eol {
+		value = withoutCR(value)
+	}
+	if m, ok := value.(map[string]any); ok {
+		delete(m, duplicateOfField)
+		delete(m, duplicateMarkedField)
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		canonical = raw
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// withoutCR replaces CRLF with LF in the strings of a canonical value.
+func withoutCR(value any) any {
+	switch v := value.(type) {
+	case string:
+		return strings.ReplaceAll(v, "\r\n", "\n")
+	case []any:
+		for i, item := range v {
+			v[i] = withoutCR(item)
+		}
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[withoutCR(key).(string)] = withoutCR(item)
+		}
+		return m
+	}
+	return value
+}
+
+// canonicalValue converts node to plain values that encoding/json writes
+// the same way for equal content: mappings become maps, whose keys it
+// sorts, with merge keys (<<) expanded; numbers, booleans and null are
+// decoded; every other scalar, timestamps included, stays the string it
+// was written as.
+func canonicalValue(node *yaml.Node) any {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil
+		}
+		return canonicalValue(node.Content[0])
+	case yaml.AliasNode:
+		return canonicalValue(node.Alias)
+	case yaml.SequenceNode:
+		list := make([]any, len(node.Content))
+		for i, item := range node.Content {
+			list[i] = canonicalValue(item)
+		}
+		return list
+	case yaml.MappingNode:
+		m := make(map[string]any, len(node.Content)/2)
+		var merged []*yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := resolveAlias(node.Content[i]), node.Content[i+1]
+			if key.Kind == yaml.ScalarNode && key.ShortTag() == "!!merge" {
+				merged = append(merged, value)
+				continue
+			}
+			m[canonicalKey(key)] = canonicalValue(value)
+		}
+		// Keys written in the mapping win over merged ones, and earlier
+		// merged mappings over later ones.
+		for _, value := range merged {
+			sources := []*yaml.Node{resolveAlias(value)}
+			if sources[0].Kind == yaml.SequenceNode {
+				sources = sources[0].Content
+			}
+			for _, source := range sources {
+				if from, ok := canonicalValue(source).(map[string]any); ok {
+					for k, v := range from {
+						if _, ok := m[k]; !ok {
+							m[k] = v
+						}
+					}
+				}
+			}
+		}
+		return m
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!int", "!!float", "!!bool", "!!null":
+			var v any
+			if err := node.Decode(&v); err == nil {
+				return v
+			}
+		}
+		return node.Value
+	}
+	return nil
+}
+
+// canonicalKey is the map key for a mapping key: its value, or for a
+// collection used as a key, its canonical JSON.
+func canonicalKey(key *yaml.Node) string {
+	if key.Kind == yaml.ScalarNode {
+		return key.Value
+	}
+	raw, err := json.Marshal(canonicalValue(key))
+	if err != nil {
+		return key.Value
+	}
+	return string(raw)
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const checkUsage = `
+Usage:
+  go run . check -dir <path-to-pocs> -xray <path-to-xray> [-target <url> | -fixtures <dir>] [-parallel N] [-format text|json]
+
+Runs every PoC that deduplication keeps through a local xray binary and
+reports the ones xray fails to load. Without -target the PoCs run against a
+built-in mock server: it replays the canned responses of -fixtures (see
+go run . mockserver -h) or answers every request with an empty 200 page, so
+only loading and parsing are exercised.
+
+Flags:
+`
+
+const (
+	defaultXrayArgs    = "webscan --plugins phantasm --poc {poc} --url {target}"
+	defaultFailPattern = `(?i)\[(ERRO|FATL)\].*(poc|yaml|parse|load|unmarshal)`
+)
+
+type checkResult struct {
+	File   string `json:"file"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Output is the tail of xray's output for failed PoCs.
+	Output string `json:"output,omitempty"`
+}
+
+// xrayChecker runs one xray process per PoC.
+type xrayChecker struct {
+	xray    string
+	args    []string
+	target  string
+	timeout time.Duration
+	fail    *regexp.Regexp
+}
+
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	xrayFlag := fs.String("xray", "", "Path to the xray binary")
+	targetFlag := fs.String("target", "", "URL to run the PoCs against (default: a built-in mock server)")
+	fixturesFlag := fs.String("fixtures", "", "Fixture directory for the built-in mock server, in the mockserver format")
+	argsFlag := fs.String("xray-args", defaultXrayArgs, "xray arguments; {poc} and {target} are replaced per PoC")
+	failPatternFlag := fs.String("fail-pattern", defaultFailPattern, "Regexp marking a PoC as rejected when it matches xray's output")
+	timeoutFlag := fs.Duration("timeout", time.Minute, "Time allowed for each xray run")
+	parallelFlag := fs.Int("parallel", 1, "Number of xray processes run at once")
+	formatFlag := fs.String("format", formatText, "Output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(checkUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	if *xrayFlag == "" {
+		slog.Error("-xray is required")
+		return exitUsage
+	}
+	format := strings.ToLower(strings.TrimSpace(*formatFlag))
+	if format != formatText && format != formatJSON {
+		slog.Error("unsupported format (want text or json)", "format", *formatFlag)
+		return exitError
+	}
+	fail, err := regexp.Compile(*failPatternFlag)
+	if err != nil {
+		slog.Error("invalid -fail-pattern", "err", err)
+		return exitUsage
+	}
+	if *targetFlag != "" && *fixturesFlag != "" {
+		slog.Error("-target and -fixtures are mutually exclusive")
+		return exitUsage
+	}
+	if *parallelFlag < 1 {
+		slog.Error("-parallel must be at least 1")
+		return exitUsage
+	}
+	xray, err := exec.LookPath(*xrayFlag)
+	if err != nil {
+		slog.Error("locating xray", "err", err)
+		return exitError
+	}
+	if xray, err = filepath.Abs(xray); err != nil {
+		slog.Error("locating xray", "err", err)
+		return exitError
+	}
+
+	corpus, err := collectCorpus(context.Background(), opts, nil)
+	if err != nil {
+		slog.Error("collecting PoCs", "err", err)
+		return exitError
+	}
+	sortGroups(corpus.groups, opts)
+	files := keptFiles(corpus.units, findDuplicates(corpus.groups, opts))
+	if len(corpus.skipped) > 0 {
+		slog.Warn("PoCs that failed to parse are not checked", "skipped", len(corpus.skipped))
+	}
+
+	target := *targetFlag
+	if target == "" {
+		var responses []mockResponse
+		if *fixturesFlag != "" {
+			if responses, err = loadMockFixtures(*fixturesFlag); err != nil {
+				slog.Error("loading fixtures", "err", err)
+				return exitError
+			}
+		}
+		url, stop, err := startMockTarget(responses)
+		if err != nil {
+			slog.Error("starting mock server", "err", err)
+			return exitError
+		}
+		defer stop()
+		target = url
+	}
+	checker := &xrayChecker{
+		xray:    xray,
+		args:    strings.Fields(*argsFlag),
+		target:  target,
+		timeout: *timeoutFlag,
+		fail:    fail,
+	}
+	slog.Info("checking PoCs with xray", "pocs", len(files), "xray", xray, "target", target)
+	results := checker.checkAll(files, *parallelFlag)
+
+	failed := 0
+	for _, r := range results {
+		if r.Status != "ok" {
+			failed++
+		}
+	}
+	if format == formatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			slog.Error("writing report", "err", err)
+			return exitError
+		}
+	} else if !*sf.quiet {
+		for _, r := range results {
+			if r.Status == "ok" {
+				continue
+			}
+			fmt.Printf("%-8s %s: %s\n", strings.ToUpper(r.Status), r.File, r.Error)
+			for _, line := range strings.Split(r.Output, "\n") {
+				if line != "" {
+					fmt.Printf("    %s\n", line)
+				}
+			}
+		}
+		fmt.Printf("%d PoCs checked with xray: %d loaded, %d failed\n", len(results), len(results)-failed, failed)
+	}
+	if failed > 0 {
+		return exitInvalid
+	}
+	return exitOK
+}
+
+// keptFiles lists the files that still hold a kept PoC once the duplicates
+// are removed, in path order.
+func keptFiles(units []pocEntry, duplicates []duplicateGroup) []string {
+	removed := make(map[string]bool)
+	for _, unit := range deletionUnits(duplicates) {
+		removed[unit] = true
+	}
+	seen := make(map[string]bool)
+	var files []string
+	for _, unit := range units {
+		if removed[unit.unit()] || seen[unit.FilePath] {
+			continue
+		}
+		seen[unit.FilePath] = true
+		files = append(files, unit.FilePath)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// startMockTarget serves the mock responses on a loopback port for PoCs to
+// run against.
+func startMockTarget(responses []mockResponse) (string, func(), error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	server := &http.Server{Handler: mockHandler(responses), ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(ln)
+	return "http://" + ln.Addr().String() + "/", func() { server.Close() }, nil
+}
+
+func (c *xrayChecker) checkAll(files []string, parallel int) []checkResult {
+	results := make([]checkResult, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = c.check(files[i])
+				slog.Debug("checked PoC", "file", files[i], "status", results[i].Status)
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// check runs xray on one PoC. xray only loads .yml and .yaml files, so JSON
+// PoCs are copied to a temporary .yml file first; JSON is valid YAML.
+func (c *xrayChecker) check(file string) checkResult {
+	r := checkResult{File: file, Status: "ok"}
+	poc := file
+	if isJSONFile(file) {
+		tmp, err := copyAsYAML(file)
+		if err != nil {
+			r.Status, r.Error = "error", err.Error()
+			return r
+		}
+		defer os.Remove(tmp)
+		poc = tmp
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	args := make([]string, len(c.args))
+	for i, arg := range c.args {
+		args[i] = strings.NewReplacer("{poc}", poc, "{target}", c.target).Replace(arg)
+	}
+	cmd := exec.CommandContext(ctx, c.xray, args...)
+	// xray reads and writes its config.yaml next to the binary.
+	cmd.Dir = filepath.Dir(c.xray)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		r.Status, r.Error = "error", fmt.Sprintf("xray did not finish within %s", c.timeout)
+	case err != nil:
+		r.Status, r.Error = "rejected", fmt.Sprintf("xray exited with %v", err)
+	default:
+		if c.fail.MatchString(out.String()) {
+			r.Status, r.Error = "rejected", "xray output matches -fail-pattern"
+		}
+	}
+	if r.Status != "ok" {
+		r.Output = outputTail(out.String(), 10)
+	}
+	return r
+}
+
+func copyAsYAML(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp("", "repeaterxraypoc-check-*.yml")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), tmp.Close()
+}
+
+// outputTail returns the last n non-empty lines of xray's output.
+func outputTail(out string, n int) string {
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimRight(line, "\r "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
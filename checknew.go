@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const checkNewUsage = `
+Usage:
+  go run . check-new -dir <path-to-pocs> [-index <file>] [-format text|json] <file>...
+  git diff --name-only | go run . check-new -dir <path-to-pocs> -files -
+
+Checks new PoC files against the corpus before they are committed and exits
+with 3 when one has the same name, the same content or the same request path
+as an existing PoC. The corpus is read from an index that is refreshed by
+re-reading only the files changed since the last run, so the check stays fast
+on large corpora. Meant for pre-commit hooks, which pass the staged files.
+-files reads further files, one per line, from a file or from stdin; listed
+files that are deleted or are not PoCs (by extension) are skipped, so the
+output of git diff --name-only can be piped in as it is.
+
+Flags:
+`
+
+type checkNewFinding struct {
+	File     string `json:"file"`
+	Existing string `json:"existing"`
+	Reason   string `json:"reason"`
+	Value    string `json:"value"`
+}
+
+func runCheckNew(args []string) int {
+	fs := flag.NewFlagSet("check-new", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	indexFlag := fs.String("index", "", "Corpus index file (default: under the user cache directory, one per -dir)")
+	formatFlag := fs.String("format", formatText, "Output format: text or json")
+	filesFlag := fs.String("files", "", "File listing further files to check, one per line (- for stdin)")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(checkNewUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	format := strings.ToLower(strings.TrimSpace(*formatFlag))
+	if format != formatText && format != formatJSON {
+		slog.Error("unsupported format (want text or json)", "format", *formatFlag)
+		return exitError
+	}
+	files := fs.Args()
+	if *filesFlag != "" {
+		listed, err := readFileList(*filesFlag)
+		if err != nil {
+			slog.Error("reading -files", "err", err)
+			return exitError
+		}
+		files = append(files, listed...)
+	}
+	if len(files) == 0 {
+		if *filesFlag != "" {
+			// An empty change set has nothing to check.
+			return exitOK
+		}
+		slog.Error("no files to check")
+		return exitUsage
+	}
+	indexPath := *indexFlag
+	if indexPath == "" {
+		indexPath = defaultIndexPath(opts.Root)
+	}
+	idx, err := openIndex(indexPath, opts)
+	if err != nil {
+		slog.Error("indexing PoCs", "err", err)
+		return exitError
+	}
+
+	findings := []checkNewFinding{}
+	invalid := 0
+	for _, file := range files {
+		docs, err := indexPoCFile(file, opts)
+		if err != nil {
+			slog.Error("cannot read new PoC", "file", file, "err", err)
+			invalid++
+			continue
+		}
+		findings = append(findings, idx.duplicatesOf(file, docs, opts)...)
+	}
+	if format == formatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(findings); err != nil {
+			slog.Error("writing report", "err", err)
+			return exitError
+		}
+	} else if !*sf.quiet {
+		for _, f := range findings {
+			fmt.Printf("%s: %s %q as existing PoC %s\n", f.File, f.Reason, f.Value, f.Existing)
+		}
+	}
+	switch {
+	case len(findings) > 0:
+		return exitDuplicates
+	case invalid > 0:
+		return exitInvalid
+	}
+	return exitOK
+}
+
+// readFileList reads the paths listed in src, or on stdin for "-", one per
+// line, leaving out blank lines and paths that do not name an existing PoC
+// file: a diff lists deleted files and files of every kind.
+func readFileList(src string) ([]string, error) {
+	in := os.Stdin
+	if src != "-" {
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+	var files []string
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		file := strings.TrimSpace(scanner.Text())
+		if file == "" {
+			continue
+		}
+		if !isSupportedExt(file) {
+			slog.Debug("skipping listed file that is not a PoC", "file", file)
+			continue
+		}
+		if info, err := os.Stat(file); err != nil || info.IsDir() {
+			slog.Debug("skipping listed file that does not exist", "file", file)
+			continue
+		}
+		files = append(files, file)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", src, err)
+	}
+	return files, nil
+}
+
+// duplicatesOf compares the documents of a new file with the indexed
+// corpus. The file's own index entry, present once it sits in the working
+// tree, is left out.
+func (idx *corpusIndex) duplicatesOf(file string, docs []indexedDoc, opts scanOptions) []checkNewFinding {
+	self := ""
+	if abs, err := filepath.Abs(file); err == nil {
+		self = relativeTo(idx.Root, abs)
+	}
+	var findings []checkNewFinding
+	for _, rel := range idx.sortedFiles() {
+		if rel == self {
+			continue
+		}
+		for i, old := range idx.Files[rel].Docs {
+			existing := filepath.Join(opts.Root, filepath.FromSlash(rel))
+			if len(idx.Files[rel].Docs) > 1 {
+				existing = fmt.Sprintf("%s#%d", existing, i)
+			}
+			for _, doc := range docs {
+				for _, f := range compareIndexed(doc, old, opts) {
+					f.File, f.Existing = file, existing
+					findings = append(findings, f)
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// compareIndexed reports how doc duplicates old: by name, which xray
+// refuses to load twice, and, unless either is exempt, by content or by
+// request path normalized the way scans group them.
+func compareIndexed(doc, old indexedDoc, opts scanOptions) []checkNewFinding {
+	var findings []checkNewFinding
+	if doc.HasName && doc.Name == old.Name {
+		findings = append(findings, checkNewFinding{Reason: "same name", Value: doc.Name})
+	}
+	if doc.Exempt || old.Exempt {
+		return findings
+	}
+	if doc.SHA256 == old.SHA256 {
+		return append(findings, checkNewFinding{Reason: "same content", Value: "sha256:" + doc.SHA256})
+	}
+	if doc.Transport != old.Transport && !opts.CrossTransport {
+		return findings
+	}
+	oldKeys := make(map[string]bool, len(old.Paths))
+	for _, p := range old.Paths {
+		oldKeys[opts.Normalize.apply(p)] = true
+	}
+	for _, p := range doc.Paths {
+		// A generic path is shared by unrelated PoCs; same content was
+		// checked above.
+		if key := opts.Normalize.apply(p); oldKeys[key] && !opts.GenericPaths[key] {
+			findings = append(findings, checkNewFinding{Reason: "same request path", Value: key})
+			delete(oldKeys, key)
+		}
+	}
+	return findings
+}
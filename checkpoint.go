@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// checkpointVersion is bumped whenever the checkpoint layout changes so old
+// checkpoints are discarded rather than misread.
+const checkpointVersion = 3
+
+// checkpointInterval is how often a running scan saves its checkpoint, so a
+// crashed scan loses at most this much work.
+const checkpointInterval = 30 * time.Second
+
+// scanCheckpoint records the PoCs an interrupted scan has read, so that a
+// rerun with the same -checkpoint only reads the files that are new or
+// changed since. Files are keyed by their path relative to the root.
+type scanCheckpoint struct {
+	Version int                       `json:"version"`
+	Root    string                    `json:"root"`
+	Options string                    `json:"options"`
+	Files   map[string]checkpointFile `json:"files"`
+
+	path   string
+	reused int
+	saved  time.Time
+}
+
+type checkpointFile struct {
+	Size    int64             `json:"size"`
+	ModTime time.Time         `json:"modified"`
+	Entries []checkpointEntry `json:"entries"`
+}
+
+// checkpointEntry adds the fields the JSON report leaves out of pocEntry.
+type checkpointEntry struct {
+	pocEntry
+	Docs    int      `json:"docs"`
+	Size    int64    `json:"size"`
+	HasName bool     `json:"has_name,omitempty"`
+	RuleSet []string `json:"rule_set,omitempty"`
+	Content string   `json:"content"`
+	Methods []string `json:"methods,omitempty"`
+}
+
+// checkpointOptions describes the options that change what a file loads
+// into; a checkpoint written under other options is not reused.
+func checkpointOptions(opts scanOptions) string {
+	groupBy := make([]string, len(opts.GroupBy))
+	for i, field := range opts.GroupBy {
+		groupBy[i] = field.Spec
+	}
+	return fmt.Sprintf("%s strategy=%s normalize=%+v generic-paths=%s loose=%t normalize-eol=%t group-by=%s subsets=%t max-file-size=%d parse-timeout=%s max-nodes=%d",
+		toolVersion(), opts.Strategy, opts.Normalize, strings.Join(sortedPaths(opts.GenericPaths), ","), opts.Loose, opts.NormalizeEOL, strings.Join(groupBy, ","),
+		opts.DetectSubsets, opts.MaxFileSize, opts.ParseTimeout, opts.MaxNodes)
+}
+
+// openCheckpoint loads the checkpoint at path, starting over when it is
+// missing or was written for another root or other options.
+func openCheckpoint(path string, opts scanOptions) (*scanCheckpoint, error) {
+	root, err := filepath.Abs(opts.Root)
+	if err != nil {
+		return nil, err
+	}
+	fresh := &scanCheckpoint{Version: checkpointVersion, Root: root, Options: checkpointOptions(opts), Files: map[string]checkpointFile{}, path: path, saved: time.Now()}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fresh, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var c scanCheckpoint
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	if c.Version != fresh.Version || c.Root != fresh.Root || c.Options != fresh.Options || c.Files == nil {
+		slog.Warn("ignoring checkpoint written for another -dir or other options", "checkpoint", path)
+		return fresh, nil
+	}
+	c.path, c.saved = path, time.Now()
+	return &c, nil
+}
+
+// lookup returns the entries recorded for path when the file is unchanged.
+// A nil checkpoint records nothing.
+func (c *scanCheckpoint) lookup(root, path string) ([]pocEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+	f, ok := c.Files[relativeTo(root, path)]
+	if !ok {
+		return nil, false
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != f.Size || !info.ModTime().Equal(f.ModTime) {
+		return nil, false
+	}
+	entries := make([]pocEntry, len(f.Entries))
+	for i, e := range f.Entries {
+		entries[i] = e.pocEntry
+		entries[i].Docs, entries[i].Size, entries[i].HasName, entries[i].RuleSet = e.Docs, e.Size, e.HasName, e.RuleSet
+		entries[i].Content, entries[i].Methods = e.Content, e.Methods
+		// The entries of one document share their detail, as when loaded.
+		if i > 0 && entries[i-1].Doc == e.Doc {
+			entries[i].Detail = entries[i-1].Detail
+		}
+	}
+	c.reused++
+	return entries, true
+}
+
+// record keeps the entries loaded from path, saving the checkpoint every
+// checkpointInterval.
+func (c *scanCheckpoint) record(root, path string, entries []pocEntry) {
+	if c == nil {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	f := checkpointFile{Size: info.Size(), ModTime: info.ModTime(), Entries: make([]checkpointEntry, len(entries))}
+	for i, entry := range entries {
+		f.Entries[i] = checkpointEntry{pocEntry: entry, Docs: entry.Docs, Size: entry.Size, HasName: entry.HasName, RuleSet: entry.RuleSet, Content: entry.Content, Methods: entry.Methods}
+	}
+	c.Files[relativeTo(root, path)] = f
+	if time.Since(c.saved) >= checkpointInterval {
+		if err := c.save(); err != nil {
+			slog.Warn("saving checkpoint", "checkpoint", c.path, "err", err)
+		}
+	}
+}
+
+func (c *scanCheckpoint) save() error {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.saved = time.Now()
+	return nil
+}
+
+// remove deletes the checkpoint once a scan has read every file.
+func (c *scanCheckpoint) remove() error {
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
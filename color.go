@@ -0,0 +1,28 @@
+package main
+
+import "os"
+
+const ansiBold = "\x1b[1m"
+
+// colorOutput enables ANSI colors in the text report. It is set when stdout
+// is a terminal, unless -no-color or the NO_COLOR convention turns it off.
+var colorOutput bool
+
+func stdoutSupportsColor() bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(os.Stdout)
+}
+
+// colored wraps s in the given ANSI codes when colors are enabled.
+func colored(s string, codes ...string) string {
+	if !colorOutput || len(codes) == 0 {
+		return s
+	}
+	var prefix string
+	for _, code := range codes {
+		prefix += code
+	}
+	return prefix + s + ansiReset
+}
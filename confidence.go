@@ -0,0 +1,108 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Confidence that a duplicate group holds real duplicates, by what its
+// PoCs are known to share. -min-confidence keeps -delete to the groups
+// scoring at least as high.
+const (
+	confidenceContent     = 1.0 // the same content
+	confidenceFingerprint = 0.9 // the same requests and response checks
+	confidenceMethod      = 0.7 // the same path or key, and request methods
+	confidenceKey         = 0.4 // the same path or key only
+)
+
+// groupConfidence scores a duplicate group and names what it is based on.
+func groupConfidence(entries []pocEntry, strategy string) (float64, string) {
+	if sameContent(entries) {
+		return confidenceContent, "same content"
+	}
+	if strategy == strategyFingerprint {
+		return confidenceFingerprint, "same requests and checks"
+	}
+	what := "path"
+	switch {
+	case strategy == strategyFields:
+		what = "key"
+	case entries[0].Detail.Transport != transportHTTP:
+		// A payload is the request of a tcp or udp PoC; there is no method.
+		return confidenceKey, "same payload"
+	}
+	if sameMethods(entries) {
+		return confidenceMethod, "same " + what + " and method"
+	}
+	return confidenceKey, "same " + what
+}
+
+func sameContent(entries []pocEntry) bool {
+	for _, entry := range entries[1:] {
+		if entry.Content == "" || entry.Content != entries[0].Content {
+			return false
+		}
+	}
+	return true
+}
+
+func sameMethods(entries []pocEntry) bool {
+	for _, entry := range entries[1:] {
+		if len(entry.Methods) == 0 || !slices.Equal(entry.Methods, entries[0].Methods) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestMethods returns the distinct methods of an http PoC's requests,
+// sorted: rules.*.request.method in the v2 layout and rules[].method in v1,
+// GET when left out.
+func requestMethods(doc *yaml.Node) []string {
+	if len(doc.Content) == 0 || documentTransport(doc) != transportHTTP {
+		return nil
+	}
+	var requests []*yaml.Node
+	switch rules := resolveAlias(mappingValue(doc.Content[0], "rules")); {
+	case rules == nil:
+	case rules.Kind == yaml.MappingNode:
+		for i := 1; i < len(rules.Content); i += 2 {
+			requests = append(requests, resolveAlias(mappingValue(resolveAlias(rules.Content[i]), "request")))
+		}
+	case rules.Kind == yaml.SequenceNode:
+		for _, rule := range rules.Content {
+			requests = append(requests, resolveAlias(rule))
+		}
+	}
+	var methods []string
+	for _, request := range requests {
+		if request == nil || request.Kind != yaml.MappingNode {
+			continue
+		}
+		method := strings.ToUpper(scalarValue(mappingValue(request, "method")))
+		if method == "" {
+			method = "GET"
+		}
+		if !slices.Contains(methods, method) {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// confidentGroups returns the groups scoring at least min and how many
+// scored lower.
+func confidentGroups(groups []duplicateGroup, min float64) (confident []duplicateGroup, low int) {
+	for _, group := range groups {
+		if group.Confidence >= min {
+			confident = append(confident, group)
+		} else {
+			low++
+		}
+	}
+	return confident, low
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const configFileName = ".repeaterxraypoc.yaml"
+
+type fileConfig struct {
+	Exclude        []string         `yaml:"exclude"`
+	Filter         []string         `yaml:"filter"`
+	Keep           string           `yaml:"keep"`
+	Strategy       string           `yaml:"strategy"`
+	Format         string           `yaml:"format"`
+	Lang           string           `yaml:"lang"`
+	Normalize      []string         `yaml:"normalize"`
+	GenericPaths   []string         `yaml:"generic_paths"`
+	PreferRoots    []string         `yaml:"prefer_roots"`
+	Overrides      []configOverride `yaml:"overrides"`
+	CrossTransport bool             `yaml:"cross_transport"`
+	Loose          bool             `yaml:"loose"`
+	NormalizeEOL   bool             `yaml:"normalize_eol"`
+	ExcludeReverse bool             `yaml:"exclude_reverse"`
+	ExcludeStubs   bool             `yaml:"exclude_stubs"`
+	GroupBy        []string         `yaml:"group_by"`
+	FileCase       string           `yaml:"file_case"`
+	MaxFileSize    string           `yaml:"max_file_size"`
+	ParseTimeout   string           `yaml:"parse_timeout"`
+	MaxNodes       int              `yaml:"max_nodes"`
+	// Profiles are the named subsets the export command writes.
+	Profiles map[string]exportProfile `yaml:"profiles"`
+}
+
+type configOverride struct {
+	Path    string   `yaml:"path"`
+	Exclude []string `yaml:"exclude"`
+	Keep    string   `yaml:"keep"`
+}
+
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// resolveConfigPath returns the explicit config path, or the nearest config
+// file found walking upward from dir. An empty result means no config.
+func resolveConfigPath(explicit, dir string) (string, error) {
+	if explicit != "" {
+		return explicit, nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		candidate := filepath.Join(abs, configFileName)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return "", nil
+		}
+		abs = parent
+	}
+}
+
+func loadConfig(path string) (*fileConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg fileConfig
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// rebaseOverrides rewrites override paths, which are relative to the config
+// file's directory, to be relative to the scanned root. Overrides outside the
+// root are dropped; overrides containing the root apply to all of it.
+func rebaseOverrides(cfgPath, root string, overrides []configOverride) ([]configOverride, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	absCfgDir, err := filepath.Abs(filepath.Dir(cfgPath))
+	if err != nil {
+		return nil, err
+	}
+	var out []configOverride
+	for _, override := range overrides {
+		dir := filepath.Join(absCfgDir, filepath.FromSlash(override.Path))
+		if rel, err := filepath.Rel(absRoot, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			override.Path = filepath.ToSlash(rel)
+		} else if rel, err := filepath.Rel(dir, absRoot); err == nil && !strings.HasPrefix(rel, "..") {
+			override.Path = ""
+		} else {
+			continue
+		}
+		out = append(out, override)
+	}
+	return out, nil
+}
+
+func (c *fileConfig) flagValues() map[string][]string {
+	values := map[string][]string{
+		"exclude":      c.Exclude,
+		"filter":       c.Filter,
+		"generic-path": c.GenericPaths,
+		"prefer-root":  c.PreferRoots,
+	}
+	for name, value := range map[string]string{
+		"keep":          c.Keep,
+		"strategy":      c.Strategy,
+		"format":        c.Format,
+		"lang":          c.Lang,
+		"normalize":     strings.Join(c.Normalize, ","),
+		"group-by":      strings.Join(c.GroupBy, ","),
+		"file-case":     c.FileCase,
+		"max-file-size": c.MaxFileSize,
+		"parse-timeout": c.ParseTimeout,
+	} {
+		if value != "" {
+			values[name] = []string{value}
+		}
+	}
+	if c.MaxNodes != 0 {
+		values["max-nodes"] = []string{strconv.Itoa(c.MaxNodes)}
+	}
+	for name, set := range map[string]bool{
+		"cross-transport": c.CrossTransport,
+		"loose":           c.Loose,
+		"normalize-eol":   c.NormalizeEOL,
+		"exclude-reverse": c.ExcludeReverse,
+		"exclude-stubs":   c.ExcludeStubs,
+	} {
+		if set {
+			values[name] = []string{"true"}
+		}
+	}
+	return values
+}
+
+// applyConfig feeds config values through the flag set so they get the same
+// parsing as command-line flags. Flags given explicitly win over the config,
+// except list flags where config entries are added to the command-line ones.
+func applyConfig(fs *flag.FlagSet, cfg *fileConfig) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for name, values := range cfg.flagValues() {
+		f := fs.Lookup(name)
+		if f == nil {
+			continue
+		}
+		if _, isList := f.Value.(*stringList); explicit[name] && !isList {
+			continue
+		}
+		for _, value := range values {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
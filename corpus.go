@@ -0,0 +1,36 @@
+package main
+
+import "context"
+
+// pocCorpus is a scanned corpus. Entries go straight into their duplicate
+// group while files are loaded, so each entry is held once instead of in a
+// flat list and again in the group map. Units keeps the first entry of every
+// PoC (a file, or a document of a multi-document file) for the passes that
+// look at whole PoCs: names, counts and statistics.
+type pocCorpus struct {
+	groups  map[string][]pocEntry
+	units   []pocEntry
+	skipped []skippedFile
+}
+
+// collectCorpus scans the root into groups. The groups are not yet ordered
+// by the keep policy: callers enrich entries first (-nvd) and then call
+// sortGroups. When ctx ends first, the corpus read so far is returned along
+// with the cause, for a partial report.
+func collectCorpus(ctx context.Context, opts scanOptions, progress *progressReporter) (*pocCorpus, error) {
+	c := &pocCorpus{groups: make(map[string][]pocEntry)}
+	skipped, err := streamPoCs(ctx, opts, progress, func(fileEntries []pocEntry) {
+		for i, entry := range fileEntries {
+			if i == 0 || entry.Doc != fileEntries[i-1].Doc {
+				c.units = append(c.units, entry)
+			}
+			key := groupKey(entry, opts)
+			c.groups[key] = append(c.groups[key], entry)
+		}
+	})
+	c.skipped = skipped
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+	return c, err
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+type cveCoverage struct {
+	CVE  string      `json:"cve"`
+	PoCs []cvePoCRef `json:"pocs"`
+}
+
+type cvePoCRef struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+}
+
+type cveReport struct {
+	ToolVersion string        `json:"tool_version"`
+	Root        string        `json:"root"`
+	Files       int           `json:"files"`
+	CVEs        []cveCoverage `json:"cves"`
+	Shared      []cveCoverage `json:"shared"`
+	Missing     []string      `json:"missing"`
+	Skipped     []skippedFile `json:"skipped"`
+}
+
+const reportUsage = `
+Usage:
+  go run . report cves -dir <path-to-pocs> [-allowlist <file>] [-format text|json] [-fail-on duplicates|invalid|none]
+  go run . report builtins -dir <path-to-pocs> [-plugins <file|->] [-builtin-dir <dir>] [-format text|json] [-fail-on duplicates|invalid|none]
+
+Modes:
+  cves      Index the CVE identifiers mentioned by each PoC (cve field, name,
+            detail links and description). Lists CVEs covered by more than one
+            PoC and, with -allowlist, CVEs from the list that no PoC covers.
+  builtins  List the PoCs that duplicate a plugin built into xray, so that
+            community copies of them can be dropped: by name, from a plugin
+            list such as the output of xray ws --list, and with -builtin-dir
+            by detection fingerprint, from the YAML of the built-in PoCs.
+
+Flags:
+`
+
+func runReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(reportUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	sf := registerScanFlags(fs)
+	formatFlag := fs.String("format", formatText, "Output format: text or json")
+	if len(args) == 0 || (args[0] != "cves" && args[0] != "builtins") {
+		fs.String("fail-on", failOnNone, "Exit non-zero when findings exist: duplicates, invalid or none")
+		fs.Usage()
+		return exitUsage
+	}
+	if args[0] == "builtins" {
+		return runBuiltinsReport(fs, sf, formatFlag, args[1:])
+	}
+	allowlistFlag := fs.String("allowlist", "", "File listing the CVEs that should be covered (one per line, # comments)")
+	failOnFlag := fs.String("fail-on", failOnNone, "Exit non-zero when findings exist: duplicates (CVEs covered more than once), invalid or none")
+	fs.Parse(args[1:])
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	format := strings.ToLower(strings.TrimSpace(*formatFlag))
+	if format != formatText && format != formatJSON {
+		slog.Error("unsupported format (want text or json)", "format", *formatFlag)
+		return exitError
+	}
+	policy, err := parseFailOn(*failOnFlag)
+	if err != nil {
+		slog.Error("invalid -fail-on", "err", err)
+		return exitError
+	}
+	var allowlist []string
+	if *allowlistFlag != "" {
+		if allowlist, err = loadCVEList(*allowlistFlag); err != nil {
+			slog.Error("loading allowlist", "err", err)
+			return exitError
+		}
+	}
+
+	entries, skipped, err := collectPoCs(context.Background(), opts, nil)
+	if err != nil {
+		slog.Error("collecting PoCs", "err", err)
+		return exitError
+	}
+	report := buildCVEReport(opts.Root, entries, skipped, allowlist)
+
+	if format == formatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else if !*sf.quiet {
+		printCVEReport(report, allowlist != nil)
+	}
+	if err != nil {
+		slog.Error("writing report", "format", format, "err", err)
+		return exitError
+	}
+	return policy.exitCode(len(report.Shared), len(report.Skipped))
+}
+
+func loadCVEList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	list := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		for _, cve := range cvePattern.FindAllString(line, -1) {
+			list = append(list, strings.ToUpper(cve))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return appendUnique(nil, list...), nil
+}
+
+func buildCVEReport(root string, entries []pocEntry, skipped []skippedFile, allowlist []string) cveReport {
+	report := cveReport{ToolVersion: toolVersion(), Root: root, CVEs: []cveCoverage{}, Shared: []cveCoverage{}, Missing: []string{}, Skipped: skipped}
+	if report.Skipped == nil {
+		report.Skipped = []skippedFile{}
+	}
+
+	index := map[string][]cvePoCRef{}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if seen[entry.unit()] {
+			continue
+		}
+		seen[entry.unit()] = true
+		report.Files++
+		for _, cve := range entry.Detail.CVEs {
+			index[cve] = append(index[cve], cvePoCRef{Name: entry.Name, File: entry.unit()})
+		}
+	}
+
+	for cve, refs := range index {
+		sort.Slice(refs, func(i, j int) bool { return refs[i].File < refs[j].File })
+		coverage := cveCoverage{CVE: cve, PoCs: refs}
+		report.CVEs = append(report.CVEs, coverage)
+		if len(refs) > 1 {
+			report.Shared = append(report.Shared, coverage)
+		}
+	}
+	byID := func(list []cveCoverage) func(i, j int) bool {
+		return func(i, j int) bool { return list[i].CVE < list[j].CVE }
+	}
+	sort.Slice(report.CVEs, byID(report.CVEs))
+	sort.Slice(report.Shared, byID(report.Shared))
+
+	for _, cve := range allowlist {
+		if _, ok := index[cve]; !ok {
+			report.Missing = append(report.Missing, cve)
+		}
+	}
+	sort.Strings(report.Missing)
+	return report
+}
+
+func printCVEReport(report cveReport, withAllowlist bool) {
+	fmt.Printf("Indexed %d CVEs across %d PoC files.\n", len(report.CVEs), report.Files)
+	if len(report.Shared) == 0 {
+		fmt.Println("No CVE is covered by more than one PoC.")
+	} else {
+		fmt.Printf("\n%d CVEs are covered by more than one PoC:\n", len(report.Shared))
+		for _, coverage := range report.Shared {
+			fmt.Printf("\nCVE: %s\n", coverage.CVE)
+			for _, ref := range coverage.PoCs {
+				fmt.Printf("  - name=%q file=%s\n", ref.Name, ref.File)
+			}
+		}
+	}
+	if withAllowlist {
+		if len(report.Missing) == 0 {
+			fmt.Println("\nEvery CVE in the allowlist has a PoC.")
+		} else {
+			fmt.Printf("\n%d CVEs in the allowlist have no PoC:\n", len(report.Missing))
+			for _, cve := range report.Missing {
+				fmt.Printf("  - %s\n", cve)
+			}
+		}
+	}
+	printSkippedReport(report.Skipped)
+}
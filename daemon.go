@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const daemonUsage = `
+Usage:
+  go run . daemon -dir <path-to-pocs> [-schedule <cron>] [-listen <addr>] [-notify <target>]... [-timeout <duration>]
+
+Rescans the corpus on a schedule and keeps the latest results in memory.
+With -notify, a summary listing the duplicate groups that are new since the
+previous scan is posted after every scan.
+Serves Prometheus metrics on /metrics, the latest JSON report on /report and
+corpus searches on /query?cve=&path=&keyword= (see query -h).
+The schedule is a five-field cron expression (minute hour day month weekday)
+or one of @hourly, @daily, @weekly and @every <duration>.
+-timeout gives up a rescan that takes longer; SIGINT or SIGTERM stops the
+rescan in progress and the daemon.
+
+Flags:
+`
+
+const defaultSchedule = "@hourly"
+
+// schedule yields the next scan time after t.
+type schedule interface {
+	next(t time.Time) time.Time
+}
+
+type everySchedule time.Duration
+
+func (e everySchedule) next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// cronSchedule holds one bit per allowed value of each cron field.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a "*" day field: cron matches a day when
+	// either day field matches, unless one of them is "*".
+	domAny, dowAny bool
+}
+
+func parseSchedule(spec string) (schedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	}
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("schedule %q: want @every <duration> of at least 1s", spec)
+		}
+		return everySchedule(d), nil
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q: want 5 fields (minute hour day month weekday)", spec)
+	}
+	var s cronSchedule
+	var err error
+	bounds := []struct {
+		dst      *uint64
+		min, max int
+	}{{&s.minute, 0, 59}, {&s.hour, 0, 23}, {&s.dom, 1, 31}, {&s.month, 1, 12}, {&s.dow, 0, 7}}
+	for i, b := range bounds {
+		if *b.dst, err = parseCronField(fields[i], b.min, b.max); err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is Sunday too
+	}
+	s.domAny, s.dowAny = fields[2] == "*", fields[4] == "*"
+	return &s, nil
+}
+
+// parseCronField accepts *, single values, ranges a-b and steps */n or
+// a-b/n, separated by commas.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Impossible dates such as 30 February never match; give up after a
+	// few years rather than loop forever.
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		y, m, d := t.Date()
+		switch {
+		case s.month&(1<<int(m)) == 0:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// daemonState is the outcome of the latest scan, shared with the HTTP
+// handlers.
+type daemonState struct {
+	mu       sync.RWMutex
+	report   *scanReport
+	stats    corpusStats
+	duration time.Duration
+	lastScan time.Time
+	scans    int
+	failures int
+	// index backs /query; postings is rebuilt from it after every scan.
+	index    *corpusIndex
+	postings *indexPostings
+	// notifiers receive a summary after every scan; known holds the keys
+	// of the previous scan's duplicate groups, so only new ones are listed.
+	notifiers []notifier
+	known     map[string]bool
+}
+
+func runDaemon(args []string) int {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	sf.registerTimeout()
+	scheduleFlag := fs.String("schedule", defaultSchedule, "When to rescan: a cron expression or @hourly, @daily, @weekly, @every <duration>")
+	listenFlag := fs.String("listen", ":9464", "Address for the /metrics, /report and /query endpoints")
+	indexFlag := fs.String("index", "", "Corpus index file backing /query (default: under the user cache directory, one per -dir)")
+	var notifyFlags stringList
+	fs.Var(&notifyFlags, "notify", notifyUsage)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(daemonUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	sched, err := parseSchedule(*scheduleFlag)
+	if err == nil && sched.next(time.Now()).IsZero() {
+		err = fmt.Errorf("schedule %q never fires", *scheduleFlag)
+	}
+	if err != nil {
+		slog.Error("invalid -schedule", "err", err)
+		return exitUsage
+	}
+	notifiers, err := parseNotifiers(notifyFlags)
+	if err != nil {
+		slog.Error("invalid -notify", "err", err)
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	indexPath := *indexFlag
+	if indexPath == "" {
+		indexPath = defaultIndexPath(opts.Root)
+	}
+	state := &daemonState{index: loadIndex(indexPath, opts), notifiers: notifiers}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", state.serveMetrics)
+	mux.HandleFunc("/report", state.serveReport)
+	mux.HandleFunc("/query", serveQuery(func() *indexPostings {
+		state.mu.RLock()
+		defer state.mu.RUnlock()
+		return state.postings
+	}))
+	server := &http.Server{Addr: *listenFlag, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	slog.Info("daemon started", "listen", *listenFlag, "schedule", *scheduleFlag, "dir", opts.Root)
+
+	scan := func() {
+		scanCtx, cancel := sf.operation(ctx)
+		defer cancel()
+		state.scan(scanCtx, opts)
+	}
+	scan()
+	for {
+		next := sched.next(time.Now())
+		slog.Debug("next scan", "at", next)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			scan()
+		case err := <-serveErr:
+			timer.Stop()
+			slog.Error("serving metrics", "err", err)
+			return exitError
+		case <-ctx.Done():
+			timer.Stop()
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := server.Shutdown(shutdown); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Warn("stopping HTTP server", "err", err)
+			}
+			slog.Info("daemon stopped")
+			return exitOK
+		}
+	}
+}
+
+// scan rescans the corpus. A failed scan, or one stopped by ctx, keeps the
+// previous results.
+func (s *daemonState) scan(ctx context.Context, opts scanOptions) {
+	trace := startSpan("daemon-scan", nil)
+	trace.set("dir", opts.Root)
+	defer trace.end(nil)
+	start := time.Now()
+	var err error
+	if opts.Remote != nil && s.scans > 0 {
+		span := startSpan("remote-sync", trace)
+		err = opts.Remote.sync(ctx)
+		span.end(err)
+	}
+	var corpus *pocCorpus
+	if err == nil {
+		span := startSpan("collect", trace)
+		corpus, err = collectCorpus(ctx, opts, nil)
+		span.end(err)
+	}
+	var postings *indexPostings
+	if err == nil {
+		span := startSpan("index", trace)
+		if err = s.index.refresh(opts); err == nil {
+			postings = s.index.postings(opts)
+			if err := s.index.save(); err != nil {
+				slog.Warn("saving index", "err", err)
+			}
+		}
+		span.end(err)
+	}
+	elapsed := time.Since(start)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scans++
+	if err != nil {
+		s.failures++
+		slog.Error("collecting PoCs", "err", err)
+		return
+	}
+	sortGroups(corpus.groups, opts)
+	duplicates := findDuplicates(corpus.groups, opts)
+	report := buildReport(opts, corpus.units, corpus.skipped, duplicates)
+	report.NameCollisions = findNameCollisions(corpus.units, opts)
+	s.report = &report
+	s.postings = postings
+	s.stats = computeStats(opts, corpus, 0)
+	s.duration = elapsed
+	s.lastScan = start
+	slog.Info("scan finished", "pocs", s.stats.PoCs, "duplicates", s.stats.DuplicateFiles,
+		"skipped", len(corpus.skipped), "duration", elapsed.Round(time.Millisecond))
+	if len(s.notifiers) > 0 {
+		known := s.known
+		summary := newScanSummary(report, func(key string) bool { return !known[key] })
+		s.known = make(map[string]bool, len(report.Duplicates))
+		for _, group := range report.Duplicates {
+			s.known[group.Key] = true
+		}
+		go sendNotifications(s.notifiers, summary)
+	}
+}
+
+func (s *daemonState) serveReport(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.report == nil {
+		http.Error(w, "no scan has finished yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSONReport(w, *s.report); err != nil {
+		slog.Debug("writing report", "err", err)
+	}
+}
+
+func (s *daemonState) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.writeMetrics(w)
+}
+
+// writeMetrics writes the Prometheus text exposition format. Gauges about
+// the corpus are left out until the first scan succeeds.
+func (s *daemonState) writeMetrics(w io.Writer) {
+	metric := func(name, kind, help string, value float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n",
+			name, help, name, kind, name, strconv.FormatFloat(value, 'g', -1, 64))
+	}
+	metric("poc_scans_total", "counter", "Scans started since the daemon started.", float64(s.scans))
+	metric("poc_scan_failures_total", "counter", "Scans that failed and kept the previous results.", float64(s.failures))
+	if s.report == nil {
+		return
+	}
+	metric("poc_total", "gauge", "PoCs found by the last scan.", float64(s.stats.PoCs))
+	metric("poc_duplicates", "gauge", "Redundant PoCs (duplicates beyond the one kept per group) found by the last scan.", float64(s.stats.DuplicateFiles))
+	metric("poc_duplicate_groups", "gauge", "Duplicate groups found by the last scan.", float64(s.stats.DuplicateGroups))
+	metric("poc_name_collisions", "gauge", "Names shared by PoCs that are not duplicates.", float64(len(s.report.NameCollisions)))
+	metric("poc_parse_errors", "gauge", "Files skipped by the last scan because they could not be parsed.", float64(len(s.report.Skipped)))
+	metric("poc_last_scan_duration_seconds", "gauge", "Duration of the last successful scan.", s.duration.Seconds())
+	metric("poc_last_scan_timestamp_seconds", "gauge", "Unix time of the last successful scan.", float64(s.lastScan.UnixNano())/1e9)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// dedupeRules removes rules repeated verbatim inside a single PoC and points
+// the top-level expression at the copy that is kept. Only the map-of-rules
+// layout (xray v2) is handled; v1 rule lists run sequentially and are left
+// alone.
+func dedupeRules(opts scanOptions) (files, removed int, err error) {
+	err = walkPoCFiles(opts, func(path string) error {
+		f, err := readPoCFile(path)
+		if err != nil {
+			// The scan reports unparsable files.
+			return nil
+		}
+		if checkExpansion(f, opts.MaxNodes) != nil {
+			return nil
+		}
+		if len(f.Docs) > 1 {
+			slog.Debug("skipping rule dedupe for multi-document file", "file", path)
+			return nil
+		}
+		updated, n, err := dedupeRulesInFile(f)
+		if err != nil {
+			slog.Warn("cannot dedupe rules", "file", path, "err", err)
+			return nil
+		}
+		if n == 0 {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, updated, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("write %s: %w", path, err)
+		}
+		// -keep newest and oldest go by the modification time.
+		if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+		slog.Info("removed repeated rules", "file", path, "rules", n)
+		files++
+		removed += n
+		return nil
+	})
+	return files, removed, err
+}
+
+func dedupeRulesInFile(f *pocFile) ([]byte, int, error) {
+	top := f.Root.Content[0]
+	rules := mappingValue(top, "rules")
+	if rules == nil || rules.Kind != yaml.MappingNode {
+		return nil, 0, nil
+	}
+
+	firstByBody := make(map[string]string)
+	renames := make(map[string]string)
+	var drop []int
+	for i := 0; i+1 < len(rules.Content); i += 2 {
+		var body any
+		if err := rules.Content[i+1].Decode(&body); err != nil {
+			return nil, 0, err
+		}
+		canonical, err := json.Marshal(body)
+		if err != nil {
+			return nil, 0, err
+		}
+		name := rules.Content[i].Value
+		if kept, ok := firstByBody[string(canonical)]; ok {
+			renames[name] = kept
+			drop = append(drop, i)
+			continue
+		}
+		firstByBody[string(canonical)] = name
+	}
+	if len(drop) == 0 {
+		return nil, 0, nil
+	}
+
+	e, err := newPoCEditor(f.Path, f.Raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := e.removeRules(renames); err != nil {
+		return nil, 0, err
+	}
+	return e.raw, len(drop), nil
+}
+
+func readPoCBytes(path string, raw []byte) (yaml.Node, error) {
+	if isJSONFile(path) {
+		return parseJSONDocument(raw)
+	}
+	var node yaml.Node
+	err := yaml.Unmarshal(raw, &node)
+	if err == nil && len(node.Content) == 0 {
+		err = errors.New("empty document")
+	}
+	return node, err
+}
+
+func renameRuleCalls(expression string, renames map[string]string) string {
+	for from, to := range renames {
+		call := regexp.MustCompile(`\b` + regexp.QuoteMeta(from) + `\s*\(\s*\)`)
+		expression = call.ReplaceAllLiteralString(expression, to+"()")
+	}
+	return expression
+}
+
+// dedupeOperands drops the operands of && and || chains that repeat an
+// earlier one, as renaming rule calls leaves behind: r0() && r0() is r0().
+// An expression without repeats is returned unchanged.
+func dedupeOperands(expr string) string {
+	trimmed := strings.TrimSpace(expr)
+	simplified := dedupeChain(trimmed)
+	if simplified == trimmed {
+		return expr
+	}
+	i := strings.Index(expr, trimmed)
+	return expr[:i] + simplified + expr[i+len(trimmed):]
+}
+
+// dedupeChain is dedupeOperands for an expression without surrounding
+// whitespace.
+func dedupeChain(expr string) string {
+	for _, op := range []string{"||", "&&"} {
+		parts := splitOperands(expr, op)
+		if len(parts) < 2 {
+			continue
+		}
+		var kept []string
+		changed := false
+		for _, part := range parts {
+			part = strings.TrimSpace(part)
+			simplified := dedupeChain(part)
+			changed = changed || simplified != part
+			if slices.Contains(kept, simplified) {
+				changed = true
+				continue
+			}
+			kept = append(kept, simplified)
+		}
+		if !changed {
+			return expr
+		}
+		return strings.Join(kept, " "+op+" ")
+	}
+	// A parenthesized chain: its closing parenthesis ends the expression.
+	if !strings.HasPrefix(expr, "(") {
+		return expr
+	}
+	parts := splitOperands(expr[1:], ")")
+	if len(parts) != 2 || parts[1] != "" {
+		return expr
+	}
+	inner := strings.TrimSpace(parts[0])
+	simplified := dedupeChain(inner)
+	if simplified == inner {
+		return expr
+	}
+	if len(splitOperands(simplified, "||")) == 1 && len(splitOperands(simplified, "&&")) == 1 {
+		return simplified
+	}
+	return "(" + simplified + ")"
+}
+
+// splitOperands splits expr at op outside of brackets and string literals.
+func splitOperands(expr, op string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case depth == 0 && strings.HasPrefix(expr[i:], op):
+			parts = append(parts, expr[start:i])
+			start = i + len(op)
+			i += len(op) - 1
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+// nextKeyLine returns the line of the key following value in mapping, or
+// fallback when value is the last one.
+func nextKeyLine(mapping, value *yaml.Node, fallback int) int {
+	for i := 1; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i] == value {
+			return mapping.Content[i+1].Line
+		}
+	}
+	return fallback
+}
+
+func isCommentOrBlank(line []byte) bool {
+	trimmed := strings.TrimSpace(string(line))
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestDedupeOperands(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "r0() && r1()", want: "r0() && r1()"},
+		{expr: "r0() && r0()", want: "r0()"},
+		{expr: "r0()&&r1()&&r0()", want: "r0() && r1()"},
+		{expr: "r0() || r0() || r2()", want: "r0() || r2()"},
+		{expr: "r0() && r0() || r2()", want: "r0() || r2()"},
+		{expr: "(r0() || r0()) && r2()", want: "r0() && r2()"},
+		{expr: "(r0() || r0() || r1()) && r2()", want: "(r0() || r1()) && r2()"},
+		{expr: "r0() && (r1() || r2())", want: "r0() && (r1() || r2())"},
+		{expr: "(r0()).x() && (r0()).x()", want: "(r0()).x()"},
+		{expr: `r0() && "a && b".contains("a && b")`, want: `r0() && "a && b".contains("a && b")`},
+		{expr: "  r0()  ", want: "  r0()  "},
+	}
+	for _, tt := range tests {
+		if got := dedupeOperands(tt.expr); got != tt.want {
+			t.Errorf("dedupeOperands(%q) = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
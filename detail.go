@@ -0,0 +1,167 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var cvePattern = regexp.MustCompile(`(?i)\bCVE-\d{4}-\d{4,}\b`)
+
+const transportHTTP = "http"
+
+// pocDetail is the triage metadata of a PoC. xray keeps it under `detail`, but
+// community PoCs often put tags or severity at the top level, so both are read.
+type pocDetail struct {
+	Author      string   `json:"author,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Severity    string   `json:"severity,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	CVEs        []string `json:"cves,omitempty"`
+	Links       []string `json:"links,omitempty"`
+	Transport   string   `json:"transport,omitempty"`
+	Rules       int      `json:"rules,omitempty"`
+	// Reverse is set when the PoC needs xray's reverse (OOB) platform.
+	Reverse bool `json:"reverse,omitempty"`
+	// Stub says why the PoC cannot detect anything, when it cannot.
+	Stub string `json:"stub,omitempty"`
+	// CVSS and Published are filled in from NVD when -nvd is set.
+	CVSS      float64 `json:"cvss,omitempty"`
+	Published string  `json:"published,omitempty"`
+}
+
+func extractDetail(root *yaml.Node, name string) *pocDetail {
+	top := root
+	if top.Kind == yaml.DocumentNode && len(top.Content) > 0 {
+		top = top.Content[0]
+	}
+	detail := mappingValue(top, "detail")
+
+	mappings := []*yaml.Node{detail, top}
+	list := func(key string) []string {
+		var out []string
+		for _, m := range mappings {
+			out = append(out, scalarList(mappingValue(m, key))...)
+		}
+		return appendUnique(nil, out...)
+	}
+
+	var d pocDetail
+	d.Author = firstString(mappings, "author")
+	d.Description = firstString(mappings, "description")
+	d.Severity = strings.ToLower(firstString(mappings, "severity", "level"))
+	d.Tags = list("tags")
+	d.Links = list("links")
+	d.Transport = strings.ToLower(firstString([]*yaml.Node{top}, "transport"))
+	if d.Transport == "" {
+		d.Transport = transportHTTP
+	}
+	d.Reverse = needsReverse(top)
+	d.Stub = stubReason(top)
+	if rules := mappingValue(top, "rules"); rules != nil {
+		switch rules.Kind {
+		case yaml.MappingNode:
+			d.Rules = len(rules.Content) / 2
+		case yaml.SequenceNode:
+			d.Rules = len(rules.Content)
+		}
+	}
+
+	var cves []string
+	for _, value := range list("cve") {
+		cves = append(cves, cvePattern.FindAllString(value, -1)...)
+	}
+	cves = append(cves, cvePattern.FindAllString(name, -1)...)
+	cves = append(cves, cvePattern.FindAllString(d.Description, -1)...)
+	for _, link := range d.Links {
+		cves = append(cves, cvePattern.FindAllString(link, -1)...)
+	}
+	for i := range cves {
+		cves[i] = strings.ToUpper(cves[i])
+	}
+	d.CVEs = appendUnique(nil, cves...)
+	return &d
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(strings.TrimSpace(node.Content[i].Value), key) {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// firstString returns the first non-empty scalar stored under one of keys,
+// looking in each mapping in turn.
+func firstString(mappings []*yaml.Node, keys ...string) string {
+	for _, node := range mappings {
+		for _, key := range keys {
+			if value := mappingValue(node, key); value != nil && value.Kind == yaml.ScalarNode {
+				if s := strings.TrimSpace(value.Value); s != "" {
+					return s
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// scalarList reads a sequence of scalars or a single comma-separated scalar.
+func scalarList(node *yaml.Node) []string {
+	if node == nil {
+		return nil
+	}
+	var out []string
+	switch node.Kind {
+	case yaml.ScalarNode:
+		for _, part := range strings.Split(node.Value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if item.Kind == yaml.ScalarNode {
+				if s := strings.TrimSpace(item.Value); s != "" {
+					out = append(out, s)
+				}
+			}
+		}
+	}
+	return out
+}
+
+func appendUnique(list []string, values ...string) []string {
+	seen := make(map[string]struct{}, len(list))
+	for _, v := range list {
+		seen[v] = struct{}{}
+	}
+	for _, v := range values {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		list = append(list, v)
+	}
+	return list
+}
+
+var ignorePragma = regexp.MustCompile(`(?mi)^\s*#\s*dedup:\s*ignore\b`)
+
+// hasIgnorePragma reports whether the PoC opts out of duplicate grouping with
+// a top-level `x-dedup: ignore` key or a `# dedup:ignore` comment line.
+func hasIgnorePragma(root *yaml.Node, raw []byte) bool {
+	top := root
+	if top.Kind == yaml.DocumentNode && len(top.Content) > 0 {
+		top = top.Content[0]
+	}
+	if v := mappingValue(top, "x-dedup"); v != nil && strings.EqualFold(strings.TrimSpace(v.Value), "ignore") {
+		return true
+	}
+	return ignorePragma.Match(raw)
+}
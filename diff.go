@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	diffOff     = ""
+	diffUnified = "unified"
+	diffColor   = "color"
+
+	diffContext = 3
+	// maxDiffCells bounds the LCS table so huge files cannot stall the report.
+	maxDiffCells = 4 << 20
+
+	ansiReset = "\x1b[0m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+)
+
+func parseDiffMode(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case diffOff, "off", "none":
+		return diffOff, nil
+	case diffUnified, diffColor:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown diff mode %q (want unified or color)", value)
+	}
+}
+
+// renderFileDiff returns a unified diff from the kept file to a candidate.
+func renderFileDiff(kept, candidate, mode string) (string, error) {
+	a, err := os.ReadFile(kept)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(candidate)
+	if err != nil {
+		return "", err
+	}
+	diff := unifiedDiff(kept, candidate, splitLines(string(a)), splitLines(string(b)))
+	if mode == diffColor || colorOutput {
+		diff = colorizeDiff(diff)
+	}
+	return diff, nil
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+func unifiedDiff(aName, bName string, a, b []string) string {
+	if len(a)*len(b) > maxDiffCells {
+		return fmt.Sprintf("(diff skipped: %s and %s are too large)\n", aName, bName)
+	}
+	ops := diffLines(a, b)
+	changed := false
+	for _, op := range ops {
+		if op.kind != ' ' {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return "(files are identical)\n"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+	for start := 0; start < len(ops); {
+		// Find the next change and expand it into a hunk with context.
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start >= len(ops) {
+			break
+		}
+		lo := max(start-diffContext, 0)
+		hi := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				hi = i
+			} else if i-hi > 2*diffContext {
+				break
+			}
+		}
+		hi = min(hi+diffContext+1, len(ops))
+
+		aLine, bLine := 1, 1
+		for _, op := range ops[:lo] {
+			if op.kind != '+' {
+				aLine++
+			}
+			if op.kind != '-' {
+				bLine++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, op := range ops[lo:hi] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aLine, aCount, bLine, bCount)
+		for _, op := range ops[lo:hi] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			sb.WriteByte('\n')
+		}
+		start = hi
+	}
+	return sb.String()
+}
+
+// diffLines computes a line-level edit script using the classic LCS table.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var ops []diffOp
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+func colorizeDiff(diff string) string {
+	lines := splitLines(diff)
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = ansiCyan + line + ansiReset
+		case strings.HasPrefix(line, "-"):
+			lines[i] = ansiRed + line + ansiReset
+		case strings.HasPrefix(line, "+"):
+			lines[i] = ansiGreen + line + ansiReset
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
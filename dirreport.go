@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+const groupReportDir = "dir"
+
+// dirSummary aggregates the duplicates found in one directory. Only the
+// files -delete would remove count, so the bytes are what cleaning the
+// directory reclaims.
+type dirSummary struct {
+	Dir         string `json:"dir"`
+	Groups      int    `json:"groups"`
+	Duplicates  int    `json:"duplicates"`
+	Reclaimable int64  `json:"reclaimable_bytes"`
+}
+
+func summarizeByDir(report scanReport) []dirSummary {
+	byDir := make(map[string]*dirSummary)
+	counted := make(map[string]bool)
+	for _, group := range report.Duplicates {
+		inGroup := make(map[string]bool)
+		for _, entry := range group.Entries[1:] {
+			unit := entry.unit()
+			if unit == group.Entries[0].unit() {
+				continue
+			}
+			dir := relativeTo(report.Root, filepath.Dir(entry.FilePath))
+			s := byDir[dir]
+			if s == nil {
+				s = &dirSummary{Dir: dir}
+				byDir[dir] = s
+			}
+			if !inGroup[dir] {
+				inGroup[dir] = true
+				s.Groups++
+			}
+			if !counted[unit] {
+				counted[unit] = true
+				s.Duplicates++
+				s.Reclaimable += entry.Size
+			}
+		}
+	}
+	out := make([]dirSummary, 0, len(byDir))
+	for _, s := range byDir {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Reclaimable != out[j].Reclaimable {
+			return out[i].Reclaimable > out[j].Reclaimable
+		}
+		return out[i].Dir < out[j].Dir
+	})
+	return out
+}
+
+func printDirReport(dirs []dirSummary) {
+	fmt.Printf(tr("Duplicates by directory (%d directories):\n\n"), len(dirs))
+	fmt.Printf("  %6s  %10s  %12s  %s\n", "GROUPS", "DUPLICATES", "RECLAIMABLE", "DIRECTORY")
+	var total int64
+	for _, d := range dirs {
+		fmt.Printf("  %6d  %10d  %12s  %s\n", d.Groups, d.Duplicates, humanBytes(d.Reclaimable), d.Dir)
+		total += d.Reclaimable
+	}
+	fmt.Printf(tr("\nTotal reclaimable: %s\n"), humanBytes(total))
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Charsets PoC files are read in. All but plain UTF-8 are converted to
+// UTF-8 when the file is loaded.
+const (
+	charsetUTF8    = "utf-8"
+	charsetUTF8BOM = "utf-8 with BOM"
+	charsetUTF16LE = "utf-16le"
+	charsetUTF16BE = "utf-16be"
+	charsetGBK     = "gbk"
+)
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// decodePoC returns raw as UTF-8 without a BOM, and the charset it was
+// in: UTF-8 with or without a BOM, UTF-16 with a BOM or mostly ASCII
+// without one, or else GBK, as Chinese Windows editors save files.
+func decodePoC(raw []byte) ([]byte, string, error) {
+	switch {
+	case bytes.HasPrefix(raw, utf8BOM):
+		return raw[len(utf8BOM):], charsetUTF8BOM, nil
+	case bytes.HasPrefix(raw, []byte{0xff, 0xfe}):
+		return decodeWith(unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), raw, charsetUTF16LE)
+	case bytes.HasPrefix(raw, []byte{0xfe, 0xff}):
+		return decodeWith(unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), raw, charsetUTF16BE)
+	}
+	if charset := guessUTF16(raw); charset == charsetUTF16LE {
+		return decodeWith(unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), raw, charset)
+	} else if charset == charsetUTF16BE {
+		return decodeWith(unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), raw, charset)
+	}
+	if utf8.Valid(raw) {
+		return raw, charsetUTF8, nil
+	}
+	return decodeWith(simplifiedchinese.GBK, raw, charsetGBK)
+}
+
+// guessUTF16 recognizes UTF-16 without a BOM by the zero bytes ASCII
+// characters leave in every other position of the first bytes.
+func guessUTF16(raw []byte) string {
+	n := min(len(raw), 64) &^ 1
+	if n < 4 {
+		return ""
+	}
+	var even, odd int
+	for i := 0; i < n; i += 2 {
+		if raw[i] == 0 {
+			even++
+		}
+		if raw[i+1] == 0 {
+			odd++
+		}
+	}
+	switch pairs := n / 2; {
+	case even == 0 && odd*4 >= pairs*3:
+		return charsetUTF16LE
+	case odd == 0 && even*4 >= pairs*3:
+		return charsetUTF16BE
+	}
+	return ""
+}
+
+func decodeWith(enc encoding.Encoding, raw []byte, charset string) ([]byte, string, error) {
+	decoded, err := enc.NewDecoder().Bytes(raw)
+	if err == nil && bytes.ContainsRune(decoded, utf8.RuneError) {
+		err = errors.New("invalid byte sequence")
+	}
+	if err != nil {
+		return nil, charset, errors.New("not UTF-8, UTF-16 or GBK text")
+	}
+	return bytes.TrimPrefix(decoded, utf8BOM), charset, nil
+}
+
+// transcodePoCs rewrites the PoC files in another charset than plain UTF-8
+// as UTF-8 and returns how many it rewrote. Files that cannot be decoded are
+// left for the scan to report.
+func transcodePoCs(opts scanOptions) (int, error) {
+	files := 0
+	err := walkPoCFiles(opts, func(path string) error {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		decoded, charset, err := decodePoC(raw)
+		if err != nil || charset == charsetUTF8 {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, decoded, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("write %s: %w", path, err)
+		}
+		// The content is the same PoC: keep the time -keep newest goes by.
+		if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+		slog.Info("rewrote PoC as UTF-8", "file", path, "charset", charset)
+		files++
+		return nil
+	})
+	return files, err
+}
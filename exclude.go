@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+type excludeRule struct {
+	base    string
+	pattern string
+}
+
+type excludeMatcher []excludeRule
+
+// newExcludeMatcher builds a matcher from global patterns and per-directory
+// override patterns. Patterns without a slash match any path component by
+// name; patterns containing a slash are matched against the path relative to
+// the scanned root (or to the override directory). A trailing slash restricts
+// the pattern to directories.
+func newExcludeMatcher(patterns []string, overrides []configOverride) excludeMatcher {
+	var rules excludeMatcher
+	for _, pattern := range patterns {
+		rules = append(rules, excludeRule{pattern: fileKey(pattern)})
+	}
+	for _, override := range overrides {
+		for _, pattern := range override.Exclude {
+			rules = append(rules, excludeRule{base: fileKey(cleanOverridePath(override.Path)), pattern: fileKey(pattern)})
+		}
+	}
+	return rules
+}
+
+func (m excludeMatcher) match(rel string, isDir bool) bool {
+	rel = fileKey(rel)
+	for _, rule := range m {
+		if !isUnderDir(rel, rule.base) {
+			continue
+		}
+		sub := strings.TrimPrefix(strings.TrimPrefix(rel, rule.base), "/")
+		if sub == "" {
+			continue
+		}
+		pattern := strings.TrimSpace(rule.pattern)
+		dirOnly := strings.HasSuffix(pattern, "/")
+		pattern = strings.Trim(pattern, "/")
+		if pattern == "" || (dirOnly && !isDir) {
+			continue
+		}
+		target := sub
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(sub)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Exit codes are part of the CLI contract relied on by CI pipelines.
+// Flag parsing errors exit with 2 (the flag package default).
+const (
+	exitOK         = 0
+	exitError      = 1
+	exitUsage      = 2
+	exitDuplicates = 3
+	exitInvalid    = 4
+)
+
+const (
+	failOnNone       = "none"
+	failOnDuplicates = "duplicates"
+	failOnInvalid    = "invalid"
+)
+
+type failPolicy struct {
+	duplicates bool
+	invalid    bool
+}
+
+func parseFailOn(value string) (failPolicy, error) {
+	var policy failPolicy
+	for _, part := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(part)) {
+		case "", failOnNone:
+		case failOnDuplicates:
+			policy.duplicates = true
+		case failOnInvalid:
+			policy.invalid = true
+		default:
+			return failPolicy{}, fmt.Errorf("unknown value %q (want duplicates, invalid or none)", part)
+		}
+	}
+	return policy, nil
+}
+
+func (p failPolicy) exitCode(duplicates, invalid int) int {
+	switch {
+	case p.duplicates && duplicates > 0:
+		return exitDuplicates
+	case p.invalid && invalid > 0:
+		return exitInvalid
+	default:
+		return exitOK
+	}
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	linkCopy    = "copy"
+	linkHard    = "hard"
+	linkSymlink = "symlink"
+	linkReflink = "reflink"
+)
+
+var errReflinkUnsupported = errors.New("reflink is not supported on this platform")
+
+// An export directory holds a sha256sum-style manifest of the exported
+// files once complete; exports written in place carry the partial marker
+// until then.
+const (
+	exportManifestName = ".repeaterxraypoc-export.sha256"
+	exportPartialName  = ".repeaterxraypoc-export.partial"
+)
+
+type exportOptions struct {
+	Link     string
+	Preserve bool
+	// Provenance is sidecar, comment or empty; ScannedAt is recorded in it.
+	Provenance string
+	ScannedAt  time.Time
+	// Delta updates the export directory in place, skipping files that
+	// already hold what would be written; Prune then removes the PoCs that
+	// are no longer part of the export.
+	Delta bool
+	Prune bool
+	// NormalizeEOL writes exported files with LF line endings.
+	NormalizeEOL bool
+	// Names are the -on-name-collision decisions: dropped PoCs are left
+	// out and suffixed ones renamed in the export. All of them are recorded
+	// in the manifest.
+	Names []exportNameDecision
+}
+
+func parseLinkMode(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case linkCopy, linkHard, linkSymlink, linkReflink:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown link mode %q (want copy, hard, symlink or reflink)", value)
+	}
+}
+
+// exportDeduplicated writes the kept PoCs under outDir and returns the
+// files written. The export is built in a temporary sibling directory that
+// replaces outDir once complete, so consumers never see a partial export;
+// see exportInPlace for when that is not possible.
+func exportDeduplicated(ctx context.Context, groupMap map[string][]pocEntry, rootDir, outDir string, eopts exportOptions) ([]string, error) {
+	if outDir == "" {
+		return nil, nil
+	}
+	absRoot, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	absOut, err := filepath.Abs(outDir)
+	if err != nil {
+		return nil, err
+	}
+	reason := exportInPlaceReason(absRoot, absOut)
+	if eopts.Delta {
+		reason = "-out-delta"
+	}
+	if reason != "" {
+		slog.Debug("exporting in place", "out", absOut, "reason", reason)
+		return exportInPlace(ctx, groupMap, absRoot, absOut, eopts)
+	}
+	if err := os.MkdirAll(filepath.Dir(absOut), 0o755); err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(absOut), "."+filepath.Base(absOut)+".partial-")
+	if err != nil {
+		return nil, err
+	}
+	rels, _, err := writeExport(ctx, groupMap, absRoot, staging, eopts)
+	if err == nil {
+		err = writeExportManifest(staging, rels, eopts.Names)
+	}
+	if err == nil {
+		err = os.Chmod(staging, 0o755)
+	}
+	if err != nil {
+		os.RemoveAll(staging)
+		return nil, err
+	}
+	if err := replaceDir(staging, absOut); err != nil {
+		os.RemoveAll(staging)
+		slog.Warn("cannot move the export into place; exporting in place instead", "out", absOut, "err", err)
+		return exportInPlace(ctx, groupMap, absRoot, absOut, eopts)
+	}
+	return joinAll(absOut, rels), nil
+}
+
+// exportInPlaceReason explains why outDir cannot be replaced as a whole:
+// it holds the scanned root, is a symlink, or has files of its own that a
+// previous export did not write.
+func exportInPlaceReason(absRoot, absOut string) string {
+	if rel, err := filepath.Rel(absOut, absRoot); err == nil && !strings.HasPrefix(rel, "..") {
+		return "contains -dir"
+	}
+	info, err := os.Lstat(absOut)
+	if err != nil {
+		return ""
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return "symlink"
+	}
+	if entries, err := os.ReadDir(absOut); err == nil && len(entries) > 0 && !isPreviousExport(absOut) {
+		return "holds files not written by a previous export"
+	}
+	return ""
+}
+
+// isPreviousExport reports whether every file under dir is listed in its
+// export manifest or is the provenance sidecar of a listed file.
+func isPreviousExport(dir string) bool {
+	manifest, err := os.ReadFile(filepath.Join(dir, exportManifestName))
+	if err != nil {
+		return false
+	}
+	listed := map[string]bool{exportManifestName: true}
+	for _, line := range strings.Split(string(manifest), "\n") {
+		if _, rel, ok := strings.Cut(line, "  "); ok {
+			listed[rel] = true
+			listed[rel+provenanceSuffix] = true
+		}
+	}
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !listed[relativeTo(dir, path)] {
+			return errors.New("unlisted file")
+		}
+		return nil
+	})
+	return err == nil
+}
+
+// exportInPlace writes straight into outDir, marking it with the .partial
+// file until the manifest is written.
+func exportInPlace(ctx context.Context, groupMap map[string][]pocEntry, absRoot, absOut string, eopts exportOptions) ([]string, error) {
+	if err := os.MkdirAll(absOut, 0o755); err != nil {
+		return nil, err
+	}
+	if absOut == absRoot {
+		_, written, err := writeExport(ctx, groupMap, absRoot, absOut, eopts)
+		return joinAll(absOut, written), err
+	}
+	if err := os.Remove(filepath.Join(absOut, exportManifestName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	marker := filepath.Join(absOut, exportPartialName)
+	if err := os.WriteFile(marker, []byte("export in progress\n"), 0o644); err != nil {
+		return nil, err
+	}
+	rels, written, err := writeExport(ctx, groupMap, absRoot, absOut, eopts)
+	if err != nil {
+		return nil, err
+	}
+	removed := 0
+	if eopts.Prune {
+		if removed, err = pruneExport(absOut, rels); err != nil {
+			return nil, err
+		}
+	}
+	if eopts.Delta {
+		slog.Info("delta export", "out", absOut, "written", len(written), "unchanged", len(rels)-len(written), "removed", removed)
+	}
+	if err := writeExportManifest(absOut, rels, eopts.Names); err != nil {
+		return nil, err
+	}
+	return joinAll(absOut, written), os.Remove(marker)
+}
+
+// pruneExport removes the PoCs and provenance sidecars under dir that are
+// not in rels, and directories left empty by that. Other files stay.
+func pruneExport(dir string, rels []string) (int, error) {
+	keep := make(map[string]bool, len(rels))
+	for _, rel := range rels {
+		keep[filepath.ToSlash(rel)] = true
+	}
+	var stale, dirs []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		rel := relativeTo(dir, path)
+		if base, ok := strings.CutSuffix(rel, provenanceSuffix); ok {
+			if !keep[base] {
+				stale = append(stale, path)
+			}
+		} else if isSupportedExt(path) && !keep[rel] {
+			stale = append(stale, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return 0, err
+		}
+		slog.Debug("pruned from export", "file", path)
+	}
+	// Deepest first, so parents emptied by their children go too.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if entries, err := os.ReadDir(dirs[i]); err == nil && len(entries) == 0 {
+			os.Remove(dirs[i])
+		}
+	}
+	return len(stale), nil
+}
+
+// exportUnchanged reports whether dest already holds what exporting src
+// would write. Provenance comments are ignored, as their scan time changes
+// on every run.
+func exportUnchanged(absSrc, dest string, keep map[int]bool, partial bool, eopts exportOptions) bool {
+	info, err := os.Lstat(dest)
+	if err != nil {
+		return false
+	}
+	switch eopts.Link {
+	case linkSymlink:
+		target, err := os.Readlink(dest)
+		return err == nil && target == absSrc
+	case linkHard:
+		src, err := os.Stat(absSrc)
+		return err == nil && os.SameFile(src, info)
+	}
+	// A hard link left by an earlier -link hard export is not a copy.
+	if src, err := os.Stat(absSrc); err != nil || !info.Mode().IsRegular() || os.SameFile(src, info) {
+		return false
+	}
+	var want []byte
+	if partial {
+		f, err := readPoCFile(absSrc)
+		if err != nil {
+			return false
+		}
+		want = joinDocuments(f.Docs, func(i int) bool { return keep[i] })
+	} else if want, err = os.ReadFile(absSrc); err != nil {
+		return false
+	}
+	have, err := os.ReadFile(dest)
+	if err != nil {
+		return false
+	}
+	if eopts.NormalizeEOL {
+		want = bytes.ReplaceAll(want, []byte("\r\n"), []byte("\n"))
+	}
+	if eopts.Provenance == provenanceComment {
+		want, have = stripProvenanceComment(want), stripProvenanceComment(have)
+	}
+	return bytes.Equal(want, have)
+}
+
+// normalizeExportedEOL rewrites the exported copy dest of src with LF line
+// endings when it has CRLF ones.
+func normalizeExportedEOL(src, dest string, preserve bool) error {
+	raw, err := os.ReadFile(dest)
+	if err != nil || !bytes.Contains(raw, []byte("\r\n")) {
+		return err
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dest, bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n")), info.Mode().Perm()); err != nil {
+		return err
+	}
+	slog.Debug("exported with LF line endings", "file", dest)
+	if preserve {
+		return preserveAttributes(src, dest)
+	}
+	return nil
+}
+
+// replaceDir renames staging to dir. An existing dir is moved aside first
+// and removed afterwards, or put back when the second rename fails.
+func replaceDir(staging, dir string) error {
+	if _, err := os.Lstat(dir); errors.Is(err, os.ErrNotExist) {
+		return os.Rename(staging, dir)
+	}
+	old := staging + ".old"
+	if err := os.Rename(dir, old); err != nil {
+		return err
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		if restoreErr := os.Rename(old, dir); restoreErr != nil {
+			return fmt.Errorf("%w; previous export left at %s", err, old)
+		}
+		return err
+	}
+	if err := os.RemoveAll(old); err != nil {
+		slog.Warn("removing previous export", "dir", old, "err", err)
+	}
+	return nil
+}
+
+func joinAll(dir string, rels []string) []string {
+	paths := make([]string, len(rels))
+	for i, rel := range rels {
+		paths[i] = filepath.Join(dir, rel)
+	}
+	return paths
+}
+
+// writeExport writes the kept PoCs under outDir and returns their paths
+// relative to it: all of them, and those actually written, which with
+// eopts.Delta leaves out the unchanged ones. It stops between files when
+// ctx ends.
+func writeExport(ctx context.Context, groupMap map[string][]pocEntry, absRoot, absOut string, eopts exportOptions) (all, written []string, err error) {
+	dropped := make(map[string]bool)
+	renamed := make(map[string]exportNameDecision)
+	for _, d := range eopts.Names {
+		switch d.Policy {
+		case nameCollisionDrop:
+			dropped[d.unit] = true
+		case nameCollisionSuffix:
+			renamed[d.unit] = d
+		}
+	}
+	// Collect the kept documents of every file: a multi-document file whose
+	// other documents are duplicates is exported with only the kept ones.
+	kept := make(map[string]map[int]bool)
+	docs := make(map[string]int)
+	for _, entries := range groupMap {
+		if len(entries) == 0 || dropped[entries[0].unit()] {
+			continue
+		}
+		keeper := entries[0]
+		if kept[keeper.FilePath] == nil {
+			kept[keeper.FilePath] = make(map[int]bool)
+		}
+		kept[keeper.FilePath][keeper.Doc] = true
+		docs[keeper.FilePath] = keeper.Docs
+	}
+	files := make([]string, 0, len(kept))
+	for file := range kept {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	// Under -file-case insensitive, files whose paths differ only in case
+	// would overwrite each other.
+	exported := make(map[string]string, len(files))
+	for _, src := range files {
+		if ctx.Err() != nil {
+			return nil, nil, context.Cause(ctx)
+		}
+		absSrc, err := filepath.Abs(src)
+		if err != nil {
+			return nil, nil, err
+		}
+		rel, err := filepath.Rel(absRoot, absSrc)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = filepath.Base(absSrc)
+		}
+		if other, ok := exported[fileKey(rel)]; ok {
+			return nil, nil, fmt.Errorf("%s and %s differ only in case and would overwrite each other in the export", other, rel)
+		}
+		exported[fileKey(rel)] = rel
+		dest := filepath.Join(absOut, rel)
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return nil, nil, err
+		}
+		partial := docs[src] > 1 && len(kept[src]) < docs[src]
+		all = append(all, rel)
+		if eopts.Delta && exportUnchanged(absSrc, dest, kept[src], partial, eopts) {
+			slog.Debug("unchanged in export", "file", dest)
+			continue
+		}
+		if partial && absSrc != dest {
+			if err := os.Remove(dest); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, nil, err
+			}
+			if err := writeDocuments(absSrc, dest, kept[src], eopts.Preserve); err != nil {
+				return nil, nil, err
+			}
+			slog.Debug("exported kept documents", "file", src, "documents", len(kept[src]), "of", docs[src])
+		} else if err := placeFile(absSrc, dest, eopts); err != nil {
+			return nil, nil, err
+		}
+		if eopts.NormalizeEOL && absSrc != dest {
+			if err := normalizeExportedEOL(absSrc, dest, eopts.Preserve); err != nil {
+				return nil, nil, err
+			}
+		}
+		if err := renameExported(src, absSrc, dest, kept[src], docs[src], renamed); err != nil {
+			return nil, nil, err
+		}
+		written = append(written, rel)
+		if eopts.Provenance == "" {
+			continue
+		}
+		if absSrc == dest && eopts.Provenance == provenanceComment {
+			slog.Debug("not annotating a PoC exported onto itself", "file", src)
+			continue
+		}
+		p, err := newProvenance(absRoot, absSrc, rel, eopts.ScannedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		if partial {
+			for doc := range kept[src] {
+				p.Documents = append(p.Documents, doc)
+			}
+			sort.Ints(p.Documents)
+		}
+		preserveFrom := ""
+		if eopts.Preserve {
+			preserveFrom = absSrc
+		}
+		if err := writeProvenance(dest, p, eopts.Provenance, preserveFrom); err != nil {
+			return nil, nil, fmt.Errorf("provenance for %s: %w", dest, err)
+		}
+	}
+	return all, written, nil
+}
+
+// renameExported applies the -on-name-collision suffixes to the exported
+// copy of src. Documents are numbered as in dest, which holds only the kept
+// ones of a partially exported file.
+func renameExported(src, absSrc, dest string, keep map[int]bool, docCount int, renamed map[string]exportNameDecision) error {
+	if len(renamed) == 0 {
+		return nil
+	}
+	destDoc := 0
+	for doc := 0; doc < max(docCount, 1); doc++ {
+		if !keep[doc] {
+			continue
+		}
+		unit := src
+		if docCount > 1 {
+			unit = fmt.Sprintf("%s#%d", src, doc)
+		}
+		if d, ok := renamed[unit]; ok {
+			if absSrc == dest {
+				return fmt.Errorf("cannot rename %s: it is exported onto itself", unit)
+			}
+			if err := rewritePoCName(dest, destDoc, d.Name, d.NewName); err != nil {
+				return fmt.Errorf("rename %s in export: %w", unit, err)
+			}
+			slog.Debug("renamed in export", "file", unit, "from", d.Name, "to", d.NewName)
+		}
+		destDoc++
+	}
+	return nil
+}
+
+// placeFile materializes src at dst using the requested link mode. Reflinks
+// fall back to a plain copy when the filesystem cannot clone the file.
+func placeFile(src, dst string, eopts exportOptions) error {
+	if src == dst {
+		return nil
+	}
+	// Replace rather than truncate dst: it may be a hard link to a PoC from
+	// an earlier -link hard export.
+	if err := os.Remove(dst); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	switch eopts.Link {
+	case linkCopy:
+		return copyFile(src, dst, eopts.Preserve)
+	case linkHard:
+		return os.Link(src, dst)
+	case linkSymlink:
+		return os.Symlink(src, dst)
+	case linkReflink:
+		if err := reflinkFile(src, dst); err != nil {
+			slog.Debug("reflink failed, copying instead", "file", src, "err", err)
+			return copyFile(src, dst, eopts.Preserve)
+		}
+		if eopts.Preserve {
+			return preserveAttributes(src, dst)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown link mode %q", eopts.Link)
+	}
+}
+
+// copyFile streams src into dst. With preserve set, the destination gets the
+// source's permission bits and modification time.
+func copyFile(src, dst string, preserve bool) error {
+	if src == dst {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	var perm os.FileMode = 0o644
+	if preserve {
+		info, err := in.Stat()
+		if err != nil {
+			return err
+		}
+		perm = info.Mode().Perm()
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if preserve {
+		return preserveAttributes(src, dst)
+	}
+	return nil
+}
+
+func preserveAttributes(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	// OpenFile only applies the mode on creation, so set it explicitly for
+	// destinations that already existed.
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// writeExportManifest lists the sha256 of every exported file, in the
+// format of sha256sum, so consumers can tell a complete export and check it.
+// Name collision decisions come first as comment lines, which sha256sum -c
+// skips.
+func writeExportManifest(dir string, rels []string, names []exportNameDecision) error {
+	sorted := append([]string(nil), rels...)
+	sort.Strings(sorted)
+	var b strings.Builder
+	for _, d := range names {
+		fmt.Fprintf(&b, "# %s\n", d)
+	}
+	for _, rel := range sorted {
+		raw, err := os.ReadFile(filepath.Join(dir, rel))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%x  %s\n", sha256.Sum256(raw), filepath.ToSlash(rel))
+	}
+	return os.WriteFile(filepath.Join(dir, exportManifestName), []byte(b.String()), 0o644)
+}
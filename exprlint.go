@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// matchAllPatterns are regular expressions that match any text.
+var matchAllPatterns = map[string]bool{
+	"": true, ".*": true, "(?s).*": true, "(?i).*": true, "^": true, "$": true,
+	"^.*": true, ".*$": true, "^.*$": true, "(?s)^.*$": true, ".*?": true,
+}
+
+// emptyAffix matches startsWith and endsWith checks with an empty argument.
+var emptyAffix = regexp.MustCompile(`^response\.(?:body|body_string|raw)\.b?(?:startsWith|endsWith)\(""\)$`)
+
+// pocExpression is one expression of a PoC: the top-level one or a rule's.
+type pocExpression struct {
+	where string
+	value string
+}
+
+// pocExpressions lists the expressions of every document of f, labelled
+// with their rule and, in a multi-document file, their document.
+func pocExpressions(f *pocFile) []pocExpression {
+	var out []pocExpression
+	for i, doc := range f.Docs {
+		prefix := ""
+		if len(f.Docs) > 1 {
+			prefix = fmt.Sprintf("document %d: ", i)
+		}
+		if len(doc.Node.Content) == 0 {
+			continue
+		}
+		top := resolveAlias(doc.Node.Content[0])
+		expr := func(node *yaml.Node) string {
+			return strings.TrimSpace(scalarValue(resolveAlias(mappingValue(node, "expression"))))
+		}
+		if value := expr(top); value != "" {
+			out = append(out, pocExpression{where: prefix + "expression", value: value})
+		}
+		rules := resolveAlias(mappingValue(top, "rules"))
+		if rules == nil {
+			continue
+		}
+		switch rules.Kind {
+		case yaml.MappingNode:
+			for j := 0; j+1 < len(rules.Content); j += 2 {
+				if value := expr(resolveAlias(rules.Content[j+1])); value != "" {
+					out = append(out, pocExpression{where: prefix + "rule " + rules.Content[j].Value, value: value})
+				}
+			}
+		case yaml.SequenceNode:
+			for j, rule := range rules.Content {
+				if value := expr(resolveAlias(rule)); value != "" {
+					out = append(out, pocExpression{where: fmt.Sprintf("%srule %d", prefix, j), value: value})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// expressionChecks splits an expression into its checks: the operands of
+// && and || at any depth. A negated operand is one check. It returns nil for
+// an expression that does not tokenize.
+func expressionChecks(expr string) [][]celToken {
+	tokens, err := tokenizeCEL(expr)
+	if err != nil {
+		return nil
+	}
+	var checks [][]celToken
+	var split func(tokens []celToken)
+	split = func(tokens []celToken) {
+		tokens = stripParens(tokens)
+		for _, op := range []string{"||", "&&"} {
+			if parts := flattenOperands(tokens, op); len(parts) > 1 {
+				for _, part := range parts {
+					split(part)
+				}
+				return
+			}
+		}
+		if len(tokens) > 0 {
+			checks = append(checks, tokens)
+		}
+	}
+	split(tokens)
+	return checks
+}
+
+// selfComparison returns the operand a check compares with itself and the
+// operator, if it does.
+func selfComparison(check []celToken) (operand, op string, ok bool) {
+	depth := 0
+	for i, t := range check {
+		if t.kind != 'p' {
+			continue
+		}
+		switch t.text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case "==", "!=", "<=", ">=", "<", ">":
+			if depth != 0 || i == 0 {
+				continue
+			}
+			lhs, rhs := renderTokens(check[:i]), renderTokens(check[i+1:])
+			return lhs, t.text, lhs == rhs
+		}
+	}
+	return "", "", false
+}
+
+// checkExpressionTautology flags expressions that are always true or always
+// false whatever the response: a bare true or false, or an operand compared
+// with itself.
+func checkExpressionTautology(f *pocFile) []string {
+	var messages []string
+	for _, e := range pocExpressions(f) {
+		for _, check := range expressionChecks(e.value) {
+			rendered := renderTokens(check)
+			if rendered == "true" || rendered == "false" {
+				messages = append(messages, fmt.Sprintf("%s: %s is always %s", e.where, rendered, rendered))
+				continue
+			}
+			operand, op, ok := selfComparison(check)
+			if !ok {
+				continue
+			}
+			always := "true"
+			if op == "!=" || op == "<" || op == ">" {
+				always = "false"
+			}
+			messages = append(messages, fmt.Sprintf("%s: %s compares %s with itself and is always %s", e.where, rendered, operand, always))
+		}
+	}
+	return messages
+}
+
+// checkExpressionMatchAll flags body checks that every response passes: an
+// empty needle or a pattern matching any text.
+func checkExpressionMatchAll(f *pocFile) []string {
+	var messages []string
+	for _, e := range pocExpressions(f) {
+		for _, check := range expressionChecks(e.value) {
+			rendered := renderTokens(check)
+			canonical := canonicalCheck(rendered)
+			matchAll := emptyAffix.MatchString(rendered)
+			for _, prefix := range []string{"body contains ", "body icontains ", "body matches "} {
+				if value, ok := strings.CutPrefix(canonical, prefix); ok {
+					pattern, err := strconv.Unquote(value)
+					matchAll = matchAll || err == nil && (pattern == "" || prefix == "body matches " && matchAllPatterns[pattern])
+				}
+			}
+			if matchAll {
+				messages = append(messages, fmt.Sprintf("%s: %s matches every response", e.where, rendered))
+			}
+		}
+	}
+	return messages
+}
+
+// checkExpressionStatus flags rules that check the body but not the status
+// code, which error and login pages echoing the request often pass.
+func checkExpressionStatus(f *pocFile) []string {
+	var messages []string
+	for _, e := range pocExpressions(f) {
+		if !strings.Contains(e.where, "rule ") {
+			continue
+		}
+		body, status := false, false
+		for _, check := range expressionChecks(e.value) {
+			canonical := canonicalCheck(renderTokens(check))
+			body = body || strings.HasPrefix(canonical, "body ")
+			status = status || strings.HasPrefix(canonical, "status") || strings.Contains(canonical, "response.status")
+		}
+		if body && !status {
+			messages = append(messages, fmt.Sprintf("%s checks the body but not response.status (e.g. response.status == 200)", e.where))
+		}
+	}
+	return messages
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// File name case handling, chosen with -file-case.
+const (
+	fileCaseAuto        = "auto"
+	fileCaseSensitive   = "sensitive"
+	fileCaseInsensitive = "insensitive"
+)
+
+// foldFileCase makes PoC file paths compare case-insensitively, as they do
+// on Windows: in -exclude, ignore files and override paths, the baseline,
+// -keep-hook answers, and between the files of an export.
+var foldFileCase = runtime.GOOS == "windows"
+
+// parseFileCase returns whether file paths are compared case-insensitively;
+// auto does so on Windows.
+func parseFileCase(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", fileCaseAuto:
+		return runtime.GOOS == "windows", nil
+	case fileCaseSensitive:
+		return false, nil
+	case fileCaseInsensitive:
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown file case %q (want auto, sensitive or insensitive)", value)
+}
+
+// fileKey is the form of a relative file path that comparisons use.
+func fileKey(rel string) string {
+	if foldFileCase {
+		return strings.ToLower(rel)
+	}
+	return rel
+}
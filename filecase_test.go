@@ -0,0 +1,144 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// withFileCase sets foldFileCase for the duration of the test.
+func withFileCase(t *testing.T, fold bool) {
+	t.Helper()
+	prev := foldFileCase
+	foldFileCase = fold
+	t.Cleanup(func() { foldFileCase = prev })
+}
+
+func TestParseFileCase(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{value: "", want: runtime.GOOS == "windows"},
+		{value: "auto", want: runtime.GOOS == "windows"},
+		{value: "sensitive", want: false},
+		{value: "insensitive", want: true},
+		{value: " Insensitive ", want: true},
+		{value: "SENSITIVE", want: false},
+		{value: "ignore", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseFileCase(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFileCase(%q) error = %v, want error %t", tt.value, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("parseFileCase(%q) = %t, want %t", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFileKey(t *testing.T) {
+	tests := []struct {
+		fold bool
+		rel  string
+		want string
+	}{
+		{fold: false, rel: "Pocs/CVE-2021-1234.yml", want: "Pocs/CVE-2021-1234.yml"},
+		{fold: false, rel: "pocs/a.yml", want: "pocs/a.yml"},
+		{fold: true, rel: "Pocs/CVE-2021-1234.yml", want: "pocs/cve-2021-1234.yml"},
+		{fold: true, rel: "pocs/a.yml", want: "pocs/a.yml"},
+		{fold: true, rel: "", want: ""},
+	}
+	for _, tt := range tests {
+		withFileCase(t, tt.fold)
+		if got := fileKey(tt.rel); got != tt.want {
+			t.Errorf("fold=%t: fileKey(%q) = %q, want %q", tt.fold, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestExcludeFileCase(t *testing.T) {
+	overrides := []configOverride{{Path: "Vendor", Exclude: []string{"*.Draft.yml"}}}
+	tests := []struct {
+		fold  bool
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{fold: false, rel: "Archive", isDir: true, want: false},
+		{fold: false, rel: "archive", isDir: true, want: true},
+		{fold: false, rel: "web/Old-Login.YML", want: false},
+		{fold: false, rel: "vendor/x.draft.yml", want: false},
+		{fold: false, rel: "Vendor/x.Draft.yml", want: true},
+		{fold: true, rel: "Archive", isDir: true, want: true},
+		{fold: true, rel: "web/Old-Login.YML", want: true},
+		{fold: true, rel: "vendor/x.draft.yml", want: true},
+		{fold: true, rel: "web/new-login.yml", want: false},
+	}
+	for _, tt := range tests {
+		withFileCase(t, tt.fold)
+		m := newExcludeMatcher([]string{"archive/", "web/old-*.yml"}, overrides)
+		if got := m.match(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("fold=%t: exclude match(%q) = %t, want %t", tt.fold, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoreFileCase(t *testing.T) {
+	tests := []struct {
+		fold bool
+		rel  string
+		want bool
+	}{
+		{fold: false, rel: "Team/Wip.yml", want: true},
+		{fold: false, rel: "team/wip.yml", want: false},
+		{fold: false, rel: "Team/Keep.yml", want: false},
+		{fold: true, rel: "team/wip.yml", want: true},
+		{fold: true, rel: "TEAM/WIP.YML", want: true},
+		{fold: true, rel: "team/keep.yml", want: false},
+		{fold: true, rel: "team/other.yml", want: false},
+	}
+	for _, tt := range tests {
+		withFileCase(t, tt.fold)
+		files := ignoreFiles{}
+		var rules []ignoreRule
+		for _, line := range []string{"W*.yml", "Keep.yml", "!Keep.yml"} {
+			if rule, ok := parseIgnoreLine(line); ok {
+				rules = append(rules, rule)
+			}
+		}
+		files[fileKey("Team")] = rules
+		if got := files.match(tt.rel, false); got != tt.want {
+			t.Errorf("fold=%t: ignore match(%q) = %t, want %t", tt.fold, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestBaselineFileCase(t *testing.T) {
+	root := t.TempDir()
+	baseline := &baselineFile{
+		Version:    baselineVersion,
+		Duplicates: []baselineGroup{{Key: "/login", Files: []string{"Pocs/A.yml", "pocs/b.yml"}}},
+	}
+	group := duplicateGroup{Key: "/login", Entries: []pocEntry{
+		{FilePath: filepath.Join(root, "pocs", "a.yml")},
+		{FilePath: filepath.Join(root, "pocs", "b.yml")},
+	}}
+	tests := []struct {
+		fold           bool
+		wantSuppressed int
+	}{
+		{fold: false, wantSuppressed: 0},
+		{fold: true, wantSuppressed: 1},
+	}
+	for _, tt := range tests {
+		withFileCase(t, tt.fold)
+		fresh, suppressed := baseline.filter(scanOptions{Root: root}, []duplicateGroup{group})
+		if suppressed != tt.wantSuppressed || len(fresh)+suppressed != 1 {
+			t.Errorf("fold=%t: baseline filter suppressed %d and kept %d groups, want %d suppressed", tt.fold, suppressed, len(fresh), tt.wantSuppressed)
+		}
+	}
+}
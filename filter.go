@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var filterFields = []string{"name", "cve", "tag", "severity", "author", "transport", "file"}
+
+// pocFilter keeps PoCs whose field matches any of the glob patterns.
+type pocFilter struct {
+	Field    string
+	Patterns []string
+}
+
+// parseFilters parses -filter values of the form field=glob[,glob...].
+// Filters on the same field are ORed, filters on different fields are ANDed.
+func parseFilters(values []string) ([]pocFilter, error) {
+	byField := map[string]int{}
+	var filters []pocFilter
+	for _, value := range values {
+		field, patterns, ok := strings.Cut(value, "=")
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !ok || field == "" {
+			return nil, fmt.Errorf("filter %q: want field=pattern", value)
+		}
+		if field == "tags" || field == "cves" {
+			field = strings.TrimSuffix(field, "s")
+		}
+		if !isFilterField(field) {
+			return nil, fmt.Errorf("filter %q: unknown field %q (want %s)", value, field, strings.Join(filterFields, ", "))
+		}
+		i, ok := byField[field]
+		if !ok {
+			i = len(filters)
+			byField[field] = i
+			filters = append(filters, pocFilter{Field: field})
+		}
+		for _, pattern := range strings.Split(patterns, ",") {
+			pattern = strings.ToLower(strings.TrimSpace(pattern))
+			if pattern == "" {
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("filter %q: %w", value, err)
+			}
+			filters[i].Patterns = append(filters[i].Patterns, pattern)
+		}
+		if len(filters[i].Patterns) == 0 {
+			return nil, fmt.Errorf("filter %q: empty pattern", value)
+		}
+	}
+	return filters, nil
+}
+
+func isFilterField(field string) bool {
+	for _, f := range filterFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func matchFilters(filters []pocFilter, entry pocEntry) bool {
+	for _, f := range filters {
+		if !f.match(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f pocFilter) match(entry pocEntry) bool {
+	var values []string
+	switch f.Field {
+	case "name":
+		values = []string{entry.Name}
+	case "cve":
+		values = entry.Detail.CVEs
+	case "tag":
+		values = entry.Detail.Tags
+	case "severity":
+		values = []string{entry.Detail.Severity}
+	case "author":
+		values = []string{entry.Detail.Author}
+	case "transport":
+		values = []string{entry.Detail.Transport}
+	case "file":
+		values = []string{filepath.Base(entry.FilePath)}
+	}
+	for _, value := range values {
+		value = strings.ToLower(value)
+		for _, pattern := range f.Patterns {
+			if ok, _ := path.Match(pattern, value); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"mime"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// strategyFingerprint groups PoCs that send the same requests and check the
+// responses the same way, whatever their YAML looks like.
+const strategyFingerprint = "fingerprint"
+
+// detectionFingerprint derives a canonical description of what a PoC sends
+// and how it decides the target is vulnerable. Each rule becomes its request
+// plus its expression reduced to normalized checks (status codes, body
+// keywords and patterns, header matches); the top-level expression is then
+// rewritten with every rN() call replaced by that rule's description, so
+// rule names, rule order, unused rules, operand order of && and ||, and the
+// spacing and quoting of the expressions do not matter.
+func detectionFingerprint(doc *yaml.Node, normalize pathNormalizer) (string, error) {
+	if len(doc.Content) == 0 {
+		return "", errors.New("empty document")
+	}
+	top := resolveAlias(doc.Content[0])
+	rules := resolveAlias(mappingValue(top, "rules"))
+	if rules == nil {
+		return "", errors.New("no rules to fingerprint")
+	}
+	vars := parseVariables(top)
+	described := make(map[string]string)
+	var all []string
+	switch rules.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(rules.Content); i += 2 {
+			rule := resolveAlias(rules.Content[i+1])
+			desc := describeRule(resolveAlias(mappingValue(rule, "request")), rule, vars, normalize)
+			described[rules.Content[i].Value] = desc
+			all = append(all, desc)
+		}
+	case yaml.SequenceNode:
+		// v1: every rule runs in turn and all of them must match.
+		for _, rule := range rules.Content {
+			rule = resolveAlias(rule)
+			all = append(all, describeRule(rule, rule, vars, normalize))
+		}
+	}
+	if len(all) == 0 {
+		return "", errors.New("no rules to fingerprint")
+	}
+	var canonical string
+	if expr := scalarValue(mappingValue(top, "expression")); expr != "" && rules.Kind == yaml.MappingNode {
+		canonical = canonicalExpression(expr, described)
+	} else {
+		sort.Strings(all)
+		canonical = "(" + strings.Join(all, "&&") + ")"
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return "fingerprint:" + hex.EncodeToString(sum[:8]), nil
+}
+
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+func scalarValue(n *yaml.Node) string {
+	if n = resolveAlias(n); n == nil || n.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return strings.TrimSpace(n.Value)
+}
+
+// describeRule renders one rule: request is where method, path, headers and
+// body live (the rule itself in the v1 layout). Variables are replaced by
+// what they stand for.
+func describeRule(request, rule *yaml.Node, vars pocVariables, normalize pathNormalizer) string {
+	return "{" + describeRequest(request, vars, normalize) + " | " +
+		canonicalExpression(vars.expression(scalarValue(mappingValue(rule, "expression"))), nil) + "}"
+}
+
+// describeRequest renders a request so that cosmetic differences vanish:
+// header names are lowercased and sorted, values trimmed, the content type
+// normalized, and the body trimmed with JSON bodies re-encoded canonically.
+func describeRequest(request *yaml.Node, vars pocVariables, normalize pathNormalizer) string {
+	var b strings.Builder
+	method := strings.ToUpper(scalarValue(mappingValue(request, "method")))
+	if method == "" {
+		method = "GET"
+	}
+	b.WriteString(method + " " + strconv.Quote(normalize.apply(vars.template(scalarValue(mappingValue(request, "path"))))))
+	contentType := ""
+	if headers := resolveAlias(mappingValue(request, "headers")); headers != nil && headers.Kind == yaml.MappingNode {
+		var lines []string
+		for i := 0; i+1 < len(headers.Content); i += 2 {
+			name := strings.ToLower(strings.TrimSpace(headers.Content[i].Value))
+			value := vars.template(scalarValue(headers.Content[i+1]))
+			if name == "content-type" {
+				value = normalizeContentType(value)
+				contentType = value
+			}
+			lines = append(lines, strconv.Quote(name)+":"+strconv.Quote(value))
+		}
+		sort.Strings(lines)
+		for _, line := range lines {
+			b.WriteString(" " + line)
+		}
+	}
+	if body := resolveAlias(mappingValue(request, "body")); body != nil && body.Kind == yaml.ScalarNode {
+		if value := normalizeBody(vars.template(body.Value), contentType); value != "" {
+			b.WriteString(" body=" + strconv.Quote(value))
+		}
+	}
+	// tcp and udp requests write content instead of a path.
+	if mappingValue(request, "content") != nil {
+		if req, err := parseTCPRequest(request); err == nil {
+			b.WriteString(" " + req.key())
+		}
+	}
+	if follow := scalarValue(mappingValue(request, "follow_redirects")); follow != "" {
+		b.WriteString(" follow=" + strings.ToLower(follow))
+	}
+	return b.String()
+}
+
+// normalizeContentType lowercases the media type and parameter names,
+// sorts the parameters and drops the spacing around them.
+func normalizeContentType(value string) string {
+	media, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		return strings.ToLower(strings.Join(strings.Fields(value), ""))
+	}
+	if charset, ok := params["charset"]; ok {
+		params["charset"] = strings.ToLower(charset)
+	}
+	return mime.FormatMediaType(media, params)
+}
+
+// normalizeBody trims the body and unifies line endings, so block scalar
+// styles (| versus |-) and trailing spaces do not matter. A body that is
+// valid JSON is re-encoded with sorted keys and no insignificant spacing.
+func normalizeBody(body, contentType string) string {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	body = strings.TrimSpace(strings.Join(lines, "\n"))
+	if strings.Contains(contentType, "json") || strings.HasPrefix(body, "{") || strings.HasPrefix(body, "[") {
+		dec := json.NewDecoder(strings.NewReader(body))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err == nil && !dec.More() {
+			if canonical, err := json.Marshal(v); err == nil {
+				return string(canonical)
+			}
+		}
+	}
+	return body
+}
+
+type celToken struct {
+	kind byte // 'i' identifier, 'n' number, 's' string, 'p' operator or punctuation
+	text string
+}
+
+// tokenizeCEL splits an expression into tokens. String literals lose their
+// quoting style and b/r prefixes: b"x" and 'x' are the same token.
+func tokenizeCEL(expr string) ([]celToken, error) {
+	var tokens []celToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			j := i
+			for j < len(expr) && (isIdentStart(expr[j]) || unicode.IsDigit(rune(expr[j]))) {
+				j++
+			}
+			word := expr[i:j]
+			if j < len(expr) && (expr[j] == '"' || expr[j] == '\'') && isStringPrefix(word) {
+				s, n, err := readCELString(expr[j:], strings.ContainsAny(word, "rR"))
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, celToken{'s', s})
+				i = j + n
+				continue
+			}
+			tokens = append(tokens, celToken{'i', word})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(expr) && (isIdentStart(expr[j]) || unicode.IsDigit(rune(expr[j])) || expr[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, celToken{'n', expr[i:j]})
+			i = j
+		case c == '"' || c == '\'':
+			s, n, err := readCELString(expr[i:], false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, celToken{'s', s})
+			i += n
+		default:
+			op := string(c)
+			if i+1 < len(expr) {
+				switch two := expr[i : i+2]; two {
+				case "&&", "||", "==", "!=", "<=", ">=":
+					op = two
+				}
+			}
+			tokens = append(tokens, celToken{'p', op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isStringPrefix(word string) bool {
+	switch strings.ToLower(word) {
+	case "b", "r", "br", "rb":
+		return true
+	}
+	return false
+}
+
+// readCELString reads a quoted literal at the start of s and returns its
+// value and length. Triple-quoted literals are supported.
+func readCELString(s string, raw bool) (string, int, error) {
+	quote := s[:1]
+	if len(s) >= 3 && s[1] == s[0] && s[2] == s[0] {
+		quote = s[:3]
+	}
+	var b strings.Builder
+	for i := len(quote); i < len(s); i++ {
+		if strings.HasPrefix(s[i:], quote) {
+			return b.String(), i + len(quote), nil
+		}
+		if s[i] == '\\' && !raw && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'x':
+				if i+2 < len(s) {
+					if v, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+						b.WriteByte(byte(v))
+						i += 2
+						continue
+					}
+				}
+				b.WriteString(`\x`)
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return "", 0, errors.New("unterminated string literal")
+}
+
+// canonicalExpression normalizes a boolean expression: operands of && and
+// || are flattened, deduplicated and sorted, and each check is rewritten by
+// canonicalCheck. Calls to the rules in rules are replaced by their
+// description. An expression that does not tokenize is kept verbatim.
+func canonicalExpression(expr string, rules map[string]string) string {
+	tokens, err := tokenizeCEL(expr)
+	if err != nil {
+		return strconv.Quote(strings.Join(strings.Fields(expr), " "))
+	}
+	return canonicalTokens(tokens, rules)
+}
+
+func canonicalTokens(tokens []celToken, rules map[string]string) string {
+	tokens = stripParens(tokens)
+	for _, op := range []string{"||", "&&"} {
+		parts := flattenOperands(tokens, op)
+		if len(parts) < 2 {
+			continue
+		}
+		seen := make(map[string]bool)
+		var operands []string
+		for _, part := range parts {
+			if operand := canonicalTokens(part, rules); !seen[operand] {
+				seen[operand] = true
+				operands = append(operands, operand)
+			}
+		}
+		if len(operands) == 1 {
+			return operands[0]
+		}
+		sort.Strings(operands)
+		return "(" + strings.Join(operands, op) + ")"
+	}
+	if len(tokens) > 0 && tokens[0].kind == 'p' && tokens[0].text == "!" {
+		return "!" + canonicalTokens(tokens[1:], rules)
+	}
+	if len(tokens) == 3 && tokens[0].kind == 'i' && tokens[1].text == "(" && tokens[2].text == ")" {
+		if desc, ok := rules[tokens[0].text]; ok {
+			return desc
+		}
+	}
+	return canonicalCheck(renderTokens(tokens))
+}
+
+// flattenOperands splits tokens at op outside of brackets and also splits
+// parenthesized operands that are themselves joined by op, so (a && b) && c
+// yields a, b and c.
+func flattenOperands(tokens []celToken, op string) [][]celToken {
+	parts := splitTopLevel(tokens, op)
+	if len(parts) < 2 {
+		return parts
+	}
+	var out [][]celToken
+	for _, part := range parts {
+		inner := stripParens(part)
+		// && binds tighter than ||: (a || b) is not an && operand list.
+		if len(splitTopLevel(inner, op)) > 1 && (op == "||" || len(splitTopLevel(inner, "||")) == 1) {
+			out = append(out, flattenOperands(inner, op)...)
+			continue
+		}
+		out = append(out, part)
+	}
+	return out
+}
+
+// stripParens removes parentheses enclosing the whole expression.
+func stripParens(tokens []celToken) []celToken {
+	for len(tokens) >= 2 && tokens[0].kind == 'p' && tokens[0].text == "(" && closingParen(tokens, 0) == len(tokens)-1 {
+		tokens = tokens[1 : len(tokens)-1]
+	}
+	return tokens
+}
+
+// splitTopLevel splits tokens at op outside of brackets.
+func splitTopLevel(tokens []celToken, op string) [][]celToken {
+	var parts [][]celToken
+	depth, start := 0, 0
+	for i, t := range tokens {
+		if t.kind != 'p' {
+			continue
+		}
+		switch t.text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case op:
+			if depth == 0 {
+				parts = append(parts, tokens[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, tokens[start:])
+}
+
+func closingParen(tokens []celToken, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		if tokens[i].kind != 'p' {
+			continue
+		}
+		switch tokens[i].text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// renderTokens prints tokens compactly: no spaces except between two words,
+// strings in Go quoting.
+func renderTokens(tokens []celToken) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 && t.kind != 'p' && tokens[i-1].kind != 'p' {
+			b.WriteByte(' ')
+		}
+		if t.kind == 's' {
+			b.WriteString(strconv.Quote(t.text))
+		} else {
+			b.WriteString(t.text)
+		}
+	}
+	return b.String()
+}
+
+const celQuoted = `("(?:[^"\\]|\\.)*")`
+
+// Checks are matched on rendered tokens. Body and header accessors that
+// read the same data are folded together.
+var (
+	statusCheck        = regexp.MustCompile(`^response\.status(==|!=|<=|>=|<|>)(\d+)$`)
+	statusCheckFlipped = regexp.MustCompile(`^(\d+)(==|!=)response\.status$`)
+	statusInCheck      = regexp.MustCompile(`^response\.status in\[([\d,]+)\]$`)
+	bodyContains       = regexp.MustCompile(`^response\.(?:body|body_string|raw)\.(b?contains|ibcontains|icontains)\(` + celQuoted + `\)$`)
+	bodyMatches        = regexp.MustCompile(`^` + celQuoted + `\.(?:b?matches|submatch|bsubmatch)\(response\.(?:body|body_string|raw)\)$`)
+	headerContains     = regexp.MustCompile(`^response\.headers\[` + celQuoted + `\]\.(b?contains|ibcontains|icontains)\(` + celQuoted + `\)$`)
+	headerEquals       = regexp.MustCompile(`^response\.headers\[` + celQuoted + `\](==|!=)` + celQuoted + `$`)
+	headerMatches      = regexp.MustCompile(`^` + celQuoted + `\.(?:b?matches|submatch|bsubmatch)\(response\.headers\[` + celQuoted + `\]\)$`)
+	contentTypeCheck   = regexp.MustCompile(`^response\.content_type\.(b?contains|ibcontains|icontains)\(` + celQuoted + `\)$`)
+)
+
+// canonicalCheck rewrites one check into a normalized form such as
+// status==200, body contains "x" or header[location] matches "re". Checks it
+// does not recognize are compared as rendered.
+func canonicalCheck(check string) string {
+	unquote := func(s string) string {
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return s
+		}
+		return v
+	}
+	header := func(name string) string {
+		return "header[" + strings.ToLower(unquote(name)) + "]"
+	}
+	contains := func(fn string) string {
+		if strings.HasPrefix(fn, "i") {
+			return "icontains"
+		}
+		return "contains"
+	}
+	if m := statusCheck.FindStringSubmatch(check); m != nil {
+		return "status" + m[1] + m[2]
+	}
+	if m := statusCheckFlipped.FindStringSubmatch(check); m != nil {
+		return "status" + m[2] + m[1]
+	}
+	if m := statusInCheck.FindStringSubmatch(check); m != nil {
+		codes := strings.Split(m[1], ",")
+		sort.Strings(codes)
+		return "status in [" + strings.Join(codes, ",") + "]"
+	}
+	if m := bodyContains.FindStringSubmatch(check); m != nil {
+		return "body " + contains(m[1]) + " " + m[2]
+	}
+	if m := bodyMatches.FindStringSubmatch(check); m != nil {
+		return "body matches " + m[1]
+	}
+	if m := headerContains.FindStringSubmatch(check); m != nil {
+		return header(m[1]) + " " + contains(m[2]) + " " + m[3]
+	}
+	if m := headerEquals.FindStringSubmatch(check); m != nil {
+		return header(m[1]) + m[2] + m[3]
+	}
+	if m := headerMatches.FindStringSubmatch(check); m != nil {
+		return header(m[2]) + " matches " + m[1]
+	}
+	if m := contentTypeCheck.FindStringSubmatch(check); m != nil {
+		return header(`"content-type"`) + " " + contains(m[1]) + " " + m[2]
+	}
+	return check
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// stderrGuard is shared by the logger and the progress bar.
+var stderrGuard = &lineGuard{w: os.Stderr}
+
+// scanFlags holds the flags shared by every command that scans a PoC corpus:
+// logging, config discovery and the options that shape grouping.
+type scanFlags struct {
+	fs             *flag.FlagSet
+	dir            *string
+	config         *string
+	keep           *string
+	strategy       *string
+	normalize      *string
+	exclude        stringList
+	genericPaths   stringList
+	preferRoots    stringList
+	crossTransport *bool
+	loose          *bool
+	normalizeEOL   *bool
+	fileCase       *string
+	groupBy        *string
+	maxFileSize    byteSize
+	parseTimeout   *time.Duration
+	timeout        *time.Duration
+	maxNodes       *int
+	quiet          *bool
+	verbose        *bool
+	trace          *bool
+	logFormat      *string
+	remoteCache    *string
+
+	cfgPath string
+	cfg     *fileConfig
+}
+
+func registerScanFlags(fs *flag.FlagSet) *scanFlags {
+	f := &scanFlags{fs: fs}
+	f.dir = fs.String("dir", ".", "Directory containing xray PoCs, or a remote share: sftp://[user@]host[:port]/path, webdav://host/path or webdavs://host/path")
+	f.remoteCache = fs.String("remote-cache", "", "Local mirror of a remote -dir (default: under the user cache directory)")
+	f.quiet = fs.Bool("quiet", false, "Suppress the human-readable report and all log output below errors")
+	f.verbose = fs.Bool("v", false, "Verbose logging (debug level)")
+	f.trace = fs.Bool("vv", false, "Very verbose logging (trace level)")
+	f.logFormat = fs.String("log-format", logFormatText, "Log format on stderr: text or json")
+	f.config = fs.String("config", "", "Config file (default: "+configFileName+" discovered upward from -dir)")
+	f.keep = fs.String("keep", keepNewest, "Keep policy for duplicate groups: newest, oldest, cvss (highest NVD score, needs -nvd) or severity (highest declared severity, then most complete detail)")
+	f.strategy = fs.String("strategy", strategyPath, "Duplicate strategy: path (same request path), hash (identical content) or fingerprint (same requests and response checks)")
+	f.normalize = fs.String("normalize", defaultNormalize, "Path normalizations applied before grouping: comma-separated case, slash, query, tokens, or none")
+	f.crossTransport = fs.Bool("cross-transport", false, "Group PoCs with the same key even when their transport (http, tcp, udp) differs")
+	f.loose = fs.Bool("loose", false, "Take path values from anywhere in a PoC instead of only the rules' requests")
+	f.normalizeEOL = fs.Bool("normalize-eol", false, "Treat CRLF like LF: hash string values without CR and write LF line endings in fmt and -out exports")
+	f.fileCase = fs.String("file-case", fileCaseAuto, "Compare PoC file paths (excludes, ignore files, baseline, export) case-sensitively or not: auto (insensitive on Windows), sensitive or insensitive")
+	f.groupBy = fs.String("group-by", "", "Comma-separated YAML paths whose values form the duplicate key, e.g. rules.*.request.path,rules.*.request.method (overrides -strategy)")
+	f.timeout = new(time.Duration)
+	f.maxFileSize = defaultMaxFileSize
+	fs.Var(&f.maxFileSize, "max-file-size", "Skip PoC files larger than this, e.g. 512KB or 4MiB (0 disables the limit)")
+	f.parseTimeout = fs.Duration("parse-timeout", defaultParseTimeout, "Skip a PoC file whose parsing takes longer than this (0 disables the limit)")
+	f.maxNodes = fs.Int("max-nodes", defaultMaxNodes, "Skip a PoC whose YAML aliases expand to more than this many nodes (0 disables the limit)")
+	fs.Var(&f.exclude, "exclude", "Exclude files or directories matching the pattern (repeatable)")
+	fs.Var(&f.preferRoots, "prefer-root", "Directory under -dir whose PoCs are kept over their duplicates elsewhere, whatever -keep says (repeatable or comma-separated; earlier ones win)")
+	fs.Var(&f.genericPaths, "generic-path", "Request path too common to group on, compared by content instead (repeatable; adds to the built-in list, none drops it)")
+	return f
+}
+
+// registerTimeout adds -timeout for the commands whose scans and exports it
+// bounds; check has a -timeout of its own for each xray run.
+func (f *scanFlags) registerTimeout() {
+	f.timeout = f.fs.Duration("timeout", 0, "Give up a scan, an export or a remote sync that takes longer than this (0 disables the limit)")
+}
+
+// setup installs the logger, applies the config file and returns the scan
+// options. It must be called after the flag set has been parsed.
+func (f *scanFlags) setup() (scanOptions, error) {
+	logger, err := newLogger(stderrGuard, *f.logFormat, logLevel(*f.quiet, *f.verbose, *f.trace))
+	if err != nil {
+		return scanOptions{}, err
+	}
+	slog.SetDefault(logger)
+
+	// A remote -dir is mirrored first so its own config and ignore files
+	// apply as they would to a local directory.
+	dir := *f.dir
+	var remote *remoteSource
+	if isRemoteDir(dir) {
+		if remote, err = openRemoteSource(dir, *f.remoteCache); err != nil {
+			return scanOptions{}, fmt.Errorf("invalid -dir: %w", err)
+		}
+		ctx, cancel := f.operation(context.Background())
+		err := remote.sync(ctx)
+		cancel()
+		if err != nil {
+			return scanOptions{}, err
+		}
+		dir = remote.cache
+	}
+
+	if f.cfgPath, err = resolveConfigPath(*f.config, dir); err != nil {
+		return scanOptions{}, fmt.Errorf("locating config: %w", err)
+	}
+	if f.cfgPath != "" {
+		slog.Debug("using config", "config", f.cfgPath)
+		if f.cfg, err = loadConfig(f.cfgPath); err != nil {
+			return scanOptions{}, fmt.Errorf("loading config %s: %w", f.cfgPath, err)
+		}
+		if err := applyConfig(f.fs, f.cfg); err != nil {
+			return scanOptions{}, fmt.Errorf("applying config %s: %w", f.cfgPath, err)
+		}
+	}
+
+	opts := scanOptions{
+		Root:           dir,
+		Remote:         remote,
+		Strategy:       strings.ToLower(strings.TrimSpace(*f.strategy)),
+		Keep:           strings.ToLower(strings.TrimSpace(*f.keep)),
+		Excludes:       f.exclude,
+		CrossTransport: *f.crossTransport,
+		Loose:          *f.loose,
+		NormalizeEOL:   *f.normalizeEOL,
+		MaxFileSize:    int64(f.maxFileSize),
+		ParseTimeout:   *f.parseTimeout,
+		MaxNodes:       *f.maxNodes,
+	}
+	if foldFileCase, err = parseFileCase(*f.fileCase); err != nil {
+		return scanOptions{}, fmt.Errorf("invalid -file-case: %w", err)
+	}
+	if opts.Normalize, err = parseNormalize(*f.normalize); err != nil {
+		return scanOptions{}, fmt.Errorf("invalid -normalize: %w", err)
+	}
+	opts.GenericPaths = parseGenericPaths(f.genericPaths, opts.Normalize)
+	for _, value := range f.preferRoots {
+		for _, dir := range strings.Split(value, ",") {
+			if strings.TrimSpace(dir) != "" {
+				opts.PreferRoots = append(opts.PreferRoots, cleanOverridePath(filepath.ToSlash(dir)))
+			}
+		}
+	}
+	if *f.groupBy != "" {
+		if opts.Strategy == strategyHash || opts.Strategy == strategyFingerprint {
+			return scanOptions{}, fmt.Errorf("-group-by cannot be combined with -strategy %s", opts.Strategy)
+		}
+		if opts.GroupBy, err = parseGroupBy(*f.groupBy); err != nil {
+			return scanOptions{}, fmt.Errorf("invalid -group-by: %w", err)
+		}
+		opts.Strategy = strategyFields
+	}
+	if f.cfg != nil {
+		if opts.Overrides, err = rebaseOverrides(f.cfgPath, opts.Root, f.cfg.Overrides); err != nil {
+			return scanOptions{}, fmt.Errorf("applying config %s: %w", f.cfgPath, err)
+		}
+	}
+	if err := opts.validate(); err != nil {
+		return scanOptions{}, err
+	}
+	return opts, nil
+}
+
+// operation returns the context of one long-running step (a scan, an
+// export, a remote sync) derived from parent. It is cancelled after -timeout
+// or on SIGINT or SIGTERM, which stop the step instead of the process until
+// cancel is called; context.Cause tells which.
+func (f *scanFlags) operation(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			cancel(fmt.Errorf("stopped by %s", sig))
+		case <-ctx.Done():
+		}
+	}()
+	stop := func() {
+		signal.Stop(signals)
+		cancel(context.Canceled)
+	}
+	if *f.timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancelTimeout := context.WithTimeoutCause(ctx, *f.timeout, fmt.Errorf("-timeout %s exceeded", *f.timeout))
+	return ctx, func() {
+		cancelTimeout()
+		stop()
+	}
+}
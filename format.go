@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const formatIndent = 2
+
+// canonicalKeyOrder is the order fmt gives the top-level PoC keys. Keys not
+// listed keep their relative order after the known ones.
+var canonicalKeyOrder = []string{"name", "transport", "set", "rules", "expression", "detail"}
+
+const fmtUsage = `
+Usage:
+  go run . fmt -dir <path-to-pocs> [-l] [-d]
+
+Rewrites PoC files in place into the canonical style: consistent indentation
+and top-level keys ordered as ` + "name, transport, set, rules, expression, detail" + `.
+Each file keeps its format and indentation width (2 spaces when it has none).
+Comments are preserved. JSON PoCs are re-indented as JSON with the same key order.
+Files saved as UTF-8 with a BOM, UTF-16 or GBK are rewritten as plain UTF-8.
+
+Flags:
+`
+
+func runFmt(args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	listFlag := fs.Bool("l", false, "List files whose formatting differs from the canonical style; do not rewrite them")
+	diffFlag := fs.Bool("d", false, "Print a diff of the formatting changes; do not rewrite files")
+	lockWaitFlag := fs.Duration("lock-wait", 0, lockWaitUsage)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(fmtUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	write := !*listFlag && !*diffFlag
+	if write {
+		unlock, err := lockRoot(opts, *lockWaitFlag)
+		if err != nil {
+			slog.Error("cannot lock -dir", "err", err)
+			return exitError
+		}
+		defer unlock()
+	}
+
+	changed, failed := 0, 0
+	err = walkPoCFiles(opts, func(path string) error {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		text, _, err := decodePoC(raw)
+		if err != nil {
+			slog.Warn("skipping file", "file", path, "err", err)
+			failed++
+			return nil
+		}
+		layout := detectLayout(path, text)
+		if opts.NormalizeEOL {
+			layout.crlf = false
+		}
+		format := formatPoC
+		if layout.json {
+			format = formatJSONPoC
+		}
+		formatted, err := format(text, layout)
+		if err != nil {
+			slog.Warn("skipping file", "file", path, "err", err)
+			failed++
+			return nil
+		}
+		if bytes.Equal(raw, formatted) {
+			return nil
+		}
+		changed++
+		if *listFlag {
+			fmt.Println(path)
+		}
+		if *diffFlag {
+			fmt.Print(unifiedDiff(path+".orig", path, splitLines(string(text)), splitLines(string(formatted))))
+		}
+		if write {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, formatted, info.Mode().Perm()); err != nil {
+				return fmt.Errorf("write %s: %w", path, err)
+			}
+			slog.Info("formatted", "file", path)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("formatting PoCs", "err", err)
+		return exitError
+	}
+	if failed > 0 || (!write && changed > 0) {
+		return exitInvalid
+	}
+	return exitOK
+}
+
+// formatPoC re-encodes a YAML PoC in the canonical style, indented as
+// layout says. The result is checked to decode to the same data as the
+// input, so formatting can never change what xray loads.
+func formatPoC(raw []byte, layout pocLayout) ([]byte, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	var doc yaml.Node
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	var extra yaml.Node
+	if err := dec.Decode(&extra); !errors.Is(err, io.EOF) {
+		return nil, errors.New("multi-document files are not supported")
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("top level is not a mapping")
+	}
+	mapping := doc.Content[0]
+	if len(mapping.Content) > 0 && mapping.Content[0].HeadComment != "" {
+		// A comment at the top of the file belongs to the file, not to
+		// whichever key happens to come first.
+		doc.HeadComment = strings.TrimSpace(doc.HeadComment + "\n" + mapping.Content[0].HeadComment)
+		mapping.Content[0].HeadComment = ""
+	}
+	reorderKeys(mapping, canonicalKeyOrder)
+	formatted, err := layout.encode(&doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var before, after any
+	if err := yaml.Unmarshal(raw, &before); err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(formatted, &after); err != nil {
+		return nil, fmt.Errorf("formatted document does not parse: %w", err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		return nil, errors.New("formatting would change the document's content")
+	}
+	return formatted, nil
+}
+
+// formatJSONPoC is formatPoC for JSON files: the output stays JSON, indented
+// as layout says, with the top-level keys in canonical order.
+func formatJSONPoC(raw []byte, layout pocLayout) ([]byte, error) {
+	doc, err := parseJSONDocument(raw)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("top level is not an object")
+	}
+	reorderKeys(doc.Content[0], canonicalKeyOrder)
+	formatted, err := layout.encode(&doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var before, after any
+	for _, v := range []struct {
+		src []byte
+		dst *any
+	}{{raw, &before}, {formatted, &after}} {
+		dec := json.NewDecoder(bytes.NewReader(v.src))
+		dec.UseNumber()
+		if err := dec.Decode(v.dst); err != nil {
+			return nil, err
+		}
+	}
+	if !reflect.DeepEqual(before, after) {
+		return nil, errors.New("formatting would change the document's content")
+	}
+	return formatted, nil
+}
+
+// reorderKeys sorts a mapping's key/value pairs so the keys in order come
+// first, in that order. Other pairs keep their original relative order.
+func reorderKeys(mapping *yaml.Node, order []string) {
+	rank := make(map[string]int, len(order))
+	for i, key := range order {
+		rank[key] = i
+	}
+	type pair struct{ key, value *yaml.Node }
+	known := make([][]pair, len(order))
+	var rest []pair
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		p := pair{mapping.Content[i], mapping.Content[i+1]}
+		if r, ok := rank[p.key.Value]; ok {
+			known[r] = append(known[r], p)
+		} else {
+			rest = append(rest, p)
+		}
+	}
+	content := mapping.Content[:0:0]
+	for _, pairs := range known {
+		for _, p := range pairs {
+			content = append(content, p.key, p.value)
+		}
+	}
+	for _, p := range rest {
+		content = append(content, p.key, p.value)
+	}
+	mapping.Content = content
+}
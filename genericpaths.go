@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// defaultGenericPaths are request paths so common that sharing one says
+// nothing about two PoCs: the landing, login and admin pages that countless
+// unrelated checks request. Grouping on them builds huge false duplicate
+// groups, so under -strategy path they are compared by content instead.
+var defaultGenericPaths = []string{
+	"/",
+	"/index.php", "/index.html", "/index.htm", "/index.jsp", "/index.asp", "/index.aspx", "/default.aspx",
+	"/login", "/login.php", "/login.jsp", "/login.html", "/login.do", "/login.action",
+	"/admin", "/admin.php", "/admin/index.php",
+	"/robots.txt", "/favicon.ico",
+}
+
+// genericPathKeyPrefix starts the key of a generic path, which is followed
+// by the canonical content hash of the PoC, as in generic-path:/login:sha256:….
+const genericPathKeyPrefix = "generic-path:"
+
+// parseGenericPaths returns the generic paths, normalized with n: the
+// built-in ones and extra, or extra alone when it lists none.
+func parseGenericPaths(extra []string, n pathNormalizer) map[string]bool {
+	paths := make(map[string]bool)
+	builtin := true
+	for _, p := range extra {
+		if p = strings.TrimSpace(p); strings.EqualFold(p, normalizeNone) {
+			builtin = false
+		} else if p != "" {
+			paths[n.apply(p)] = true
+		}
+	}
+	if builtin {
+		for _, p := range defaultGenericPaths {
+			paths[n.apply(p)] = true
+		}
+	}
+	return paths
+}
+
+// genericPathKey is the grouping key of a PoC requesting the generic path
+// key: only copies of the same content share it.
+func genericPathKey(key, hash string) string {
+	return genericPathKeyPrefix + key + ":sha256:" + hash
+}
+
+// sortedPaths lists a set of paths in order, for fingerprints and logs.
+func sortedPaths(paths map[string]bool) []string {
+	list := make([]string, 0, len(paths))
+	for p := range paths {
+		list = append(list, p)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitRepo commits the changes a run makes under the scanned directory.
+type gitRepo struct {
+	root string
+	// branch is set when the changes go to a pull request branch.
+	branch    string
+	committed bool
+}
+
+func git(dir string, stdin []byte, args ...string) (string, error) {
+	return gitWith(dir, nil, stdin, args...)
+}
+
+// gitWith runs git with extra environment variables.
+func gitWith(dir string, env []string, stdin []byte, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// openGitRepo checks that root is inside a git work tree without pending
+// changes, so the commit made later contains only what this run changed.
+func openGitRepo(root string) (*gitRepo, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if out, err := git(abs, nil, "rev-parse", "--is-inside-work-tree"); err != nil || strings.TrimSpace(out) != "true" {
+		return nil, fmt.Errorf("%s is not inside a git work tree", root)
+	}
+	status, err := git(abs, nil, "status", "--porcelain", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(status) != "" {
+		return nil, fmt.Errorf("%s has uncommitted changes; commit or stash them first", root)
+	}
+	return &gitRepo{root: abs}, nil
+}
+
+// startBranch switches to a new branch for this run's changes and returns
+// the ref to go back to.
+func (r *gitRepo) startBranch(name string) (string, error) {
+	prev, err := git(r.root, nil, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	prev = strings.TrimSpace(prev)
+	if prev == "HEAD" {
+		// Detached: go back to the commit itself.
+		if prev, err = git(r.root, nil, "rev-parse", "HEAD"); err != nil {
+			return "", err
+		}
+		prev = strings.TrimSpace(prev)
+	}
+	if _, err := git(r.root, nil, "checkout", "-q", "-b", name); err != nil {
+		return "", err
+	}
+	return prev, nil
+}
+
+// leaveBranch returns to prev, deleting branch unless it holds a commit.
+// Changes under the root that were not committed, such as deletions of a
+// run that failed, are discarded first so they do not follow onto prev;
+// the root was clean when the branch was started.
+func (r *gitRepo) leaveBranch(prev, branch string, keep bool) error {
+	if !keep {
+		status, err := git(r.root, nil, "status", "--porcelain", "--", ".")
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(status) != "" {
+			slog.Warn("discarding uncommitted changes", "dir", r.root, "branch", branch)
+			for _, args := range [][]string{
+				{"reset", "-q", "--", "."},
+				{"checkout", "-q", "--", "."},
+				{"clean", "-q", "-f", "-d", "--", "."},
+			} {
+				if _, err := git(r.root, nil, args...); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if _, err := git(r.root, nil, "checkout", "-q", prev); err != nil {
+		return err
+	}
+	if keep {
+		return nil
+	}
+	_, err := git(r.root, nil, "branch", "-q", "-D", branch)
+	return err
+}
+
+// commit stages every change under the root and commits it. It reports
+// false when the run changed nothing.
+func (r *gitRepo) commit(message string) (bool, error) {
+	if _, err := git(r.root, nil, "add", "-A", "--", "."); err != nil {
+		return false, err
+	}
+	if _, err := git(r.root, nil, "diff", "--cached", "--quiet"); err == nil {
+		return false, nil
+	}
+	if _, err := git(r.root, []byte(message), "commit", "-q", "-F", "-"); err != nil {
+		return false, err
+	}
+	r.committed = true
+	return true, nil
+}
+
+// dedupeCommitMessage describes what a run removed and renamed, and why.
+func dedupeCommitMessage(opts scanOptions, kept string, groups []duplicateGroup, deleted []string, marked, renamed, rulesRemoved, transcoded int) string {
+	var parts []string
+	if len(deleted) > 0 {
+		parts = append(parts, fmt.Sprintf("remove %d duplicate PoCs", len(deleted)))
+	}
+	if marked > 0 {
+		parts = append(parts, fmt.Sprintf("mark %d duplicate PoCs", marked))
+	}
+	if renamed > 0 {
+		parts = append(parts, fmt.Sprintf("rename %d colliding PoCs", renamed))
+	}
+	if rulesRemoved > 0 {
+		parts = append(parts, fmt.Sprintf("drop %d repeated rules", rulesRemoved))
+	}
+	if transcoded > 0 {
+		parts = append(parts, fmt.Sprintf("convert %d PoCs to UTF-8", transcoded))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "update PoCs")
+	}
+	subject := strings.Join(parts, ", ")
+	var b strings.Builder
+	b.WriteString(strings.ToUpper(subject[:1]) + subject[1:] + "\n")
+	if len(deleted) > 0 {
+		fmt.Fprintf(&b, "\nKept the %s PoC of each duplicate group (strategy: %s).\n\nRemoved:\n", kept, opts.Strategy)
+		gone := make(map[string]bool, len(deleted))
+		for _, unit := range deleted {
+			gone[unit] = true
+		}
+		for _, group := range groups {
+			for _, entry := range group.Entries[1:] {
+				if !gone[entry.unit()] {
+					continue
+				}
+				delete(gone, entry.unit())
+				fmt.Fprintf(&b, "- %s (duplicate of %s, %s)\n",
+					relativeTo(opts.Root, entry.unit()), relativeTo(opts.Root, group.Entries[0].unit()), group.Key)
+			}
+		}
+	}
+	return b.String()
+}
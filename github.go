@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultGitHubAPI = "https://api.github.com"
+
+	// forkAuto makes -github-fork use the token owner's fork, creating it
+	// when there is none.
+	forkAuto = "auto"
+)
+
+// githubClient opens pull requests through the GitHub REST API.
+type githubClient struct {
+	api  string
+	repo string
+	// fork is where the branch is pushed: "" for repo itself, owner/name or
+	// forkAuto.
+	fork  string
+	token string
+	http  *http.Client
+}
+
+func checkRepoName(repo string) error {
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("repository %q: want owner/name", repo)
+	}
+	return nil
+}
+
+func newGitHubClient(repo, fork, token string) (*githubClient, error) {
+	if err := checkRepoName(repo); err != nil {
+		return nil, err
+	}
+	if fork != "" && fork != forkAuto {
+		if err := checkRepoName(fork); err != nil {
+			return nil, fmt.Errorf("fork: %w", err)
+		}
+	}
+	if token == "" {
+		return nil, errors.New("a token is required (-github-token or $GITHUB_TOKEN)")
+	}
+	api := os.Getenv("GITHUB_API_URL")
+	if api == "" {
+		api = defaultGitHubAPI
+	}
+	return &githubClient{
+		api:   strings.TrimSuffix(api, "/"),
+		repo:  repo,
+		fork:  fork,
+		token: token,
+		http:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (c *githubClient) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.api+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("GitHub %s %s: %s %s", method, path, resp.Status, apiErr.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode GitHub response: %w", err)
+	}
+	return nil
+}
+
+func (c *githubClient) defaultBranch(ctx context.Context) (string, error) {
+	var repo struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/repos/"+c.repo, nil, &repo); err != nil {
+		return "", err
+	}
+	return repo.DefaultBranch, nil
+}
+
+func (c *githubClient) createPullRequest(ctx context.Context, title, body, head, base string) (string, error) {
+	in := map[string]string{"title": title, "body": body, "head": head, "base": base}
+	var pr struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/repos/"+c.repo+"/pulls", in, &pr); err != nil {
+		return "", err
+	}
+	return pr.HTMLURL, nil
+}
+
+// createFork forks the repository into the token owner's account and
+// returns the fork's owner/name. GitHub returns the existing fork when there
+// already is one.
+func (c *githubClient) createFork(ctx context.Context) (string, error) {
+	var fork struct {
+		FullName string `json:"full_name"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/repos/"+c.repo+"/forks", map[string]any{}, &fork); err != nil {
+		return "", err
+	}
+	if fork.FullName == "" {
+		return "", errors.New("GitHub did not name the fork")
+	}
+	return fork.FullName, nil
+}
+
+// remoteURL is the git remote of repo on the API's host.
+func (c *githubClient) remoteURL(repo string) string {
+	if c.api == defaultGitHubAPI {
+		return "https://github.com/" + repo + ".git"
+	}
+	// GitHub Enterprise serves the API under <host>/api/v3.
+	return strings.TrimSuffix(c.api, "/api/v3") + "/" + repo + ".git"
+}
+
+// pushEnv passes the token to git through the environment rather than the
+// command line, where other users could read it.
+func (c *githubClient) pushEnv() []string {
+	auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + c.token))
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + auth,
+		"GIT_TERMINAL_PROMPT=0",
+	}
+}
+
+// openPullRequest pushes the current branch, to the fork if there is one,
+// and opens a pull request for it on the repository.
+func (c *githubClient) openPullRequest(repo *gitRepo, branch, base, message string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if base == "" {
+		var err error
+		if base, err = c.defaultBranch(ctx); err != nil {
+			return "", err
+		}
+	}
+	target, head := c.repo, branch
+	if c.fork != "" {
+		target = c.fork
+		if c.fork == forkAuto {
+			var err error
+			if target, err = c.createFork(ctx); err != nil {
+				return "", fmt.Errorf("forking %s: %w", c.repo, err)
+			}
+		}
+		owner, _, _ := strings.Cut(target, "/")
+		head = owner + ":" + branch
+	}
+	push := func() error {
+		_, err := gitWith(repo.root, c.pushEnv(), nil, "push", "-q", c.remoteURL(target), "HEAD:refs/heads/"+branch)
+		return err
+	}
+	err := push()
+	// A fork created just now takes a few seconds to accept pushes.
+	for attempt := 1; err != nil && c.fork == forkAuto && attempt < 10; attempt++ {
+		slog.Debug("fork not ready, retrying push", "fork", target, "err", err)
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-time.After(3 * time.Second):
+		}
+		err = push()
+	}
+	if err != nil {
+		return "", err
+	}
+	title, body, _ := strings.Cut(message, "\n")
+	body = strings.TrimSpace(body) + "\n\nGenerated by repeaterxraypoc " + toolVersion() + ".\n"
+	return c.createPullRequest(ctx, title, body, head, base)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// strategyFields groups by the fields listed in -group-by.
+const strategyFields = "fields"
+
+// groupField is one dot-separated path of a -group-by list. A `*` segment
+// matches every value of a mapping or every item of a sequence, a number
+// indexes a sequence and other segments name a mapping key.
+type groupField struct {
+	Spec     string
+	Segments []string
+}
+
+func parseGroupBy(value string) ([]groupField, error) {
+	var fields []groupField
+	for _, spec := range strings.Split(value, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		segments := strings.Split(spec, ".")
+		for _, segment := range segments {
+			if strings.TrimSpace(segment) == "" {
+				return nil, fmt.Errorf("field %q: empty path segment", spec)
+			}
+		}
+		fields = append(fields, groupField{Spec: spec, Segments: segments})
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("no fields given")
+	}
+	return fields, nil
+}
+
+// values returns the sorted, distinct values the field resolves to. Mappings
+// and sequences are rendered as JSON so structured fields such as headers can
+// be compared too.
+func (f groupField) values(doc *yaml.Node, normalize pathNormalizer) ([]string, error) {
+	nodes := doc.Content
+	for _, segment := range f.Segments {
+		var next []*yaml.Node
+		for _, n := range nodes {
+			next = append(next, fieldChildren(n, segment)...)
+		}
+		nodes = next
+	}
+	isPath := strings.EqualFold(f.Segments[len(f.Segments)-1], "path")
+	var out []string
+	for _, n := range nodes {
+		if n.Kind == yaml.AliasNode {
+			n = n.Alias
+		}
+		value := strings.TrimSpace(n.Value)
+		if n.Kind != yaml.ScalarNode {
+			var decoded any
+			if err := n.Decode(&decoded); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Spec, err)
+			}
+			raw, err := json.Marshal(decoded)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Spec, err)
+			}
+			value = string(raw)
+		} else if isPath {
+			value = normalize.apply(value)
+		}
+		if value != "" {
+			out = appendUnique(out, value)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func fieldChildren(n *yaml.Node, segment string) []*yaml.Node {
+	switch n.Kind {
+	case yaml.MappingNode:
+		if segment == "*" {
+			var out []*yaml.Node
+			for i := 1; i < len(n.Content); i += 2 {
+				out = append(out, n.Content[i])
+			}
+			return out
+		}
+		if v := mappingValue(n, segment); v != nil {
+			return []*yaml.Node{v}
+		}
+	case yaml.SequenceNode:
+		if segment == "*" {
+			return n.Content
+		}
+		if i, err := strconv.Atoi(segment); err == nil && i >= 0 && i < len(n.Content) {
+			return []*yaml.Node{n.Content[i]}
+		}
+	case yaml.AliasNode:
+		return fieldChildren(n.Alias, segment)
+	}
+	return nil
+}
+
+// groupByKey builds the grouping key as field=value pairs in -group-by order.
+func groupByKey(fields []groupField, doc *yaml.Node, normalize pathNormalizer) (string, error) {
+	parts := make([]string, len(fields))
+	found := false
+	for i, f := range fields {
+		values, err := f.values(doc, normalize)
+		if err != nil {
+			return "", err
+		}
+		found = found || len(values) > 0
+		parts[i] = f.Spec + "=" + strings.Join(values, ",")
+	}
+	if !found {
+		return "", errors.New("none of the -group-by fields is set")
+	}
+	return strings.Join(parts, " "), nil
+}
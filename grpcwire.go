@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The gRPC protocol over the standard library's HTTP/2 server: a request
+// and a response are each one length-prefixed protobuf message, and the
+// status travels in the grpc-status and grpc-message trailers. Messages are
+// encoded by hand; the service is small enough not to need generated code.
+
+// gRPC status codes.
+const (
+	grpcOK                 = 0
+	grpcInvalidArgument    = 3
+	grpcPermissionDenied   = 7
+	grpcFailedPrecondition = 9
+	grpcAborted            = 10
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnauthenticated    = 16
+)
+
+// maxGRPCMessage bounds a request message; plans are the largest.
+const maxGRPCMessage = 64 << 20
+
+// grpcError is an error with the status an RPC returns for it.
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string { return e.msg }
+
+func grpcErrorf(code int, format string, args ...any) error {
+	return &grpcError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// grpcMethod handles one unary RPC: the request message in, the response
+// message out.
+type grpcMethod func(r *http.Request, req []byte) ([]byte, error)
+
+// grpcHandler serves the methods, keyed by their /package.Service/Method
+// path.
+type grpcHandler map[string]grpcMethod
+
+func (h grpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	resp, err := h.call(r)
+	code := grpcOK
+	if err == nil {
+		frame := make([]byte, 5, 5+len(resp))
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(resp)))
+		_, err = w.Write(append(frame, resp...))
+		if err != nil {
+			return
+		}
+	} else {
+		code = grpcInternal
+		var ge *grpcError
+		if errors.As(err, &ge) {
+			code = ge.code
+		}
+		w.Header().Set("Grpc-Message", grpcPercentEncode(err.Error()))
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+}
+
+func (h grpcHandler) call(r *http.Request) ([]byte, error) {
+	method := h[r.URL.Path]
+	if method == nil {
+		return nil, grpcErrorf(grpcUnimplemented, "unknown method %s", r.URL.Path)
+	}
+	var prefix [5]byte
+	if _, err := io.ReadFull(r.Body, prefix[:]); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "reading request: %v", err)
+	}
+	if prefix[0] != 0 {
+		return nil, grpcErrorf(grpcUnimplemented, "compressed requests are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxGRPCMessage {
+		return nil, grpcErrorf(grpcInvalidArgument, "request of %d bytes is too large", size)
+	}
+	req := make([]byte, size)
+	if _, err := io.ReadFull(r.Body, req); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "reading request: %v", err)
+	}
+	return method(r, req)
+}
+
+// grpcPercentEncode escapes a status message as grpc-message requires.
+func grpcPercentEncode(msg string) string {
+	return strings.ReplaceAll(url.QueryEscape(msg), "+", "%20")
+}
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// protoWriter appends the fields of a protobuf message. As in proto3, zero
+// scalars are left out.
+type protoWriter struct {
+	buf []byte
+}
+
+func (w *protoWriter) tag(field, wire int) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field)<<3|uint64(wire))
+}
+
+func (w *protoWriter) int64(field int, v int64) {
+	if v != 0 {
+		w.tag(field, wireVarint)
+		w.buf = binary.AppendUvarint(w.buf, uint64(v))
+	}
+}
+
+func (w *protoWriter) bool(field int, v bool) {
+	if v {
+		w.int64(field, 1)
+	}
+}
+
+func (w *protoWriter) double(field int, v float64) {
+	if v != 0 {
+		w.tag(field, wireFixed64)
+		w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(v))
+	}
+}
+
+func (w *protoWriter) bytes(field int, b []byte) {
+	if len(b) > 0 {
+		w.message(field, b)
+	}
+}
+
+func (w *protoWriter) string(field int, s string) {
+	w.bytes(field, []byte(s))
+}
+
+// packed writes a repeated integer field in the packed encoding of proto3.
+func (w *protoWriter) packed(field int, vs []int) {
+	var p []byte
+	for _, v := range vs {
+		p = binary.AppendUvarint(p, uint64(v))
+	}
+	w.bytes(field, p)
+}
+
+// message writes an embedded message, or an element of a repeated field,
+// even when empty.
+func (w *protoWriter) message(field int, m []byte) {
+	w.tag(field, wireBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(m)))
+	w.buf = append(w.buf, m...)
+}
+
+// protoField is one field read from a message: its number and its value,
+// in value for the varint and fixed wire types and in data for the others.
+type protoField struct {
+	num   int
+	wire  int
+	value uint64
+	data  []byte
+}
+
+func (f protoField) double() float64 {
+	if f.wire != wireFixed64 {
+		return 0
+	}
+	return math.Float64frombits(f.value)
+}
+
+// varints returns the values of an element of a repeated integer field,
+// which parsers must accept both packed and unpacked.
+func (f protoField) varints() ([]uint64, error) {
+	if f.wire == wireVarint {
+		return []uint64{f.value}, nil
+	}
+	if f.wire != wireBytes {
+		return nil, fmt.Errorf("malformed protobuf: field %d is not an integer", f.num)
+	}
+	var vs []uint64
+	for raw := f.data; len(raw) > 0; {
+		v, n := binary.Uvarint(raw)
+		if n <= 0 {
+			return nil, errors.New("malformed protobuf: bad varint")
+		}
+		vs = append(vs, v)
+		raw = raw[n:]
+	}
+	return vs, nil
+}
+
+// readProto calls fn for each field of the message raw, in order.
+func readProto(raw []byte, fn func(f protoField) error) error {
+	for len(raw) > 0 {
+		key, n := binary.Uvarint(raw)
+		if n <= 0 {
+			return errors.New("malformed protobuf: bad field key")
+		}
+		raw = raw[n:]
+		f := protoField{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			if f.value, n = binary.Uvarint(raw); n <= 0 {
+				return errors.New("malformed protobuf: bad varint")
+			}
+		case wireFixed64:
+			if n = 8; len(raw) < n {
+				return errors.New("malformed protobuf: short fixed64")
+			}
+			f.value = binary.LittleEndian.Uint64(raw)
+		case wireFixed32:
+			if n = 4; len(raw) < n {
+				return errors.New("malformed protobuf: short fixed32")
+			}
+			f.value = uint64(binary.LittleEndian.Uint32(raw))
+		case wireBytes:
+			size, m := binary.Uvarint(raw)
+			if m <= 0 || size > uint64(len(raw)-m) {
+				return errors.New("malformed protobuf: bad length")
+			}
+			f.data, n = raw[m:m+int(size)], m+int(size)
+		default:
+			return fmt.Errorf("malformed protobuf: unsupported wire type %d", f.wire)
+		}
+		raw = raw[n:]
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const historyUsage = `
+Usage:
+  go run . history [-dir <path-to-pocs>] [-last N] [-format text|json] <history-file>
+
+Lists the scans recorded with -history, oldest first: corpus size, duplicate
+groups, redundant PoCs, reclaimable bytes, parse errors and deletions.
+
+Flags:
+`
+
+const trendUsage = `
+Usage:
+  go run . trend [-dir <path-to-pocs>] [-last N] [-format text|json] <history-file>
+
+Summarizes how the metrics recorded with -history evolved: the first and
+last value of each, the change between them and a sparkline of every run.
+
+Flags:
+`
+
+// historySnapshot is one scan recorded with -history. Duplicate counts
+// include the groups a baseline suppresses, so cleanup shows in the trend
+// even for accepted duplicates.
+type historySnapshot struct {
+	Time            time.Time `json:"time"`
+	ToolVersion     string    `json:"tool_version,omitempty"`
+	Root            string    `json:"root"`
+	Strategy        string    `json:"strategy"`
+	Files           int       `json:"files"`
+	PoCs            int       `json:"pocs"`
+	Bytes           int64     `json:"bytes"`
+	DuplicateGroups int       `json:"duplicate_groups"`
+	Duplicates      int       `json:"duplicates"`
+	Reclaimable     int64     `json:"reclaimable_bytes"`
+	NameCollisions  int       `json:"name_collisions"`
+	ParseErrors     int       `json:"parse_errors"`
+	Deleted         int       `json:"deleted"`
+}
+
+func newHistorySnapshot(opts scanOptions, corpus *pocCorpus, duplicates []duplicateGroup, collisions, deleted int) historySnapshot {
+	root, err := filepath.Abs(opts.Root)
+	if err != nil {
+		root = opts.Root
+	}
+	s := historySnapshot{
+		Time:            time.Now().UTC().Truncate(time.Second),
+		ToolVersion:     toolVersion(),
+		Root:            root,
+		Strategy:        opts.Strategy,
+		PoCs:            len(corpus.units),
+		DuplicateGroups: len(duplicates),
+		Duplicates:      len(deletionUnits(duplicates)),
+		NameCollisions:  collisions,
+		ParseErrors:     len(corpus.skipped),
+		Deleted:         deleted,
+	}
+	files := make(map[string]bool)
+	for _, unit := range corpus.units {
+		files[unit.FilePath] = true
+		s.Bytes += unit.Size
+	}
+	s.Files = len(files)
+	counted := make(map[string]bool)
+	for _, group := range duplicates {
+		s.Reclaimable += reclaimableBytes(group.Entries, counted)
+	}
+	return s
+}
+
+// appendHistory adds a snapshot to the history file, one JSON object per
+// line, so concurrent runs and partial writes never corrupt earlier runs.
+func appendHistory(path string, s historySnapshot) error {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(raw, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadHistory reads the snapshots of root (all of them when root is empty),
+// keeping the last n when n > 0. Unreadable lines are skipped.
+func loadHistory(path, root string, n int) ([]historySnapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if root != "" {
+		if root, err = filepath.Abs(root); err != nil {
+			return nil, err
+		}
+	}
+	var snapshots []historySnapshot
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var s historySnapshot
+		if err := json.Unmarshal([]byte(text), &s); err != nil {
+			slog.Warn("skipping unreadable history entry", "file", path, "line", line, "err", err)
+			continue
+		}
+		if root == "" || s.Root == root {
+			snapshots = append(snapshots, s)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	if n > 0 && len(snapshots) > n {
+		snapshots = snapshots[len(snapshots)-n:]
+	}
+	return snapshots, nil
+}
+
+type historyFlags struct {
+	fs      *flag.FlagSet
+	dir     *string
+	last    *int
+	format  *string
+	quiet   *bool
+	verbose *bool
+}
+
+func registerHistoryFlags(fs *flag.FlagSet, usage string) *historyFlags {
+	f := &historyFlags{fs: fs}
+	f.dir = fs.String("dir", "", "Only show the scans of this directory (default: every directory in the file)")
+	f.last = fs.Int("last", 0, "Only show the last N scans (0 shows all)")
+	f.format = fs.String("format", formatText, "Output format: text or json")
+	f.quiet = fs.Bool("quiet", false, "Only log errors")
+	f.verbose = fs.Bool("v", false, "Verbose logging (debug level)")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(usage, "\n"))
+		fs.PrintDefaults()
+	}
+	return f
+}
+
+// load sets up logging and reads the snapshots the flags select.
+func (f *historyFlags) load(args []string) ([]historySnapshot, string, int) {
+	f.fs.Parse(args)
+	logger, err := newLogger(stderrGuard, logFormatText, logLevel(*f.quiet, *f.verbose, false))
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return nil, "", exitError
+	}
+	slog.SetDefault(logger)
+	format := strings.ToLower(strings.TrimSpace(*f.format))
+	if format != formatText && format != formatJSON {
+		slog.Error("unsupported format (want text or json)", "format", *f.format)
+		return nil, "", exitError
+	}
+	if f.fs.NArg() != 1 {
+		slog.Error("pass exactly one history file")
+		return nil, "", exitUsage
+	}
+	if *f.last < 0 {
+		slog.Error("-last must not be negative")
+		return nil, "", exitUsage
+	}
+	snapshots, err := loadHistory(f.fs.Arg(0), *f.dir, *f.last)
+	if err != nil {
+		slog.Error("loading history", "err", err)
+		return nil, "", exitError
+	}
+	return snapshots, format, exitOK
+}
+
+func runHistory(args []string) int {
+	f := registerHistoryFlags(flag.NewFlagSet("history", flag.ExitOnError), historyUsage)
+	snapshots, format, code := f.load(args)
+	if code != exitOK {
+		return code
+	}
+	if format == formatJSON {
+		if snapshots == nil {
+			snapshots = []historySnapshot{}
+		}
+		return encodeJSON(snapshots)
+	}
+	if len(snapshots) == 0 {
+		fmt.Println("No scans recorded.")
+		return exitOK
+	}
+	fmt.Printf("%-20s  %7s  %7s  %10s  %7s  %10s  %11s  %6s  %7s\n",
+		"TIME", "FILES", "POCS", "SIZE", "GROUPS", "DUPLICATES", "RECLAIMABLE", "ERRORS", "DELETED")
+	for _, s := range snapshots {
+		fmt.Printf("%-20s  %7d  %7d  %10s  %7d  %10d  %11s  %6d  %7d\n",
+			s.Time.Format(time.RFC3339), s.Files, s.PoCs, humanBytes(s.Bytes), s.DuplicateGroups,
+			s.Duplicates, humanBytes(s.Reclaimable), s.ParseErrors, s.Deleted)
+	}
+	return exitOK
+}
+
+// trendMetric is the evolution of one recorded value.
+type trendMetric struct {
+	Name   string  `json:"name"`
+	First  int64   `json:"first"`
+	Last   int64   `json:"last"`
+	Change int64   `json:"change"`
+	Values []int64 `json:"values"`
+}
+
+type trendReport struct {
+	Runs    int           `json:"runs"`
+	From    time.Time     `json:"from"`
+	To      time.Time     `json:"to"`
+	Metrics []trendMetric `json:"metrics"`
+}
+
+func computeTrend(snapshots []historySnapshot) trendReport {
+	t := trendReport{Runs: len(snapshots), From: snapshots[0].Time, To: snapshots[len(snapshots)-1].Time}
+	metrics := []struct {
+		name  string
+		value func(historySnapshot) int64
+	}{
+		{"files", func(s historySnapshot) int64 { return int64(s.Files) }},
+		{"pocs", func(s historySnapshot) int64 { return int64(s.PoCs) }},
+		{"bytes", func(s historySnapshot) int64 { return s.Bytes }},
+		{"duplicate_groups", func(s historySnapshot) int64 { return int64(s.DuplicateGroups) }},
+		{"duplicates", func(s historySnapshot) int64 { return int64(s.Duplicates) }},
+		{"reclaimable_bytes", func(s historySnapshot) int64 { return s.Reclaimable }},
+		{"name_collisions", func(s historySnapshot) int64 { return int64(s.NameCollisions) }},
+		{"parse_errors", func(s historySnapshot) int64 { return int64(s.ParseErrors) }},
+	}
+	for _, m := range metrics {
+		tm := trendMetric{Name: m.name}
+		for _, s := range snapshots {
+			tm.Values = append(tm.Values, m.value(s))
+		}
+		tm.First, tm.Last = tm.Values[0], tm.Values[len(tm.Values)-1]
+		tm.Change = tm.Last - tm.First
+		t.Metrics = append(t.Metrics, tm)
+	}
+	return t
+}
+
+// sparkline draws values as block characters scaled between their minimum
+// and maximum.
+func sparkline(values []int64) string {
+	const blocks = "▁▂▃▄▅▆▇█"
+	levels := []rune(blocks)
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		level := 0
+		if hi > lo {
+			level = int((v - lo) * int64(len(levels)-1) / (hi - lo))
+		}
+		b.WriteRune(levels[level])
+	}
+	return b.String()
+}
+
+func runTrend(args []string) int {
+	f := registerHistoryFlags(flag.NewFlagSet("trend", flag.ExitOnError), trendUsage)
+	snapshots, format, code := f.load(args)
+	if code != exitOK {
+		return code
+	}
+	if len(snapshots) == 0 {
+		slog.Error("no scans recorded", "file", f.fs.Arg(0))
+		return exitError
+	}
+	trend := computeTrend(snapshots)
+	if format == formatJSON {
+		return encodeJSON(trend)
+	}
+	fmt.Printf("%d scans from %s to %s\n\n", trend.Runs, trend.From.Format(time.RFC3339), trend.To.Format(time.RFC3339))
+	fmt.Printf("%-18s  %10s  %10s  %16s  %s\n", "METRIC", "FIRST", "LAST", "CHANGE", "TREND")
+	for _, m := range trend.Metrics {
+		first, last, change := fmt.Sprint(m.First), fmt.Sprint(m.Last), fmt.Sprintf("%+d", m.Change)
+		if strings.HasSuffix(m.Name, "bytes") {
+			first, last = humanBytes(m.First), humanBytes(m.Last)
+			change = "+" + humanBytes(m.Change)
+			if m.Change < 0 {
+				change = "-" + humanBytes(-m.Change)
+			}
+		}
+		if m.First != 0 {
+			change += fmt.Sprintf(" (%+.0f%%)", float64(m.Change)*100/float64(m.First))
+		}
+		fmt.Printf("%-18s  %10s  %10s  %16s  %s\n", m.Name, first, last, change, sparkline(m.Values))
+	}
+	return exitOK
+}
+
+func encodeJSON(v any) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		slog.Error("writing report", "err", err)
+		return exitError
+	}
+	return exitOK
+}
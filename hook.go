@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const hookTimeout = 30 * time.Second
+
+// hookCommand runs a user-supplied command line through the platform shell,
+// so hooks can be scripts with arguments or small pipelines.
+func hookCommand(ctx context.Context, cmdline string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", cmdline)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", cmdline)
+}
+
+const (
+	hookPreDelete  = "pre-delete"
+	hookPostExport = "post-export"
+)
+
+// runFileHook runs a -pre-delete-hook or -post-export-hook with the affected
+// files on stdin, one per line. The event, the scanned root and the export
+// directory are passed in REPEATERXRAYPOC_* environment variables.
+func runFileHook(cmdline, event string, files []string, root, out string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := hookCommand(ctx, cmdline)
+	var stdin bytes.Buffer
+	for _, file := range files {
+		stdin.WriteString(file + "\n")
+	}
+	cmd.Stdin = &stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"REPEATERXRAYPOC_EVENT="+event,
+		"REPEATERXRAYPOC_ROOT="+root,
+		"REPEATERXRAYPOC_OUT="+out,
+		fmt.Sprintf("REPEATERXRAYPOC_COUNT=%d", len(files)),
+	)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook: %w", event, err)
+	}
+	return nil
+}
+
+// keepHookInput is what -keep-hook receives on stdin for every duplicate
+// group. Entries are in the order of the keep policy.
+type keepHookInput struct {
+	Key      string     `json:"key"`
+	Strategy string     `json:"strategy"`
+	Root     string     `json:"root"`
+	Keep     string     `json:"keep"`
+	Entries  []pocEntry `json:"entries"`
+}
+
+// applyKeepHook asks the hook which PoC of each duplicate group to keep and
+// moves it to the front. Empty output keeps the policy's choice.
+func applyKeepHook(hook string, groupMap map[string][]pocEntry, opts scanOptions) error {
+	keys := make([]string, 0, len(groupMap))
+	for key, list := range groupMap {
+		if len(list) > 1 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		list := groupMap[key]
+		input, err := json.Marshal(keepHookInput{
+			Key:      key,
+			Strategy: opts.Strategy,
+			Root:     opts.Root,
+			Keep:     list[0].unit(),
+			Entries:  list,
+		})
+		if err != nil {
+			return err
+		}
+		choice, err := runKeepHook(hook, input)
+		if err != nil {
+			return fmt.Errorf("group %s: %w", key, err)
+		}
+		if choice == "" {
+			continue
+		}
+		i := findHookChoice(list, choice, opts.Root)
+		if i < 0 {
+			return fmt.Errorf("group %s: hook chose %q, which is not in the group", key, choice)
+		}
+		chosen := list[i]
+		copy(list[1:i+1], list[:i])
+		list[0] = chosen
+	}
+	return nil
+}
+
+func runKeepHook(hook string, input []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := hookCommand(ctx, hook)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("keep hook: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// findHookChoice matches the hook's answer against the file path, the
+// file#doc unit or the path relative to the scanned root.
+func findHookChoice(list []pocEntry, choice, root string) int {
+	choice = fileKey(filepath.ToSlash(choice))
+	for i, entry := range list {
+		for _, name := range []string{entry.FilePath, entry.unit()} {
+			if fileKey(filepath.ToSlash(name)) == choice || fileKey(relativeTo(root, name)) == choice {
+				return i
+			}
+		}
+	}
+	return -1
+}
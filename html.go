@@ -0,0 +1,62 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed report.html.tmpl
+var htmlReportTemplate string
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"join": strings.Join,
+	"percent": func(rate float64) string {
+		return fmt.Sprintf("%.1f%%", rate*100)
+	},
+}).Parse(htmlReportTemplate))
+
+type htmlCountTable struct {
+	Title string
+	Rows  []htmlCountRow
+}
+
+type htmlCountRow struct {
+	Key   string
+	Count int
+}
+
+// writeHTMLReport renders a single self-contained page: styles and the table
+// sorting script are inlined so the file can be attached to a ticket as is.
+func writeHTMLReport(w io.Writer, report scanReport, stats corpusStats) error {
+	return htmlReport.Execute(w, struct {
+		Report    scanReport
+		Stats     corpusStats
+		Counts    []htmlCountTable
+		Generated string
+	}{
+		Report: report,
+		Stats:  stats,
+		Counts: []htmlCountTable{
+			countTable("Transport", stats.Transports),
+			countTable("Severity", stats.Severities),
+			countTable("CVE year", stats.Years),
+		},
+		Generated: time.Now().Format(time.RFC3339),
+	})
+}
+
+func countTable(title string, counts map[string]int) htmlCountTable {
+	table := htmlCountTable{Title: title}
+	for key, count := range counts {
+		table.Rows = append(table.Rows, htmlCountRow{Key: key, Count: count})
+	}
+	sort.Slice(table.Rows, func(i, j int) bool {
+		return table.Rows[i].Key < table.Rows[j].Key
+	})
+	return table
+}
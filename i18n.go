@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Report languages, chosen with -lang.
+const (
+	langEnglish = "en"
+	langChinese = "zh"
+)
+
+// reportLang is the language of the human-readable report. Logs and the
+// machine-readable formats (JSON, SARIF) stay English.
+var reportLang = langEnglish
+
+// messageCatalogs translates the English messages of the report, keyed by
+// the exact English format string. A message missing from a catalog is
+// printed in English. Translations keep the verbs of the original; indexed
+// verbs (%[2]d) reorder them.
+var messageCatalogs = map[string]map[string]string{
+	langChinese: {
+		// Text report.
+		"No PoC files found.\n": "未找到 PoC 文件。\n",
+		"\n%d known duplicate groups suppressed by the baseline.\n":                                             "\n基线已接受的 %d 个重复组未列出。\n",
+		"No duplicate PoCs detected based on %s.\n":                                                             "按 %s 未检测到重复的 PoC。\n",
+		"\nTotal reclaimable: %s\n":                                                                             "\n可释放空间合计：%s\n",
+		"\nRun again with -delete -dry-run to review the deletions and get the token -delete -confirm needs.\n": "\n加上 -delete -dry-run 重新运行可预览将删除的文件并获取 -delete -confirm 所需的确认令牌。\n",
+		"\nDry run: nothing was deleted. Run again with -delete -confirm %s to carry out these deletions.\n":    "\n试运行：未删除任何文件。加上 -delete -confirm %s 重新运行即可执行上述删除。\n",
+		"\nSkipped %d files:\n": "\n跳过了 %d 个文件：\n",
+		"\n%d lint findings:\n": "\n%d 处检查问题：\n",
+		"\nDetected %d name collisions (xray refuses duplicate plugin names):\n": "\n检测到 %d 处名称冲突（xray 拒绝加载同名插件）：\n",
+		"Name: %s": "名称：%s",
+		"Detected %d duplicated %s groups, showing the top %d by %s:\n": "检测到 %d 个重复组（%s），按 %[4]s 显示前 %[3]d 组：\n",
+		"Detected %d duplicated %s groups:\n":                           "检测到 %d 个重复组（%s）：\n",
+		"Path":                                                          "路径",
+		"Hash":                                                          "哈希",
+		"Fingerprint":                                                   "指纹",
+		"Key":                                                           "键",
+		"  * keep: %s (reclaimable: %s)":                                "  * 保留：%s（可释放：%s）",
+		"== %s: %d groups ==":                                           "== %s：%d 组 ==",
+		"  owners: %s\n":                                                "  负责人：%s\n",
+		"  authors:":                                                    "  作者：",
+		"declared: ":                                                    "声明：",
+		" lines":                                                        " 行",
+		"unknown":                                                       "未知",
+		"  confidence: %.1f (%s)\n":                                     "  置信度：%.1f（%s）\n",
+		"Duplicates by directory (%d directories):\n\n":                                              "按目录汇总的重复情况（%d 个目录）：\n\n",
+		"\nDetected %d PoCs superseded by a PoC with more rules:\n":                                  "\n检测到 %d 个 PoC 被规则更多的 PoC 覆盖：\n",
+		"  - %s (%d rules) is covered by %s (%d rules)\n":                                            "  - %s（%d 条规则）已被 %s（%d 条规则）覆盖\n",
+		"\n%d PoCs need a reverse (OOB) server; leave them out with -exclude-reverse:\n":             "\n%d 个 PoC 依赖反连（OOB）平台，可用 -exclude-reverse 排除：\n",
+		"\n%d stub PoCs cannot detect anything; leave them out with -exclude-stubs:\n":               "\n%d 个 PoC 是空壳，无法检测任何漏洞，可用 -exclude-stubs 排除：\n",
+		"Partial report: the scan stopped early (%s) and only covers the files read until then.\n\n": "部分报告：扫描提前结束（%s），仅包含此前读取的文件。\n\n",
+
+		// Progress line.
+		"[%s] %d/%d files  parse errors: %d  duplicates: %d  ETA: %s": "[%s] %d/%d 个文件  解析错误：%d  重复：%d  预计剩余：%s",
+
+		// Markdown report.
+		"### PoC duplicate check": "### PoC 重复检查",
+		"**Partial report:** the scan stopped early (%s) and only covers the files read until then.\n\n":    "**部分报告：**扫描提前结束（%s），仅包含此前读取的文件。\n\n",
+		"No duplicate PoCs detected among %d files (strategy: %s).\n":                                       "%d 个文件中未检测到重复的 PoC（策略：%s）。\n",
+		"Scanned %d files (strategy: %s): **%d duplicate groups**, %d name collisions, %d skipped files.\n": "扫描了 %d 个文件（策略：%s）：**%d 个重复组**，%d 处名称冲突，%d 个文件被跳过。\n",
+		"\nOnly the top %d groups are listed.\n":                                                            "\n仅列出前 %d 组。\n",
+		"<details>\n<summary><code>%s</code> — %d PoCs</summary>\n\n":                                       "<details>\n<summary><code>%s</code> — %d 个 PoC</summary>\n\n",
+		"| | Name | File | Modified | Severity | CVE |":                                                     "| | 名称 | 文件 | 修改时间 | 严重程度 | CVE |",
+		"keep":                      "保留",
+		"\n#### %s: %d groups\n":    "\n#### %s：%d 组\n",
+		"Owners: %s\n\n":            "负责人：%s\n\n",
+		"Authors:":                  "作者：",
+		"Confidence: %.1f (%s)\n\n": "置信度：%.1f（%s）\n\n",
+
+		// Confidence bases, in both reports.
+		"same content":             "内容相同",
+		"same requests and checks": "请求与判定相同",
+		"same path and method":     "路径与请求方法相同",
+		"same path":                "路径相同",
+		"same key and method":      "分组键与请求方法相同",
+		"same key":                 "分组键相同",
+		"same payload":             "载荷相同",
+		"<details>\n<summary>%d name collisions</summary>\n\n": "<details>\n<summary>%d 处名称冲突</summary>\n\n",
+		"<details>\n<summary>%d skipped files</summary>\n\n":   "<details>\n<summary>%d 个跳过的文件</summary>\n\n",
+		"<details>\n<summary>%d lint findings</summary>\n\n":   "<details>\n<summary>%d 处检查问题</summary>\n\n",
+	},
+}
+
+func parseLang(value string) (string, error) {
+	lang := strings.ToLower(strings.TrimSpace(value))
+	// Accept locale names such as zh_CN.UTF-8 or zh-Hans.
+	lang, _, _ = strings.Cut(lang, ".")
+	lang, _, _ = strings.Cut(strings.ReplaceAll(lang, "_", "-"), "-")
+	switch lang {
+	case "", langEnglish:
+		return langEnglish, nil
+	case langChinese:
+		return langChinese, nil
+	}
+	return "", fmt.Errorf("unsupported language %q (want en or zh)", value)
+}
+
+// tr returns message in the report language.
+func tr(message string) string {
+	if translated, ok := messageCatalogs[reportLang][message]; ok {
+		return translated
+	}
+	return message
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const ignoreFileName = ".pocdedupignore"
+
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreFiles holds the rules of every .pocdedupignore seen during a walk,
+// keyed by the directory (relative to the root) that contains the file.
+type ignoreFiles map[string][]ignoreRule
+
+// load reads the ignore file of dir, if any.
+func (f ignoreFiles) load(dir, rel string) error {
+	file, err := os.Open(filepath.Join(dir, ignoreFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(rules) > 0 {
+		f[fileKey(ignoreBase(rel))] = rules
+	}
+	return nil
+}
+
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// As in gitignore, a slash anywhere but the end anchors the pattern to
+	// the directory holding the ignore file.
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.pattern = fileKey(line)
+	return rule, true
+}
+
+// match reports whether rel (relative to the root) is ignored by the ignore
+// files of its ancestor directories. Deeper files and later lines win, and
+// "!" lines re-include what an earlier line ignored.
+func (f ignoreFiles) match(rel string, isDir bool) bool {
+	if len(f) == 0 {
+		return false
+	}
+	rel = fileKey(rel)
+	ignored := false
+	dirs := append([]string{""}, ancestorDirs(rel)...)
+	for _, dir := range dirs {
+		sub := strings.TrimPrefix(strings.TrimPrefix(rel, dir), "/")
+		for _, rule := range f[dir] {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			target := sub
+			if !rule.anchored {
+				target = path.Base(sub)
+			}
+			if globMatch(rule.pattern, target) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// ancestorDirs returns the proper ancestors of rel below the root, outermost
+// first: "a/b/c.yml" gives ["a", "a/b"].
+func ancestorDirs(rel string) []string {
+	var dirs []string
+	for i := 0; i < len(rel); i++ {
+		if rel[i] == '/' {
+			dirs = append(dirs, rel[:i])
+		}
+	}
+	return dirs
+}
+
+func ignoreBase(rel string) string {
+	if rel == "." {
+		return ""
+	}
+	return rel
+}
+
+// globMatch matches slash-separated paths where "**" spans any number of
+// directories and every other segment uses path.Match syntax.
+func globMatch(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
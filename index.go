@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// indexVersion is bumped whenever indexedDoc changes so stale indexes are
+// rebuilt rather than misread.
+const indexVersion = 4
+
+// corpusIndex is a persisted summary of every PoC under a root, refreshed
+// by re-reading only the files whose size or modification time changed.
+// Paths are stored as written; normalization happens at lookup so the index
+// does not depend on -normalize.
+type corpusIndex struct {
+	Version int                    `json:"version"`
+	Root    string                 `json:"root"`
+	Loose   bool                   `json:"loose"`
+	EOL     bool                   `json:"normalize_eol,omitempty"`
+	Files   map[string]indexedFile `json:"files"`
+
+	path  string
+	dirty bool
+}
+
+type indexedFile struct {
+	Size    int64        `json:"size"`
+	ModTime time.Time    `json:"modified"`
+	Docs    []indexedDoc `json:"docs,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// indexedDoc is one PoC: a file, or a document of a multi-document file.
+type indexedDoc struct {
+	Name      string   `json:"name"`
+	HasName   bool     `json:"has_name,omitempty"`
+	SHA256    string   `json:"sha256"`
+	Paths     []string `json:"paths,omitempty"`
+	Transport string   `json:"transport"`
+	CVEs      []string `json:"cves,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Keywords  []string `json:"keywords,omitempty"`
+	// Fields holds every scalar value for search.
+	Fields []indexedField `json:"fields,omitempty"`
+	Exempt bool           `json:"exempt,omitempty"`
+}
+
+func defaultIndexPath(root string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, "repeaterxraypoc", "index", hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadIndex reads the index at path, starting over when it is missing,
+// unreadable or built for other options. An empty path keeps the index in
+// memory only.
+func loadIndex(path string, opts scanOptions) *corpusIndex {
+	root, err := filepath.Abs(opts.Root)
+	if err != nil {
+		root = opts.Root
+	}
+	fresh := &corpusIndex{Version: indexVersion, Root: root, Loose: opts.Loose, EOL: opts.NormalizeEOL, Files: map[string]indexedFile{}, path: path}
+	if path == "" {
+		return fresh
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("ignoring unreadable index", "index", path, "err", err)
+		}
+		return fresh
+	}
+	var idx corpusIndex
+	if err := json.Unmarshal(raw, &idx); err != nil {
+		slog.Warn("ignoring corrupt index", "index", path, "err", err)
+		return fresh
+	}
+	if idx.Version != indexVersion || idx.Root != root || idx.Loose != opts.Loose || idx.EOL != opts.NormalizeEOL || idx.Files == nil {
+		slog.Debug("rebuilding index built for other options", "index", path)
+		return fresh
+	}
+	idx.path = path
+	return &idx
+}
+
+// openIndex loads the index at path and refreshes it, saving the result.
+func openIndex(path string, opts scanOptions) (*corpusIndex, error) {
+	idx := loadIndex(path, opts)
+	if err := idx.refresh(opts); err != nil {
+		return nil, err
+	}
+	if err := idx.save(); err != nil {
+		slog.Warn("saving index", "index", path, "err", err)
+	}
+	return idx, nil
+}
+
+// refresh brings the index up to date with the files under the root.
+func (idx *corpusIndex) refresh(opts scanOptions) error {
+	seen := make(map[string]bool, len(idx.Files))
+	reread := 0
+	err := walkPoCFiles(opts, func(path string) error {
+		rel := relativeTo(opts.Root, path)
+		seen[rel] = true
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if f, ok := idx.Files[rel]; ok && f.Size == info.Size() && f.ModTime.Equal(info.ModTime()) {
+			return nil
+		}
+		f := indexedFile{Size: info.Size(), ModTime: info.ModTime()}
+		if f.Docs, err = indexPoCFile(path, opts); err != nil {
+			f.Error = err.Error()
+		}
+		idx.Files[rel] = f
+		idx.dirty = true
+		reread++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for rel := range idx.Files {
+		if !seen[rel] {
+			delete(idx.Files, rel)
+			idx.dirty = true
+		}
+	}
+	slog.Debug("index refreshed", "files", len(idx.Files), "reread", reread)
+	return nil
+}
+
+// sortedFiles returns the indexed relative paths in order.
+func (idx *corpusIndex) sortedFiles() []string {
+	rels := make([]string, 0, len(idx.Files))
+	for rel := range idx.Files {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	return rels
+}
+
+func (idx *corpusIndex) save() error {
+	if !idx.dirty || idx.path == "" {
+		return nil
+	}
+	raw, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0o755); err != nil {
+		return err
+	}
+	tmp := idx.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, idx.path)
+}
+
+// indexPoCFile summarizes every document of a PoC file.
+func indexPoCFile(path string, opts scanOptions) ([]indexedDoc, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxFileSize > 0 && info.Size() > opts.MaxFileSize {
+		return nil, fmt.Errorf("file size %s exceeds -max-file-size %s", humanBytes(info.Size()), humanBytes(opts.MaxFileSize))
+	}
+	file, err := readPoCFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkExpansion(file, opts.MaxNodes); err != nil {
+		return nil, err
+	}
+	docs := make([]indexedDoc, 0, len(file.Docs))
+	lineOffset := 0
+	for _, doc := range file.Docs {
+		root := &doc.Node
+		d := indexedDoc{Name: strings.TrimSpace(findFirstScalar(root, "name"))}
+		d.HasName = d.Name != ""
+		if !d.HasName {
+			d.Name = filepath.Base(path)
+		}
+		d.SHA256 = contentHash(root, doc.Raw, opts.NormalizeEOL)
+		// Invalid tcp/udp PoCs are reported by the scan; here they have no
+		// paths to match.
+		d.Paths, _ = requestKeys(root, opts.Loose)
+		detail := extractDetail(root, d.Name)
+		d.Transport = detail.Transport
+		d.CVEs = detail.CVEs
+		d.Tags = detail.Tags
+		d.Keywords = keywords(append([]string{d.Name, detail.Description}, detail.Tags...)...)
+		d.Exempt = hasIgnorePragma(root, doc.Raw)
+		d.Fields = indexFields(root, "", lineOffset, nil)
+		lineOffset += bytes.Count(doc.Raw, []byte("\n"))
+		docs = append(docs, d)
+	}
+	return docs, nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+func isJSONFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// parseJSONDocument parses a JSON PoC into the same node tree the YAML parser
+// produces, with line and column positions, so every consumer (path
+// extraction, in-place edits) works on both formats. Going through the YAML
+// parser instead rejects valid JSON such as duplicate keys and mishandles
+// escaped surrogate pairs.
+func parseJSONDocument(raw []byte) (yaml.Node, error) {
+	p := &jsonParser{src: raw, line: 1, col: 1}
+	p.skipSpace()
+	value, err := p.value()
+	if err != nil {
+		return yaml.Node{}, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return yaml.Node{}, p.errorf("unexpected %q after top-level value", p.src[p.pos])
+	}
+	return yaml.Node{Kind: yaml.DocumentNode, Line: 1, Column: 1, Content: []*yaml.Node{value}}, nil
+}
+
+type jsonParser struct {
+	src       []byte
+	pos       int
+	line, col int
+}
+
+func (p *jsonParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("json: line %d column %d: %s", p.line, p.col, fmt.Sprintf(format, args...))
+}
+
+// advance moves past n bytes, keeping line and rune column in step.
+func (p *jsonParser) advance(n int) {
+	end := p.pos + n
+	for p.pos < end {
+		r, size := utf8.DecodeRune(p.src[p.pos:])
+		p.pos += size
+		if r == '\n' {
+			p.line++
+			p.col = 1
+		} else {
+			p.col++
+		}
+	}
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\r', '\n':
+			p.advance(1)
+		default:
+			return
+		}
+	}
+}
+
+func (p *jsonParser) expect(c byte) error {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return p.errorf("unexpected end of input, want %q", c)
+	}
+	if p.src[p.pos] != c {
+		return p.errorf("unexpected %q, want %q", p.src[p.pos], c)
+	}
+	p.advance(1)
+	return nil
+}
+
+func (p *jsonParser) value() (*yaml.Node, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unexpected end of input")
+	}
+	node := &yaml.Node{Line: p.line, Column: p.col}
+	switch c := p.src[p.pos]; {
+	case c == '{':
+		node.Kind, node.Tag, node.Style = yaml.MappingNode, "!!map", yaml.FlowStyle
+		return node, p.container('}', func() error {
+			key, err := p.value()
+			if err != nil {
+				return err
+			}
+			if key.Tag != "!!str" {
+				return p.errorf("object key must be a string")
+			}
+			if err := p.expect(':'); err != nil {
+				return err
+			}
+			value, err := p.value()
+			if err != nil {
+				return err
+			}
+			node.Content = append(node.Content, key, value)
+			return nil
+		})
+	case c == '[':
+		node.Kind, node.Tag, node.Style = yaml.SequenceNode, "!!seq", yaml.FlowStyle
+		return node, p.container(']', func() error {
+			value, err := p.value()
+			if err != nil {
+				return err
+			}
+			node.Content = append(node.Content, value)
+			return nil
+		})
+	case c == '"':
+		end, err := p.stringEnd()
+		if err != nil {
+			return nil, err
+		}
+		var s string
+		if err := json.Unmarshal(p.src[p.pos:end], &s); err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		node.Kind, node.Tag, node.Style, node.Value = yaml.ScalarNode, "!!str", yaml.DoubleQuotedStyle, s
+		p.advance(end - p.pos)
+		return node, nil
+	default:
+		end := p.pos
+		for end < len(p.src) && strings.IndexByte(",:]} \t\r\n", p.src[end]) < 0 {
+			end++
+		}
+		literal := string(p.src[p.pos:end])
+		node.Kind, node.Value = yaml.ScalarNode, literal
+		switch {
+		case literal == "true" || literal == "false":
+			node.Tag = "!!bool"
+		case literal == "null":
+			node.Tag = "!!null"
+		case json.Valid([]byte(literal)):
+			node.Tag = "!!float"
+			if !strings.ContainsAny(literal, ".eE") {
+				node.Tag = "!!int"
+			}
+		default:
+			return nil, p.errorf("invalid value %q", literal)
+		}
+		p.advance(end - p.pos)
+		return node, nil
+	}
+}
+
+// container parses the members of an object or array after its opening
+// bracket, calling member for each one.
+func (p *jsonParser) container(closing byte, member func() error) error {
+	p.advance(1)
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] == closing {
+		p.advance(1)
+		return nil
+	}
+	for {
+		if err := member(); err != nil {
+			return err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return p.errorf("unexpected end of input, want %q", closing)
+		}
+		switch p.src[p.pos] {
+		case ',':
+			p.advance(1)
+		case closing:
+			p.advance(1)
+			return nil
+		default:
+			return p.errorf("unexpected %q, want ',' or %q", p.src[p.pos], closing)
+		}
+	}
+}
+
+func (p *jsonParser) stringEnd() (int, error) {
+	for i := p.pos + 1; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, nil
+		case '\n':
+			return 0, p.errorf("newline in string")
+		}
+	}
+	return 0, p.errorf("unterminated string")
+}
+
+// encodeJSONNode serializes a node tree back to JSON, keeping key order and
+// number literals as written.
+func encodeJSONNode(node *yaml.Node, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeJSONNode(&buf, node, indent, ""); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func writeJSONNode(buf *bytes.Buffer, node *yaml.Node, indent, prefix string) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return errors.New("empty document")
+		}
+		return writeJSONNode(buf, node.Content[0], indent, prefix)
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, closing, step := byte('{'), byte('}'), 2
+		if node.Kind == yaml.SequenceNode {
+			open, closing, step = '[', ']', 1
+		}
+		buf.WriteByte(open)
+		if len(node.Content) == 0 {
+			buf.WriteByte(closing)
+			return nil
+		}
+		inner := prefix + indent
+		for i := 0; i < len(node.Content); i += step {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString("\n" + inner)
+			if step == 2 {
+				key, err := doubleQuoted(node.Content[i].Value)
+				if err != nil {
+					return err
+				}
+				buf.WriteString(key + ": ")
+			}
+			if err := writeJSONNode(buf, node.Content[i+step-1], indent, inner); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("\n" + prefix)
+		buf.WriteByte(closing)
+		return nil
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!int", "!!float", "!!bool", "!!null":
+			buf.WriteString(node.Value)
+			return nil
+		}
+		s, err := doubleQuoted(node.Value)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+		return nil
+	default:
+		return fmt.Errorf("line %d: cannot encode node kind %d as JSON", node.Line, node.Kind)
+	}
+}
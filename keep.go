@@ -0,0 +1,169 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	keepNewest = "newest"
+	keepOldest = "oldest"
+	// keepCVSS keeps the PoC whose CVEs have the highest NVD score, falling
+	// back to the newest. Scores are only known when -nvd is set.
+	keepCVSS = "cvss"
+	// keepSeverity keeps the PoC declaring the highest severity, then the
+	// one with the most complete detail block, falling back to the -keep
+	// policy (newest when that is severity too).
+	keepSeverity = "severity"
+)
+
+// severityRanks orders the severities PoCs declare, in English or Chinese.
+var severityRanks = map[string]int{
+	"critical": 4, "严重": 4,
+	"high": 3, "高危": 3, "高": 3,
+	"medium": 2, "moderate": 2, "中危": 2, "中": 2,
+	"low": 1, "低危": 1, "低": 1,
+	"info": 0, "informational": 0, "信息": 0,
+}
+
+func isKeepPolicy(policy string) bool {
+	return policy == keepNewest || policy == keepOldest || policy == keepCVSS || policy == keepSeverity
+}
+
+func keepDescription(policy string) string {
+	switch policy {
+	case keepOldest:
+		return "oldest"
+	case keepCVSS:
+		return "highest CVSS"
+	case keepSeverity:
+		return "highest severity"
+	default:
+		return "most recent"
+	}
+}
+
+// sortByKeepPolicy orders a group so that the PoC to keep comes first.
+// PoCs the severity policy cannot tell apart are ordered by fallback.
+func sortByKeepPolicy(list []pocEntry, policy, fallback string) {
+	sort.SliceStable(list, func(i, j int) bool {
+		by := policy
+		if policy == keepSeverity {
+			a, b := severityRank(list[i].Detail.Severity), severityRank(list[j].Detail.Severity)
+			if a != b {
+				return a > b
+			}
+			if a, b := detailCompleteness(*list[i].Detail), detailCompleteness(*list[j].Detail); a != b {
+				return a > b
+			}
+			by = fallback
+		}
+		if by == keepOldest {
+			return list[i].ModTime.Before(list[j].ModTime)
+		}
+		if by == keepCVSS && list[i].Detail.CVSS != list[j].Detail.CVSS {
+			return list[i].Detail.CVSS > list[j].Detail.CVSS
+		}
+		return list[i].ModTime.After(list[j].ModTime)
+	})
+}
+
+// keepFallback is the policy that breaks severity ties: the -keep policy,
+// or newest when that is severity.
+func keepFallback(opts scanOptions) string {
+	if opts.Keep == keepSeverity {
+		return keepNewest
+	}
+	return opts.Keep
+}
+
+// severityRank ranks a declared severity; a missing or unknown one ranks
+// below info.
+func severityRank(severity string) int {
+	if rank, ok := severityRanks[strings.ToLower(strings.TrimSpace(severity))]; ok {
+		return rank
+	}
+	return -1
+}
+
+// detailCompleteness counts the detail fields a PoC fills in.
+func detailCompleteness(d pocDetail) int {
+	n := 0
+	for _, set := range []bool{d.Author != "", d.Description != "", d.Severity != "", len(d.Tags) > 0, len(d.CVEs) > 0, len(d.Links) > 0} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// sortByPreferredRoot moves the PoCs under the highest-priority -prefer-root
+// to the front, keeping the keep-policy order among PoCs of equal priority.
+func sortByPreferredRoot(list []pocEntry, opts scanOptions) {
+	if len(opts.PreferRoots) == 0 {
+		return
+	}
+	rank := func(entry pocEntry) int {
+		rel := relativeTo(opts.Root, entry.FilePath)
+		for i, dir := range opts.PreferRoots {
+			if isUnderDir(rel, dir) {
+				return i
+			}
+		}
+		return len(opts.PreferRoots)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return rank(list[i]) < rank(list[j])
+	})
+}
+
+// groupKeepPolicy returns the keep policy of the most specific override
+// containing every file of the group, falling back to the global policy.
+func groupKeepPolicy(list []pocEntry, opts scanOptions) string {
+	policy := opts.Keep
+	best := -1
+	for _, override := range opts.Overrides {
+		if override.Keep == "" {
+			continue
+		}
+		dir := cleanOverridePath(override.Path)
+		if len(dir) <= best {
+			continue
+		}
+		inside := true
+		for _, entry := range list {
+			if !isUnderDir(relativeTo(opts.Root, entry.FilePath), dir) {
+				inside = false
+				break
+			}
+		}
+		if inside {
+			policy = strings.ToLower(override.Keep)
+			best = len(dir)
+		}
+	}
+	return policy
+}
+
+func usesKeepPolicy(opts scanOptions, policy string) bool {
+	if opts.Keep == policy {
+		return true
+	}
+	for _, override := range opts.Overrides {
+		if strings.EqualFold(override.Keep, policy) {
+			return true
+		}
+	}
+	return false
+}
+
+func cleanOverridePath(dir string) string {
+	dir = path.Clean("/" + strings.TrimSpace(dir))
+	return strings.TrimPrefix(dir, "/")
+}
+
+func isUnderDir(rel, dir string) bool {
+	rel, dir = fileKey(rel), fileKey(dir)
+	return dir == "" || rel == dir || strings.HasPrefix(rel, dir+"/")
+}
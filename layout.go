@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Indentation limits of the YAML encoder.
+const (
+	minYAMLIndent = 2
+	maxYAMLIndent = 9
+)
+
+// pocLayout is how a PoC file is laid out: JSON or YAML, one level of
+// indentation and line endings. Operations that re-encode a PoC write it
+// back in the layout it was read in, so a rewrite never turns JSON into YAML,
+// re-indents a 4-space file or changes CRLF into LF.
+type pocLayout struct {
+	json bool
+	// indent is one level of indentation: spaces, or a tab in JSON.
+	indent string
+	// crlf is set when most lines end in CRLF.
+	crlf bool
+}
+
+// detectLayout reads the layout of raw, the content of the PoC at path. The
+// indentation is the shallowest one of any line; a file without indented
+// lines gets formatIndent spaces.
+func detectLayout(path string, raw []byte) pocLayout {
+	l := pocLayout{json: isJSONFile(path)}
+	l.crlf = 2*bytes.Count(raw, []byte("\r\n")) > bytes.Count(raw, []byte("\n"))
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(nil, len(raw)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || trimmed == line || (!l.json && strings.HasPrefix(trimmed, "#")) {
+			continue
+		}
+		indent := line[:len(line)-len(trimmed)]
+		if l.json && strings.HasPrefix(indent, "\t") {
+			l.indent = "\t"
+			break
+		}
+		indent = strings.TrimRight(indent, "\t")
+		if indent != "" && (l.indent == "" || len(indent) < len(l.indent)) {
+			l.indent = indent
+		}
+	}
+	if l.indent == "" {
+		l.indent = strings.Repeat(" ", formatIndent)
+	}
+	if !l.json {
+		l.indent = strings.Repeat(" ", min(max(len(l.indent), minYAMLIndent), maxYAMLIndent))
+	}
+	return l
+}
+
+// encode serializes doc in the layout.
+func (l pocLayout) encode(doc *yaml.Node) ([]byte, error) {
+	out, err := l.encodeLF(doc)
+	if err != nil || !l.crlf {
+		return out, err
+	}
+	return bytes.ReplaceAll(out, []byte("\n"), []byte("\r\n")), nil
+}
+
+func (l pocLayout) encodeLF(doc *yaml.Node) ([]byte, error) {
+	if l.json {
+		return encodeJSONNode(doc, l.indent)
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(len(l.indent))
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultMaxFileSize  = 2 << 20
+	defaultParseTimeout = 10 * time.Second
+)
+
+// byteSize is a flag value accepting plain byte counts or sizes with a
+// KB/MB/GB (or KiB/MiB/GiB) suffix. Both suffix forms are powers of 1024.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	if b == nil {
+		return ""
+	}
+	return humanBytes(int64(*b))
+}
+
+func (b *byteSize) Set(value string) error {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	multiplier := 1.0
+	if i := strings.IndexAny(s, "KMG"); i >= 0 && i == len(s)-1 {
+		multiplier = float64(int64(1) << (10 * (strings.IndexByte("KMG", s[i]) + 1)))
+		s = s[:i]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", value)
+	}
+	*b = byteSize(n * multiplier)
+	return nil
+}
+
+// parseWithin runs parse and gives up once timeout has passed. The YAML
+// parser cannot be interrupted, so a parse that overruns keeps running in the
+// background until it finishes; the size limit bounds what it can consume.
+func parseWithin(timeout time.Duration, parse func() ([]pocEntry, error)) ([]pocEntry, error) {
+	if timeout <= 0 {
+		return parse()
+	}
+	type result struct {
+		entries []pocEntry
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		entries, err := parse()
+		done <- result{entries, err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.entries, r.err
+	case <-timer.C:
+		return nil, fmt.Errorf("parsing took longer than %s (-parse-timeout)", timeout)
+	}
+}
+
+const defaultMaxNodes = 100000
+
+// expandedNodes counts the nodes of the tree with every alias replaced by
+// the node it refers to, which is what decoding the document materializes.
+// Counting stops as soon as limit is exceeded, and sizes are memoized per
+// anchor, so a billion-laughs document is rejected in linear time.
+func expandedNodes(root *yaml.Node, limit int) (int, bool) {
+	sizes := make(map[*yaml.Node]int)
+	var count func(n *yaml.Node) int
+	count = func(n *yaml.Node) int {
+		if n.Kind == yaml.AliasNode {
+			if n.Alias == nil {
+				return 1
+			}
+			if size, ok := sizes[n.Alias]; ok {
+				return size
+			}
+			sizes[n.Alias] = limit + 1 // a self-referencing anchor never ends
+			sizes[n.Alias] = count(n.Alias)
+			return sizes[n.Alias]
+		}
+		total := 1
+		for _, child := range n.Content {
+			total += count(child)
+			if total > limit {
+				return limit + 1
+			}
+		}
+		return total
+	}
+	total := count(root)
+	return total, total <= limit
+}
+
+// checkExpansion rejects a file with a document that expands past limit
+// nodes. A limit of 0 disables the check.
+func checkExpansion(f *pocFile, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+	for i := range f.Docs {
+		if _, ok := expandedNodes(&f.Docs[i].Node, limit); ok {
+			continue
+		}
+		if len(f.Docs) == 1 {
+			return fmt.Errorf("aliases expand to more than %d nodes (-max-nodes)", limit)
+		}
+		return fmt.Errorf("document %d: aliases expand to more than %d nodes (-max-nodes)", i, limit)
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	fixTargetFile = "file"
+	fixTargetName = "name"
+
+	pocNamePrefix = "poc-yaml-"
+)
+
+type lintFinding struct {
+	File    string `json:"file"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Fixed   bool   `json:"fixed"`
+}
+
+type lintOptions struct {
+	Fix       bool
+	FixTarget string
+}
+
+// lintRule checks one parsed PoC. fix is optional and returns a description
+// of what it changed.
+type lintRule struct {
+	ID          string
+	Description string
+	check       func(f *pocFile) []string
+	fix         func(f *pocFile, lopts lintOptions) (string, error)
+}
+
+var lintRules = []lintRule{
+	{
+		ID:          "name-filename",
+		Description: "name field must match the file name (<name>.yml or poc-yaml-<file>)",
+		check:       checkNameFilename,
+		fix:         fixNameFilename,
+	},
+	{
+		ID:          "expr-tautology",
+		Description: "expressions must not be always true or false, e.g. response.status == response.status",
+		check:       checkExpressionTautology,
+	},
+	{
+		ID:          "expr-match-all",
+		Description: "body checks must not match every response, e.g. response.body.bcontains(b\"\")",
+		check:       checkExpressionMatchAll,
+	},
+	{
+		ID:          "expr-status",
+		Description: "rules matching the body must also check response.status",
+		check:       checkExpressionStatus,
+	},
+}
+
+const lintUsage = `
+Usage:
+  go run . lint -dir <path-to-pocs> [-fix] [-fix-target file|name] [-rules id,...] [-format text|json]
+
+Rules:
+`
+
+func runLint(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	fixFlag := fs.Bool("fix", false, "Fix findings in place where the rule supports it")
+	fixTargetFlag := fs.String("fix-target", fixTargetFile, "What name-filename fixes rewrite: file (rename the file) or name (rewrite the name field)")
+	rulesFlag := fs.String("rules", "", "Comma-separated rule IDs to run (default: all)")
+	formatFlag := fs.String("format", formatText, "Output format: text or json")
+	lockWaitFlag := fs.Duration("lock-wait", 0, lockWaitUsage)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(lintUsage, "\n"))
+		for _, rule := range lintRules {
+			fmt.Fprintf(fs.Output(), "  %-16s %s\n", rule.ID, rule.Description)
+		}
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	lopts := lintOptions{Fix: *fixFlag, FixTarget: strings.ToLower(strings.TrimSpace(*fixTargetFlag))}
+	if lopts.FixTarget != fixTargetFile && lopts.FixTarget != fixTargetName {
+		slog.Error("invalid -fix-target (want file or name)", "fix-target", *fixTargetFlag)
+		return exitError
+	}
+	rules, err := selectLintRules(*rulesFlag)
+	if err != nil {
+		slog.Error("invalid -rules", "err", err)
+		return exitError
+	}
+	format := strings.ToLower(strings.TrimSpace(*formatFlag))
+	if format != formatText && format != formatJSON {
+		slog.Error("unsupported format (want text or json)", "format", *formatFlag)
+		return exitError
+	}
+	if lopts.Fix {
+		unlock, err := lockRoot(opts, *lockWaitFlag)
+		if err != nil {
+			slog.Error("cannot lock -dir", "err", err)
+			return exitError
+		}
+		defer unlock()
+	}
+
+	findings, err := lintCorpus(opts, rules, lopts)
+	if err != nil {
+		slog.Error("linting PoCs", "err", err)
+		return exitError
+	}
+
+	if format == formatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(findings); err != nil {
+			slog.Error("writing report", "err", err)
+			return exitError
+		}
+	} else if !*sf.quiet {
+		for _, finding := range findings {
+			suffix := ""
+			if finding.Fixed {
+				suffix = " (fixed)"
+			}
+			fmt.Printf("%s: [%s] %s%s\n", finding.File, finding.Rule, finding.Message, suffix)
+		}
+	}
+
+	for _, finding := range findings {
+		if !finding.Fixed {
+			return exitInvalid
+		}
+	}
+	return exitOK
+}
+
+func selectLintRules(ids string) ([]lintRule, error) {
+	if strings.TrimSpace(ids) == "" {
+		return lintRules, nil
+	}
+	var selected []lintRule
+	for _, id := range strings.Split(ids, ",") {
+		id = strings.TrimSpace(id)
+		found := false
+		for _, rule := range lintRules {
+			if rule.ID == id {
+				selected = append(selected, rule)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown rule %q", id)
+		}
+	}
+	return selected, nil
+}
+
+func lintCorpus(opts scanOptions, rules []lintRule, lopts lintOptions) ([]lintFinding, error) {
+	findings := []lintFinding{}
+	err := walkPoCFiles(opts, func(path string) error {
+		found, err := lintFile(path, rules, lopts)
+		findings = append(findings, found...)
+		return err
+	})
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].File < findings[j].File
+	})
+	return findings, err
+}
+
+// scanLintRules are the rules a scan with -lint runs: the expression checks,
+// which flag PoCs that parse but cannot detect what they claim to.
+func scanLintRules() []lintRule {
+	var rules []lintRule
+	for _, rule := range lintRules {
+		if strings.HasPrefix(rule.ID, "expr-") {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// lintEntries runs rules over the files a scan read, once per file.
+func lintEntries(entries []pocEntry, rules []lintRule) ([]lintFinding, error) {
+	findings := []lintFinding{}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if seen[entry.FilePath] {
+			continue
+		}
+		seen[entry.FilePath] = true
+		found, err := lintFile(entry.FilePath, rules, lintOptions{})
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, found...)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].File < findings[j].File
+	})
+	return findings, nil
+}
+
+func lintFile(path string, rules []lintRule, lopts lintOptions) ([]lintFinding, error) {
+	f, err := readPoCFile(path)
+	if err != nil {
+		return []lintFinding{{File: path, Rule: "parse", Message: err.Error()}}, nil
+	}
+	var findings []lintFinding
+	for _, rule := range rules {
+		for _, message := range rule.check(f) {
+			finding := lintFinding{File: path, Rule: rule.ID, Message: message}
+			if lopts.Fix && rule.fix != nil {
+				change, err := rule.fix(f, lopts)
+				if err != nil {
+					slog.Warn("fix failed", "file", path, "rule", rule.ID, "err", err)
+				} else {
+					finding.Fixed = true
+					finding.Message += "; " + change
+					// Later rules must see the fixed file.
+					if f, err = readPoCFile(f.Path); err != nil {
+						return findings, err
+					}
+				}
+			}
+			findings = append(findings, finding)
+		}
+	}
+	return findings, nil
+}
+
+func fileStem(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func checkNameFilename(f *pocFile) []string {
+	if len(f.Docs) > 1 {
+		// A file holding several PoCs cannot be named after all of them.
+		return nil
+	}
+	name := findFirstScalar(&f.Root, "name")
+	if name == "" {
+		return nil
+	}
+	stem := fileStem(f.Path)
+	if stem == name || pocNamePrefix+stem == name || stem == pocNamePrefix+name || stem == normalizedStem(name) {
+		return nil
+	}
+	return []string{fmt.Sprintf("name %q does not match file name %q", name, filepath.Base(f.Path))}
+}
+
+func fixNameFilename(f *pocFile, lopts lintOptions) (string, error) {
+	name := findFirstScalar(&f.Root, "name")
+	stem := fileStem(f.Path)
+	if lopts.FixTarget == fixTargetName {
+		newName := stem
+		if !strings.HasPrefix(newName, pocNamePrefix) {
+			newName = pocNamePrefix + newName
+		}
+		if err := rewritePoCName(f.Path, 0, name, newName); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("name rewritten to %q", newName), nil
+	}
+
+	// The same convention as normalize-names, so the two agree.
+	newStem := normalizedStem(name)
+	if newStem == "" {
+		return "", fmt.Errorf("name %q gives no file name", name)
+	}
+	ext := ".yml"
+	if isJSONFile(f.Path) {
+		ext = ".json"
+	}
+	target := filepath.Join(filepath.Dir(f.Path), newStem+ext)
+	// movePoCFile also handles names that differ only in case on a
+	// case-insensitive filesystem.
+	if err := movePoCFile(filepath.Dir(f.Path), f.Path, target, false); err != nil {
+		return "", fmt.Errorf("cannot rename: %w", err)
+	}
+	f.Path = target
+	return fmt.Sprintf("renamed to %s", target), nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const lockWaitUsage = "How long to wait for another run modifying the same -dir to finish (0 fails at once)"
+
+// errLocked is returned by tryLockRoot when another process holds the lock.
+var errLocked = errors.New("locked")
+
+// lockRoot takes the exclusive lock that serializes runs modifying root:
+// -delete, -dedupe-rules, -transcode, -rename-collisions, lint -fix, fmt and
+// new. It waits up to wait for a running one to finish. Read-only runs do not
+// lock. A remote -dir is only a mirror and cannot be modified.
+func lockRoot(opts scanOptions, wait time.Duration) (release func(), err error) {
+	if opts.Remote != nil {
+		return nil, fmt.Errorf("%s is a remote source and is read-only", opts.Remote.url)
+	}
+	root := opts.Root
+	deadline := time.Now().Add(wait)
+	logged := false
+	for {
+		release, err := tryLockRoot(root)
+		if !errors.Is(err, errLocked) {
+			return release, err
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("another run is modifying %s (%v); retry later or pass -lock-wait", root, err)
+		}
+		if !logged {
+			slog.Info("waiting for another run modifying the same directory", "dir", root, "wait", wait)
+			logged = true
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
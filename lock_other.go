@@ -0,0 +1,35 @@
+//go:build !unix
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// tryLockRoot creates a lock file in the temporary directory, named after
+// root. A run that crashes leaves the file behind; the error names it so it
+// can be removed by hand.
+func tryLockRoot(root string) (func(), error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	// Paths differing only in case name the same directory on Windows.
+	sum := sha256.Sum256([]byte(fileKey(filepath.Clean(abs))))
+	path := filepath.Join(os.TempDir(), "repeaterxraypoc-"+hex.EncodeToString(sum[:8])+".lock")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("%w (lock file %s)", errLocked, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	f.Close()
+	return func() { os.Remove(path) }, nil
+}
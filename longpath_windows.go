@@ -0,0 +1,23 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxPath is the length from which Windows needs the \\?\ form; directories
+// are limited to 248 characters, files to 260.
+const maxPath = 248
+
+// longPath returns path in the \\?\ form when it is too long for the
+// classic Windows API, which os only does for absolute paths itself.
+func longPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil || len(abs) < maxPath || strings.HasPrefix(abs, `\\?\`) {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,40 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLongPath(t *testing.T) {
+	long := strings.Repeat(`segment\`, 40) + "poc.yml"
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "short drive path", path: `C:\pocs\a.yml`, want: `C:\pocs\a.yml`},
+		{name: "long drive path", path: `C:\pocs\` + long, want: `\\?\C:\pocs\` + long},
+		{name: "long drive path is cleaned", path: `C:\pocs\.\` + long, want: `\\?\C:\pocs\` + long},
+		{name: "short UNC path", path: `\\server\share\a.yml`, want: `\\server\share\a.yml`},
+		{name: "long UNC path", path: `\\server\share\` + long, want: `\\?\UNC\server\share\` + long},
+		{name: "already prefixed", path: `\\?\C:\pocs\` + long, want: `\\?\C:\pocs\` + long},
+		{name: "already prefixed UNC", path: `\\?\UNC\server\share\` + long, want: `\\?\UNC\server\share\` + long},
+		{name: "short relative path", path: `pocs\a.yml`, want: `pocs\a.yml`},
+		{name: "long relative path", path: long, want: `\\?\` + filepath.Join(cwd, long)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := longPath(tt.path); got != tt.want {
+				t.Errorf("longPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -21,32 +24,290 @@ type pocMeta struct {
 
 type pocEntry struct {
 	pocMeta
-	FilePath string
-	ModTime  time.Time
+	Key      string    `json:"key"`
+	FilePath string    `json:"file"`
+	ModTime  time.Time `json:"modified"`
+	// Detail is shared by the entries of one document.
+	Detail *pocDetail `json:"detail"`
+	// Doc is the index of the document within a multi-document file.
+	Doc  int `json:"doc"`
+	Docs int `json:"-"`
+	// Size is the byte size of the file, or of the document in a
+	// multi-document file.
+	Size int64 `json:"-"`
+	// Exempt is set by a dedup:ignore pragma; the entry never joins a group.
+	Exempt bool `json:"exempt,omitempty"`
+	// HasName is false when Name fell back to the file name.
+	HasName bool `json:"-"`
+	// Unverified is set when the signature check failed under -unverified warn.
+	Unverified bool `json:"unverified,omitempty"`
+	// RuleSet describes the document's rules; only set for -detect-subsets.
+	RuleSet []string `json:"-"`
+	// Content is the canonical content hash of the document.
+	Content string `json:"-"`
+	// Methods are the document's distinct request methods, sorted.
+	Methods []string `json:"-"`
+}
+
+const (
+	strategyPath = "path"
+	strategyHash = "hash"
+)
+
+// noPathKeyPrefix keys the PoCs without a request path under -strategy path
+// by the sha256 of their canonical content (see contentHash).
+const noPathKeyPrefix = "no-path:sha256:"
+
+type scanOptions struct {
+	Root      string
+	Strategy  string
+	Keep      string
+	Excludes  []string
+	Overrides []configOverride
+	Normalize pathNormalizer
+	// PreferRoots are directories relative to Root, highest priority first,
+	// whose PoCs are kept over duplicates elsewhere whatever the policy.
+	PreferRoots []string
+	// GenericPaths are the normalized request paths grouped by content
+	// rather than by path.
+	GenericPaths   map[string]bool
+	Filters        []pocFilter
+	CrossTransport bool
+	Loose          bool
+	// NormalizeEOL makes CRLF and LF line endings compare equal.
+	NormalizeEOL  bool
+	GroupBy       []groupField
+	MaxFileSize   int64
+	ParseTimeout  time.Duration
+	MaxNodes      int
+	Verifier      *signatureVerifier
+	Unverified    string
+	DetectSubsets bool
+	// ExcludeReverse leaves out the PoCs that need a reverse server.
+	ExcludeReverse bool
+	// ExcludeStubs leaves out the PoCs that cannot detect anything.
+	ExcludeStubs bool
+	// Remote is set when -dir is a remote share mirrored into Root.
+	Remote *remoteSource
+	// Checkpoint is set by -checkpoint; loaded files are recorded in it and
+	// unchanged ones taken from it.
+	Checkpoint *scanCheckpoint
+}
+
+type skippedFile struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
 }
 
 var usageText = `
 Usage:
-  go run . -dir <path-to-pocs> [-delete] [-out <output-dir>]
+  go run . -version
+  go run . -dir <path-to-pocs> [-delete -dry-run|-delete -confirm <token>|-plan <file> [-min-confidence <0-1>]] [-out <output-dir> [-out-delta [-out-prune]]] [-format text|json|sarif|html|markdown] [-fail-on duplicates|invalid|none] [-strict] [-quiet]
+           [-v|-vv] [-log-format text|json] [-progress=false] [-config <file>] [-exclude <pattern>]... [-keep newest|oldest|cvss|severity] [-keep-hook <cmd>]
+           [-pre-delete-hook <cmd>] [-backup <dir>] [-post-export-hook <cmd>] [-git-commit]
+           [-github-pr owner/name [-github-token <token>] [-github-base <branch>] [-github-fork owner/name|auto]] [-strategy path|hash|fingerprint]
+           [-normalize case,slash,query,tokens|none] [-generic-path <path>|none]... [-cross-transport] [-loose] [-normalize-eol] [-group-by <field,...>] [-group-report dir]
+           [-sort path|count|size|newest] [-top N] [-lang en|zh] [-no-color] [-history <file>]
+           [-codeowners <file> [-assign]] [-attribution] [-notify slack://...|webhook://...|smtp://...]...
+           [-max-file-size <size>] [-parse-timeout <duration>] [-max-nodes N] [-timeout <duration>]
+           [-verify-keys <file> [-manifest <file>] [-unverified skip|warn]] [-diff unified|color]
+           [-link copy|hard|symlink|reflink] [-preserve=false] [-provenance sidecar|comment] [-on-name-collision warn|fail|suffix|drop]
+           [-mark] [-rename-collisions] [-filter field=glob]... [-list-reverse] [-exclude-reverse] [-list-stubs] [-exclude-stubs] [-checkpoint <file>]
+           [-nvd [-nvd-api-key <key>] [-nvd-cache <file>]]
+           [-baseline <file> [-update-baseline]] [-dedupe-rules] [-transcode] [-detect-subsets [-delete-subsets]]
+
+Commands:
+  apply       Carry out a reviewed -plan file (go run . apply -h)
+  bench       Measure the scan pipeline and write profiles (go run . bench -h)
+  check       Load kept PoCs with a local xray binary (go run . check -h)
+  check-new   Pre-commit check of new PoCs against the corpus (go run . check-new -h)
+  daemon      Rescan on a schedule and serve Prometheus metrics (go run . daemon -h)
+  export      Export a subset defined by a config profile (go run . export -h)
+  history     List the scans recorded with -history (go run . history -h)
+  lint        Check PoCs against naming rules (go run . lint -h)
+  fmt         Rewrite PoCs into the canonical style (go run . fmt -h)
+  mockserver  Serve canned HTTP responses for smoke tests (go run . mockserver -h)
+  new         Scaffold a PoC skeleton (go run . new -h)
+  normalize-names  Rename PoC files after their name field (go run . normalize-names -h)
+  package     Package kept PoCs and a config snippet for xray (go run . package -h)
+  purge-marked  Delete the duplicates a -mark scan annotated (go run . purge-marked -h)
+  query       Search the corpus index by CVE, path or keyword (go run . query -h)
+  reorganize  Move PoCs into a layout derived from their metadata (go run . reorganize -h)
+  report      Cross-reference reports, e.g. report cves (go run . report -h)
+  search      Search PoC values by regexp (go run . search -h)
+  serve       Serve scans and plans over gRPC (go run . serve -h)
+  stats       Print corpus-wide metrics (go run . stats -h)
+  trend       Show how recorded metrics evolved (go run . trend -h)
+  verify      Check PoC signatures (go run . verify -h)
 
 Examples:
   # Scan and show duplicate groups only
   go run . -dir ./pocs
 
-  # Delete older duplicates while keeping the latest
-  go run . -dir ./pocs -delete
+  # Delete older duplicates while keeping the latest: dry run, then confirm
+  go run . -dir ./pocs -delete -dry-run
+  go run . -dir ./pocs -delete -confirm <token>
+
+  # Mark duplicates for review, delete them later
+  go run . -dir ./pocs -mark
+  go run . purge-marked -dir ./pocs
+
+  # Review the deletions first, then carry them out
+  go run . -dir ./pocs -plan plan.json
+  go run . apply plan.json
 
   # Export deduplicated PoCs to another directory
   go run . -dir ./pocs -out ./deduped
 
   # Delete and export in one shot
   go run . -dir ./pocs -delete -out ./deduped
+
+  # Only look at critical PoCs for 2023 CVEs
+  go run . -dir ./pocs -filter "cve=CVE-2023-*" -filter severity=critical
+
+  # Keep the PoC covering the highest-severity CVE according to NVD
+  go run . -dir ./pocs -nvd -keep cvss
+
+  # Only fail CI on duplicates not already accepted in the baseline
+  go run . -dir ./pocs -baseline dedup-baseline.json -fail-on duplicates
+
+  # Emit SARIF for code scanning annotations
+  go run . -dir ./pocs -format sarif > dedup.sarif
+
+  # Write a standalone HTML report for a review ticket
+  go run . -dir ./pocs -format html > dedup.html
+
+  # Render a PR comment for a CI bot
+  go run . -dir ./pocs -format markdown > comment.md
+
+  # Fail a CI pipeline (exit code 3) when duplicates exist
+  go run . -dir ./pocs -fail-on duplicates -quiet
+
+  # Review the 20 groups that free the most space first
+  go run . -dir ./pocs -sort size -top 20
+
+  # Print the report in Chinese
+  go run . -dir ./pocs -lang zh
+
+  # Split the report into one section per CODEOWNERS owner
+  go run . -dir ./pocs -codeowners .github/CODEOWNERS -assign
+
+  # Name the authors of each duplicate before deleting any
+  go run . -dir ./pocs -attribution
+
+  # Post new duplicates and parse errors to Slack after a CI run
+  go run . -dir ./pocs -baseline dedup-baseline.json -notify "slack://hooks.slack.com/services/T000/B000/XXXX"
+
+  # Record every scan and show the cleanup progress
+  go run . -dir ./pocs -history dedup-history.jsonl
+  go run . trend dedup-history.jsonl
+
+  # Review what differs before deleting
+  go run . -dir ./pocs -diff color
+
+  # Group byte-identical files, keep the oldest copy and skip templates
+  go run . -dir ./pocs -strategy hash -keep oldest -exclude 'templates/'
 `
 
+var subcommands = map[string]func(args []string) int{
+	"check":           runCheck,
+	"apply":           runApply,
+	"bench":           runBench,
+	"check-new":       runCheckNew,
+	"daemon":          runDaemon,
+	"export":          runExport,
+	"lint":            runLint,
+	"mockserver":      runMockServer,
+	"fmt":             runFmt,
+	"history":         runHistory,
+	"new":             runNew,
+	"normalize-names": runNormalizeNames,
+	"package":         runPackage,
+	"purge-marked":    runPurgeMarked,
+	"query":           runQuery,
+	"reorganize":      runReorganize,
+	"report":          runReport,
+	"search":          runSearch,
+	"serve":           runServe,
+	"stats":           runStats,
+	"trend":           runTrend,
+	"verify":          runVerify,
+}
+
 func main() {
-	dirFlag := flag.String("dir", ".", "Directory containing xray PoCs")
-	deleteFlag := flag.Bool("delete", false, "Delete duplicates keeping the most recently modified PoC")
-	outFlag := flag.String("out", "", "Directory to write deduplicated PoCs")
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+	os.Exit(run())
+}
+
+func run() (code int) {
+	sf := registerScanFlags(flag.CommandLine)
+	sf.registerTimeout()
+	deleteFlag := flag.Bool("delete", false, "Delete older duplicates, keeping one PoC per group according to -keep; needs -confirm or -dry-run")
+	confirmFlag := flag.String("confirm", "", "With -delete, the token printed by a -delete -dry-run run; nothing is deleted unless the deletions still match it")
+	dryRunFlag := flag.Bool("dry-run", false, "With -delete, report what would be deleted and print the -confirm token without changing anything")
+	var notifyFlags stringList
+	flag.Var(&notifyFlags, "notify", notifyUsage)
+	codeOwnersFlag := flag.String("codeowners", "", "CODEOWNERS file whose owners annotate each duplicate group")
+	attributionFlag := flag.Bool("attribution", false, "Name the authors of each duplicate PoC, from detail.author and author comments and from git blame, so they can be consulted before deletion")
+	assignFlag := flag.Bool("assign", false, "Split the text and markdown reports into one section per owner (needs -codeowners)")
+	historyFlag := flag.String("history", "", "Append a snapshot of this scan's metrics to this file (see history -h and trend -h)")
+	planFlag := flag.String("plan", "", "Write the deletions -delete would make to this file for review instead of deleting; run them with apply")
+	outFlag := flag.String("out", "", "Directory to write deduplicated PoCs, or s3://, gs:// or azblob:// bucket/prefix to upload them to")
+	formatFlag := flag.String("format", formatText, "Report format: text, json, sarif, html or markdown")
+	failOnFlag := flag.String("fail-on", failOnNone, "Exit non-zero when findings exist: duplicates, invalid or none (comma-separated)")
+	strictFlag := flag.Bool("strict", false, "Exit non-zero when any file was skipped (same as adding -fail-on invalid)")
+	progressFlag := flag.Bool("progress", true, "Show a live progress bar on stderr (only when stderr is a terminal)")
+	linkFlag := flag.String("link", linkCopy, "How -out materializes kept PoCs: copy, hard, symlink or reflink")
+	preserveFlag := flag.Bool("preserve", true, "Preserve file mode and modification time of exported PoCs")
+	outDeltaFlag := flag.Bool("out-delta", false, "Update -out in place, only writing files whose content changed")
+	outPruneFlag := flag.Bool("out-prune", false, "With -out-delta, remove PoCs from -out that are no longer part of the export")
+	uploadParallelFlag := flag.Int("upload-parallel", defaultUploadParallel, "Concurrent uploads when -out is object storage")
+	provenanceFlag := flag.String("provenance", provenanceNone, "Record where each exported PoC came from: sidecar (<file>"+provenanceSuffix+"), comment (x-provenance header) or none")
+	renameCollisionsFlag := flag.Bool("rename-collisions", false, "Rewrite colliding PoC names in place with a numeric suffix")
+	onNameCollisionFlag := flag.String("on-name-collision", nameCollisionWarn, "What -out does when kept PoCs share a name: warn, fail (export nothing), suffix (rename in the export) or drop (export only the first)")
+	diffFlag := flag.String("diff", diffOff, "Show a diff between the kept file and each duplicate in the text report: unified or color")
+	nvdFlag := flag.Bool("nvd", false, "Enrich CVE-tagged PoCs with CVSS score and publish date from the NVD API")
+	nvdKeyFlag := flag.String("nvd-api-key", os.Getenv("NVD_API_KEY"), "NVD API key for higher rate limits (default: $NVD_API_KEY)")
+	nvdCacheFlag := flag.String("nvd-cache", defaultNVDCachePath(), "File caching NVD lookups between runs (empty disables the cache)")
+	baselineFlag := flag.String("baseline", "", "Baseline of accepted duplicates: written on first use, later runs only report new duplicates")
+	updateBaselineFlag := flag.Bool("update-baseline", false, "Rewrite the -baseline file with the current duplicate set")
+	noColorFlag := flag.Bool("no-color", false, "Disable colors in the text report (colors are only used when stdout is a terminal)")
+	langFlag := flag.String("lang", langEnglish, "Language of the text and markdown reports and the progress bar: en or zh (JSON, SARIF and logs stay English)")
+	sortFlag := flag.String("sort", reportSortPath, "Order of the duplicate groups in the report: path, count (most PoCs first), size (most reclaimable bytes first) or newest")
+	topFlag := flag.Int("top", 0, "Only report the first N duplicate groups in -sort order (0 reports all); -delete and -out still cover every group")
+	groupReportFlag := flag.String("group-report", "", "Aggregate duplicates instead of listing groups: dir (counts and reclaimable bytes per directory; text and json only)")
+	verifyKeysFlag := flag.String("verify-keys", "", "Check PoC signatures against these ed25519 public keys (see the verify command)")
+	manifestFlag := flag.String("manifest", "", "Signed manifest of sha256 sums used with -verify-keys")
+	unverifiedFlag := flag.String("unverified", unverifiedSkip, "What to do with unsigned or invalidly signed PoCs under -verify-keys: skip or warn")
+	dedupeRulesFlag := flag.Bool("dedupe-rules", false, "Before scanning, remove rules repeated verbatim inside a PoC and update its expression")
+	transcodeFlag := flag.Bool("transcode", false, "Before scanning, rewrite PoCs saved as UTF-8 with a BOM, UTF-16 or GBK as plain UTF-8")
+	preDeleteHookFlag := flag.String("pre-delete-hook", "", "Command run before -delete with the files to remove on stdin; a non-zero exit aborts the deletion")
+	markFlag := flag.Bool("mark", false, "Instead of deleting duplicates, add an "+duplicateOfField+" field naming the kept PoC to each; delete them later with purge-marked")
+	backupFlag := flag.String("backup", "", "Directory to write a timestamped tar.gz of the files -delete removes or edits, with a manifest, before deleting")
+	postExportHookFlag := flag.String("post-export-hook", "", "Command run after -out with the exported files on stdin")
+	gitCommitFlag := flag.Bool("git-commit", false, "Commit the deletions, renames and rule rewrites of this run when -dir is in a git work tree")
+	githubPRFlag := flag.String("github-pr", "", "Open a pull request with this run's changes on the GitHub repository owner/name instead of leaving them in -dir")
+	githubTokenFlag := flag.String("github-token", "", "GitHub token for -github-pr (default: $GITHUB_TOKEN)")
+	githubBaseFlag := flag.String("github-base", "", "Base branch of the pull request (default: the repository's default branch)")
+	githubForkFlag := flag.String("github-fork", "", "Push the -github-pr branch to this fork (owner/name), or to the token owner's fork with auto, instead of the repository itself")
+	detectSubsetsFlag := flag.Bool("detect-subsets", false, "Report PoCs whose rules are a strict subset of another PoC's rules")
+	deleteSubsetsFlag := flag.Bool("delete-subsets", false, "With -delete or -plan, also delete the PoCs reported by -detect-subsets")
+	minConfidenceFlag := flag.Float64("min-confidence", 0, "With -delete or -plan, only delete from duplicate groups whose confidence is at least this: 0.4 same path, 0.7 same path and method, 0.9 same fingerprint, 1 same content")
+	lockWaitFlag := flag.Duration("lock-wait", 0, lockWaitUsage)
+	keepHookFlag := flag.String("keep-hook", "", "Command that picks the PoC to keep: gets each duplicate group as JSON on stdin, prints the file to keep")
+	versionFlag := flag.Bool("version", false, "Print the version and exit")
+	listReverseFlag := flag.Bool("list-reverse", false, "List the PoCs that need xray's reverse (OOB, dnslog) platform, i.e. call newReverse()")
+	checkpointFlag := flag.String("checkpoint", "", "Record the PoCs a scan has read in this file, every 30s and when it stops early; a rerun with the same file resumes from it")
+	excludeReverseFlag := flag.Bool("exclude-reverse", false, "Leave out the PoCs that need a reverse (OOB) server, e.g. when exporting for an offline network")
+	listStubsFlag := flag.Bool("list-stubs", false, "List the stub PoCs: no rules, an empty expression or a TODO placeholder")
+	lintFlag := flag.Bool("lint", false, "Also run the expression lint rules (expr-*) on the scanned PoCs; findings are reported with the skipped files and count for -fail-on invalid")
+	excludeStubsFlag := flag.Bool("exclude-stubs", false, "Leave out the stub PoCs from grouping, deletion and export")
+	var filterFlag stringList
+	flag.Var(&filterFlag, "filter", "Only consider PoCs matching field=glob, e.g. cve=CVE-2023-* or severity=critical,high (repeatable)")
 
 	flag.Usage = func() {
 		fmt.Fprintln(flag.CommandLine.Output(), strings.TrimSpace(usageText))
@@ -55,72 +316,777 @@ func main() {
 	}
 
 	flag.Parse()
+	if *versionFlag {
+		fmt.Printf("repeaterxraypoc %s (%s %s/%s)\n", toolVersion(), runtime.Version(), runtime.GOOS, runtime.GOARCH)
+		return exitOK
+	}
 
-	entries, err := collectPoCs(*dirFlag)
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	if opts.Filters, err = parseFilters(filterFlag); err != nil {
+		slog.Error("invalid -filter", "err", err)
+		return exitError
+	}
+
+	if *verifyKeysFlag != "" {
+		if opts.Verifier, err = newSignatureVerifier(*verifyKeysFlag, *manifestFlag); err != nil {
+			slog.Error("loading signature keys", "err", err)
+			return exitError
+		}
+	} else if *manifestFlag != "" {
+		slog.Error("-manifest requires -verify-keys")
+		return exitError
+	}
+	switch opts.Unverified = strings.ToLower(strings.TrimSpace(*unverifiedFlag)); opts.Unverified {
+	case unverifiedSkip, unverifiedWarn:
+	default:
+		slog.Error("unsupported -unverified (want skip or warn)", "unverified", *unverifiedFlag)
+		return exitError
+	}
+
+	if *deleteFlag && *planFlag != "" {
+		slog.Error("-plan replaces -delete; apply the plan to delete")
+		return exitUsage
+	}
+	if (*confirmFlag != "" || *dryRunFlag) && !*deleteFlag {
+		slog.Error("-confirm and -dry-run require -delete")
+		return exitUsage
+	}
+	if *deleteFlag && *confirmFlag == "" && !*dryRunFlag {
+		slog.Error("-delete needs -confirm <token>; run with -delete -dry-run first to review the deletions and get the token")
+		return exitUsage
+	}
+	if *markFlag && (*deleteFlag || *planFlag != "") {
+		slog.Error("-mark replaces -delete and -plan; delete marked PoCs with purge-marked")
+		return exitUsage
+	}
+	if *backupFlag != "" && !*deleteFlag {
+		slog.Error("-backup requires -delete")
+		return exitUsage
+	}
+	if *githubForkFlag != "" && *githubPRFlag == "" {
+		slog.Error("-github-fork requires -github-pr")
+		return exitUsage
+	}
+	if *dryRunFlag && *dedupeRulesFlag {
+		slog.Error("-dry-run cannot be combined with -dedupe-rules, which rewrites PoCs before the scan")
+		return exitUsage
+	}
+	if *dryRunFlag && *transcodeFlag {
+		slog.Error("-dry-run cannot be combined with -transcode, which rewrites PoCs before the scan")
+		return exitUsage
+	}
+	if *planFlag != "" && opts.Remote != nil {
+		slog.Error("-plan needs a local -dir", "dir", opts.Remote.url)
+		return exitUsage
+	}
+	if *deleteSubsetsFlag && !*deleteFlag && *planFlag == "" && !*markFlag {
+		slog.Error("-delete-subsets requires -delete, -plan or -mark")
+		return exitUsage
+	}
+	if *minConfidenceFlag < 0 || *minConfidenceFlag > 1 {
+		slog.Error("invalid -min-confidence: want a value between 0 and 1", "min-confidence", *minConfidenceFlag)
+		return exitUsage
+	}
+	if *minConfidenceFlag > 0 && !*deleteFlag && *planFlag == "" && !*markFlag {
+		slog.Error("-min-confidence requires -delete, -plan or -mark")
+		return exitUsage
+	}
+	opts.DetectSubsets = *detectSubsetsFlag || *deleteSubsetsFlag
+	opts.ExcludeReverse = *excludeReverseFlag
+	opts.ExcludeStubs = *excludeStubsFlag
+	if *checkpointFlag != "" {
+		if opts.Checkpoint, err = openCheckpoint(*checkpointFlag, opts); err != nil {
+			slog.Error("loading checkpoint", "err", err)
+			return exitError
+		}
+		if n := len(opts.Checkpoint.Files); n > 0 {
+			slog.Info("resuming from checkpoint", "checkpoint", *checkpointFlag, "files", n)
+		}
+	}
+
+	format := strings.ToLower(strings.TrimSpace(*formatFlag))
+	if !isSupportedFormat(format) {
+		slog.Error("unsupported format (want text, json, sarif, html or markdown)", "format", *formatFlag)
+		return exitError
+	}
+	switch *groupReportFlag {
+	case "":
+	case groupReportDir:
+		if format != formatText && format != formatJSON {
+			slog.Error("-group-report supports text and json output only", "format", format)
+			return exitError
+		}
+	default:
+		slog.Error("unsupported -group-report (want dir)", "group-report", *groupReportFlag)
+		return exitError
+	}
+	diffMode, err := parseDiffMode(*diffFlag)
+	if err != nil {
+		slog.Error("invalid -diff", "err", err)
+		return exitError
+	}
+	colorOutput = format == formatText && !*noColorFlag && stdoutSupportsColor()
+	if reportLang, err = parseLang(*langFlag); err != nil {
+		slog.Error("invalid -lang", "err", err)
+		return exitUsage
+	}
+	reportSort := strings.ToLower(strings.TrimSpace(*sortFlag))
+	if !isSupportedReportSort(reportSort) {
+		slog.Error("unsupported -sort (want path, count, size or newest)", "sort", *sortFlag)
+		return exitUsage
+	}
+	notifiers, err := parseNotifiers(notifyFlags)
+	if err != nil {
+		slog.Error("invalid -notify", "err", err)
+		return exitUsage
+	}
+	var owners *codeOwners
+	if *codeOwnersFlag != "" {
+		if owners, err = loadCodeOwners(*codeOwnersFlag); err != nil {
+			slog.Error("invalid -codeowners", "err", err)
+			return exitUsage
+		}
+	}
+	if *assignFlag {
+		if owners == nil {
+			slog.Error("-assign needs -codeowners")
+			return exitUsage
+		}
+		if format != formatText && format != formatMarkdown {
+			slog.Error("-assign supports text and markdown output only", "format", format)
+			return exitUsage
+		}
+	}
+	if *topFlag < 0 {
+		slog.Error("-top must not be negative")
+		return exitUsage
+	}
+	eopts := exportOptions{Preserve: *preserveFlag, Delta: *outDeltaFlag, Prune: *outPruneFlag, NormalizeEOL: opts.NormalizeEOL}
+	if eopts.Prune && !eopts.Delta {
+		slog.Error("-out-prune requires -out-delta")
+		return exitUsage
+	}
+	if isObjectStoreURL(*outFlag) {
+		// Uploads always skip unchanged objects; links and pruning need a
+		// local directory.
+		if eopts.Prune || *linkFlag != linkCopy {
+			slog.Error("-out-prune and -link are not supported with object storage -out")
+			return exitUsage
+		}
+		if *uploadParallelFlag < 1 {
+			slog.Error("-upload-parallel must be at least 1")
+			return exitUsage
+		}
+		if _, _, err := openObjectStore(context.Background(), *outFlag); err != nil {
+			slog.Error("invalid -out", "err", err)
+			return exitUsage
+		}
+	}
+	if eopts.Link, err = parseLinkMode(*linkFlag); err != nil {
+		slog.Error("invalid -link", "err", err)
+		return exitError
+	}
+	if eopts.Provenance, err = parseProvenanceMode(*provenanceFlag); err != nil {
+		slog.Error("invalid -provenance", "err", err)
+		return exitError
+	}
+	if eopts.Provenance == provenanceComment && (eopts.Link == linkHard || eopts.Link == linkSymlink) {
+		slog.Error("-provenance comment rewrites exported files and cannot be used with -link hard or symlink")
+		return exitError
+	}
+	namePolicy, err := parseNameCollisionPolicy(*onNameCollisionFlag)
+	if err != nil {
+		slog.Error("invalid -on-name-collision", "err", err)
+		return exitUsage
+	}
+	if namePolicy == nameCollisionSuffix && (eopts.Link == linkHard || eopts.Link == linkSymlink) {
+		slog.Error("-on-name-collision suffix rewrites exported files and cannot be used with -link hard or symlink")
+		return exitUsage
+	}
+	if eopts.NormalizeEOL && *outFlag != "" && (eopts.Link == linkHard || eopts.Link == linkSymlink) {
+		slog.Error("-normalize-eol rewrites exported files and cannot be used with -link hard or symlink")
+		return exitUsage
+	}
+	eopts.ScannedAt = time.Now()
+	policy, err := parseFailOn(*failOnFlag)
 	if err != nil {
-		log.Fatalf("collecting PoCs: %v", err)
+		slog.Error("invalid -fail-on", "err", err)
+		return exitError
 	}
-	if len(entries) == 0 {
-		fmt.Println("No PoC files found.")
-		return
+	if *strictFlag {
+		policy.invalid = true
 	}
+	trace := startSpan("scan", nil)
+	trace.set("dir", opts.Root)
+	trace.set("strategy", opts.Strategy)
+	defer func() {
+		trace.set("exit_code", code)
+		var err error
+		if code == exitError {
+			err = errors.New("scan failed")
+		}
+		trace.end(err)
+	}()
+	var progress *progressReporter
+	if *progressFlag && !*sf.quiet && isTerminal(os.Stderr) {
+		progress = newProgressReporter(stderrGuard, opts)
+	}
+	if (*deleteFlag && !*dryRunFlag) || *markFlag || *dedupeRulesFlag || *transcodeFlag || *renameCollisionsFlag {
+		unlock, err := lockRoot(opts, *lockWaitFlag)
+		if err != nil {
+			slog.Error("cannot lock -dir", "err", err)
+			return exitError
+		}
+		defer unlock()
+	}
+	var repo *gitRepo
+	var github *githubClient
+	if *githubPRFlag != "" {
+		token := *githubTokenFlag
+		if token == "" {
+			token = os.Getenv("GITHUB_TOKEN")
+		}
+		if github, err = newGitHubClient(*githubPRFlag, *githubForkFlag, token); err != nil {
+			slog.Error("invalid -github-pr", "err", err)
+			return exitError
+		}
+	}
+	if *gitCommitFlag || github != nil {
+		if repo, err = openGitRepo(opts.Root); err != nil {
+			slog.Error("cannot commit changes", "err", err)
+			return exitError
+		}
+	}
+	if github != nil {
+		branch := "repeaterxraypoc/dedupe-" + time.Now().UTC().Format("20060102-150405")
+		prev, err := repo.startBranch(branch)
+		if err != nil {
+			slog.Error("creating branch", "err", err)
+			return exitError
+		}
+		repo.branch = branch
+		defer func() {
+			if err := repo.leaveBranch(prev, branch, repo.committed); err != nil {
+				slog.Warn("switching back", "branch", prev, "err", err)
+			}
+		}()
+	}
+	transcoded := 0
+	if *transcodeFlag {
+		span := startSpan("transcode", trace)
+		transcoded, err = transcodePoCs(opts)
+		span.set("files", transcoded)
+		span.end(err)
+		if err != nil {
+			slog.Error("transcoding PoCs", "err", err)
+			return exitError
+		}
+		slog.Info("PoCs rewritten as UTF-8", "files", transcoded)
+	}
+	rulesRemoved := 0
+	if *dedupeRulesFlag {
+		span := startSpan("dedupe-rules", trace)
+		files, removed, err := dedupeRules(opts)
+		span.set("rules_removed", removed)
+		span.end(err)
+		if err != nil {
+			slog.Error("deduplicating rules", "err", err)
+			return exitError
+		}
+		rulesRemoved = removed
+		slog.Info("repeated rules removed", "files", files, "rules", removed)
+	}
+	span := startSpan("collect", trace)
+	ctx, cancel := sf.operation(context.Background())
+	corpus, err := collectCorpus(ctx, opts, progress)
+	cancel()
+	if corpus != nil {
+		span.set("pocs", len(corpus.units))
+		span.set("skipped", len(corpus.skipped))
+	}
+	span.end(err)
+	// A scan stopped by SIGINT or -timeout still reports what it read, but
+	// changes nothing.
+	incomplete := ""
+	if err != nil && corpus != nil {
+		incomplete, err = err.Error(), nil
+		slog.Warn("scan stopped early; reporting the files read so far", "reason", incomplete, "pocs", len(corpus.units))
+	} else if err != nil {
+		slog.Error("collecting PoCs", "err", err)
+		if opts.Checkpoint != nil {
+			if err := opts.Checkpoint.save(); err != nil {
+				slog.Warn("saving checkpoint", "checkpoint", *checkpointFlag, "err", err)
+			}
+		}
+		return exitError
+	}
+	if opts.Checkpoint != nil {
+		if incomplete != "" {
+			err = opts.Checkpoint.save()
+			if err == nil {
+				slog.Info("checkpoint written; run again with the same -checkpoint to resume", "checkpoint", *checkpointFlag, "files", len(opts.Checkpoint.Files))
+			}
+		} else {
+			slog.Debug("scan complete, checkpoint removed", "checkpoint", *checkpointFlag, "reused", opts.Checkpoint.reused)
+			err = opts.Checkpoint.remove()
+		}
+		if err != nil {
+			slog.Warn("updating checkpoint", "checkpoint", *checkpointFlag, "err", err)
+			err = nil
+		}
+	}
+	units, skipped, groups := corpus.units, corpus.skipped, corpus.groups
 
-	groups := groupEntries(entries)
-	duplicates := findDuplicates(groups)
-	if len(duplicates) == 0 {
-		fmt.Println("No duplicate PoCs detected based on path.")
-		if *outFlag != "" {
-			if err := exportDeduplicated(groups, *dirFlag, *outFlag); err != nil {
-				log.Fatalf("exporting deduplicated PoCs: %v", err)
+	if *nvdFlag && incomplete == "" {
+		span := startSpan("nvd", trace)
+		nvd, err := newNVDClient(*nvdKeyFlag, *nvdCacheFlag)
+		if err != nil {
+			span.end(err)
+			slog.Error("loading NVD cache", "err", err)
+			return exitError
+		}
+		ctx, cancel := sf.operation(context.Background())
+		nvd.enrich(ctx, units)
+		cancel()
+		span.end(nil)
+		if err := nvd.saveCache(); err != nil {
+			slog.Warn("saving NVD cache", "cache", *nvdCacheFlag, "err", err)
+		}
+	} else if !*nvdFlag && usesKeepPolicy(opts, keepCVSS) {
+		slog.Warn("keep policy cvss needs -nvd; falling back to newest")
+	}
+
+	span = startSpan("group", trace)
+	sortGroups(groups, opts)
+	if *keepHookFlag != "" {
+		if err := applyKeepHook(*keepHookFlag, groups, opts); err != nil {
+			span.end(err)
+			slog.Error("running keep hook", "err", err)
+			return exitError
+		}
+	}
+	duplicates := findDuplicates(groups, opts)
+	span.set("groups", len(groups))
+	span.set("duplicate_groups", len(duplicates))
+	span.end(nil)
+
+	allDuplicates := duplicates
+	suppressed := 0
+	if *baselineFlag != "" && incomplete != "" {
+		slog.Warn("the baseline is not applied to a partial scan", "baseline", *baselineFlag)
+	} else if *baselineFlag != "" {
+		base, err := loadBaseline(*baselineFlag)
+		if errors.Is(err, os.ErrNotExist) || (err == nil && *updateBaselineFlag) {
+			base = newBaseline(opts, duplicates)
+			if err := base.write(*baselineFlag); err != nil {
+				slog.Error("writing baseline", "baseline", *baselineFlag, "err", err)
+				return exitError
 			}
-			fmt.Printf("Deduplicated PoCs copied to %s\n", *outFlag)
+			slog.Info("baseline written", "baseline", *baselineFlag, "groups", len(base.Duplicates))
+		} else if err != nil {
+			slog.Error("loading baseline", "err", err)
+			return exitError
+		}
+		if base.Strategy != opts.Strategy {
+			slog.Warn("baseline was written with a different strategy", "baseline", base.Strategy, "strategy", opts.Strategy)
 		}
-		return
+		duplicates, suppressed = base.filter(opts, duplicates)
+	} else if *updateBaselineFlag {
+		slog.Error("-update-baseline requires -baseline")
+		return exitError
 	}
 
-	printDuplicateReport(duplicates)
+	span = startSpan("report", trace)
+	span.set("format", format)
+	collisions := findNameCollisions(units, opts)
 
-	if *deleteFlag {
-		if err := deleteDuplicateFiles(duplicates); err != nil {
-			log.Fatalf("deleting duplicates: %v", err)
+	report := buildReport(opts, units, skipped, duplicates)
+	report.BaselineSuppressed = suppressed
+	report.Incomplete = incomplete
+	report.NameCollisions = collisions
+	if opts.DetectSubsets {
+		removed := make(map[string]bool)
+		for _, unit := range deletionUnits(duplicates) {
+			removed[unit] = true
+		}
+		report.Subsets = findSubsets(units, removed)
+	}
+	if *listReverseFlag {
+		report.Reverse = findReversePoCs(units)
+	}
+	if *listStubsFlag {
+		report.Stubs = findStubPoCs(units)
+	}
+	if *lintFlag {
+		if report.Lint, err = lintEntries(units, scanLintRules()); err != nil {
+			span.end(err)
+			slog.Error("linting PoCs", "err", err)
+			return exitError
+		}
+	}
+	invalid := len(skipped) + len(report.Lint)
+	if *groupReportFlag == groupReportDir {
+		report.Directories = summarizeByDir(report)
+	}
+	removals, lowConfidence := confidentGroups(duplicates, *minConfidenceFlag)
+	if lowConfidence > 0 {
+		slog.Info("leaving duplicate groups below -min-confidence alone", "groups", lowConfidence, "min-confidence", *minConfidenceFlag)
+	}
+	if *deleteSubsetsFlag {
+		removals = append(removals[:len(removals):len(removals)], subsetGroups(report.Subsets, units)...)
+	}
+	var deletions *dedupePlan
+	var confirmToken string
+	if *deleteFlag && incomplete == "" && len(removals) > 0 {
+		if deletions, err = newPlan(opts, removals); err != nil {
+			slog.Error("planning deletions", "err", err)
+			return exitError
+		}
+		confirmToken = deletions.confirmToken()
+		if *dryRunFlag {
+			report.ConfirmToken = confirmToken
+		}
+	}
+	// Taken before -top so the notification covers every new group.
+	summary := newScanSummary(report, func(string) bool { return true })
+	sortReportGroups(report.Duplicates, reportSort)
+	limitReportGroups(&report, *topFlag)
+	if owners != nil {
+		assignOwners(&report, owners)
+	}
+	if *attributionFlag {
+		attributeGroups(&report, opts.Root)
+	}
+	switch format {
+	case formatJSON:
+		err = writeJSONReport(os.Stdout, report)
+	case formatSARIF:
+		err = writeSARIFReport(os.Stdout, report)
+	case formatHTML:
+		err = writeHTMLReport(os.Stdout, report, computeStats(opts, corpus, 20))
+	case formatMarkdown:
+		err = writeMarkdownReport(os.Stdout, report, *assignFlag)
+	default:
+		if !*sf.quiet {
+			printTextReport(report, textReportOptions{
+				Deleting: *deleteFlag || *planFlag != "" || *markFlag,
+				Diff:     diffMode,
+				ByDir:    *groupReportFlag == groupReportDir,
+				Sort:     reportSort,
+				Assign:   *assignFlag,
+			})
+		}
+	}
+	span.end(err)
+	if err != nil {
+		slog.Error("writing report", "format", format, "err", err)
+		return exitError
+	}
+	if incomplete != "" {
+		return exitError
+	}
+	if len(units) == 0 {
+		return policy.exitCode(0, invalid)
+	}
+	if *dryRunFlag {
+		if confirmToken == "" {
+			slog.Info("dry run: nothing to delete")
+		} else {
+			slog.Info("dry run: nothing deleted; run again with -delete -confirm to delete", "units", len(deletionUnits(removals)), "confirm", confirmToken)
+		}
+		return policy.exitCode(len(duplicates), invalid)
+	}
+	if *deleteFlag && confirmToken != "" && *confirmFlag != confirmToken {
+		// Files or groups changed since the dry run, or the token belongs to
+		// another run: what it reviewed is not what would be deleted now.
+		slog.Error("the deletions do not match -confirm; run with -delete -dry-run again and review them", "confirm", *confirmFlag)
+		return exitError
+	}
+
+	// -rename-collisions leaves every surviving name unique, kept ones
+	// included.
+	if *outFlag != "" && !*renameCollisionsFlag {
+		if eopts.Names, err = exportNameDecisions(groups, opts, namePolicy); err != nil {
+			slog.Error("refusing to export", "err", err)
+			return exitError
+		}
+	}
+
+	var deleted []string
+	kept := keepDescription(opts.Keep)
+	if len(opts.PreferRoots) > 0 {
+		kept = fmt.Sprintf("%s (preferring %s)", kept, strings.Join(opts.PreferRoots, " over "))
+	}
+	if *keepHookFlag != "" {
+		kept = "chosen by -keep-hook"
+	}
+	if *planFlag != "" {
+		plan, err := newPlan(opts, removals)
+		if err == nil {
+			err = plan.write(*planFlag)
+		}
+		if err != nil {
+			slog.Error("writing plan", "plan", *planFlag, "err", err)
+			return exitError
+		}
+		slog.Info("plan written; review it, then run apply", "plan", *planFlag, "actions", len(plan.Actions))
+	}
+	if *deleteFlag && len(removals) > 0 {
+		span := startSpan("delete", trace)
+		if *preDeleteHookFlag != "" {
+			if err := runFileHook(*preDeleteHookFlag, hookPreDelete, deletionUnits(removals), opts.Root, *outFlag); err != nil {
+				span.end(err)
+				slog.Error("deletion aborted", "err", err)
+				return exitError
+			}
+		}
+		if *backupFlag != "" {
+			archive, err := writeBackup(*backupFlag, deletions)
+			if err != nil {
+				span.end(err)
+				slog.Error("deletion aborted: writing backup", "backup", *backupFlag, "err", err)
+				return exitError
+			}
+			slog.Info("backup written", "archive", archive, "files", len(deletions.Actions))
+		}
+		deleted, err = deleteDuplicateFiles(removals)
+		span.set("deleted", len(deleted))
+		span.end(err)
+		if err != nil {
+			slog.Error("deleting duplicates", "err", err)
+			return exitError
+		}
+		slog.Info("duplicate files deleted", "deleted", len(deleted), "kept", kept, "per", opts.Strategy)
+	}
+
+	var marked []string
+	if *markFlag && len(removals) > 0 {
+		span := startSpan("mark", trace)
+		marked, err = markDuplicates(removals, opts.Root)
+		span.set("marked", len(marked))
+		span.end(err)
+		if err != nil {
+			slog.Error("marking duplicates", "err", err)
+			return exitError
+		}
+		slog.Info("duplicates marked; review them, then run purge-marked", "marked", len(marked), "field", duplicateOfField)
+	}
+
+	renamed := 0
+	if *renameCollisionsFlag && len(collisions) > 0 {
+		if renamed, err = renameCollisions(collisions, units, deleted); err != nil {
+			slog.Error("renaming name collisions", "err", err)
+			return exitError
+		}
+		slog.Info("name collisions renamed", "renamed", renamed)
+	}
+
+	if repo != nil {
+		span := startSpan("git-commit", trace)
+		message := dedupeCommitMessage(opts, kept, removals, deleted, len(marked), renamed, rulesRemoved, transcoded)
+		committed, err := repo.commit(message)
+		span.end(err)
+		if err != nil {
+			slog.Error("committing changes", "err", err)
+			return exitError
+		}
+		if committed {
+			slog.Info("changes committed", "dir", opts.Root)
+		}
+		if committed && github != nil {
+			span := startSpan("github-pr", trace)
+			url, err := github.openPullRequest(repo, repo.branch, *githubBaseFlag, message)
+			span.end(err)
+			if err != nil {
+				slog.Error("opening pull request", "err", err)
+				return exitError
+			}
+			slog.Info("pull request opened", "url", url)
 		}
-		fmt.Println("Duplicate files deleted (kept the most recent version for each path).")
-	} else {
-		fmt.Println("\nRun again with -delete to remove the older duplicates automatically.")
 	}
 
 	if *outFlag != "" {
-		if err := exportDeduplicated(groups, *dirFlag, *outFlag); err != nil {
-			log.Fatalf("exporting deduplicated PoCs: %v", err)
+		span := startSpan("export", trace)
+		span.set("link", eopts.Link)
+		ctx, cancel := sf.operation(context.Background())
+		var exported []string
+		if isObjectStoreURL(*outFlag) {
+			exported, err = exportToObjectStore(ctx, groups, opts.Root, *outFlag, eopts, *uploadParallelFlag)
+		} else {
+			exported, err = exportDeduplicated(ctx, groups, opts.Root, *outFlag, eopts)
+		}
+		cancel()
+		span.set("files", len(exported))
+		span.end(err)
+		if err != nil {
+			slog.Error("exporting deduplicated PoCs", "err", err)
+			return exitError
+		}
+		slog.Info("deduplicated PoCs exported", "out", *outFlag)
+		if *postExportHookFlag != "" {
+			if err := runFileHook(*postExportHookFlag, hookPostExport, exported, opts.Root, *outFlag); err != nil {
+				slog.Error("running post-export hook", "err", err)
+				return exitError
+			}
+		}
+	}
+	if *historyFlag != "" {
+		snapshot := newHistorySnapshot(opts, corpus, allDuplicates, len(collisions), len(deleted))
+		if err := appendHistory(*historyFlag, snapshot); err != nil {
+			slog.Warn("recording history", "history", *historyFlag, "err", err)
 		}
-		fmt.Printf("Deduplicated PoCs copied to %s\n", *outFlag)
 	}
+	sendNotifications(notifiers, summary)
+	return policy.exitCode(len(duplicates), invalid)
 }
 
-func collectPoCs(root string) ([]pocEntry, error) {
+func (o scanOptions) validate() error {
+	switch o.Strategy {
+	case strategyPath, strategyHash, strategyFingerprint:
+	case strategyFields:
+		if len(o.GroupBy) == 0 {
+			return errors.New("strategy fields needs -group-by")
+		}
+	default:
+		return fmt.Errorf("unsupported strategy %q (want path, hash or fingerprint)", o.Strategy)
+	}
+	if !isKeepPolicy(o.Keep) {
+		return fmt.Errorf("unsupported keep policy %q (want newest, oldest, cvss or severity)", o.Keep)
+	}
+	for _, override := range o.Overrides {
+		if override.Keep != "" && !isKeepPolicy(strings.ToLower(override.Keep)) {
+			return fmt.Errorf("override %s: unsupported keep policy %q", override.Path, override.Keep)
+		}
+	}
+	return nil
+}
+
+func collectPoCs(ctx context.Context, opts scanOptions, progress *progressReporter) ([]pocEntry, []skippedFile, error) {
 	var entries []pocEntry
-	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+	skipped, err := streamPoCs(ctx, opts, progress, func(fileEntries []pocEntry) {
+		entries = append(entries, fileEntries...)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, skipped, nil
+}
+
+// streamPoCs loads the PoCs under the root one file at a time and hands the
+// entries of each file to add, so callers decide what to keep in memory.
+// When ctx ends it stops and returns the cause with the files skipped so far.
+func streamPoCs(ctx context.Context, opts scanOptions, progress *progressReporter, add func([]pocEntry)) ([]skippedFile, error) {
+	var skipped []skippedFile
+	err := walkPoCFiles(opts, func(path string) error {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		var verifyErr error
+		if opts.Verifier != nil {
+			if verifyErr = opts.Verifier.verify(path); verifyErr != nil {
+				verifyErr = fmt.Errorf("signature check: %w", verifyErr)
+			}
+		}
+		fileEntries, cached := opts.Checkpoint.lookup(opts.Root, path)
+		var err error
+		if !cached {
+			fileEntries, err = loadPoC(path, opts)
+			if err == nil {
+				opts.Checkpoint.record(opts.Root, path, fileEntries)
+			}
+		}
+		if err == nil && verifyErr != nil && opts.Unverified != unverifiedWarn {
+			err = verifyErr
+		}
+		if err != nil {
+			slog.Warn("skipping file", "file", path, "err", err)
+			skipped = append(skipped, skippedFile{File: path, Error: err.Error()})
+			progress.fileDone(nil, true)
+			return nil
+		}
+		if verifyErr != nil {
+			slog.Warn("unverified PoC", "file", path, "err", verifyErr)
+			for i := range fileEntries {
+				fileEntries[i].Unverified = true
+			}
+		}
+		if len(opts.Filters) > 0 && len(fileEntries) > 0 {
+			fileEntries = slices.DeleteFunc(fileEntries, func(entry pocEntry) bool {
+				if !matchFilters(opts.Filters, entry) {
+					slog.Debug("filtered out", "file", entry.unit())
+					return true
+				}
+				return false
+			})
+			if len(fileEntries) == 0 {
+				progress.fileDone(nil, false)
+				return nil
+			}
+		}
+		if opts.ExcludeReverse {
+			fileEntries = slices.DeleteFunc(fileEntries, func(entry pocEntry) bool {
+				if entry.Detail.Reverse {
+					slog.Debug("needs a reverse server, excluded", "file", entry.unit())
+				}
+				return entry.Detail.Reverse
+			})
+			if len(fileEntries) == 0 {
+				progress.fileDone(nil, false)
+				return nil
+			}
+		}
+		if opts.ExcludeStubs {
+			fileEntries = slices.DeleteFunc(fileEntries, func(entry pocEntry) bool {
+				if entry.Detail.Stub != "" {
+					slog.Debug("stub PoC excluded", "file", entry.unit(), "reason", entry.Detail.Stub)
+				}
+				return entry.Detail.Stub != ""
+			})
+			if len(fileEntries) == 0 {
+				progress.fileDone(nil, false)
+				return nil
+			}
+		}
+		slog.Debug("loaded PoC", "file", path, "entries", len(fileEntries))
+		for _, entry := range fileEntries {
+			slog.Log(context.Background(), levelTrace, "grouping key", "file", path, "key", entry.Key)
+		}
+		add(fileEntries)
+		progress.fileDone(fileEntries, false)
+		return nil
+	})
+	progress.finish()
+	return skipped, err
+}
+
+// walkPoCFiles calls fn for every supported PoC file under the root that is
+// not excluded.
+func walkPoCFiles(opts scanOptions, fn func(path string) error) error {
+	excluded := newExcludeMatcher(opts.Excludes, opts.Overrides)
+	ignored := ignoreFiles{}
+	return filepath.WalkDir(opts.Root, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if d.IsDir() {
+		rel := relativeTo(opts.Root, path)
+		if path != opts.Root && (excluded.match(rel, d.IsDir()) || ignored.match(rel, d.IsDir())) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
-		if !isSupportedExt(path) {
-			return nil
+		if d.IsDir() {
+			return ignored.load(path, rel)
 		}
-		fileEntries, err := loadPoC(path)
-		if err != nil {
-			log.Printf("Skipping %s: %v", path, err)
+		if !isSupportedExt(path) || strings.HasSuffix(path, provenanceSuffix) || d.Name() == configFileName {
 			return nil
 		}
-		entries = append(entries, fileEntries...)
-		return nil
+		return fn(path)
 	})
-	if err != nil {
-		return nil, err
-	}
-	return entries, nil
 }
 
 func isSupportedExt(path string) bool {
@@ -132,41 +1098,188 @@ func isSupportedExt(path string) bool {
 	}
 }
 
-func loadPoC(path string) ([]pocEntry, error) {
+// pocFile is a parsed PoC file together with its source bytes, so callers can
+// both inspect the document and edit it in place. Root is the first document;
+// files holding several PoCs separated by `---` list them all in Docs.
+type pocFile struct {
+	Path string
+	// Raw is the content as UTF-8; Charset is what the file is in.
+	Raw     []byte
+	Charset string
+	Root    yaml.Node
+	Docs    []yamlDoc
+}
+
+func readPoCFile(path string) (*pocFile, error) {
 	raw, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	var root yaml.Node
-	if err := yaml.Unmarshal(raw, &root); err != nil {
+	raw, charset, err := decodePoC(raw)
+	if err != nil {
 		return nil, err
 	}
-	paths := extractPathValues(&root)
-	if len(paths) == 0 {
-		return nil, errors.New("missing path field")
+	if isJSONFile(path) {
+		node, err := parseJSONDocument(raw)
+		if err != nil {
+			return nil, err
+		}
+		return &pocFile{Path: path, Raw: raw, Charset: charset, Root: node, Docs: []yamlDoc{{Raw: raw, Node: node}}}, nil
 	}
+	docs, err := splitDocuments(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &pocFile{Path: path, Raw: raw, Charset: charset, Root: docs[0].Node, Docs: docs}, nil
+}
+
+func loadPoC(path string, opts scanOptions) ([]pocEntry, error) {
 	info, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
-	name := strings.TrimSpace(findFirstScalar(&root, "name"))
-	if name == "" {
+	if opts.MaxFileSize > 0 && info.Size() > opts.MaxFileSize {
+		return nil, fmt.Errorf("file size %s exceeds -max-file-size %s", humanBytes(info.Size()), humanBytes(opts.MaxFileSize))
+	}
+	return parseWithin(opts.ParseTimeout, func() ([]pocEntry, error) {
+		file, err := readPoCFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkExpansion(file, opts.MaxNodes); err != nil {
+			return nil, err
+		}
+		var entries []pocEntry
+		for i, doc := range file.Docs {
+			docEntries, err := loadDocument(path, i, &doc, opts)
+			if err != nil {
+				if len(file.Docs) == 1 {
+					return nil, err
+				}
+				return nil, fmt.Errorf("document %d: %w", i, err)
+			}
+			for j := range docEntries {
+				docEntries[j].ModTime = info.ModTime()
+				docEntries[j].Docs = len(file.Docs)
+				docEntries[j].Size = info.Size()
+				if len(file.Docs) > 1 {
+					docEntries[j].Size = int64(len(doc.Raw))
+				}
+			}
+			entries = append(entries, docEntries...)
+		}
+		return entries, nil
+	})
+}
+
+func loadDocument(path string, index int, doc *yamlDoc, opts scanOptions) ([]pocEntry, error) {
+	root := &doc.Node
+	paths, err := requestKeys(root, opts.Loose)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 && opts.Strategy != strategyFields && (len(root.Content) == 0 || mappingValue(root.Content[0], "rules") == nil) {
+		// Other YAML living next to the PoCs, such as CI workflows.
+		return nil, errors.New("missing path field")
+	}
+	name := strings.TrimSpace(findFirstScalar(root, "name"))
+	hasName := name != ""
+	if !hasName {
 		name = filepath.Base(path)
 	}
+	detail := extractDetail(root, name)
+	exempt := hasIgnorePragma(root, doc.Raw)
+	var rules []string
+	if opts.DetectSubsets {
+		rules = ruleSet(root, opts.Normalize)
+	}
+	content := contentHash(root, doc.Raw, opts.NormalizeEOL)
+	methods := requestMethods(root)
+	entry := func(requestPath, key string) pocEntry {
+		return pocEntry{
+			pocMeta:  pocMeta{Name: name, Path: requestPath},
+			Key:      key,
+			FilePath: path,
+			Doc:      index,
+			Detail:   detail,
+			Exempt:   exempt,
+			HasName:  hasName,
+			RuleSet:  rules,
+			Content:  content,
+			Methods:  methods,
+		}
+	}
+	var firstPath string
+	if len(paths) > 0 {
+		firstPath = paths[0]
+	}
+	switch opts.Strategy {
+	case strategyFields:
+		key, err := groupByKey(opts.GroupBy, root, opts.Normalize)
+		if err != nil {
+			return nil, err
+		}
+		return []pocEntry{entry(firstPath, key)}, nil
+	case strategyFingerprint:
+		key, err := detectionFingerprint(root, opts.Normalize)
+		if err != nil {
+			return nil, err
+		}
+		return []pocEntry{entry(firstPath, key)}, nil
+	case strategyHash:
+		return []pocEntry{entry(firstPath, "sha256:"+content)}, nil
+	}
+	if len(paths) == 0 {
+		// Nothing to compare but the content: the PoC stays in the corpus,
+		// and in exports, grouped with copies of the same content only.
+		return []pocEntry{entry("", noPathKeyPrefix+content)}, nil
+	}
 	var entries []pocEntry
+	seen := make(map[string]struct{})
 	for _, p := range paths {
-		entries = append(entries, pocEntry{
-			pocMeta: pocMeta{
-				Name: name,
-				Path: p,
-			},
-			FilePath: path,
-			ModTime:  info.ModTime(),
-		})
+		key := opts.Normalize.apply(p)
+		if opts.GenericPaths[key] {
+			key = genericPathKey(key, content)
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		entries = append(entries, entry(p, key))
 	}
 	return entries, nil
 }
 
+// extractRequestPaths returns the request paths of the rules only:
+// rules.*.request.path in the v2 layout and rules[].path in v1.
+func extractRequestPaths(doc *yaml.Node) []string {
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	var candidates []*yaml.Node
+	rules := mappingValue(doc.Content[0], "rules")
+	if rules != nil && rules.Kind == yaml.MappingNode {
+		for i := 1; i < len(rules.Content); i += 2 {
+			candidates = append(candidates, mappingValue(mappingValue(rules.Content[i], "request"), "path"))
+		}
+	} else if rules != nil && rules.Kind == yaml.SequenceNode {
+		for _, rule := range rules.Content {
+			candidates = append(candidates, mappingValue(rule, "path"))
+		}
+	}
+	var out []string
+	for _, n := range candidates {
+		if n == nil || n.Kind != yaml.ScalarNode {
+			continue
+		}
+		if value := strings.TrimSpace(n.Value); value != "" {
+			out = appendUnique(out, value)
+		}
+	}
+	return out
+}
+
+// extractPathValues returns every scalar path value anywhere in the document.
 func extractPathValues(node *yaml.Node) []string {
 	seen := make(map[string]struct{})
 	var out []string
@@ -206,10 +1319,17 @@ func extractPathValues(node *yaml.Node) []string {
 }
 
 func findFirstScalar(node *yaml.Node, key string) string {
-	var result string
+	if n := findFirstScalarNode(node, key); n != nil {
+		return strings.TrimSpace(n.Value)
+	}
+	return ""
+}
+
+func findFirstScalarNode(node *yaml.Node, key string) *yaml.Node {
+	var result *yaml.Node
 	var walk func(*yaml.Node)
 	walk = func(n *yaml.Node) {
-		if n == nil || result != "" {
+		if n == nil || result != nil {
 			return
 		}
 		switch n.Kind {
@@ -218,11 +1338,12 @@ func findFirstScalar(node *yaml.Node, key string) string {
 				walk(child)
 			}
 		case yaml.MappingNode:
-			for i := 0; i < len(n.Content)-1 && result == ""; i += 2 {
+			for i := 0; i < len(n.Content)-1 && result == nil; i += 2 {
 				keyNode := n.Content[i]
 				valNode := n.Content[i+1]
-				if strings.EqualFold(strings.TrimSpace(keyNode.Value), key) && valNode.Kind == yaml.ScalarNode {
-					result = strings.TrimSpace(valNode.Value)
+				if strings.EqualFold(strings.TrimSpace(keyNode.Value), key) && valNode.Kind == yaml.ScalarNode &&
+					strings.TrimSpace(valNode.Value) != "" {
+					result = valNode
 					return
 				}
 				walk(valNode)
@@ -238,123 +1359,113 @@ func findFirstScalar(node *yaml.Node, key string) string {
 }
 
 type duplicateGroup struct {
-	Path    string
+	Key     string
 	Entries []pocEntry
+	// Confidence scores the group, on the grounds Basis names.
+	Confidence float64
+	Basis      string
 }
 
-func groupEntries(entries []pocEntry) map[string][]pocEntry {
-	groupMap := map[string][]pocEntry{}
-	for _, entry := range entries {
-		key := entry.Path
-		groupMap[key] = append(groupMap[key], entry)
+func groupKey(entry pocEntry, opts scanOptions) string {
+	key := entry.Key
+	if t := entry.Detail.Transport; !opts.CrossTransport && t != transportHTTP {
+		// Paths of tcp/udp PoCs live in payload metadata and mean
+		// nothing next to an http request path.
+		key = t + ":" + key
 	}
-	for key, list := range groupMap {
-		sort.Slice(list, func(i, j int) bool {
-			return list[i].ModTime.After(list[j].ModTime)
-		})
-		groupMap[key] = list
+	if entry.Exempt {
+		// A group of its own keeps the file in exports without ever
+		// making it a duplicate.
+		key = "exempt:" + entry.FilePath + ":" + key
+	}
+	return key
+}
+
+// sortGroups orders every group by its keep policy, keeper first.
+func sortGroups(groupMap map[string][]pocEntry, opts scanOptions) {
+	for _, list := range groupMap {
+		sortByKeepPolicy(list, groupKeepPolicy(list, opts), keepFallback(opts))
+		sortByPreferredRoot(list, opts)
 	}
-	return groupMap
 }
 
-func findDuplicates(groupMap map[string][]pocEntry) []duplicateGroup {
+func findDuplicates(groupMap map[string][]pocEntry, opts scanOptions) []duplicateGroup {
 	var groups []duplicateGroup
-	for path, list := range groupMap {
+	for key, list := range groupMap {
 		if len(list) > 1 {
+			confidence, basis := groupConfidence(list, opts.Strategy)
 			groups = append(groups, duplicateGroup{
-				Path:    path,
-				Entries: list,
+				Key:        key,
+				Entries:    list,
+				Confidence: confidence,
+				Basis:      basis,
 			})
 		}
 	}
 	sort.Slice(groups, func(i, j int) bool {
-		return groups[i].Path < groups[j].Path
+		return groups[i].Key < groups[j].Key
 	})
 	return groups
 }
 
-func printDuplicateReport(groups []duplicateGroup) {
-	fmt.Printf("Detected %d duplicated path groups:\n", len(groups))
+// deleteDuplicateFiles removes every duplicate but the first of each group.
+// Documents of a multi-document file are cut out of it; the file itself is
+// only removed once all its documents are duplicates.
+func deleteDuplicateFiles(groups []duplicateGroup) ([]string, error) {
+	drop := make(map[string]map[int]bool)
+	units := make(map[string][]string)
+	multiDoc := make(map[string]bool)
+	var files []string
 	for _, group := range groups {
-		fmt.Printf("\nPath: %s\n", group.Path)
-		for _, entry := range group.Entries {
-			fmt.Printf("  - name=%q file=%s modified=%s\n", entry.Name, entry.FilePath, entry.ModTime.Format(time.RFC3339))
-		}
-		fmt.Printf("  * keep: %s\n", group.Entries[0].FilePath)
-	}
-}
-
-func deleteDuplicateFiles(groups []duplicateGroup) error {
-	deleted := make(map[string]struct{})
-	for _, group := range groups {
-		filesToDelete := group.Entries[1:]
-		for _, entry := range filesToDelete {
-			if _, ok := deleted[entry.FilePath]; ok {
-				continue
+		for _, entry := range group.Entries[1:] {
+			docs := drop[entry.FilePath]
+			if docs == nil {
+				docs = make(map[int]bool)
+				drop[entry.FilePath] = docs
+				files = append(files, entry.FilePath)
 			}
-			if err := os.Remove(entry.FilePath); err != nil {
-				return fmt.Errorf("remove %s: %w", entry.FilePath, err)
+			if docs[entry.Doc] {
+				continue
 			}
-			deleted[entry.FilePath] = struct{}{}
+			docs[entry.Doc] = true
+			multiDoc[entry.FilePath] = entry.Docs > 1
+			units[entry.FilePath] = append(units[entry.FilePath], entry.unit())
+			slog.Debug("deleting duplicate", "file", entry.unit(), "kept", group.Entries[0].unit())
 		}
 	}
-	return nil
-}
-
-func exportDeduplicated(groupMap map[string][]pocEntry, rootDir, outDir string) error {
-	if outDir == "" {
-		return nil
-	}
-	absRoot, err := filepath.Abs(rootDir)
-	if err != nil {
-		return err
-	}
-	absOut, err := filepath.Abs(outDir)
-	if err != nil {
-		return err
-	}
-	if err := os.MkdirAll(absOut, 0o755); err != nil {
-		return err
-	}
-
-	paths := make([]string, 0, len(groupMap))
-	for path := range groupMap {
-		paths = append(paths, path)
-	}
-	sort.Strings(paths)
-
-	for _, path := range paths {
-		entries := groupMap[path]
-		if len(entries) == 0 {
-			continue
+	var removed []string
+	for _, file := range files {
+		remove := os.Remove
+		if multiDoc[file] {
+			remove = func(path string) error { return removeDocuments(path, drop[file]) }
 		}
-		src := entries[0].FilePath
-		absSrc, err := filepath.Abs(src)
-		if err != nil {
-			return err
-		}
-		rel, err := filepath.Rel(absRoot, absSrc)
-		if err != nil || strings.HasPrefix(rel, "..") {
-			rel = filepath.Base(absSrc)
-		}
-		dest := filepath.Join(absOut, rel)
-		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
-			return err
-		}
-		if err := copyFile(absSrc, dest); err != nil {
-			return err
+		if err := remove(longPath(file)); err != nil {
+			return removed, fmt.Errorf("remove %s: %w", file, err)
 		}
+		removed = append(removed, units[file]...)
 	}
-	return nil
+	return removed, nil
 }
 
-func copyFile(src, dst string) error {
-	if src == dst {
-		return nil
+// deletionUnits lists what deleteDuplicateFiles would remove, in order.
+func deletionUnits(groups []duplicateGroup) []string {
+	seen := make(map[string]bool)
+	var units []string
+	for _, group := range groups {
+		for _, entry := range group.Entries[1:] {
+			if unit := entry.unit(); !seen[unit] {
+				seen[unit] = true
+				units = append(units, unit)
+			}
+		}
 	}
-	data, err := os.ReadFile(src)
+	return units
+}
+
+func relativeTo(root, path string) string {
+	rel, err := filepath.Rel(root, path)
 	if err != nil {
-		return err
+		return filepath.ToSlash(path)
 	}
-	return os.WriteFile(dst, data, 0o644)
+	return filepath.ToSlash(rel)
 }
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// duplicateOfField is the top-level field -mark adds to a duplicate instead
+// of deleting it. Its value is the PoC kept in its place, relative to -dir,
+// as a/b.yml or a/b.yml#1 for a document of a multi-document file.
+const duplicateOfField = "x-duplicate-of"
+
+// duplicateMarkedField records when -mark added duplicateOfField, as an
+// RFC 3339 time, for purge-marked -older-than.
+const duplicateMarkedField = "x-duplicate-marked"
+
+const purgeMarkedUsage = `
+Usage:
+  go run . purge-marked -dir <path-to-pocs> [-older-than <duration>] [-dry-run] [-pre-delete-hook <cmd>] [-backup <dir>] [-lock-wait <duration>]
+
+Deletes the PoCs a scan with -mark annotated with ` + duplicateOfField + `, once the
+annotations have been reviewed; remove the field from a PoC to keep it. A
+marked PoC whose kept copy is gone or marked as well stays, so a purge never
+deletes the last copy. Documents of a multi-document file are cut out, and the
+file is deleted once every document is marked. With -older-than, only PoCs
+marked at least that long ago are deleted, giving reviewers a grace period.
+
+Flags:
+`
+
+// markDuplicates adds duplicateOfField to the PoCs the groups would delete,
+// naming the kept PoC of their group, and returns the marked units.
+func markDuplicates(groups []duplicateGroup, root string) ([]string, error) {
+	targets := make(map[string]map[int]string)
+	var files []string
+	for _, group := range groups {
+		kept := relativeTo(root, group.Entries[0].unit())
+		for _, entry := range group.Entries[1:] {
+			docs := targets[entry.FilePath]
+			if docs == nil {
+				docs = make(map[int]string)
+				targets[entry.FilePath] = docs
+				files = append(files, entry.FilePath)
+			}
+			if _, ok := docs[entry.Doc]; !ok {
+				docs[entry.Doc] = kept
+			}
+		}
+	}
+	var marked []string
+	for _, file := range files {
+		units, err := markFile(file, targets[file])
+		if err != nil {
+			return marked, fmt.Errorf("mark %s: %w", file, err)
+		}
+		marked = append(marked, units...)
+	}
+	return marked, nil
+}
+
+func markFile(file string, targets map[int]string) ([]string, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	pf, err := readPoCFile(longPath(file))
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]int, 0, len(targets))
+	for doc := range targets {
+		docs = append(docs, doc)
+	}
+	sort.Ints(docs)
+	var units []string
+	for _, doc := range docs {
+		if doc >= len(pf.Docs) {
+			return nil, fmt.Errorf("document %d no longer exists", doc)
+		}
+		e, err := newPoCEditor(file, pf.Docs[doc].Raw)
+		if err != nil {
+			return nil, err
+		}
+		// A PoC marked for another kept PoC is up for review again.
+		top := e.root.Content[0]
+		if scalarValue(mappingValue(top, duplicateOfField)) != targets[doc] || mappingValue(top, duplicateMarkedField) == nil {
+			if err := e.setField(duplicateMarkedField, now); err != nil {
+				return nil, err
+			}
+		}
+		if err := e.setField(duplicateOfField, targets[doc]); err != nil {
+			return nil, err
+		}
+		pf.Docs[doc].Raw = e.raw
+		unit := file
+		if len(pf.Docs) > 1 {
+			unit = fmt.Sprintf("%s#%d", file, doc)
+		}
+		units = append(units, unit)
+		slog.Debug("marked duplicate", "file", unit, "duplicate_of", targets[doc])
+	}
+	info, err := os.Stat(longPath(file))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(longPath(file), joinDocuments(pf.Docs, func(int) bool { return true }), info.Mode().Perm()); err != nil {
+		return nil, err
+	}
+	// Keep the modification time, which -keep newest and oldest go by, so a
+	// rescan keeps the same PoC rather than the marked one.
+	return units, os.Chtimes(longPath(file), info.ModTime(), info.ModTime())
+}
+
+// splitUnit parses a unit relative to root, as duplicateOfField holds it,
+// into the file and the document, which is 0 when none is given.
+func splitUnit(root, unit string) (string, int, error) {
+	doc := 0
+	if i := strings.LastIndexByte(unit, '#'); i >= 0 {
+		if n, err := strconv.Atoi(unit[i+1:]); err == nil && n >= 0 {
+			unit, doc = unit[:i], n
+		}
+	}
+	file, err := safeJoin(root, unit)
+	return file, doc, err
+}
+
+func runPurgeMarked(args []string) int {
+	fs := flag.NewFlagSet("purge-marked", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	olderThanFlag := fs.Duration("older-than", 0, "Only delete PoCs marked at least this long ago, e.g. 168h (0 deletes every marked PoC)")
+	dryRunFlag := fs.Bool("dry-run", false, "List the marked PoCs that would be deleted without deleting them")
+	preDeleteHookFlag := fs.String("pre-delete-hook", "", "Command run with the files to delete on stdin before deleting; a failure aborts")
+	backupFlag := fs.String("backup", "", "Directory to write a timestamped tar.gz of the files to delete or edit, with a manifest, before deleting")
+	lockWaitFlag := fs.Duration("lock-wait", 0, lockWaitUsage)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(purgeMarkedUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	if !*dryRunFlag {
+		unlock, err := lockRoot(opts, *lockWaitFlag)
+		if err != nil {
+			slog.Error("cannot lock -dir", "err", err)
+			return exitError
+		}
+		defer unlock()
+	}
+	if *olderThanFlag < 0 {
+		slog.Error("-older-than must not be negative")
+		return exitUsage
+	}
+	plan, err := markedPlan(opts, *olderThanFlag, time.Now())
+	if err != nil {
+		slog.Error("finding marked PoCs", "err", err)
+		return exitError
+	}
+	units := plan.units()
+	if *dryRunFlag || len(units) == 0 {
+		for _, a := range plan.Actions {
+			fmt.Printf("%s (%s, duplicate of %s)\n", a.File, a.Action, strings.Join(a.DuplicateOf, ", "))
+		}
+		slog.Info("marked PoCs to purge", "files", len(plan.Actions), "pocs", len(units))
+		return exitOK
+	}
+	if *preDeleteHookFlag != "" {
+		if err := runFileHook(*preDeleteHookFlag, hookPreDelete, units, plan.Root, ""); err != nil {
+			slog.Error("purge aborted", "err", err)
+			return exitError
+		}
+	}
+	if *backupFlag != "" {
+		archive, err := writeBackup(*backupFlag, plan)
+		if err != nil {
+			slog.Error("purge aborted: writing backup", "backup", *backupFlag, "err", err)
+			return exitError
+		}
+		slog.Info("backup written", "archive", archive, "files", len(plan.Actions))
+	}
+	if err := plan.apply(); err != nil {
+		slog.Error("purging marked PoCs", "err", err)
+		return exitError
+	}
+	slog.Info("marked PoCs purged", "files", len(plan.Actions), "pocs", len(units))
+	return exitOK
+}
+
+// markedPoC is a document carrying duplicateOfField.
+type markedPoC struct {
+	target string
+	at     time.Time
+}
+
+// markedPlan finds the PoCs under opts.Root marked with duplicateOfField
+// and plans the deletion of those marked at least olderThan before now,
+// leaving out those whose kept PoC is missing or marked too. A PoC without
+// a valid duplicateMarkedField counts as marked when the file was modified.
+func markedPlan(opts scanOptions, olderThan time.Duration, now time.Time) (*dedupePlan, error) {
+	root, err := filepath.Abs(opts.Root)
+	if err != nil {
+		return nil, err
+	}
+	marked := make(map[string]map[int]markedPoC)
+	docCount := make(map[string]int)
+	err = walkPoCFiles(opts, func(path string) error {
+		pf, err := readPoCFile(path)
+		if err != nil {
+			slog.Warn("skipping file", "file", path, "err", err)
+			return nil
+		}
+		for i, doc := range pf.Docs {
+			if len(doc.Node.Content) == 0 {
+				continue
+			}
+			target := resolveAlias(mappingValue(doc.Node.Content[0], duplicateOfField))
+			if target == nil || target.Kind != yaml.ScalarNode || strings.TrimSpace(target.Value) == "" {
+				continue
+			}
+			file, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			at, err := time.Parse(time.RFC3339, scalarValue(mappingValue(doc.Node.Content[0], duplicateMarkedField)))
+			if err != nil {
+				info, err := os.Stat(path)
+				if err != nil {
+					return err
+				}
+				at = info.ModTime()
+			}
+			if marked[file] == nil {
+				marked[file] = make(map[int]markedPoC)
+			}
+			marked[file][i] = markedPoC{target: strings.TrimSpace(target.Value), at: at}
+			docCount[file] = len(pf.Docs)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &dedupePlan{
+		Version:     planVersion,
+		ToolVersion: toolVersion(),
+		Created:     time.Now().UTC().Truncate(time.Second),
+		Root:        root,
+		Strategy:    "mark",
+		Actions:     []planAction{},
+		Files:       map[string]string{},
+	}
+	recent := 0
+	for file, docs := range marked {
+		a := planAction{File: relativeTo(root, file)}
+		for doc, m := range docs {
+			if now.Sub(m.at) < olderThan {
+				recent++
+				continue
+			}
+			target := m.target
+			kept, keptDoc, err := splitUnit(root, target)
+			if err == nil {
+				_, err = os.Stat(longPath(kept))
+			}
+			if err == nil && marked[kept] != nil {
+				if _, ok := marked[kept][keptDoc]; ok {
+					err = fmt.Errorf("%s is marked as a duplicate too", target)
+				}
+			}
+			if err != nil {
+				slog.Warn("keeping marked PoC whose kept copy is unavailable", "file", a.File, "doc", doc, duplicateOfField, target, "err", err)
+				continue
+			}
+			if err := plan.record(root, kept); err != nil {
+				return nil, err
+			}
+			a.Docs = append(a.Docs, doc)
+			if !slices.Contains(a.DuplicateOf, target) {
+				a.DuplicateOf = append(a.DuplicateOf, target)
+			}
+		}
+		if len(a.Docs) == 0 {
+			continue
+		}
+		if err := plan.record(root, file); err != nil {
+			return nil, err
+		}
+		sort.Ints(a.Docs)
+		sort.Strings(a.DuplicateOf)
+		a.Action = planRemoveDocs
+		if len(a.Docs) == docCount[file] {
+			a.Action, a.Docs = planDelete, nil
+		}
+		plan.Actions = append(plan.Actions, a)
+	}
+	sort.Slice(plan.Actions, func(i, j int) bool { return plan.Actions[i].File < plan.Actions[j].File })
+	if recent > 0 {
+		slog.Info("leaving PoCs marked less than -older-than ago", "pocs", recent, "older-than", olderThan)
+	}
+	return plan, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// writeMarkdownReport renders the report as a PR comment: a one-line summary
+// followed by one collapsible section per finding, with file paths relative
+// to the scanned root so they read the same on every CI runner.
+func writeMarkdownReport(w io.Writer, report scanReport, assign bool) error {
+	bw := bufio.NewWriter(w)
+	rel := func(path string) string {
+		return relativeTo(report.Root, path)
+	}
+
+	fmt.Fprintln(bw, tr("### PoC duplicate check"))
+	fmt.Fprintln(bw)
+	if report.Incomplete != "" {
+		fmt.Fprintf(bw, tr("**Partial report:** the scan stopped early (%s) and only covers the files read until then.\n\n"), report.Incomplete)
+	}
+	if len(report.Duplicates) == 0 && len(report.NameCollisions) == 0 && len(report.Skipped) == 0 && len(report.Lint) == 0 {
+		fmt.Fprintf(bw, tr("No duplicate PoCs detected among %d files (strategy: %s).\n"), report.Files, report.Strategy)
+		return bw.Flush()
+	}
+	fmt.Fprintf(bw, tr("Scanned %d files (strategy: %s): **%d duplicate groups**, %d name collisions, %d skipped files.\n"),
+		report.Files, report.Strategy, len(report.Duplicates)+report.OmittedGroups, len(report.NameCollisions), len(report.Skipped))
+	if report.OmittedGroups > 0 {
+		fmt.Fprintf(bw, tr("\nOnly the top %d groups are listed.\n"), len(report.Duplicates))
+	}
+
+	if assign {
+		for _, section := range splitByOwner(report.Duplicates) {
+			fmt.Fprintf(bw, tr("\n#### %s: %d groups\n"), markdownEscapeHTML(section.Owner), len(section.Groups))
+			for _, group := range section.Groups {
+				writeMarkdownGroup(bw, group, rel)
+			}
+		}
+	} else {
+		for _, group := range report.Duplicates {
+			writeMarkdownGroup(bw, group, rel)
+		}
+	}
+
+	if len(report.NameCollisions) > 0 {
+		fmt.Fprintln(bw)
+		fmt.Fprintf(bw, tr("<details>\n<summary>%d name collisions</summary>\n\n"), len(report.NameCollisions))
+		for _, collision := range report.NameCollisions {
+			files := make([]string, len(collision.Files))
+			for i, file := range collision.Files {
+				files[i] = "`" + rel(file) + "`"
+			}
+			fmt.Fprintf(bw, "- `%s`: %s\n", collision.Name, strings.Join(files, ", "))
+		}
+		fmt.Fprintln(bw, "\n</details>")
+	}
+
+	if len(report.Lint) > 0 {
+		fmt.Fprintln(bw)
+		fmt.Fprintf(bw, tr("<details>\n<summary>%d lint findings</summary>\n\n"), len(report.Lint))
+		for _, finding := range report.Lint {
+			fmt.Fprintf(bw, "- `%s`: [%s] %s\n", rel(finding.File), finding.Rule, markdownCell(finding.Message))
+		}
+		fmt.Fprintln(bw, "\n</details>")
+	}
+
+	if len(report.Skipped) > 0 {
+		fmt.Fprintln(bw)
+		fmt.Fprintf(bw, tr("<details>\n<summary>%d skipped files</summary>\n\n"), len(report.Skipped))
+		for _, skipped := range report.Skipped {
+			fmt.Fprintf(bw, "- `%s`: %s\n", rel(skipped.File), markdownCell(skipped.Error))
+		}
+		fmt.Fprintln(bw, "\n</details>")
+	}
+	return bw.Flush()
+}
+
+func writeMarkdownGroup(bw *bufio.Writer, group reportGroup, rel func(string) string) {
+	fmt.Fprintln(bw)
+	fmt.Fprintf(bw, tr("<details>\n<summary><code>%s</code> — %d PoCs</summary>\n\n"), markdownEscapeHTML(group.Key), len(group.Entries))
+	fmt.Fprintf(bw, tr("Confidence: %.1f (%s)\n\n"), group.Confidence, tr(group.Basis))
+	if len(group.Owners) > 0 {
+		fmt.Fprintf(bw, tr("Owners: %s\n\n"), markdownCell(strings.Join(group.Owners, " ")))
+	}
+	if len(group.Attribution) > 0 {
+		fmt.Fprintln(bw, tr("Authors:"))
+		fmt.Fprintln(bw)
+		for _, attr := range group.Attribution {
+			fmt.Fprintf(bw, "- `%s`: %s\n", markdownCell(rel(attr.File)), markdownCell(describeAttribution(attr)))
+		}
+		fmt.Fprintln(bw)
+	}
+	fmt.Fprintln(bw, tr("| | Name | File | Modified | Severity | CVE |"))
+	fmt.Fprintln(bw, "| --- | --- | --- | --- | --- | --- |")
+	for _, entry := range group.Entries {
+		mark := ""
+		if entry.unit() == group.Entries[0].unit() {
+			mark = tr("keep")
+		}
+		fmt.Fprintf(bw, "| %s | %s | `%s` | %s | %s | %s |\n",
+			mark,
+			markdownCell(entry.Name),
+			markdownCell(rel(entry.unit())),
+			entry.ModTime.Format(time.DateOnly),
+			markdownCell(entry.Detail.Severity),
+			markdownCell(strings.Join(entry.Detail.CVEs, ", ")))
+	}
+	fmt.Fprintln(bw, "\n</details>")
+}
+
+// markdownCell keeps a value on one table row and stops it from closing the cell.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+func markdownEscapeHTML(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
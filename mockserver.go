@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const mockServerUsage = `
+Usage:
+  go run . mockserver -fixtures <dir> [-listen <addr>]
+
+Serves canned HTTP responses so PoCs can be smoke-tested without a real
+target. Every .yml or .yaml file in the fixtures directory holds a list of
+responses; a request gets the first one whose method and path match, files
+read in name order, or an empty 404 when none does.
+
+  - method: GET              # optional, any method when empty
+    path: /login             # exact path; include ?query to match it too
+    path_regex: ^/api/v\d+/  # or a regexp on path and query
+    status: 200              # default 200
+    headers:
+      Content-Type: text/html
+    body: <title>Login</title>
+    body_file: login.html    # instead of body, relative to the fixture file
+
+Flags:
+`
+
+// mockResponse is one canned response of a fixture file.
+type mockResponse struct {
+	Method    string            `yaml:"method"`
+	Path      string            `yaml:"path"`
+	PathRegex string            `yaml:"path_regex"`
+	Status    int               `yaml:"status"`
+	Headers   map[string]string `yaml:"headers"`
+	Body      string            `yaml:"body"`
+	BodyFile  string            `yaml:"body_file"`
+
+	pathRegex *regexp.Regexp
+	source    string
+}
+
+func runMockServer(args []string) int {
+	fs := flag.NewFlagSet("mockserver", flag.ExitOnError)
+	fixturesFlag := fs.String("fixtures", "", "Directory of fixture files with the canned responses")
+	listenFlag := fs.String("listen", "127.0.0.1:8080", "Address to listen on")
+	quietFlag := fs.Bool("quiet", false, "Only log errors")
+	verboseFlag := fs.Bool("v", false, "Log every request (debug level)")
+	logFormatFlag := fs.String("log-format", logFormatText, "Log format on stderr: text or json")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(mockServerUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	logger, err := newLogger(stderrGuard, *logFormatFlag, logLevel(*quietFlag, *verboseFlag, false))
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	slog.SetDefault(logger)
+	if *fixturesFlag == "" {
+		slog.Error("-fixtures is required")
+		return exitUsage
+	}
+	responses, err := loadMockFixtures(*fixturesFlag)
+	if err != nil {
+		slog.Error("loading fixtures", "err", err)
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ln, err := net.Listen("tcp", *listenFlag)
+	if err != nil {
+		slog.Error("listening", "err", err)
+		return exitError
+	}
+	server := &http.Server{Handler: mockHandler(responses), ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(ln)
+	}()
+	slog.Info("mock server started", "url", "http://"+ln.Addr().String()+"/", "responses", len(responses))
+
+	select {
+	case err := <-serveErr:
+		slog.Error("serving", "err", err)
+		return exitError
+	case <-ctx.Done():
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdown); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("stopping HTTP server", "err", err)
+		}
+		return exitOK
+	}
+}
+
+// loadMockFixtures reads every fixture file of dir, in name order.
+func loadMockFixtures(dir string) ([]mockResponse, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".yml", ".yaml":
+			if !e.IsDir() {
+				names = append(names, e.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+	var responses []mockResponse
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var list []mockResponse
+		if err := yaml.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for i := range list {
+			r := &list[i]
+			r.source = fmt.Sprintf("%s[%d]", name, i)
+			if r.Path != "" && r.PathRegex != "" {
+				return nil, fmt.Errorf("%s: path and path_regex are mutually exclusive", r.source)
+			}
+			if r.PathRegex != "" {
+				if r.pathRegex, err = regexp.Compile(r.PathRegex); err != nil {
+					return nil, fmt.Errorf("%s: path_regex: %w", r.source, err)
+				}
+			}
+			if r.BodyFile != "" {
+				if r.Body != "" {
+					return nil, fmt.Errorf("%s: body and body_file are mutually exclusive", r.source)
+				}
+				body, err := os.ReadFile(filepath.Join(dir, r.BodyFile))
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", r.source, err)
+				}
+				r.Body = string(body)
+			}
+			if r.Status == 0 {
+				r.Status = http.StatusOK
+			}
+			if r.Status < 100 || r.Status > 999 {
+				return nil, fmt.Errorf("%s: invalid status %d", r.source, r.Status)
+			}
+		}
+		responses = append(responses, list...)
+	}
+	return responses, nil
+}
+
+func (m *mockResponse) matches(r *http.Request) bool {
+	if m.Method != "" && !strings.EqualFold(m.Method, r.Method) {
+		return false
+	}
+	switch {
+	case m.pathRegex != nil:
+		return m.pathRegex.MatchString(r.URL.RequestURI())
+	case m.Path == "":
+		return true
+	case strings.Contains(m.Path, "?"):
+		return m.Path == r.URL.RequestURI()
+	default:
+		return m.Path == r.URL.Path
+	}
+}
+
+// mockHandler replays the first matching response. Without any responses
+// it answers every request with an empty 200 page.
+func mockHandler(responses []mockResponse) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if responses == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<html><body></body></html>")
+			return
+		}
+		for i := range responses {
+			m := &responses[i]
+			if !m.matches(r) {
+				continue
+			}
+			slog.Debug("mock request", "method", r.Method, "uri", r.URL.RequestURI(), "fixture", m.source, "status", m.Status)
+			for k, v := range m.Headers {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(m.Status)
+			fmt.Fprint(w, m.Body)
+			return
+		}
+		slog.Debug("mock request", "method", r.Method, "uri", r.URL.RequestURI(), "status", http.StatusNotFound)
+		w.WriteHeader(http.StatusNotFound)
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlDoc is one document of a PoC file. Raw is the exact source of the
+// document, including its `---` marker and any comments before it, so the
+// Raw of every document concatenated gives back the whole file.
+type yamlDoc struct {
+	Raw  []byte
+	Node yaml.Node
+}
+
+// splitDocuments cuts a YAML stream at its document markers. A `---` or
+// `...` line at column 0 can never be content, so a line scan is exact.
+// Segments without content (a leading comment block, a trailing marker) are
+// merged into their neighbour.
+func splitDocuments(raw []byte) ([]yamlDoc, error) {
+	var segments [][]byte
+	start := 0
+	for offset := 0; offset < len(raw); {
+		end := bytes.IndexByte(raw[offset:], '\n')
+		next := len(raw)
+		if end >= 0 {
+			next = offset + end + 1
+		}
+		line := bytes.TrimRight(raw[offset:next], "\r\n")
+		switch {
+		case isDocumentStart(line) && offset > start:
+			segments = append(segments, raw[start:offset])
+			start = offset
+		case bytes.Equal(bytes.TrimRight(line, " \t"), []byte("...")):
+			segments = append(segments, raw[start:next])
+			start = next
+		}
+		offset = next
+	}
+	if start < len(raw) {
+		segments = append(segments, raw[start:])
+	}
+
+	var docs []yamlDoc
+	var pending []byte
+	for _, segment := range segments {
+		var node yaml.Node
+		if err := yaml.Unmarshal(segment, &node); err != nil {
+			return nil, fmt.Errorf("document %d: %w", len(docs), err)
+		}
+		if len(node.Content) == 0 {
+			pending = append(pending, segment...)
+			continue
+		}
+		docs = append(docs, yamlDoc{Raw: append(pending, segment...)})
+		pending = nil
+	}
+	if len(docs) == 0 {
+		return nil, errors.New("empty document")
+	}
+	last := &docs[len(docs)-1]
+	last.Raw = append(last.Raw, pending...)
+	for i := range docs {
+		// Re-parse so node positions match the merged source.
+		if err := yaml.Unmarshal(docs[i].Raw, &docs[i].Node); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+	return docs, nil
+}
+
+func isDocumentStart(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("---")) &&
+		(len(line) == 3 || line[3] == ' ' || line[3] == '\t')
+}
+
+func joinDocuments(docs []yamlDoc, keep func(i int) bool) []byte {
+	var out []byte
+	for i, doc := range docs {
+		if keep(i) {
+			out = append(out, doc.Raw...)
+		}
+	}
+	return out
+}
+
+// unit identifies what delete and export act on: the file, or one document
+// of a multi-document file.
+func (e pocEntry) unit() string {
+	if e.Docs > 1 {
+		return fmt.Sprintf("%s#%d", e.FilePath, e.Doc)
+	}
+	return e.FilePath
+}
+
+// removeDocuments deletes the given documents from file, removing the file
+// once no document is left.
+func removeDocuments(file string, drop map[int]bool) error {
+	f, err := readPoCFile(file)
+	if err != nil {
+		return err
+	}
+	remaining := 0
+	for i := range f.Docs {
+		if !drop[i] {
+			remaining++
+		}
+	}
+	if remaining == 0 {
+		return os.Remove(file)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	data := joinDocuments(f.Docs, func(i int) bool { return !drop[i] })
+	if err := os.WriteFile(file, data, info.Mode().Perm()); err != nil {
+		return err
+	}
+	slog.Debug("removed documents", "file", file, "removed", len(f.Docs)-remaining, "remaining", remaining)
+	return nil
+}
+
+// writeDocuments writes the kept documents of src to dst.
+func writeDocuments(src, dst string, keep map[int]bool, preserve bool) error {
+	f, err := readPoCFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dst, joinDocuments(f.Docs, func(i int) bool { return keep[i] }), 0o644); err != nil {
+		return err
+	}
+	if preserve {
+		return preserveAttributes(src, dst)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// nameCollision lists files sharing one PoC name, in keep-policy order: the
+// first file keeps the name when collisions are renamed. Documents of
+// multi-document files are listed as file#index.
+type nameCollision struct {
+	Name  string   `json:"name"`
+	Files []string `json:"files"`
+}
+
+func findNameCollisions(entries []pocEntry, opts scanOptions) []nameCollision {
+	byName := make(map[string][]pocEntry)
+	seen := make(map[string]struct{})
+	for _, entry := range entries {
+		if !entry.HasName {
+			continue
+		}
+		if _, ok := seen[entry.unit()]; ok {
+			continue
+		}
+		seen[entry.unit()] = struct{}{}
+		byName[entry.Name] = append(byName[entry.Name], entry)
+	}
+	collisions := []nameCollision{}
+	for name, list := range byName {
+		if len(list) < 2 {
+			continue
+		}
+		sortByKeepPolicy(list, opts.Keep, keepFallback(opts))
+		sortByPreferredRoot(list, opts)
+		collision := nameCollision{Name: name}
+		for _, entry := range list {
+			collision.Files = append(collision.Files, entry.unit())
+		}
+		collisions = append(collisions, collision)
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i].Name < collisions[j].Name
+	})
+	return collisions
+}
+
+// renameCollisions appends -2, -3, ... to the name of every colliding file
+// except the first surviving one. Deleted files are ignored.
+func renameCollisions(collisions []nameCollision, entries []pocEntry, deleted []string) (int, error) {
+	gone := make(map[string]struct{}, len(deleted))
+	for _, file := range deleted {
+		gone[file] = struct{}{}
+	}
+	taken := make(map[string]struct{})
+	byUnit := make(map[string]pocEntry)
+	for _, entry := range entries {
+		taken[entry.Name] = struct{}{}
+		byUnit[entry.unit()] = entry
+	}
+
+	renamed := 0
+	for _, c := range collisions {
+		var survivors []string
+		for _, file := range c.Files {
+			if _, ok := gone[file]; !ok {
+				survivors = append(survivors, file)
+			}
+		}
+		if len(survivors) < 2 {
+			continue
+		}
+		suffix := 2
+		for _, unit := range survivors[1:] {
+			var name string
+			for {
+				name = c.Name + "-" + strconv.Itoa(suffix)
+				suffix++
+				if _, ok := taken[name]; !ok {
+					break
+				}
+			}
+			entry := byUnit[unit]
+			if err := rewritePoCName(entry.FilePath, entry.Doc, c.Name, name); err != nil {
+				return renamed, fmt.Errorf("rename %s: %w", unit, err)
+			}
+			taken[name] = struct{}{}
+			renamed++
+			slog.Debug("renamed PoC", "file", unit, "from", c.Name, "to", name)
+		}
+	}
+	return renamed, nil
+}
+
+func rewritePoCName(file string, doc int, oldName, newName string) error {
+	pf, err := readPoCFile(file)
+	if err != nil {
+		return err
+	}
+	if doc >= len(pf.Docs) {
+		return fmt.Errorf("document %d no longer exists", doc)
+	}
+	target := &pf.Docs[doc]
+	e, err := newPoCEditor(file, target.Raw)
+	if err != nil {
+		return err
+	}
+	if findFirstScalar(&e.root, "name") != oldName {
+		return fmt.Errorf("name field changed since scan")
+	}
+	if err := e.setName(newName); err != nil {
+		return err
+	}
+	target.Raw = e.raw
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, joinDocuments(pf.Docs, func(int) bool { return true }), info.Mode().Perm())
+}
+
+// Policies for name collisions among the PoCs an export keeps, chosen with
+// -on-name-collision. xray refuses to load a directory with duplicate plugin
+// names, so only warn leaves them in the export.
+const (
+	nameCollisionWarn   = "warn"
+	nameCollisionFail   = "fail"
+	nameCollisionSuffix = "suffix"
+	nameCollisionDrop   = "drop"
+)
+
+func parseNameCollisionPolicy(value string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(value)); policy {
+	case nameCollisionWarn, nameCollisionFail, nameCollisionSuffix, nameCollisionDrop:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown policy %q (want warn, fail, suffix or drop)", value)
+	}
+}
+
+// keptEntries lists the PoC every group keeps, the set an export writes.
+func keptEntries(groupMap map[string][]pocEntry) []pocEntry {
+	var kept []pocEntry
+	for _, entries := range groupMap {
+		if len(entries) > 0 {
+			kept = append(kept, entries[0])
+		}
+	}
+	return kept
+}
+
+// exportNameDecision records what an export did with a kept PoC whose name
+// an earlier kept PoC already has. Files are relative to -dir.
+type exportNameDecision struct {
+	Name    string
+	File    string
+	KeptBy  string
+	Policy  string
+	NewName string
+	// unit is the PoC as scanned, to match it while exporting.
+	unit string
+}
+
+func (d exportNameDecision) String() string {
+	switch d.Policy {
+	case nameCollisionSuffix:
+		return fmt.Sprintf("name collision %s: renamed %s to %s (kept by %s)", d.Name, d.File, d.NewName, d.KeptBy)
+	case nameCollisionDrop:
+		return fmt.Sprintf("name collision %s: dropped %s (kept by %s)", d.Name, d.File, d.KeptBy)
+	default:
+		return fmt.Sprintf("name collision %s: exported %s alongside %s", d.Name, d.File, d.KeptBy)
+	}
+}
+
+// exportNameDecisions resolves the name collisions among the PoCs groups
+// keep and logs every decision. Under the fail policy any collision is an
+// error.
+func exportNameDecisions(groups map[string][]pocEntry, opts scanOptions, policy string) ([]exportNameDecision, error) {
+	kept := keptEntries(groups)
+	collisions := findNameCollisions(kept, opts)
+	decisions := resolveExportCollisions(collisions, kept, opts.Root, policy)
+	for _, d := range decisions {
+		switch policy {
+		case nameCollisionFail:
+			slog.Error("exported PoCs would share a name", "name", d.Name, "file", d.File, "kept_by", d.KeptBy)
+		case nameCollisionWarn:
+			slog.Warn("exported PoCs share a name", "name", d.Name, "file", d.File, "kept_by", d.KeptBy)
+		default:
+			slog.Info("name collision resolved in export", "decision", d.String())
+		}
+	}
+	if policy == nameCollisionFail && len(collisions) > 0 {
+		return nil, fmt.Errorf("%d names collide among the exported PoCs; see -on-name-collision", len(collisions))
+	}
+	return decisions, nil
+}
+
+// resolveExportCollisions decides the fate of every kept PoC that shares
+// its name with another: the first in keep-policy order keeps the name, the
+// others are suffixed, dropped or only reported, as policy says.
+func resolveExportCollisions(collisions []nameCollision, kept []pocEntry, root, policy string) []exportNameDecision {
+	taken := make(map[string]struct{}, len(kept))
+	for _, entry := range kept {
+		taken[entry.Name] = struct{}{}
+	}
+	var decisions []exportNameDecision
+	for _, c := range collisions {
+		suffix := 2
+		for _, unit := range c.Files[1:] {
+			d := exportNameDecision{
+				Name:   c.Name,
+				File:   relativeTo(root, unit),
+				KeptBy: relativeTo(root, c.Files[0]),
+				Policy: policy,
+				unit:   unit,
+			}
+			if policy == nameCollisionSuffix {
+				for {
+					d.NewName = c.Name + "-" + strconv.Itoa(suffix)
+					suffix++
+					if _, ok := taken[d.NewName]; !ok {
+						break
+					}
+				}
+				taken[d.NewName] = struct{}{}
+			}
+			decisions = append(decisions, d)
+		}
+	}
+	return decisions
+}
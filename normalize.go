@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	normalizeCase   = "case"
+	normalizeSlash  = "slash"
+	normalizeQuery  = "query"
+	normalizeTokens = "tokens"
+	normalizeNone   = "none"
+
+	// defaultNormalize only drops trailing slashes: the others would merge
+	// endpoints that may differ, and -delete trusts the grouping.
+	defaultNormalize = normalizeSlash
+
+	// tokenPlaceholder replaces every template token, so PoCs differing only
+	// in random-marker names ({{r1}} vs {{r2}}, {{reverse.url}}) collide.
+	tokenPlaceholder = "{{}}"
+)
+
+var templateToken = regexp.MustCompile(`\{\{[^{}]*\}\}`)
+
+// pathNormalizer turns a request path into the fingerprint used as grouping
+// key, so trivially different spellings of the same endpoint collide.
+type pathNormalizer struct {
+	lowerCase     bool
+	trimSlash     bool
+	stripQuery    bool
+	replaceTokens bool
+}
+
+func parseNormalize(value string) (pathNormalizer, error) {
+	var n pathNormalizer
+	for _, part := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(part)) {
+		case "", normalizeNone:
+		case normalizeCase:
+			n.lowerCase = true
+		case normalizeSlash:
+			n.trimSlash = true
+		case normalizeQuery:
+			n.stripQuery = true
+		case normalizeTokens:
+			n.replaceTokens = true
+		default:
+			return pathNormalizer{}, fmt.Errorf("unknown normalization %q (want case, slash, query, tokens or none)", part)
+		}
+	}
+	return n, nil
+}
+
+func (n pathNormalizer) apply(p string) string {
+	if n.replaceTokens {
+		p = templateToken.ReplaceAllString(p, tokenPlaceholder)
+	}
+	if n.stripQuery {
+		if i := strings.IndexAny(p, "?#"); i >= 0 {
+			p = p[:i]
+		}
+	}
+	if n.trimSlash {
+		if trimmed := strings.TrimRight(p, "/"); trimmed != "" {
+			p = trimmed
+		} else if p != "" {
+			p = "/"
+		}
+	}
+	if n.lowerCase {
+		p = strings.ToLower(p)
+	}
+	return p
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const normalizeNamesUsage = `
+Usage:
+  go run . normalize-names -dir <path-to-pocs> [-dry-run] [-map <file>] [-git-mv] [-lock-wait <duration>]
+
+Renames PoC files after their name field, the way xray names them:
+poc-yaml-<vendor>-<product>-<vuln>.yml. The name is lowercased, runs of other
+characters than letters, digits and dashes become a dash, and the poc-yaml-
+prefix is added when missing; .yaml files become .yml, JSON files keep .json.
+Files stay in their directory. When the new name is taken, by another file or
+by another PoC renamed before, -2, -3, ... is appended. Files holding several
+PoCs or no name are left alone. Each rename is printed as old -> new; -map
+writes them as a JSON object of paths relative to -dir, for updating
+references elsewhere. With -git-mv, files tracked by git are moved with git mv
+so the renames are staged.
+
+Flags:
+`
+
+// fileMove is one file normalize-names or reorganize moves, relative to the
+// root.
+type fileMove struct {
+	From string
+	To   string
+}
+
+func runNormalizeNames(args []string) int {
+	fs := flag.NewFlagSet("normalize-names", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	dryRunFlag := fs.Bool("dry-run", false, "Print the renames without renaming anything")
+	mapFlag := fs.String("map", "", "Write the renames as a JSON object of old to new paths to this file")
+	gitMvFlag := fs.Bool("git-mv", false, "Rename files tracked by git with git mv")
+	lockWaitFlag := fs.Duration("lock-wait", 0, lockWaitUsage)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(normalizeNamesUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	if !*dryRunFlag {
+		unlock, err := lockRoot(opts, *lockWaitFlag)
+		if err != nil {
+			slog.Error("cannot lock -dir", "err", err)
+			return exitError
+		}
+		defer unlock()
+	}
+	renames, err := planNameRenames(opts)
+	if err != nil {
+		slog.Error("planning renames", "err", err)
+		return exitError
+	}
+
+	done := renames
+	if !*dryRunFlag {
+		done, err = moveFiles(opts.Root, renames, *gitMvFlag)
+		if err != nil {
+			slog.Error("renaming PoCs", "err", err)
+		}
+	}
+	if !*sf.quiet {
+		for _, r := range done {
+			fmt.Printf("%s -> %s\n", r.From, r.To)
+		}
+	}
+	if *mapFlag != "" {
+		if werr := writeRenameMap(*mapFlag, done); werr != nil {
+			slog.Error("writing rename map", "map", *mapFlag, "err", werr)
+			return exitError
+		}
+	}
+	if err != nil {
+		return exitError
+	}
+	slog.Info("PoC file names normalized", "renamed", len(done), "dry_run", *dryRunFlag)
+	return exitOK
+}
+
+// normalizedStem is the file name, without extension, that xray's naming
+// convention gives a PoC called name, or "" when name has nothing to go by.
+func normalizedStem(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	stem := strings.TrimPrefix(b.String(), pocNamePrefix)
+	if stem == "" || stem == strings.TrimSuffix(pocNamePrefix, "-") {
+		return ""
+	}
+	return pocNamePrefix + stem
+}
+
+// planNameRenames finds the files whose name does not follow the convention
+// and picks their new name, suffixed when it is taken. Every file present
+// counts as taken, so the renames can be carried out one after another.
+func planNameRenames(opts scanOptions) ([]fileMove, error) {
+	type candidate struct {
+		path, name string
+	}
+	var candidates []candidate
+	taken := make(map[string]bool)
+	err := walkPoCFiles(opts, func(path string) error {
+		taken[fileKey(relativeTo(opts.Root, path))] = true
+		pf, err := readPoCFile(path)
+		if err != nil {
+			slog.Warn("skipping file", "file", path, "err", err)
+			return nil
+		}
+		if len(pf.Docs) != 1 {
+			slog.Debug("leaving file with several PoCs", "file", path, "pocs", len(pf.Docs))
+			return nil
+		}
+		if name := findFirstScalar(&pf.Root, "name"); name != "" {
+			candidates = append(candidates, candidate{path: path, name: name})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].path < candidates[j].path })
+
+	var renames []fileMove
+	for _, c := range candidates {
+		stem := normalizedStem(c.name)
+		if stem == "" {
+			slog.Warn("name gives no file name", "file", c.path, "name", c.name)
+			continue
+		}
+		ext := ".yml"
+		if isJSONFile(c.path) {
+			ext = ".json"
+		}
+		from := relativeTo(opts.Root, c.path)
+		dir := filepath.ToSlash(filepath.Dir(filepath.FromSlash(from)))
+		if dir == "." {
+			dir = ""
+		} else {
+			dir += "/"
+		}
+		to := dir + stem + ext
+		if to == from {
+			continue
+		}
+		for suffix := 2; taken[fileKey(to)] && fileKey(to) != fileKey(from); suffix++ {
+			to = dir + stem + "-" + strconv.Itoa(suffix) + ext
+		}
+		if to == from {
+			continue
+		}
+		taken[fileKey(to)] = true
+		renames = append(renames, fileMove{From: from, To: to})
+	}
+	return renames, nil
+}
+
+// moveFiles moves the files, with their provenance sidecars, creating the
+// directories they move to and removing those they leave empty. It returns
+// the moves carried out, up to the one that failed.
+func moveFiles(root string, moves []fileMove, gitMv bool) ([]fileMove, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	var done []fileMove
+	for _, r := range moves {
+		from := filepath.Join(abs, filepath.FromSlash(r.From))
+		to := filepath.Join(abs, filepath.FromSlash(r.To))
+		if err := os.MkdirAll(longPath(filepath.Dir(to)), 0o755); err != nil {
+			return done, err
+		}
+		if err := movePoCFile(abs, from, to, gitMv); err != nil {
+			return done, fmt.Errorf("move %s to %s: %w", r.From, r.To, err)
+		}
+		if _, err := os.Lstat(from + provenanceSuffix); err == nil {
+			if err := movePoCFile(abs, from+provenanceSuffix, to+provenanceSuffix, gitMv); err != nil {
+				slog.Warn("provenance sidecar not moved", "file", r.From+provenanceSuffix, "err", err)
+			}
+		}
+		done = append(done, r)
+		slog.Debug("moved PoC file", "from", r.From, "to", r.To)
+		for dir := filepath.Dir(from); dir != abs && strings.HasPrefix(dir, abs); dir = filepath.Dir(dir) {
+			if os.Remove(longPath(dir)) != nil {
+				break
+			}
+		}
+	}
+	return done, nil
+}
+
+// movePoCFile renames from to to, with git mv when asked and git tracks
+// the file. An existing to is never overwritten.
+func movePoCFile(root, from, to string, gitMv bool) error {
+	if info, err := os.Lstat(longPath(to)); err == nil {
+		if src, err := os.Lstat(longPath(from)); err == nil && os.SameFile(src, info) {
+			return renameCase(root, from, to, gitMv)
+		}
+		return fmt.Errorf("%s exists", to)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if gitMv {
+		if out, err := git(root, nil, "ls-files", "--", from); err == nil && strings.TrimSpace(out) != "" {
+			_, err := git(root, nil, "mv", "--", from, to)
+			return err
+		}
+	}
+	return os.Rename(longPath(from), longPath(to))
+}
+
+// renameCase renames from to to when to already names from, as when only
+// the case differs on a case-insensitive filesystem: through a temporary
+// name, since renaming a file onto itself does nothing.
+func renameCase(root, from, to string, gitMv bool) error {
+	tmp := from + ".rename"
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(longPath(tmp)); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		tmp = from + ".rename" + strconv.Itoa(i)
+	}
+	if err := movePoCFile(root, from, tmp, gitMv); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(longPath(to)); err == nil {
+		// to was another link to the file, not from itself.
+		if err := movePoCFile(root, tmp, from, gitMv); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s exists", to)
+	}
+	return movePoCFile(root, tmp, to, gitMv)
+}
+
+func writeRenameMap(path string, renames []fileMove) error {
+	m := make(map[string]string, len(renames))
+	for _, r := range renames {
+		m[r.From] = r.To
+	}
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(raw, '\n'), 0o644)
+}
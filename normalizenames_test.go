@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenameCase(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "Poc-Yaml-A.yml")
+	to := filepath.Join(dir, "poc-yaml-a.yml")
+	if err := os.WriteFile(from, []byte("name: poc-yaml-a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := renameCase(dir, from, to, false); err != nil {
+		t.Fatalf("renameCase: %v", err)
+	}
+	if _, err := os.Stat(to); err != nil {
+		t.Errorf("%s missing after the rename: %v", to, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("want only the renamed file, got %d entries", len(entries))
+	}
+
+	// Another link to the file is a file of its own and is kept.
+	other := filepath.Join(dir, "other.yml")
+	if err := os.Link(to, other); err != nil {
+		t.Skipf("hard links: %v", err)
+	}
+	if err := movePoCFile(dir, to, other, false); err == nil {
+		t.Errorf("moving onto another link of the file succeeded")
+	}
+	for _, path := range []string{to, other} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s missing after the refused move: %v", path, err)
+		}
+	}
+}
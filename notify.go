@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// notifyListLimit bounds the groups and files listed in a chat message; the
+// webhook payload carries the same lists.
+const notifyListLimit = 10
+
+const notifyUsage = "Post a summary of the scan to slack://<hook-url>, webhook://<url> (webhook+http:// for plain HTTP) or smtp://[user:pass@]host[:port]?from=<addr>&to=<addr,...> (repeatable)"
+
+// scanSummary is what -notify sends: the outcome of one scan, with the
+// duplicate groups that are new since the baseline (or, in the daemon, since
+// the previous scan).
+type scanSummary struct {
+	Tool            string    `json:"tool"`
+	ToolVersion     string    `json:"tool_version"`
+	Time            time.Time `json:"time"`
+	Root            string    `json:"root"`
+	Strategy        string    `json:"strategy"`
+	Files           int       `json:"files"`
+	DuplicateGroups int       `json:"duplicate_groups"`
+	NewDuplicates   []string  `json:"new_duplicates"`
+	NameCollisions  int       `json:"name_collisions"`
+	ParseErrors     []string  `json:"parse_errors"`
+	Reclaimable     int64     `json:"reclaimable_bytes"`
+}
+
+// newScanSummary summarizes report. isNew tells which groups to list as new.
+func newScanSummary(report scanReport, isNew func(key string) bool) scanSummary {
+	s := scanSummary{
+		Tool:            "repeaterxraypoc",
+		ToolVersion:     toolVersion(),
+		Time:            time.Now().UTC().Truncate(time.Second),
+		Root:            report.Root,
+		Strategy:        report.Strategy,
+		Files:           report.Files,
+		DuplicateGroups: len(report.Duplicates) + report.BaselineSuppressed,
+		NewDuplicates:   []string{},
+		NameCollisions:  len(report.NameCollisions),
+		ParseErrors:     []string{},
+		Reclaimable:     report.Reclaimable,
+	}
+	for _, group := range report.Duplicates {
+		if isNew(group.Key) {
+			s.NewDuplicates = append(s.NewDuplicates, group.Key)
+		}
+	}
+	for _, skipped := range report.Skipped {
+		s.ParseErrors = append(s.ParseErrors, skipped.File)
+	}
+	return s
+}
+
+func (s scanSummary) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "PoC duplicate scan of %s: %d duplicate groups (%d new), %d name collisions, %d parse errors, %s reclaimable.",
+		s.Root, s.DuplicateGroups, len(s.NewDuplicates), s.NameCollisions, len(s.ParseErrors), humanBytes(s.Reclaimable))
+	list := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n\n%s:", title)
+		for i, item := range items {
+			if i == notifyListLimit {
+				fmt.Fprintf(&b, "\n• … and %d more", len(items)-i)
+				break
+			}
+			fmt.Fprintf(&b, "\n• %s", item)
+		}
+	}
+	list("New duplicate groups", s.NewDuplicates)
+	list("Parse errors", s.ParseErrors)
+	return b.String()
+}
+
+// notifier delivers a summary to one -notify target.
+type notifier interface {
+	notify(ctx context.Context, s scanSummary) error
+	// String names the target without credentials, for logs.
+	String() string
+}
+
+func parseNotifiers(targets []string) ([]notifier, error) {
+	var notifiers []notifier
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("notify target: %w", err)
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("notify target %s://...: missing host", u.Scheme)
+		}
+		switch u.Scheme {
+		case "slack":
+			u.Scheme = "https"
+			notifiers = append(notifiers, &webhookNotifier{url: u, http: client, slack: true})
+		case "webhook", "webhook+https":
+			u.Scheme = "https"
+			notifiers = append(notifiers, &webhookNotifier{url: u, http: client})
+		case "webhook+http":
+			u.Scheme = "http"
+			notifiers = append(notifiers, &webhookNotifier{url: u, http: client})
+		case "smtp":
+			n, err := newMailNotifier(u)
+			if err != nil {
+				return nil, err
+			}
+			notifiers = append(notifiers, n)
+		default:
+			return nil, fmt.Errorf("notify target %s://...: unsupported scheme (want slack, webhook or smtp)", u.Scheme)
+		}
+	}
+	return notifiers, nil
+}
+
+// sendNotifications delivers s to every notifier. Failures are logged and do
+// not fail the scan.
+func sendNotifications(notifiers []notifier, s scanSummary) {
+	for _, n := range notifiers {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		err := n.notify(ctx, s)
+		cancel()
+		if err != nil {
+			slog.Warn("sending notification", "target", n.String(), "err", err)
+			continue
+		}
+		slog.Debug("notification sent", "target", n.String())
+	}
+}
+
+// webhookNotifier posts the summary as JSON, or as a Slack message for a
+// Slack incoming webhook.
+type webhookNotifier struct {
+	url   *url.URL
+	http  *http.Client
+	slack bool
+}
+
+func (n *webhookNotifier) String() string {
+	return n.url.Scheme + "://" + n.url.Host
+}
+
+func (n *webhookNotifier) notify(ctx context.Context, s scanSummary) error {
+	var payload any = s
+	if n.slack {
+		payload = map[string]string{"text": s.text()}
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url.String(), bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.http.Do(req)
+	if err != nil {
+		// The URL may hold a secret token; keep it out of the error.
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// mailNotifier sends the summary as a plain-text email. The password may
+// also come from $SMTP_PASSWORD to keep it off the command line.
+type mailNotifier struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from string
+	to   []string
+}
+
+func newMailNotifier(u *url.URL) (*mailNotifier, error) {
+	q := u.Query()
+	n := &mailNotifier{addr: u.Host, host: u.Hostname(), from: q.Get("from")}
+	if u.Port() == "" {
+		n.addr = net.JoinHostPort(n.host, "587")
+	}
+	for _, to := range strings.Split(q.Get("to"), ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			n.to = append(n.to, to)
+		}
+	}
+	if n.from == "" || len(n.to) == 0 {
+		return nil, fmt.Errorf("notify target smtp://%s: want ?from=<addr>&to=<addr,...>", u.Host)
+	}
+	if u.User != nil {
+		password, ok := u.User.Password()
+		if !ok {
+			password = os.Getenv("SMTP_PASSWORD")
+		}
+		n.auth = smtp.PlainAuth("", u.User.Username(), password, n.host)
+	}
+	return n, nil
+}
+
+func (n *mailNotifier) String() string {
+	return "smtp://" + n.addr
+}
+
+func (n *mailNotifier) notify(ctx context.Context, s scanSummary) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: PoC duplicate scan of %s: %d new duplicate groups\r\n",
+		n.from, strings.Join(n.to, ", "), s.Root, len(s.NewDuplicates))
+	fmt.Fprintf(&msg, "Date: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n", s.Time.Format(time.RFC1123Z))
+	msg.WriteString(strings.ReplaceAll(s.text(), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+	// net/smtp has no context support; run it aside and give up on timeout.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(n.addr, n.auth, n.from, n.to, msg.Bytes())
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
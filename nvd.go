@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	nvdEndpoint = "https://services.nvd.nist.gov/rest/json/cves/2.0"
+	nvdCacheTTL = 7 * 24 * time.Hour
+
+	// NVD allows 5 requests per 30s without an API key and 50 with one.
+	nvdDelayAnonymous = 6 * time.Second
+	nvdDelayWithKey   = 600 * time.Millisecond
+)
+
+type nvdRecord struct {
+	CVSS      float64   `json:"cvss"`
+	Published string    `json:"published"`
+	Fetched   time.Time `json:"fetched"`
+}
+
+type nvdClient struct {
+	apiKey    string
+	cachePath string
+	cache     map[string]nvdRecord
+	failed    map[string]error
+	dirty     bool
+	http      *http.Client
+	lastCall  time.Time
+}
+
+func defaultNVDCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "repeaterxraypoc", "nvd.json")
+}
+
+func newNVDClient(apiKey, cachePath string) (*nvdClient, error) {
+	c := &nvdClient{
+		apiKey:    apiKey,
+		cachePath: cachePath,
+		cache:     map[string]nvdRecord{},
+		failed:    map[string]error{},
+		http:      &http.Client{Timeout: 30 * time.Second},
+	}
+	if cachePath == "" {
+		return c, nil
+	}
+	raw, err := os.ReadFile(cachePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &c.cache); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", cachePath, err)
+	}
+	return c, nil
+}
+
+// enrich fills in CVSS scores and publish dates for every entry tagged with a
+// CVE. A PoC covering several CVEs gets the highest score among them.
+// Lookup failures are logged and leave the entry unscored.
+func (c *nvdClient) enrich(ctx context.Context, entries []pocEntry) {
+	for i := range entries {
+		d := entries[i].Detail
+		var best nvdRecord
+		for _, cve := range d.CVEs {
+			rec, err := c.lookup(ctx, cve)
+			if err != nil {
+				continue
+			}
+			if rec.CVSS > best.CVSS || best.Published == "" {
+				best = rec
+			}
+		}
+		d.CVSS, d.Published = best.CVSS, best.Published
+	}
+}
+
+func (c *nvdClient) lookup(ctx context.Context, cve string) (nvdRecord, error) {
+	if rec, ok := c.cache[cve]; ok && time.Since(rec.Fetched) < nvdCacheTTL {
+		return rec, nil
+	}
+	if err, ok := c.failed[cve]; ok {
+		return nvdRecord{}, err
+	}
+	rec, err := c.fetch(ctx, cve)
+	if err != nil {
+		slog.Warn("NVD lookup failed", "cve", cve, "err", err)
+		c.failed[cve] = err
+		return nvdRecord{}, err
+	}
+	c.cache[cve] = rec
+	c.dirty = true
+	return rec, nil
+}
+
+func (c *nvdClient) fetch(ctx context.Context, cve string) (nvdRecord, error) {
+	delay := nvdDelayAnonymous
+	if c.apiKey != "" {
+		delay = nvdDelayWithKey
+	}
+	if wait := delay - time.Since(c.lastCall); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return nvdRecord{}, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	c.lastCall = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, nvdEndpoint+"?cveId="+url.QueryEscape(cve), nil)
+	if err != nil {
+		return nvdRecord{}, err
+	}
+	if c.apiKey != "" {
+		req.Header.Set("apiKey", c.apiKey)
+	}
+	slog.Debug("querying NVD", "cve", cve)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nvdRecord{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nvdRecord{}, fmt.Errorf("NVD returned %s", resp.Status)
+	}
+	var body nvdResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nvdRecord{}, fmt.Errorf("decode NVD response: %w", err)
+	}
+	rec := nvdRecord{Fetched: time.Now().UTC()}
+	if len(body.Vulnerabilities) > 0 {
+		v := body.Vulnerabilities[0].CVE
+		rec.Published = v.Published
+		rec.CVSS = v.Metrics.baseScore()
+	}
+	return rec, nil
+}
+
+func (c *nvdClient) saveCache() error {
+	if !c.dirty || c.cachePath == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(c.cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.cachePath), 0o755); err != nil {
+		return err
+	}
+	tmp := c.cachePath + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.cachePath)
+}
+
+type nvdResponse struct {
+	Vulnerabilities []struct {
+		CVE struct {
+			Published string     `json:"published"`
+			Metrics   nvdMetrics `json:"metrics"`
+		} `json:"cve"`
+	} `json:"vulnerabilities"`
+}
+
+type nvdMetric struct {
+	CVSSData struct {
+		BaseScore float64 `json:"baseScore"`
+	} `json:"cvssData"`
+}
+
+type nvdMetrics struct {
+	V40 []nvdMetric `json:"cvssMetricV40"`
+	V31 []nvdMetric `json:"cvssMetricV31"`
+	V30 []nvdMetric `json:"cvssMetricV30"`
+	V2  []nvdMetric `json:"cvssMetricV2"`
+}
+
+// baseScore returns the highest base score of the newest CVSS version present.
+func (m nvdMetrics) baseScore() float64 {
+	for _, metrics := range [][]nvdMetric{m.V40, m.V31, m.V30, m.V2} {
+		if len(metrics) == 0 {
+			continue
+		}
+		score := 0.0
+		for _, metric := range metrics {
+			score = max(score, metric.CVSSData.BaseScore)
+		}
+		return score
+	}
+	return 0
+}
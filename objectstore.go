@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/oauth2/google"
+)
+
+// Object storage targets for -out. Every object carries the sha256 of its
+// content as metadata, so unchanged files are not uploaded again.
+const (
+	schemeS3     = "s3"
+	schemeGCS    = "gs"
+	schemeAzBlob = "azblob"
+
+	defaultUploadParallel = 8
+)
+
+type objectStore interface {
+	// sha256 returns the content hash recorded on the object, or "" when
+	// the object does not exist or has none.
+	sha256(ctx context.Context, key string) (string, error)
+	put(ctx context.Context, key string, body []byte, sum string) error
+	url(key string) string
+}
+
+// isObjectStoreURL reports whether -out names an object storage location
+// rather than a directory.
+func isObjectStoreURL(out string) bool {
+	scheme, _, ok := strings.Cut(out, "://")
+	return ok && (scheme == schemeS3 || scheme == schemeGCS || scheme == schemeAzBlob)
+}
+
+// openObjectStore returns the store for s3://bucket/prefix,
+// gs://bucket/prefix or azblob://container/prefix, and the key prefix.
+// Credentials are found the way each provider's own tools find them.
+func openObjectStore(ctx context.Context, out string) (objectStore, string, error) {
+	u, err := url.Parse(out)
+	if err != nil {
+		return nil, "", err
+	}
+	if u.Host == "" {
+		return nil, "", fmt.Errorf("%s: missing bucket", out)
+	}
+	prefix := strings.Trim(u.Path, "/")
+	switch u.Scheme {
+	case schemeS3:
+		s, err := newS3Store(ctx, u.Host)
+		return s, prefix, err
+	case schemeGCS:
+		s, err := newGCSStore(ctx, u.Host)
+		return s, prefix, err
+	case schemeAzBlob:
+		s, err := newAzBlobStore(u.Host)
+		return s, prefix, err
+	default:
+		return nil, "", fmt.Errorf("%s: unsupported scheme %q (want s3, gs or azblob)", out, u.Scheme)
+	}
+}
+
+// exportToObjectStore builds the export in a temporary directory and
+// uploads it under the URL's prefix, the manifest last so that its presence
+// marks a complete export. It returns the URLs of the objects written.
+func exportToObjectStore(ctx context.Context, groupMap map[string][]pocEntry, rootDir, out string, eopts exportOptions, parallel int) ([]string, error) {
+	store, prefix, err := openObjectStore(ctx, out)
+	if err != nil {
+		return nil, err
+	}
+	absRoot, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp("", "repeaterxraypoc-export-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	eopts.Link, eopts.Delta, eopts.Prune = linkCopy, false, false
+	rels, _, err := writeExport(ctx, groupMap, absRoot, tmp, eopts)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeExportManifest(tmp, rels, eopts.Names); err != nil {
+		return nil, err
+	}
+	var files []string
+	err = filepath.WalkDir(tmp, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && d.Name() != exportManifestName {
+			files = append(files, relativeTo(tmp, p))
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	uploaded := make([]bool, len(files))
+	errs := make([]error, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				uploaded[i], errs[i] = uploadObject(ctx, store, path.Join(prefix, files[i]), filepath.Join(tmp, files[i]), false)
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if ctx.Err() != nil {
+		// The manifest is not uploaded, so the export stays incomplete.
+		return nil, context.Cause(ctx)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	manifestKey := path.Join(prefix, exportManifestName)
+	if _, err := uploadObject(ctx, store, manifestKey, filepath.Join(tmp, exportManifestName), true); err != nil {
+		return nil, err
+	}
+
+	var written []string
+	for i, file := range files {
+		if uploaded[i] {
+			written = append(written, store.url(path.Join(prefix, file)))
+		}
+	}
+	slog.Info("exported to object storage", "out", out, "uploaded", len(written), "unchanged", len(files)-len(written))
+	return written, nil
+}
+
+// uploadObject puts the file under key unless the object already has the
+// same content; force skips that check.
+func uploadObject(ctx context.Context, store objectStore, key, file string, force bool) (bool, error) {
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(body)
+	hexSum := hex.EncodeToString(sum[:])
+	if !force {
+		existing, err := store.sha256(ctx, key)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", store.url(key), err)
+		}
+		if existing == hexSum {
+			slog.Debug("unchanged in object storage", "object", store.url(key))
+			return false, nil
+		}
+	}
+	if err := store.put(ctx, key, body, hexSum); err != nil {
+		return false, fmt.Errorf("%s: %w", store.url(key), err)
+	}
+	slog.Debug("uploaded", "object", store.url(key))
+	return true, nil
+}
+
+// objectStoreError describes a failed request with the start of the
+// response body, where the stores explain the failure.
+func objectStoreError(method string, resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s: %s %s", method, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// s3Store uses the AWS SDK's default credential chain: environment
+// variables, the shared config and credentials files (AWS_PROFILE), web
+// identity tokens such as IRSA, and the ECS or EC2 instance role.
+type s3Store struct {
+	client *s3.Client
+	bucket string
+}
+
+func newS3Store(ctx context.Context, bucket string) (*s3Store, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		// S3-compatible stores such as MinIO, addressed with
+		// AWS_ENDPOINT_URL, usually only support path-style requests.
+		o.UsePathStyle = os.Getenv("AWS_ENDPOINT_URL_S3") != "" || os.Getenv("AWS_ENDPOINT_URL") != "" || strings.Contains(bucket, ".")
+	})
+	return &s3Store{client: client, bucket: bucket}, nil
+}
+
+func (s *s3Store) url(key string) string {
+	return schemeS3 + "://" + s.bucket + "/" + key
+}
+
+func (s *s3Store) sha256(ctx context.Context, key string) (string, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &s.bucket, Key: &key})
+	var respErr *awshttp.ResponseError
+	switch {
+	case errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound:
+		return "", nil
+	case errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusForbidden:
+		// S3 answers 403 for missing objects without s3:ListBucket.
+		return "", nil
+	case err != nil:
+		return "", err
+	}
+	return out.Metadata["sha256"], nil
+}
+
+func (s *s3Store) put(ctx context.Context, key string, body []byte, sum string) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      &s.bucket,
+		Key:         &key,
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/x-yaml"),
+		Metadata:    map[string]string{"sha256": sum},
+	})
+	return err
+}
+
+// gcsStore speaks the Cloud Storage XML API with Application Default
+// Credentials: GOOGLE_APPLICATION_CREDENTIALS, gcloud's user credentials,
+// workload identity federation, or the metadata server on GCE and GKE.
+type gcsStore struct {
+	bucket string
+	http   *http.Client
+}
+
+const gcsEndpoint = "https://storage.googleapis.com"
+
+func newGCSStore(ctx context.Context, bucket string) (*gcsStore, error) {
+	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/devstorage.read_write")
+	if err != nil {
+		return nil, fmt.Errorf("gs: %w", err)
+	}
+	client.Timeout = 2 * time.Minute
+	return &gcsStore{bucket: bucket, http: client}, nil
+}
+
+func (s *gcsStore) url(key string) string {
+	return schemeGCS + "://" + s.bucket + "/" + key
+}
+
+func (s *gcsStore) objectURL(key string) string {
+	u := url.URL{Path: "/" + s.bucket + "/" + key}
+	return gcsEndpoint + u.EscapedPath()
+}
+
+func (s *gcsStore) sha256(ctx context.Context, key string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.objectURL(key), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", nil
+	case resp.StatusCode/100 != 2:
+		return "", objectStoreError(http.MethodHead, resp)
+	}
+	return resp.Header.Get("X-Goog-Meta-Sha256"), nil
+}
+
+func (s *gcsStore) put(ctx context.Context, key string, body []byte, sum string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-yaml")
+	req.Header.Set("X-Goog-Meta-Sha256", sum)
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return objectStoreError(http.MethodPut, resp)
+	}
+	return nil
+}
+
+// azBlobStore writes block blobs. A connection string, account key or SAS
+// token in the environment is used when set; otherwise the Azure SDK's
+// default credential chain: service principal variables, workload
+// identity, managed identity, and the Azure CLI login.
+type azBlobStore struct {
+	container *container.Client
+	name      string
+}
+
+func newAzBlobStore(name string) (*azBlobStore, error) {
+	var client *azblob.Client
+	var err error
+	account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+	endpoint := "https://" + account + ".blob.core.windows.net/"
+	if e := os.Getenv("AZURE_STORAGE_BLOB_ENDPOINT"); e != "" {
+		// Emulators such as Azurite carry the account name in the
+		// endpoint's path.
+		endpoint = strings.TrimSuffix(e, "/") + "/"
+	}
+	switch {
+	case os.Getenv("AZURE_STORAGE_CONNECTION_STRING") != "":
+		client, err = azblob.NewClientFromConnectionString(os.Getenv("AZURE_STORAGE_CONNECTION_STRING"), nil)
+	case account == "":
+		return nil, errors.New("azblob: set AZURE_STORAGE_ACCOUNT or AZURE_STORAGE_CONNECTION_STRING")
+	case os.Getenv("AZURE_STORAGE_KEY") != "":
+		var cred *azblob.SharedKeyCredential
+		if cred, err = azblob.NewSharedKeyCredential(account, os.Getenv("AZURE_STORAGE_KEY")); err == nil {
+			client, err = azblob.NewClientWithSharedKeyCredential(endpoint, cred, nil)
+		}
+	case os.Getenv("AZURE_STORAGE_SAS_TOKEN") != "":
+		client, err = azblob.NewClientWithNoCredential(endpoint+"?"+strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?"), nil)
+	default:
+		var cred *azidentity.DefaultAzureCredential
+		if cred, err = azidentity.NewDefaultAzureCredential(nil); err == nil {
+			client, err = azblob.NewClient(endpoint, cred, nil)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("azblob: %w", err)
+	}
+	return &azBlobStore{container: client.ServiceClient().NewContainerClient(name), name: name}, nil
+}
+
+func (s *azBlobStore) url(key string) string {
+	return schemeAzBlob + "://" + s.name + "/" + key
+}
+
+func (s *azBlobStore) sha256(ctx context.Context, key string) (string, error) {
+	props, err := s.container.NewBlockBlobClient(key).GetProperties(ctx, nil)
+	var respErr *azcore.ResponseError
+	switch {
+	case errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound:
+		return "", nil
+	case err != nil:
+		return "", err
+	}
+	// Metadata names come back in the case the service sends them.
+	for name, value := range props.Metadata {
+		if strings.EqualFold(name, "sha256") && value != nil {
+			return *value, nil
+		}
+	}
+	return "", nil
+}
+
+func (s *azBlobStore) put(ctx context.Context, key string, body []byte, sum string) error {
+	_, err := s.container.NewBlockBlobClient(key).Upload(ctx, streaming.NopCloser(bytes.NewReader(body)), &blockblob.UploadOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: to.Ptr("application/x-yaml")},
+		Metadata:    map[string]*string{"sha256": &sum},
+	})
+	return err
+}
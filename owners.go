@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// unownedSection collects the groups no CODEOWNERS rule covers in -assign
+// output.
+const unownedSection = "(unowned)"
+
+type ownerRule struct {
+	ignoreRule
+	owners []string
+}
+
+// codeOwners maps files to owners the way GitHub reads CODEOWNERS: patterns
+// use gitignore syntax relative to the repository root and the last matching
+// line wins.
+type codeOwners struct {
+	base  string
+	rules []ownerRule
+}
+
+// loadCodeOwners reads a CODEOWNERS file. Patterns are relative to the
+// repository root: the parent of a .github or docs directory holding the
+// file, otherwise the file's own directory.
+func loadCodeOwners(file string) (*codeOwners, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(abs)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c := &codeOwners{base: filepath.Dir(abs)}
+	if name := filepath.Base(c.base); name == ".github" || name == "docs" {
+		c.base = filepath.Dir(c.base)
+	}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), " #")
+		fields := strings.Fields(text)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		rule, ok := parseIgnoreLine(fields[0])
+		if !ok || rule.negate {
+			return nil, fmt.Errorf("%s:%d: invalid pattern %q", file, line, fields[0])
+		}
+		// A line without owners removes ownership, as on GitHub.
+		c.rules = append(c.rules, ownerRule{ignoreRule: rule, owners: fields[1:]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", file, err)
+	}
+	return c, nil
+}
+
+// ownersOf returns the owners of file, or nil when it has none.
+func (c *codeOwners) ownersOf(file string) []string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil
+	}
+	rel, err := filepath.Rel(c.base, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+	// A pattern naming a directory owns everything below it.
+	candidates := append(ancestorDirs(rel), rel)
+	var owners []string
+	for _, rule := range c.rules {
+		for i, candidate := range candidates {
+			isDir := i < len(candidates)-1
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			target := candidate
+			if !rule.anchored {
+				target = path.Base(candidate)
+			}
+			if globMatch(rule.pattern, target) {
+				owners = rule.owners
+				break
+			}
+		}
+	}
+	return owners
+}
+
+// assignOwners sets the owners of every group: the owners of all its files.
+func assignOwners(report *scanReport, owners *codeOwners) {
+	for i := range report.Duplicates {
+		group := &report.Duplicates[i]
+		group.Owners = nil
+		for _, entry := range group.Entries {
+			for _, owner := range owners.ownersOf(entry.FilePath) {
+				group.Owners = appendUnique(group.Owners, owner)
+			}
+		}
+		sort.Strings(group.Owners)
+	}
+}
+
+// ownerSection is the part of an -assign report for one owner.
+type ownerSection struct {
+	Owner  string
+	Groups []reportGroup
+}
+
+// splitByOwner lists the groups of every owner, owners sorted and unowned
+// groups last. A group with several owners appears in each of their sections.
+func splitByOwner(groups []reportGroup) []ownerSection {
+	byOwner := make(map[string][]reportGroup)
+	for _, group := range groups {
+		owners := group.Owners
+		if len(owners) == 0 {
+			owners = []string{unownedSection}
+		}
+		for _, owner := range owners {
+			byOwner[owner] = append(byOwner[owner], group)
+		}
+	}
+	sections := make([]ownerSection, 0, len(byOwner))
+	for owner, groups := range byOwner {
+		sections = append(sections, ownerSection{Owner: owner, Groups: groups})
+	}
+	sort.Slice(sections, func(i, j int) bool {
+		a, b := sections[i].Owner, sections[j].Owner
+		if (a == unownedSection) != (b == unownedSection) {
+			return b == unownedSection
+		}
+		return a < b
+	})
+	return sections
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The files of a package, relative to its directory.
+const (
+	packagePoCDir     = "pocs"
+	packageConfigName = "xray-config.yaml"
+)
+
+const packageUsage = `
+Usage:
+  go run . package -dir <path-to-pocs> -out <dir> [-poc-path <path>] [-timeout <duration>]
+
+Packages the PoCs deduplication keeps for an xray deployment: one PoC per
+file under pocs/, named <name>.yml after its name field as xray expects,
+and ` + packageConfigName + `, the plugins section to merge into xray's config.yaml
+so that it loads them. Multi-document files are split and JSON PoCs are
+written as .yml. Nothing is written unless every kept PoC is valid: it has
+a poc-yaml- name that no other kept PoC uses, rules and, for rules given as
+a mapping, a top-level expression. Unreadable files fail the package too;
+-exclude them to package the rest. -poc-path is where the pocs directory
+will be on the xray host (default: its path under -out).
+
+Flags:
+`
+
+// xrayPluginConfig is the part of xray's config.yaml that loads local PoCs.
+type xrayPluginConfig struct {
+	Plugins struct {
+		Phantasm struct {
+			Enabled    bool     `yaml:"enabled"`
+			IncludePoC []string `yaml:"include_poc"`
+		} `yaml:"phantasm"`
+	} `yaml:"plugins"`
+}
+
+// packagedPoC is one document of the package.
+type packagedPoC struct {
+	unit string
+	name string
+	raw  []byte
+}
+
+func runPackage(args []string) int {
+	fs := flag.NewFlagSet("package", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	sf.registerTimeout()
+	outFlag := fs.String("out", "", "Directory to write the package to; replaced as a whole")
+	pocPathFlag := fs.String("poc-path", "", "Path of the package's pocs directory on the xray host (default: under -out)")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(packageUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	if *outFlag == "" {
+		slog.Error("package needs -out")
+		return exitUsage
+	}
+	root, err := filepath.Abs(opts.Root)
+	if err != nil {
+		slog.Error("invalid -dir", "err", err)
+		return exitError
+	}
+	out, err := filepath.Abs(*outFlag)
+	if err != nil {
+		slog.Error("invalid -out", "err", err)
+		return exitError
+	}
+	if reason := exportInPlaceReason(root, out); reason != "" {
+		slog.Error("refusing to replace -out", "out", out, "reason", reason)
+		return exitError
+	}
+	pocPath := *pocPathFlag
+	if pocPath == "" {
+		pocPath = filepath.Join(out, packagePoCDir)
+	}
+
+	ctx, cancel := sf.operation(context.Background())
+	corpus, err := collectCorpus(ctx, opts, nil)
+	cancel()
+	if err != nil {
+		slog.Error("collecting PoCs", "err", err)
+		return exitError
+	}
+	sortGroups(corpus.groups, opts)
+	pocs, problems, err := packagedPoCs(corpus.groups)
+	if err != nil {
+		slog.Error("reading kept PoCs", "err", err)
+		return exitError
+	}
+	for _, s := range corpus.skipped {
+		problems = append(problems, fmt.Sprintf("%s: %s", s.File, s.Error))
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		if !*sf.quiet {
+			for _, p := range problems {
+				fmt.Println(p)
+			}
+		}
+		slog.Error("nothing packaged: fix the PoCs xray would reject", "problems", len(problems))
+		return exitInvalid
+	}
+	if err := writePackage(out, pocPath, pocs); err != nil {
+		slog.Error("writing package", "out", out, "err", err)
+		return exitError
+	}
+	slog.Info("PoCs packaged for xray", "out", out, "pocs", len(pocs))
+	return exitOK
+}
+
+// packagedPoCs reads the documents kept by the groups and checks them,
+// returning what xray would reject as problems.
+func packagedPoCs(groups map[string][]pocEntry) ([]packagedPoC, []string, error) {
+	kept := make(map[string]map[int]bool)
+	for _, entries := range groups {
+		if len(entries) == 0 {
+			continue
+		}
+		keeper := entries[0]
+		if kept[keeper.FilePath] == nil {
+			kept[keeper.FilePath] = make(map[int]bool)
+		}
+		kept[keeper.FilePath][keeper.Doc] = true
+	}
+	files := make([]string, 0, len(kept))
+	for file := range kept {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var pocs []packagedPoC
+	var problems []string
+	byName := make(map[string]string)
+	for _, file := range files {
+		pf, err := readPoCFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, doc := range pf.Docs {
+			if !kept[file][i] {
+				continue
+			}
+			unit := file
+			if len(pf.Docs) > 1 {
+				unit = fmt.Sprintf("%s#%d", file, i)
+			}
+			name, docProblems := checkPackagedPoC(&doc.Node)
+			for _, p := range docProblems {
+				problems = append(problems, fmt.Sprintf("%s: %s", unit, p))
+			}
+			if len(docProblems) > 0 {
+				continue
+			}
+			if other, ok := byName[fileKey(name)]; ok {
+				problems = append(problems, fmt.Sprintf("%s: name %q is also used by %s", unit, name, other))
+				continue
+			}
+			byName[fileKey(name)] = unit
+			pocs = append(pocs, packagedPoC{unit: unit, name: name, raw: doc.Raw})
+		}
+	}
+	return pocs, problems, nil
+}
+
+// checkPackagedPoC returns the name of a PoC document and what keeps xray
+// from loading it.
+func checkPackagedPoC(doc *yaml.Node) (string, []string) {
+	if len(doc.Content) == 0 {
+		return "", []string{"empty document"}
+	}
+	top := resolveAlias(doc.Content[0])
+	if top.Kind != yaml.MappingNode {
+		return "", []string{"not a mapping"}
+	}
+	var problems []string
+	name := scalarValue(resolveAlias(mappingValue(top, "name")))
+	switch {
+	case name == "":
+		problems = append(problems, "no name field")
+	case !strings.HasPrefix(name, pocNamePrefix):
+		problems = append(problems, fmt.Sprintf("name %q does not start with %s", name, pocNamePrefix))
+	case name != strings.TrimSpace(name) || strings.ContainsAny(name, `/\:*?"<>| `):
+		problems = append(problems, fmt.Sprintf("name %q cannot be a file name", name))
+	}
+	rules := resolveAlias(mappingValue(top, "rules"))
+	if rules == nil || len(rules.Content) == 0 {
+		return name, append(problems, "no rules")
+	}
+	if rules.Kind == yaml.MappingNode {
+		if strings.TrimSpace(scalarValue(resolveAlias(mappingValue(top, "expression")))) == "" {
+			problems = append(problems, "no top-level expression")
+		}
+		for i := 0; i+1 < len(rules.Content); i += 2 {
+			rule := resolveAlias(rules.Content[i+1])
+			if mappingValue(rule, "request") == nil || strings.TrimSpace(scalarValue(resolveAlias(mappingValue(rule, "expression")))) == "" {
+				problems = append(problems, fmt.Sprintf("rule %s needs a request and an expression", rules.Content[i].Value))
+			}
+		}
+	}
+	return name, problems
+}
+
+// writePackage builds the package in a temporary sibling of out and then
+// replaces out with it, so a deployment never picks up half a package.
+func writePackage(out, pocPath string, pocs []packagedPoC) error {
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return err
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(out), "."+filepath.Base(out)+".partial-")
+	if err != nil {
+		return err
+	}
+	err = writePackageFiles(staging, pocPath, pocs)
+	if err == nil {
+		err = os.Chmod(staging, 0o755)
+	}
+	if err == nil {
+		err = replaceDir(staging, out)
+	}
+	if err != nil {
+		os.RemoveAll(staging)
+	}
+	return err
+}
+
+func writePackageFiles(dir, pocPath string, pocs []packagedPoC) error {
+	if err := os.Mkdir(filepath.Join(dir, packagePoCDir), 0o755); err != nil {
+		return err
+	}
+	rels := []string{packageConfigName}
+	for _, poc := range pocs {
+		rel := packagePoCDir + "/" + poc.name + ".yml"
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(rel)), poc.raw, 0o644); err != nil {
+			return err
+		}
+		rels = append(rels, rel)
+		slog.Debug("packaged PoC", "file", poc.unit, "as", rel)
+	}
+
+	var cfg xrayPluginConfig
+	cfg.Plugins.Phantasm.Enabled = true
+	cfg.Plugins.Phantasm.IncludePoC = []string{filepath.ToSlash(filepath.Join(pocPath, "*.yml"))}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Merge into xray's config.yaml to load the %d packaged PoCs.\n", len(pocs))
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, packageConfigName), buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return writeExportManifest(dir, rels, nil)
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const planVersion = 1
+
+// Plan actions: delete removes a whole file, remove-docs drops documents
+// from a multi-document file and keeps the rest.
+const (
+	planDelete     = "delete"
+	planRemoveDocs = "remove-docs"
+)
+
+const applyUsage = `
+Usage:
+  go run . apply [-lock-wait <duration>] [-pre-delete-hook <cmd>] [-backup <dir>] [-dry-run] <plan.json>
+
+Carries out a plan written by a scan with -plan, after it has been reviewed.
+The plan records the sha256 of every file it deletes, edits or keeps; when
+any of them changed or disappeared since the scan, nothing is applied and the
+command exits with 1. Scan again to get a fresh plan.
+
+Flags:
+`
+
+// dedupePlan is the reviewable list of changes -delete would make. Files
+// are relative to Root.
+type dedupePlan struct {
+	Version     int          `json:"version"`
+	ToolVersion string       `json:"tool_version,omitempty"`
+	Created     time.Time    `json:"created"`
+	Root        string       `json:"root"`
+	Strategy    string       `json:"strategy"`
+	Actions     []planAction `json:"actions"`
+	// Files holds the sha256 of every file the actions touch or rely on.
+	Files map[string]string `json:"files"`
+}
+
+type planAction struct {
+	Action string `json:"action"`
+	File   string `json:"file"`
+	// Docs lists the documents remove-docs drops.
+	Docs []int `json:"docs,omitempty"`
+	// DuplicateOf lists the PoCs kept in place of what is removed.
+	DuplicateOf []string `json:"duplicate_of"`
+}
+
+func newPlan(opts scanOptions, removals []duplicateGroup) (*dedupePlan, error) {
+	root, err := filepath.Abs(opts.Root)
+	if err != nil {
+		return nil, err
+	}
+	plan := &dedupePlan{
+		Version:     planVersion,
+		ToolVersion: toolVersion(),
+		Created:     time.Now().UTC().Truncate(time.Second),
+		Root:        root,
+		Strategy:    opts.Strategy,
+		Actions:     []planAction{},
+		Files:       map[string]string{},
+	}
+	byFile := make(map[string]*planAction)
+	docCount := make(map[string]int)
+	for _, group := range removals {
+		kept := relativeTo(opts.Root, group.Entries[0].unit())
+		if err := plan.record(opts.Root, group.Entries[0].FilePath); err != nil {
+			return nil, err
+		}
+		for _, entry := range group.Entries[1:] {
+			file := relativeTo(opts.Root, entry.FilePath)
+			a := byFile[file]
+			if a == nil {
+				if err := plan.record(opts.Root, entry.FilePath); err != nil {
+					return nil, err
+				}
+				a = &planAction{File: file}
+				byFile[file] = a
+				docCount[file] = entry.Docs
+			}
+			if entry.Docs > 1 && !slices.Contains(a.Docs, entry.Doc) {
+				a.Docs = append(a.Docs, entry.Doc)
+			}
+			a.DuplicateOf = appendUnique(a.DuplicateOf, kept)
+		}
+	}
+	for file, a := range byFile {
+		a.Action = planRemoveDocs
+		if len(a.Docs) == 0 || len(a.Docs) == docCount[file] {
+			a.Action, a.Docs = planDelete, nil
+		}
+		sort.Ints(a.Docs)
+		plan.Actions = append(plan.Actions, *a)
+	}
+	sort.Slice(plan.Actions, func(i, j int) bool { return plan.Actions[i].File < plan.Actions[j].File })
+	return plan, nil
+}
+
+// confirmToken identifies what the plan deletes and the content of every
+// file it relies on. -delete -confirm only deletes when a fresh plan still
+// has the token a -dry-run printed.
+func (p *dedupePlan) confirmToken() string {
+	raw, _ := json.Marshal(struct {
+		Root     string
+		Strategy string
+		Actions  []planAction
+		Files    map[string]string
+	}{p.Root, p.Strategy, p.Actions, p.Files})
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:6])
+}
+
+// record stores the current hash of path.
+func (p *dedupePlan) record(root, path string) error {
+	rel := relativeTo(root, path)
+	if _, ok := p.Files[rel]; ok {
+		return nil
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	p.Files[rel] = sum
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (p *dedupePlan) write(path string) error {
+	raw, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(raw, '\n'), 0o644)
+}
+
+func loadPlan(path string) (*dedupePlan, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePlan(raw, path)
+}
+
+// parsePlan decodes and checks a plan read from path.
+func parsePlan(raw []byte, path string) (*dedupePlan, error) {
+	var p dedupePlan
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := p.check(path); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// check validates a plan read from source before anything trusts it.
+func (p *dedupePlan) check(source string) error {
+	if p.Version != planVersion {
+		return fmt.Errorf("%s: unsupported plan version %d", source, p.Version)
+	}
+	if !filepath.IsAbs(p.Root) {
+		return fmt.Errorf("%s: root %q is not absolute", source, p.Root)
+	}
+	for rel := range p.Files {
+		if _, err := safeJoin(p.Root, rel); err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+	}
+	for _, a := range p.Actions {
+		if _, ok := p.Files[a.File]; !ok {
+			return fmt.Errorf("%s: no hash recorded for %s", source, a.File)
+		}
+		if a.Action != planDelete && a.Action != planRemoveDocs {
+			return fmt.Errorf("%s: unknown action %q for %s", source, a.Action, a.File)
+		}
+	}
+	return nil
+}
+
+// changedFiles lists the files whose content differs from the plan.
+func (p *dedupePlan) changedFiles() []string {
+	var changed []string
+	for rel, want := range p.Files {
+		sum, err := fileSHA256(filepath.Join(p.Root, filepath.FromSlash(rel)))
+		if err == nil && sum == want {
+			continue
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Debug("checking planned file", "file", rel, "err", err)
+		}
+		changed = append(changed, rel)
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// unplanned lists the actions of p that fresh, a plan made from a new scan,
+// does not also make: removing a document fresh removes is fine, deleting a
+// file it only edits or leaves alone is not.
+func (p *dedupePlan) unplanned(fresh *dedupePlan) []string {
+	byFile := make(map[string]planAction, len(fresh.Actions))
+	for _, a := range fresh.Actions {
+		byFile[a.File] = a
+	}
+	var out []string
+	for _, a := range p.Actions {
+		f, ok := byFile[a.File]
+		switch {
+		case !ok:
+		case f.Action == planDelete:
+			continue
+		case a.Action == planRemoveDocs && len(a.Docs) > 0 && !slices.ContainsFunc(a.Docs, func(doc int) bool { return !slices.Contains(f.Docs, doc) }):
+			continue
+		}
+		out = append(out, a.File)
+	}
+	return out
+}
+
+// units lists what the plan removes, as deletionUnits does for a scan.
+func (p *dedupePlan) units() []string {
+	var units []string
+	for _, a := range p.Actions {
+		file := filepath.Join(p.Root, filepath.FromSlash(a.File))
+		if a.Action == planDelete {
+			units = append(units, file)
+			continue
+		}
+		for _, doc := range a.Docs {
+			units = append(units, fmt.Sprintf("%s#%d", file, doc))
+		}
+	}
+	return units
+}
+
+func runApply(args []string) int {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	lockWaitFlag := fs.Duration("lock-wait", 0, lockWaitUsage)
+	preDeleteHookFlag := fs.String("pre-delete-hook", "", "Command run with the files to delete on stdin before deleting; a failure aborts")
+	backupFlag := fs.String("backup", "", "Directory to write a timestamped tar.gz of the files the plan deletes or edits, with the plan as manifest, before applying it")
+	dryRunFlag := fs.Bool("dry-run", false, "Only check that the plan still applies")
+	quietFlag := fs.Bool("quiet", false, "Only log errors")
+	verboseFlag := fs.Bool("v", false, "Verbose logging (debug level)")
+	logFormatFlag := fs.String("log-format", logFormatText, "Log format on stderr: text or json")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(applyUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	logger, err := newLogger(stderrGuard, *logFormatFlag, logLevel(*quietFlag, *verboseFlag, false))
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	slog.SetDefault(logger)
+	if fs.NArg() != 1 {
+		slog.Error("pass exactly one plan file")
+		return exitUsage
+	}
+	plan, err := loadPlan(fs.Arg(0))
+	if err != nil {
+		slog.Error("loading plan", "err", err)
+		return exitError
+	}
+
+	unlock, err := lockRoot(scanOptions{Root: plan.Root}, *lockWaitFlag)
+	if err != nil {
+		slog.Error("cannot lock the plan's directory", "err", err)
+		return exitError
+	}
+	defer unlock()
+	if changed := plan.changedFiles(); len(changed) > 0 {
+		for _, file := range changed {
+			slog.Error("file changed since the plan was written", "file", file)
+		}
+		slog.Error("refusing to apply a stale plan; scan again with -plan", "plan", fs.Arg(0), "changed", len(changed))
+		return exitError
+	}
+	if *dryRunFlag {
+		slog.Info("plan applies cleanly", "actions", len(plan.Actions))
+		return exitOK
+	}
+	if *preDeleteHookFlag != "" {
+		if err := runFileHook(*preDeleteHookFlag, hookPreDelete, plan.units(), plan.Root, ""); err != nil {
+			slog.Error("apply aborted", "err", err)
+			return exitError
+		}
+	}
+	if *backupFlag != "" {
+		archive, err := writeBackup(*backupFlag, plan)
+		if err != nil {
+			slog.Error("apply aborted: writing backup", "backup", *backupFlag, "err", err)
+			return exitError
+		}
+		slog.Info("backup written", "archive", archive, "files", len(plan.Actions))
+	}
+	if err := plan.apply(); err != nil {
+		slog.Error("applying plan", "err", err)
+		return exitError
+	}
+	slog.Info("plan applied", "actions", len(plan.Actions), "root", plan.Root)
+	return exitOK
+}
+
+// apply carries out the plan's actions in order, stopping at the first
+// that fails.
+func (p *dedupePlan) apply() error {
+	for _, a := range p.Actions {
+		file := filepath.Join(p.Root, filepath.FromSlash(a.File))
+		var err error
+		if a.Action == planDelete {
+			err = os.Remove(longPath(file))
+		} else {
+			drop := make(map[int]bool, len(a.Docs))
+			for _, doc := range a.Docs {
+				drop[doc] = true
+			}
+			err = removeDocuments(longPath(file), drop)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", a.Action, a.File, err)
+		}
+		slog.Debug("applied", "action", a.Action, "file", a.File, "duplicate_of", a.DuplicateOf)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestUnplanned(t *testing.T) {
+	fresh := &dedupePlan{Actions: []planAction{
+		{Action: planDelete, File: "b.yml", DuplicateOf: []string{"a.yml"}},
+		{Action: planRemoveDocs, File: "multi.yml", Docs: []int{1, 3}, DuplicateOf: []string{"a.yml"}},
+	}}
+	tests := []struct {
+		name    string
+		actions []planAction
+		want    []string
+	}{
+		{name: "same plan", actions: fresh.Actions},
+		{name: "subset", actions: fresh.Actions[:1]},
+		{name: "fewer documents", actions: []planAction{{Action: planRemoveDocs, File: "multi.yml", Docs: []int{3}}}},
+		{name: "document of a deleted file", actions: []planAction{{Action: planRemoveDocs, File: "b.yml", Docs: []int{2}}}},
+		{name: "kept file", actions: []planAction{{Action: planDelete, File: "a.yml", DuplicateOf: []string{"b.yml"}}}, want: []string{"a.yml"}},
+		{name: "delete of an edited file", actions: []planAction{{Action: planDelete, File: "multi.yml"}}, want: []string{"multi.yml"}},
+		{name: "other document", actions: []planAction{{Action: planRemoveDocs, File: "multi.yml", Docs: []int{1, 2}}}, want: []string{"multi.yml"}},
+		{name: "no documents", actions: []planAction{{Action: planRemoveDocs, File: "multi.yml"}}, want: []string{"multi.yml"}},
+	}
+	for _, tt := range tests {
+		p := &dedupePlan{Actions: tt.actions}
+		if got := p.unplanned(fresh); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: unplanned = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
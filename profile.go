@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const exportUsage = `
+Usage:
+  go run . export -profile <name> [-dir <path-to-pocs>] [-out <dir>|s3://...] [-link copy|hard|symlink|reflink]
+                  [-on-name-collision warn|fail|suffix|drop] [-timeout <duration>]
+
+Exports the deduplicated subset of the corpus that a profile of the config
+file selects. A profile combines -filter conditions, which may also match
+the transport, with exclude_reverse and exclude_stubs, and may name its
+output:
+
+  profiles:
+    internet-facing-critical:
+      filter: [severity=critical, transport=http]
+      exclude_reverse: true
+      exclude_stubs: true
+      out: exports/internet-facing-critical
+
+Duplicates are resolved within the subset, as a scan with the same -filter
+would. -out overrides the profile's out, which is relative to the config
+file.
+
+Flags:
+`
+
+// exportProfile is a named export subset defined in the config file.
+type exportProfile struct {
+	Filter         []string `yaml:"filter"`
+	ExcludeReverse bool     `yaml:"exclude_reverse"`
+	ExcludeStubs   bool     `yaml:"exclude_stubs"`
+	Out            string   `yaml:"out"`
+}
+
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	sf.registerTimeout()
+	profileFlag := fs.String("profile", "", "Profile of the config file to export")
+	outFlag := fs.String("out", "", "Directory or s3://, gs:// or azblob:// bucket/prefix to export to (default: the profile's out)")
+	linkFlag := fs.String("link", linkCopy, "How the export materializes kept PoCs: copy, hard, symlink or reflink")
+	onNameCollisionFlag := fs.String("on-name-collision", nameCollisionWarn, "What to do when exported PoCs share a name: warn, fail, suffix or drop")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(exportUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	var profiles map[string]exportProfile
+	if sf.cfg != nil {
+		profiles = sf.cfg.Profiles
+	}
+	profile, ok := profiles[*profileFlag]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		slog.Error("unknown -profile", "profile", *profileFlag, "config", sf.cfgPath, "profiles", strings.Join(names, ","))
+		return exitUsage
+	}
+	if opts.Filters, err = parseFilters(profile.Filter); err != nil {
+		slog.Error("invalid profile", "profile", *profileFlag, "err", err)
+		return exitError
+	}
+	opts.ExcludeReverse = profile.ExcludeReverse
+	opts.ExcludeStubs = profile.ExcludeStubs
+	out := *outFlag
+	if out == "" && profile.Out != "" {
+		out = profile.Out
+		if !isObjectStoreURL(out) && !filepath.IsAbs(out) {
+			out = filepath.Join(filepath.Dir(sf.cfgPath), filepath.FromSlash(out))
+		}
+	}
+	if out == "" {
+		slog.Error("pass -out or set out in the profile", "profile", *profileFlag)
+		return exitUsage
+	}
+	eopts := exportOptions{Preserve: true, ScannedAt: time.Now(), NormalizeEOL: opts.NormalizeEOL}
+	if eopts.Link, err = parseLinkMode(*linkFlag); err != nil {
+		slog.Error("invalid -link", "err", err)
+		return exitUsage
+	}
+	namePolicy, err := parseNameCollisionPolicy(*onNameCollisionFlag)
+	if err != nil {
+		slog.Error("invalid -on-name-collision", "err", err)
+		return exitUsage
+	}
+	if namePolicy == nameCollisionSuffix && (eopts.Link == linkHard || eopts.Link == linkSymlink) {
+		slog.Error("-on-name-collision suffix rewrites exported files and cannot be used with -link hard or symlink")
+		return exitUsage
+	}
+	if eopts.NormalizeEOL && (eopts.Link == linkHard || eopts.Link == linkSymlink) {
+		slog.Error("-normalize-eol rewrites exported files and cannot be used with -link hard or symlink")
+		return exitUsage
+	}
+
+	ctx, cancel := sf.operation(context.Background())
+	corpus, err := collectCorpus(ctx, opts, nil)
+	cancel()
+	if err != nil {
+		slog.Error("collecting PoCs", "err", err)
+		return exitError
+	}
+	sortGroups(corpus.groups, opts)
+	if eopts.Names, err = exportNameDecisions(corpus.groups, opts, namePolicy); err != nil {
+		slog.Error("refusing to export", "err", err)
+		return exitError
+	}
+	ctx, cancel = sf.operation(context.Background())
+	defer cancel()
+	if isObjectStoreURL(out) {
+		_, err = exportToObjectStore(ctx, corpus.groups, opts.Root, out, eopts, defaultUploadParallel)
+	} else {
+		_, err = exportDeduplicated(ctx, corpus.groups, opts.Root, out, eopts)
+	}
+	if err != nil {
+		slog.Error("exporting profile", "profile", *profileFlag, "err", err)
+		return exitError
+	}
+	slog.Info("profile exported", "profile", *profileFlag, "out", out)
+	return exitOK
+}
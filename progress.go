@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const progressInterval = 100 * time.Millisecond
+
+// lineGuard serializes writes to stderr and keeps an in-place progress line
+// intact: the line is cleared before other output and redrawn afterwards.
+type lineGuard struct {
+	mu   sync.Mutex
+	w    io.Writer
+	line string
+}
+
+func (g *lineGuard) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.line != "" {
+		fmt.Fprint(g.w, "\r\x1b[K")
+	}
+	n, err := g.w.Write(p)
+	if g.line != "" {
+		fmt.Fprint(g.w, g.line)
+	}
+	return n, err
+}
+
+func (g *lineGuard) setLine(line string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.line = line
+	fmt.Fprint(g.w, "\r\x1b[K"+line)
+}
+
+func (g *lineGuard) clearLine() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.line != "" {
+		fmt.Fprint(g.w, "\r\x1b[K")
+		g.line = ""
+	}
+}
+
+// progressReporter draws scan statistics. A nil reporter is a no-op so the
+// scan code does not need to check whether progress is enabled.
+type progressReporter struct {
+	out        *lineGuard
+	total      int
+	scanned    int
+	errors     int
+	duplicates int
+	keys       map[string]int
+	opts       scanOptions
+	start      time.Time
+	lastDraw   time.Time
+}
+
+func newProgressReporter(out *lineGuard, opts scanOptions) *progressReporter {
+	total := 0
+	// A cheap pre-walk gives the total needed for the bar and ETA.
+	_ = walkPoCFiles(opts, func(string) error {
+		total++
+		return nil
+	})
+	return &progressReporter{
+		out:   out,
+		total: total,
+		keys:  make(map[string]int),
+		opts:  opts,
+		start: time.Now(),
+	}
+}
+
+func (p *progressReporter) fileDone(entries []pocEntry, failed bool) {
+	if p == nil {
+		return
+	}
+	p.scanned++
+	if failed {
+		p.errors++
+	}
+	for _, entry := range entries {
+		key := groupKey(entry, p.opts)
+		p.keys[key]++
+		if p.keys[key] == 2 {
+			p.duplicates++
+		}
+	}
+	if time.Since(p.lastDraw) >= progressInterval {
+		p.draw()
+	}
+}
+
+func (p *progressReporter) finish() {
+	if p == nil {
+		return
+	}
+	p.out.clearLine()
+}
+
+func (p *progressReporter) draw() {
+	p.lastDraw = time.Now()
+	const width = 30
+	ratio := 1.0
+	if p.total > 0 && p.scanned < p.total {
+		ratio = float64(p.scanned) / float64(p.total)
+	}
+	filled := int(ratio * width)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+	eta := "--"
+	if p.scanned > 0 && p.scanned < p.total {
+		elapsed := time.Since(p.start)
+		remaining := time.Duration(float64(elapsed) / float64(p.scanned) * float64(p.total-p.scanned))
+		eta = remaining.Round(time.Second).String()
+	}
+	p.out.setLine(fmt.Sprintf(tr("[%s] %d/%d files  parse errors: %d  duplicates: %d  ETA: %s"),
+		bar, p.scanned, p.total, p.errors, p.duplicates, eta))
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	provenanceNone    = "none"
+	provenanceSidecar = "sidecar"
+	provenanceComment = "comment"
+
+	provenanceSuffix = ".provenance.json"
+)
+
+// provenance records where an exported PoC came from, so a deduplicated
+// corpus can be traced back to the scanned one.
+type provenance struct {
+	SourceRoot  string `json:"source_root"`
+	Source      string `json:"source"`
+	SHA256      string `json:"sha256"`
+	ScannedAt   string `json:"scanned_at"`
+	ToolVersion string `json:"tool_version"`
+	Documents   []int  `json:"documents,omitempty"`
+}
+
+func parseProvenanceMode(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case "", provenanceNone:
+		return "", nil
+	case provenanceSidecar, provenanceComment:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown provenance mode %q (want sidecar, comment or none)", value)
+	}
+}
+
+func newProvenance(absRoot, absSrc, rel string, scannedAt time.Time) (provenance, error) {
+	raw, err := os.ReadFile(absSrc)
+	if err != nil {
+		return provenance{}, err
+	}
+	sum := sha256.Sum256(raw)
+	return provenance{
+		SourceRoot:  absRoot,
+		Source:      filepath.ToSlash(rel),
+		SHA256:      hex.EncodeToString(sum[:]),
+		ScannedAt:   scannedAt.UTC().Format(time.RFC3339),
+		ToolVersion: toolVersion(),
+	}, nil
+}
+
+// writeProvenance records p for the exported file dest. JSON PoCs cannot
+// carry comments, so they always get a sidecar.
+func writeProvenance(dest string, p provenance, mode string, preserveFrom string) error {
+	if mode == provenanceComment && !isJSONFile(dest) {
+		return prependProvenanceComment(dest, p, preserveFrom)
+	}
+	raw, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dest+provenanceSuffix, append(raw, '\n'), 0o644)
+}
+
+// prependProvenanceComment puts an x-provenance comment block at the top of
+// dest. preserveFrom, when set, is the file whose mode and modification time
+// dest keeps.
+func prependProvenanceComment(dest string, p provenance, preserveFrom string) error {
+	raw, err := os.ReadFile(dest)
+	if err != nil {
+		return err
+	}
+	raw = stripProvenanceComment(raw)
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "# x-provenance:")
+	fmt.Fprintf(&buf, "#   source_root: %s\n", p.SourceRoot)
+	fmt.Fprintf(&buf, "#   source: %s\n", p.Source)
+	fmt.Fprintf(&buf, "#   sha256: %s\n", p.SHA256)
+	fmt.Fprintf(&buf, "#   scanned_at: %s\n", p.ScannedAt)
+	fmt.Fprintf(&buf, "#   tool_version: %s\n", p.ToolVersion)
+	if len(p.Documents) > 0 {
+		docs := make([]string, len(p.Documents))
+		for i, d := range p.Documents {
+			docs[i] = fmt.Sprint(d)
+		}
+		fmt.Fprintf(&buf, "#   documents: [%s]\n", strings.Join(docs, ", "))
+	}
+	buf.Write(raw)
+	info, err := os.Stat(dest)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dest, buf.Bytes(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if preserveFrom != "" {
+		return preserveAttributes(preserveFrom, dest)
+	}
+	return nil
+}
+
+// stripProvenanceComment drops a block left by an earlier export, so
+// re-exporting an exported corpus does not stack them.
+func stripProvenanceComment(raw []byte) []byte {
+	if !bytes.HasPrefix(raw, []byte("# x-provenance:\n")) {
+		return raw
+	}
+	rest := raw[len("# x-provenance:\n"):]
+	for bytes.HasPrefix(rest, []byte("#   ")) {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			return nil
+		}
+		rest = rest[i+1:]
+	}
+	return rest
+}
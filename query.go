@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const queryUsage = `
+Usage:
+  go run . query -dir <path-to-pocs> [-cve <id>] [-path <request-path>] [-keyword <words>] [-format text|json]
+
+Answers "does a PoC exist for X?" from the corpus index (see check-new -h),
+refreshed from the files changed since the last run. Criteria combine: a PoC
+is listed when it matches all of them.
+
+  -cve      a CVE the PoC detects, e.g. CVE-2022-22965
+  -path     a request path, normalized like -normalize; also matches the
+            paths below it, so /actuator finds /actuator/env
+  -keyword  words from the PoC's name, tags and description; all must occur
+
+Flags:
+`
+
+// queryStopWords occur in nearly every PoC name and would match everything.
+var queryStopWords = map[string]bool{"poc": true, "yaml": true}
+
+type indexQuery struct {
+	CVE     string
+	Path    string
+	Keyword string
+}
+
+type queryMatch struct {
+	File  string   `json:"file"`
+	Name  string   `json:"name"`
+	CVEs  []string `json:"cves,omitempty"`
+	Paths []string `json:"paths,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+type pathPosting struct {
+	key string
+	doc int
+}
+
+// indexPostings is the inverted view of an index: CVE, keyword and
+// normalized request path to the PoCs holding them. Paths are kept sorted so
+// a path query also finds the paths below it.
+type indexPostings struct {
+	docs      []queryMatch
+	byCVE     map[string][]int
+	byKeyword map[string][]int
+	paths     []pathPosting
+	normalize pathNormalizer
+}
+
+func (idx *corpusIndex) postings(opts scanOptions) *indexPostings {
+	p := &indexPostings{byCVE: map[string][]int{}, byKeyword: map[string][]int{}, normalize: opts.Normalize}
+	for _, rel := range idx.sortedFiles() {
+		docs := idx.Files[rel].Docs
+		for i, d := range docs {
+			file := filepath.Join(opts.Root, filepath.FromSlash(rel))
+			if len(docs) > 1 {
+				file = fmt.Sprintf("%s#%d", file, i)
+			}
+			n := len(p.docs)
+			p.docs = append(p.docs, queryMatch{File: file, Name: d.Name, CVEs: d.CVEs, Paths: d.Paths, Tags: d.Tags})
+			for _, cve := range d.CVEs {
+				p.byCVE[cve] = append(p.byCVE[cve], n)
+			}
+			for _, word := range d.Keywords {
+				p.byKeyword[word] = append(p.byKeyword[word], n)
+			}
+			seen := map[string]bool{}
+			for _, path := range d.Paths {
+				if key := opts.Normalize.apply(path); !seen[key] {
+					seen[key] = true
+					p.paths = append(p.paths, pathPosting{key: key, doc: n})
+				}
+			}
+		}
+	}
+	sort.Slice(p.paths, func(i, j int) bool { return p.paths[i].key < p.paths[j].key })
+	return p
+}
+
+// keywords splits text into lowercase searchable words.
+func keywords(texts ...string) []string {
+	var words []string
+	for _, text := range texts {
+		for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len(word) > 1 && !queryStopWords[word] {
+				words = appendUnique(words, word)
+			}
+		}
+	}
+	return words
+}
+
+// query returns the PoCs matching every criterion of q, in file order.
+func (p *indexPostings) query(q indexQuery) []queryMatch {
+	var sets [][]int
+	if q.CVE != "" {
+		sets = append(sets, p.byCVE[strings.ToUpper(strings.TrimSpace(q.CVE))])
+	}
+	if q.Path != "" {
+		key := p.normalize.apply(q.Path)
+		prefix := strings.TrimSuffix(key, "/") + "/"
+		var docs []int
+		for i := sort.Search(len(p.paths), func(i int) bool { return p.paths[i].key >= key }); i < len(p.paths); i++ {
+			if k := p.paths[i].key; k != key && !strings.HasPrefix(k, prefix) {
+				break
+			}
+			docs = append(docs, p.paths[i].doc)
+		}
+		sets = append(sets, docs)
+	}
+	if q.Keyword != "" {
+		words := keywords(q.Keyword)
+		if len(words) == 0 {
+			sets = append(sets, nil)
+		}
+		for _, word := range words {
+			sets = append(sets, p.byKeyword[word])
+		}
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+	count := make(map[int]int)
+	for _, set := range sets {
+		seen := make(map[int]bool, len(set))
+		for _, doc := range set {
+			if !seen[doc] {
+				seen[doc] = true
+				count[doc]++
+			}
+		}
+	}
+	var hits []int
+	for doc, n := range count {
+		if n == len(sets) {
+			hits = append(hits, doc)
+		}
+	}
+	sort.Ints(hits)
+	matches := make([]queryMatch, 0, len(hits))
+	for _, doc := range hits {
+		matches = append(matches, p.docs[doc])
+	}
+	return matches
+}
+
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	cveFlag := fs.String("cve", "", "CVE the PoC detects")
+	pathFlag := fs.String("path", "", "Request path, also matching the paths below it")
+	keywordFlag := fs.String("keyword", "", "Words from the PoC's name, tags and description")
+	indexFlag := fs.String("index", "", "Corpus index file (default: under the user cache directory, one per -dir)")
+	formatFlag := fs.String("format", formatText, "Output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(queryUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	format := strings.ToLower(strings.TrimSpace(*formatFlag))
+	if format != formatText && format != formatJSON {
+		slog.Error("unsupported format (want text or json)", "format", *formatFlag)
+		return exitError
+	}
+	q := indexQuery{CVE: *cveFlag, Path: *pathFlag, Keyword: *keywordFlag}
+	if q == (indexQuery{}) {
+		slog.Error("pass at least one of -cve, -path and -keyword")
+		return exitUsage
+	}
+	indexPath := *indexFlag
+	if indexPath == "" {
+		indexPath = defaultIndexPath(opts.Root)
+	}
+	idx, err := openIndex(indexPath, opts)
+	if err != nil {
+		slog.Error("indexing PoCs", "err", err)
+		return exitError
+	}
+	matches := idx.postings(opts).query(q)
+
+	if format == formatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(matches); err != nil {
+			slog.Error("writing report", "err", err)
+			return exitError
+		}
+		return exitOK
+	}
+	for _, m := range matches {
+		fmt.Printf("%s\t%s", m.File, m.Name)
+		if len(m.CVEs) > 0 {
+			fmt.Printf("\t%s", strings.Join(m.CVEs, ","))
+		}
+		fmt.Println()
+	}
+	if len(matches) == 0 {
+		fmt.Fprintln(os.Stderr, "no PoC matches")
+	}
+	return exitOK
+}
+
+// serveQuery answers /query?cve=&path=&keyword= with the matching PoCs as
+// JSON.
+func serveQuery(postings func() *indexPostings) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values := r.URL.Query()
+		q := indexQuery{CVE: values.Get("cve"), Path: values.Get("path"), Keyword: values.Get("keyword")}
+		if q == (indexQuery{}) {
+			http.Error(w, "pass at least one of cve, path and keyword", http.StatusBadRequest)
+			return
+		}
+		p := postings()
+		if p == nil {
+			http.Error(w, "no scan has finished yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(p.query(q)); err != nil {
+			slog.Debug("writing query result", "err", err)
+		}
+	}
+}
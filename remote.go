@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A remote -dir (sftp:// or webdav[s]://) is mirrored into a local cache
+// before every scan. Only the listing and the files whose size or
+// modification time changed are transferred; the scan then runs on the
+// cache, which keeps the remote modification times for -keep.
+const (
+	schemeSFTP    = "sftp"
+	schemeWebDAV  = "webdav"
+	schemeWebDAVS = "webdavs"
+)
+
+type remoteFile struct {
+	Path    string // slash-separated, relative to the remote directory
+	Size    int64
+	ModTime time.Time
+}
+
+type remoteFetcher interface {
+	list(ctx context.Context) ([]remoteFile, error)
+	// fetch writes the files, given by relative path, under dir.
+	fetch(ctx context.Context, files []string, dir string) error
+}
+
+// remoteSource is a remote -dir and its local mirror.
+type remoteSource struct {
+	url     string // without credentials, for logs
+	cache   string
+	fetcher remoteFetcher
+}
+
+func isRemoteDir(dir string) bool {
+	scheme, _, ok := strings.Cut(dir, "://")
+	return ok && (scheme == schemeSFTP || scheme == schemeWebDAV || scheme == schemeWebDAVS)
+}
+
+// openRemoteSource parses a remote -dir. cache defaults to a directory
+// under the user cache directory named after the URL.
+func openRemoteSource(dir, cache string) (*remoteSource, error) {
+	u, err := url.Parse(dir)
+	if err != nil {
+		return nil, err
+	}
+	if u.Hostname() == "" || strings.HasPrefix(u.Host, "-") {
+		return nil, fmt.Errorf("%s: invalid host", dir)
+	}
+	display := *u
+	display.User = nil
+	if u.User != nil {
+		display.User = url.User(u.User.Username())
+	}
+	r := &remoteSource{url: display.String(), cache: cache}
+	switch u.Scheme {
+	case schemeSFTP:
+		r.fetcher = newSFTPFetcher(u)
+	case schemeWebDAV, schemeWebDAVS:
+		r.fetcher = newWebDAVFetcher(u)
+	default:
+		return nil, fmt.Errorf("%s: unsupported scheme %q (want sftp, webdav or webdavs)", dir, u.Scheme)
+	}
+	if r.cache == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("no cache directory for %s (set -remote-cache): %w", r.url, err)
+		}
+		sum := sha256.Sum256([]byte(r.url))
+		r.cache = filepath.Join(base, "repeaterxraypoc", "remote", hex.EncodeToString(sum[:8]))
+	}
+	return r, nil
+}
+
+// wantRemoteFile selects what is mirrored: PoCs plus the ignore files and
+// the config file that shape the scan.
+func wantRemoteFile(rel string) bool {
+	base := path.Base(rel)
+	return (isSupportedExt(rel) && !strings.HasSuffix(rel, provenanceSuffix)) ||
+		base == ignoreFileName || rel == configFileName
+}
+
+// sync brings the cache up to date with the remote directory.
+func (r *remoteSource) sync(ctx context.Context) error {
+	start := time.Now()
+	listed, err := r.fetcher.list(ctx)
+	if err != nil {
+		return fmt.Errorf("listing %s: %w", r.url, err)
+	}
+	if err := os.MkdirAll(r.cache, 0o755); err != nil {
+		return err
+	}
+	remote := make(map[string]remoteFile)
+	var changed []string
+	for _, f := range listed {
+		if !wantRemoteFile(f.Path) {
+			continue
+		}
+		remote[f.Path] = f
+		info, err := os.Stat(filepath.Join(r.cache, filepath.FromSlash(f.Path)))
+		if err == nil && info.Size() == f.Size && info.ModTime().Unix() == f.ModTime.Unix() {
+			continue
+		}
+		changed = append(changed, f.Path)
+	}
+	if len(changed) > 0 {
+		if err := r.fetcher.fetch(ctx, changed, r.cache); err != nil {
+			return fmt.Errorf("fetching from %s: %w", r.url, err)
+		}
+		for _, rel := range changed {
+			mtime := remote[rel].ModTime
+			if err := os.Chtimes(filepath.Join(r.cache, filepath.FromSlash(rel)), mtime, mtime); err != nil {
+				return err
+			}
+		}
+	}
+	removed, err := pruneMirror(r.cache, remote)
+	if err != nil {
+		return err
+	}
+	slog.Info("remote PoCs synced", "remote", r.url, "cache", r.cache, "files", len(remote),
+		"fetched", len(changed), "removed", removed, "duration", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// pruneMirror removes the cached files that are gone from the remote.
+func pruneMirror(cache string, remote map[string]remoteFile) (int, error) {
+	var stale []string
+	err := filepath.WalkDir(cache, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if _, ok := remote[relativeTo(cache, p)]; !ok {
+			stale = append(stale, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range stale {
+		if err := os.Remove(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
+
+// safeJoin places a remote relative path under dir, refusing paths that
+// would escape it.
+func safeJoin(dir, rel string) (string, error) {
+	clean := path.Clean("/" + rel)
+	if clean == "/" || rel != strings.TrimPrefix(clean, "/") {
+		return "", fmt.Errorf("unexpected relative path %q", rel)
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean[1:])), nil
+}
+
+// writeMirrorFile replaces dest with the content of r.
+func writeMirrorFile(dest string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".fetch-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// sftpFetcher reads an SFTP share through the sftp subsystem of the system
+// ssh client, so keys, agents, known_hosts and ProxyJump come from the
+// user's ssh config. It needs no shell on the host, so accounts limited to
+// internal-sftp, chrooted or not, work.
+type sftpFetcher struct {
+	dest string // [user@]host
+	port string
+	dir  string // remote directory; relative paths start at the login directory
+}
+
+func newSFTPFetcher(u *url.URL) *sftpFetcher {
+	f := &sftpFetcher{dest: u.Hostname(), port: u.Port(), dir: u.Path}
+	if u.User != nil {
+		f.dest = u.User.Username() + "@" + f.dest
+	}
+	// sftp://host/~/pocs is relative to the home directory, where the
+	// server starts.
+	if rest, ok := strings.CutPrefix(u.Path, "/~"); ok && (rest == "" || rest[0] == '/') {
+		f.dir = "." + rest
+	}
+	if f.dir == "" {
+		f.dir = "."
+	}
+	return f
+}
+
+func (f *sftpFetcher) dial(ctx context.Context) (*sftpClient, error) {
+	args := []string{"-o", "BatchMode=yes"}
+	if f.port != "" {
+		args = append(args, "-p", f.port)
+	}
+	return dialSFTP(ctx, append(args, "-s", f.dest, "sftp"))
+}
+
+func (f *sftpFetcher) list(ctx context.Context) ([]remoteFile, error) {
+	c, err := f.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	var files []remoteFile
+	var walk func(rel string) error
+	walk = func(rel string) error {
+		entries, err := c.readDir(path.Join(f.dir, rel))
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.name == "." || e.name == ".." {
+				continue
+			}
+			p := path.Join(rel, e.name)
+			attrs := e.attrs
+			if attrs.mode == 0 {
+				if attrs, err = c.stat(path.Join(f.dir, p)); err != nil {
+					return err
+				}
+			}
+			// Symbolic links are skipped, as find -type f would.
+			switch attrs.mode & sftpModeType {
+			case sftpModeDir:
+				if err := walk(p); err != nil {
+					return err
+				}
+			case sftpModeReg:
+				files = append(files, remoteFile{Path: p, Size: attrs.size, ModTime: time.Unix(attrs.mtime, 0)})
+			}
+		}
+		return nil
+	}
+	if err := walk(""); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (f *sftpFetcher) fetch(ctx context.Context, files []string, dir string) error {
+	c, err := f.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	for _, rel := range files {
+		dest, err := safeJoin(dir, rel)
+		if err != nil {
+			return err
+		}
+		file, err := c.open(path.Join(f.dir, rel))
+		if err != nil {
+			return err
+		}
+		err = writeMirrorFile(dest, file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+	}
+	return nil
+}
+
+// webdavFetcher lists a WebDAV collection with PROPFIND, one level at a
+// time since many servers refuse Depth: infinity, and downloads with GET.
+type webdavFetcher struct {
+	base     *url.URL // collection URL, ending in /
+	user     string
+	password string
+	http     *http.Client
+}
+
+func newWebDAVFetcher(u *url.URL) *webdavFetcher {
+	base := *u
+	base.Scheme = "http"
+	if u.Scheme == schemeWebDAVS {
+		base.Scheme = "https"
+	}
+	base.User = nil
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	f := &webdavFetcher{
+		base:     &base,
+		user:     os.Getenv("WEBDAV_USERNAME"),
+		password: os.Getenv("WEBDAV_PASSWORD"),
+		http:     &http.Client{Timeout: time.Minute},
+	}
+	if u.User != nil {
+		f.user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			f.password = p
+		}
+	}
+	return f
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/><D:getlastmodified/></D:prop></D:propfind>`
+
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+				ContentLength int64  `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+func (f *webdavFetcher) request(ctx context.Context, method string, u *url.URL, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if f.user != "" {
+		req.SetBasicAuth(f.user, f.password)
+	}
+	if method == "PROPFIND" {
+		req.Header.Set("Depth", "1")
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	return f.http.Do(req)
+}
+
+func (f *webdavFetcher) list(ctx context.Context) ([]remoteFile, error) {
+	var files []remoteFile
+	queue := []string{f.base.Path}
+	seen := map[string]bool{f.base.Path: true}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		u := *f.base
+		u.Path = dir
+		resp, err := f.request(ctx, "PROPFIND", &u, strings.NewReader(propfindBody))
+		if err != nil {
+			return nil, err
+		}
+		var ms davMultistatus
+		if resp.StatusCode != http.StatusMultiStatus {
+			err = fmt.Errorf("PROPFIND %s: %s", u.Path, resp.Status)
+		} else {
+			err = xml.NewDecoder(resp.Body).Decode(&ms)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range ms.Responses {
+			href, err := url.Parse(r.Href)
+			if err != nil {
+				return nil, fmt.Errorf("PROPFIND %s: bad href %q", u.Path, r.Href)
+			}
+			p := href.Path
+			rel, ok := strings.CutPrefix(p, f.base.Path)
+			if !ok || strings.TrimSuffix(p, "/") == strings.TrimSuffix(dir, "/") {
+				continue
+			}
+			for _, ps := range r.Propstat {
+				if !strings.Contains(ps.Status, " 200 ") {
+					continue
+				}
+				if ps.Prop.ResourceType.Collection != nil {
+					if !strings.HasSuffix(p, "/") {
+						p += "/"
+					}
+					if !seen[p] {
+						seen[p] = true
+						queue = append(queue, p)
+					}
+					continue
+				}
+				mtime, _ := http.ParseTime(ps.Prop.LastModified)
+				files = append(files, remoteFile{Path: rel, Size: ps.Prop.ContentLength, ModTime: mtime})
+			}
+		}
+	}
+	return files, nil
+}
+
+func (f *webdavFetcher) fetch(ctx context.Context, files []string, dir string) error {
+	const workers = 4
+	jobs := make(chan string)
+	errs := make(chan error, len(files))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range jobs {
+				errs <- f.get(ctx, rel, dir)
+			}
+		}()
+	}
+	for _, rel := range files {
+		jobs <- rel
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+	var all []error
+	for err := range errs {
+		all = append(all, err)
+	}
+	return errors.Join(all...)
+}
+
+func (f *webdavFetcher) get(ctx context.Context, rel, dir string) error {
+	dest, err := safeJoin(dir, rel)
+	if err != nil {
+		return err
+	}
+	u := *f.base
+	u.Path = f.base.Path + rel
+	resp, err := f.request(ctx, http.MethodGet, &u, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u.Path, resp.Status)
+	}
+	return writeMirrorFile(dest, resp.Body)
+}
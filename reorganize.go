@@ -0,0 +1,305 @@
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// layoutManifestName is the manifest reorganize keeps at the top of -dir:
+// the layout, the moves of the last run and the sha256 of every PoC, in the
+// format of sha256sum.
+const layoutManifestName = ".repeaterxraypoc-layout.sha256"
+
+// layoutPresets are the -layout shorthands.
+var layoutPresets = map[string]string{
+	"by-year":     "by-year/CVE-{year}",
+	"by-vendor":   "by-vendor/{vendor}",
+	"by-severity": "by-severity/{severity}",
+}
+
+// layoutUnknown stands in for a placeholder a PoC has no value for.
+const layoutUnknown = "unknown"
+
+var layoutPlaceholder = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// layoutFields are the placeholders of a layout template.
+var layoutFields = map[string]string{
+	"year":      "year of the first CVE",
+	"cve":       "first CVE",
+	"vendor":    "vendor field, or the first word of the name after poc-yaml-",
+	"product":   "product field, or the second word of a name of three or more",
+	"severity":  "severity",
+	"tag":       "first tag",
+	"transport": "transport (http, tcp or udp)",
+}
+
+const reorganizeUsage = `
+Usage:
+  go run . reorganize -dir <path-to-pocs> -layout <template|preset> [-dry-run] [-manifest <file>] [-git-mv] [-lock-wait <duration>]
+
+Moves PoC files into the directories a layout template derives from their
+metadata, so that a flat directory of thousands of PoCs becomes navigable.
+The template is a relative path with placeholders, e.g.
+by-vendor/{vendor}/{severity}; presets: by-year (by-year/CVE-{year}),
+by-vendor (by-vendor/{vendor}) and by-severity (by-severity/{severity}). A
+placeholder without a value becomes "unknown". Files keep their name, with
+-2, -3, ... appended when it is taken in the new directory; files holding
+several PoCs stay where they are. Directories left empty are removed. Each
+move is printed as old -> new, and the manifest (` + layoutManifestName + `
+under -dir by default) is rewritten with the layout, the moves and the
+sha256 of every PoC. With -git-mv, files tracked by git are moved with git mv.
+
+Placeholders:
+`
+
+func runReorganize(args []string) int {
+	fs := flag.NewFlagSet("reorganize", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	layoutFlag := fs.String("layout", "", "Directory layout: a template such as by-vendor/{vendor} or a preset (by-year, by-vendor, by-severity)")
+	dryRunFlag := fs.Bool("dry-run", false, "Print the moves without moving anything")
+	manifestFlag := fs.String("manifest", "", "Manifest to rewrite (default: "+layoutManifestName+" under -dir; none to skip)")
+	gitMvFlag := fs.Bool("git-mv", false, "Move files tracked by git with git mv")
+	lockWaitFlag := fs.Duration("lock-wait", 0, lockWaitUsage)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(reorganizeUsage, "\n"))
+		fields := make([]string, 0, len(layoutFields))
+		for field := range layoutFields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			fmt.Fprintf(fs.Output(), "  %-12s %s\n", "{"+field+"}", layoutFields[field])
+		}
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	layout, err := parseLayout(*layoutFlag)
+	if err != nil {
+		slog.Error("invalid -layout", "err", err)
+		return exitUsage
+	}
+	if !*dryRunFlag {
+		unlock, err := lockRoot(opts, *lockWaitFlag)
+		if err != nil {
+			slog.Error("cannot lock -dir", "err", err)
+			return exitError
+		}
+		defer unlock()
+	}
+	moves, err := planLayoutMoves(opts, layout)
+	if err != nil {
+		slog.Error("planning moves", "err", err)
+		return exitError
+	}
+
+	done := moves
+	if !*dryRunFlag {
+		done, err = moveFiles(opts.Root, moves, *gitMvFlag)
+		if err != nil {
+			slog.Error("moving PoCs", "err", err)
+		}
+	}
+	if !*sf.quiet {
+		for _, m := range done {
+			fmt.Printf("%s -> %s\n", m.From, m.To)
+		}
+	}
+	if !*dryRunFlag && *manifestFlag != "none" {
+		manifest := *manifestFlag
+		if manifest == "" {
+			manifest = filepath.Join(opts.Root, layoutManifestName)
+		}
+		if werr := writeLayoutManifest(manifest, opts, layout, done); werr != nil {
+			slog.Error("writing manifest", "manifest", manifest, "err", werr)
+			return exitError
+		}
+	}
+	if err != nil {
+		return exitError
+	}
+	slog.Info("PoCs reorganized", "layout", layout, "moved", len(done), "dry_run", *dryRunFlag)
+	return exitOK
+}
+
+// parseLayout expands a preset and checks the template: a relative path
+// whose placeholders are known.
+func parseLayout(value string) (string, error) {
+	layout := strings.TrimSpace(value)
+	if preset, ok := layoutPresets[strings.ToLower(layout)]; ok {
+		layout = preset
+	}
+	if layout == "" {
+		return "", fmt.Errorf("no layout given")
+	}
+	layout = strings.Trim(filepath.ToSlash(layout), "/")
+	for _, segment := range strings.Split(layout, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("%q is not a relative directory path", value)
+		}
+	}
+	for _, m := range layoutPlaceholder.FindAllStringSubmatch(layout, -1) {
+		if _, ok := layoutFields[m[1]]; !ok {
+			return "", fmt.Errorf("unknown placeholder {%s}", m[1])
+		}
+	}
+	if rest := layoutPlaceholder.ReplaceAllString(layout, ""); strings.ContainsAny(rest, "{}") {
+		return "", fmt.Errorf("malformed placeholder in %q", value)
+	}
+	return layout, nil
+}
+
+// layoutValues extracts the placeholder values of a PoC document.
+func layoutValues(root *yaml.Node, name string) map[string]string {
+	detail := extractDetail(root, name)
+	top := root
+	if top.Kind == yaml.DocumentNode && len(top.Content) > 0 {
+		top = top.Content[0]
+	}
+	mappings := []*yaml.Node{mappingValue(top, "detail"), top}
+	values := map[string]string{
+		"severity":  detail.Severity,
+		"transport": detail.Transport,
+		"vendor":    firstString(mappings, "vendor"),
+		"product":   firstString(mappings, "product"),
+	}
+	if len(detail.CVEs) > 0 {
+		values["cve"] = detail.CVEs[0]
+		values["year"] = strings.SplitN(detail.CVEs[0], "-", 3)[1]
+	}
+	if len(detail.Tags) > 0 {
+		values["tag"] = detail.Tags[0]
+	}
+	words := strings.Split(strings.TrimPrefix(normalizedStem(name), pocNamePrefix), "-")
+	if values["vendor"] == "" && words[0] != "" {
+		values["vendor"] = words[0]
+	}
+	if values["product"] == "" && len(words) >= 3 {
+		values["product"] = words[1]
+	}
+	return values
+}
+
+// layoutSegment makes a placeholder value safe as part of a directory name.
+func layoutSegment(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '-'
+	}, strings.TrimSpace(value))
+	if value = strings.Trim(value, "-."); value == "" {
+		return layoutUnknown
+	}
+	return value
+}
+
+// renderLayout fills in the template for one PoC. Names are lowercased;
+// CVE IDs keep their case.
+func renderLayout(layout string, values map[string]string) string {
+	return layoutPlaceholder.ReplaceAllStringFunc(layout, func(m string) string {
+		field := m[1 : len(m)-1]
+		value := values[field]
+		if field != "cve" {
+			value = strings.ToLower(value)
+		}
+		return layoutSegment(value)
+	})
+}
+
+// planLayoutMoves picks the directory of every single-PoC file under the
+// layout, suffixing the file name when it is taken there. Every file present
+// counts as taken, so the moves can be carried out one after another.
+func planLayoutMoves(opts scanOptions, layout string) ([]fileMove, error) {
+	type candidate struct {
+		rel, dir string
+	}
+	var candidates []candidate
+	taken := make(map[string]bool)
+	err := walkPoCFiles(opts, func(file string) error {
+		rel := relativeTo(opts.Root, file)
+		taken[fileKey(rel)] = true
+		pf, err := readPoCFile(file)
+		if err != nil {
+			slog.Warn("skipping file", "file", file, "err", err)
+			return nil
+		}
+		if len(pf.Docs) != 1 {
+			slog.Debug("leaving file with several PoCs", "file", file, "pocs", len(pf.Docs))
+			return nil
+		}
+		dir := renderLayout(layout, layoutValues(&pf.Root, findFirstScalar(&pf.Root, "name")))
+		candidates = append(candidates, candidate{rel: rel, dir: dir})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].rel < candidates[j].rel })
+
+	var moves []fileMove
+	for _, c := range candidates {
+		base := path.Base(c.rel)
+		if path.Dir(c.rel) == c.dir {
+			continue
+		}
+		ext := path.Ext(base)
+		stem := strings.TrimSuffix(base, ext)
+		to := c.dir + "/" + base
+		for suffix := 2; taken[fileKey(to)]; suffix++ {
+			to = c.dir + "/" + stem + "-" + strconv.Itoa(suffix) + ext
+		}
+		taken[fileKey(to)] = true
+		moves = append(moves, fileMove{From: c.rel, To: to})
+	}
+	return moves, nil
+}
+
+// writeLayoutManifest records the layout and the moves as comment lines,
+// which sha256sum -c skips, followed by the sha256 of every PoC file.
+func writeLayoutManifest(manifest string, opts scanOptions, layout string, moves []fileMove) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# layout: %s\n", layout)
+	for _, m := range moves {
+		fmt.Fprintf(&b, "# moved: %s -> %s\n", m.From, m.To)
+	}
+	sums := make(map[string][sha256.Size]byte)
+	err := walkPoCFiles(opts, func(file string) error {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		sums[relativeTo(opts.Root, file)] = sha256.Sum256(raw)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	rels := make([]string, 0, len(sums))
+	for rel := range sums {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	for _, rel := range rels {
+		fmt.Fprintf(&b, "%x  %s\n", sums[rel], rel)
+	}
+	return os.WriteFile(manifest, []byte(b.String()), 0o644)
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	formatText     = "text"
+	formatJSON     = "json"
+	formatSARIF    = "sarif"
+	formatHTML     = "html"
+	formatMarkdown = "markdown"
+)
+
+type scanReport struct {
+	ToolVersion string `json:"tool_version"`
+	Root        string `json:"root"`
+	Strategy    string `json:"strategy"`
+	Files       int    `json:"files"`
+	// Reclaimable is the number of bytes -delete frees overall, counting
+	// a PoC found in several groups once.
+	Reclaimable    int64           `json:"reclaimable_bytes"`
+	Duplicates     []reportGroup   `json:"duplicates"`
+	NameCollisions []nameCollision `json:"name_collisions"`
+	// BaselineSuppressed counts duplicate groups hidden because the baseline
+	// already accepts them.
+	BaselineSuppressed int           `json:"baseline_suppressed,omitempty"`
+	Skipped            []skippedFile `json:"skipped"`
+	// Directories is set by -group-report dir.
+	Directories []dirSummary `json:"directories,omitempty"`
+	// Subsets is set by -detect-subsets.
+	Subsets []subsetFinding `json:"subsets,omitempty"`
+	// Reverse is set by -list-reverse.
+	Reverse []reversePoC `json:"reverse,omitempty"`
+	// Stubs is set by -list-stubs.
+	Stubs []stubPoC `json:"stubs,omitempty"`
+	// Lint is set by -lint; its findings count as invalid PoCs.
+	Lint []lintFinding `json:"lint,omitempty"`
+	// OmittedGroups counts the duplicate groups left out by -top.
+	OmittedGroups int `json:"omitted_groups,omitempty"`
+	// Incomplete says why the scan stopped before reading every file, on
+	// SIGINT or -timeout; the report then covers the files read until then.
+	Incomplete string `json:"incomplete,omitempty"`
+	// ConfirmToken is set by -delete -dry-run: the -confirm value that
+	// carries out the deletions it reviewed.
+	ConfirmToken string `json:"confirm_token,omitempty"`
+}
+
+type reportGroup struct {
+	Key     string     `json:"key"`
+	Keep    string     `json:"keep"`
+	Entries []pocEntry `json:"entries"`
+	// Reclaimable is the number of bytes -delete frees in this group.
+	Reclaimable int64 `json:"reclaimable_bytes"`
+	// Confidence scores how surely the group holds real duplicates, from
+	// 0.4 (same path only) to 1 (same content); Basis says why.
+	Confidence float64 `json:"confidence"`
+	Basis      string  `json:"confidence_basis"`
+	// Owners is set by -codeowners.
+	Owners []string `json:"owners,omitempty"`
+	// Attribution is set by -attribution: the authors of each file.
+	Attribution []pocAttribution `json:"attribution,omitempty"`
+}
+
+// Orders of the duplicate groups in the report, chosen with -sort.
+const (
+	reportSortPath   = "path"
+	reportSortCount  = "count"
+	reportSortSize   = "size"
+	reportSortNewest = "newest"
+)
+
+func isSupportedReportSort(by string) bool {
+	switch by {
+	case reportSortPath, reportSortCount, reportSortSize, reportSortNewest:
+		return true
+	default:
+		return false
+	}
+}
+
+// sortReportGroups orders the groups for review: by key (path), by number
+// of PoCs, by the bytes -delete would free in the group, or by the most
+// recent modification, ties broken by key.
+func sortReportGroups(groups []reportGroup, by string) {
+	metric := func(g reportGroup) int64 {
+		switch by {
+		case reportSortCount:
+			return int64(len(g.Entries))
+		case reportSortSize:
+			return g.Reclaimable
+		case reportSortNewest:
+			var newest int64
+			for _, entry := range g.Entries {
+				newest = max(newest, entry.ModTime.UnixNano())
+			}
+			return newest
+		}
+		return 0
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if a, b := metric(groups[i]), metric(groups[j]); a != b {
+			return a > b
+		}
+		return groups[i].Key < groups[j].Key
+	})
+}
+
+// reclaimableBytes is the size of the PoCs -delete removes from the
+// group. counted, shared across groups, makes a PoC that is a duplicate in
+// several groups count once; pass nil for the group on its own.
+func reclaimableBytes(entries []pocEntry, counted map[string]bool) int64 {
+	if counted == nil {
+		counted = make(map[string]bool)
+	}
+	var total int64
+	keep := entries[0].unit()
+	for _, entry := range entries[1:] {
+		if unit := entry.unit(); unit != keep && !counted[unit] {
+			counted[unit] = true
+			total += entry.Size
+		}
+	}
+	return total
+}
+
+// limitReportGroups keeps the first top groups, recording how many were
+// left out. top 0 keeps them all.
+func limitReportGroups(report *scanReport, top int) {
+	if top > 0 && len(report.Duplicates) > top {
+		report.OmittedGroups = len(report.Duplicates) - top
+		report.Duplicates = report.Duplicates[:top]
+	}
+}
+
+func isSupportedFormat(format string) bool {
+	switch format {
+	case formatText, formatJSON, formatSARIF, formatHTML, formatMarkdown:
+		return true
+	default:
+		return false
+	}
+}
+
+func buildReport(opts scanOptions, entries []pocEntry, skipped []skippedFile, duplicates []duplicateGroup) scanReport {
+	files := make(map[string]struct{})
+	for _, entry := range entries {
+		files[entry.FilePath] = struct{}{}
+	}
+	report := scanReport{
+		ToolVersion: toolVersion(),
+		Root:        opts.Root,
+		Strategy:    opts.Strategy,
+		Files:       len(files),
+		Duplicates:  make([]reportGroup, 0, len(duplicates)),
+		Skipped:     skipped,
+	}
+	if report.Skipped == nil {
+		report.Skipped = []skippedFile{}
+	}
+	report.NameCollisions = []nameCollision{}
+	counted := make(map[string]bool)
+	for _, group := range duplicates {
+		report.Duplicates = append(report.Duplicates, reportGroup{
+			Key:         group.Key,
+			Keep:        group.Entries[0].FilePath,
+			Entries:     group.Entries,
+			Reclaimable: reclaimableBytes(group.Entries, nil),
+			Confidence:  group.Confidence,
+			Basis:       group.Basis,
+		})
+		report.Reclaimable += reclaimableBytes(group.Entries, counted)
+	}
+	return report
+}
+
+// writeJSONReport encodes the duplicate groups one at a time rather than
+// building the whole document in memory first; the output is the same as
+// encoding the report in one go.
+func writeJSONReport(w io.Writer, report scanReport) error {
+	groups := report.Duplicates
+	report.Duplicates = nil
+	head, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	before, after, ok := bytes.Cut(head, []byte("\n  \"duplicates\": null"))
+	if !ok {
+		return errors.New("encoding report: duplicates field not found")
+	}
+	bw := bufio.NewWriter(w)
+	bw.Write(before)
+	bw.WriteString("\n  \"duplicates\": [")
+	for i, group := range groups {
+		raw, err := json.MarshalIndent(group, "    ", "  ")
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		bw.WriteString("\n    ")
+		bw.Write(raw)
+	}
+	if len(groups) > 0 {
+		bw.WriteString("\n  ")
+	}
+	bw.WriteByte(']')
+	bw.Write(after)
+	bw.WriteByte('\n')
+	return bw.Flush()
+}
+
+type textReportOptions struct {
+	Deleting bool
+	Diff     string
+	ByDir    bool
+	Sort     string
+	Assign   bool
+}
+
+func printTextReport(report scanReport, ropts textReportOptions) {
+	if report.Incomplete != "" {
+		fmt.Printf(tr("Partial report: the scan stopped early (%s) and only covers the files read until then.\n\n"), report.Incomplete)
+	}
+	defer printSkippedReport(report.Skipped)
+	defer printLintFindings(report.Lint)
+	if report.Files == 0 {
+		fmt.Print(tr("No PoC files found.\n"))
+		return
+	}
+	defer printNameCollisions(report.NameCollisions)
+	defer printSubsets(report.Subsets)
+	defer printReversePoCs(report.Reverse)
+	defer printStubPoCs(report.Stubs)
+	if report.BaselineSuppressed > 0 {
+		defer fmt.Printf(tr("\n%d known duplicate groups suppressed by the baseline.\n"), report.BaselineSuppressed)
+	}
+	if len(report.Duplicates) == 0 {
+		fmt.Printf(tr("No duplicate PoCs detected based on %s.\n"), report.Strategy)
+		return
+	}
+	if ropts.ByDir {
+		printDirReport(report.Directories)
+	} else {
+		printDuplicateReport(report, ropts)
+		fmt.Printf(tr("\nTotal reclaimable: %s\n"), humanBytes(report.Reclaimable))
+	}
+	if report.ConfirmToken != "" {
+		fmt.Printf(tr("\nDry run: nothing was deleted. Run again with -delete -confirm %s to carry out these deletions.\n"), report.ConfirmToken)
+	} else if !ropts.Deleting && report.Incomplete == "" {
+		fmt.Print(tr("\nRun again with -delete -dry-run to review the deletions and get the token -delete -confirm needs.\n"))
+	}
+}
+
+func printSkippedReport(skipped []skippedFile) {
+	if len(skipped) == 0 {
+		return
+	}
+	fmt.Printf(tr("\nSkipped %d files:\n"), len(skipped))
+	for _, s := range skipped {
+		fmt.Printf("  - %s: %s\n", s.File, s.Error)
+	}
+}
+
+func printLintFindings(findings []lintFinding) {
+	if len(findings) == 0 {
+		return
+	}
+	fmt.Printf(tr("\n%d lint findings:\n"), len(findings))
+	for _, finding := range findings {
+		fmt.Printf("  - %s: [%s] %s\n", finding.File, finding.Rule, finding.Message)
+	}
+}
+
+func printNameCollisions(collisions []nameCollision) {
+	if len(collisions) == 0 {
+		return
+	}
+	fmt.Printf(tr("\nDetected %d name collisions (xray refuses duplicate plugin names):\n"), len(collisions))
+	for _, c := range collisions {
+		fmt.Printf("\n%s\n", colored(fmt.Sprintf(tr("Name: %s"), c.Name), ansiBold))
+		for _, file := range c.Files {
+			fmt.Printf("  - %s\n", file)
+		}
+	}
+}
+
+func printDuplicateReport(report scanReport, ropts textReportOptions) {
+	label := "Path"
+	switch report.Strategy {
+	case strategyHash:
+		label = "Hash"
+	case strategyFingerprint:
+		label = "Fingerprint"
+	case strategyFields:
+		label = "Key"
+	}
+	if report.OmittedGroups > 0 {
+		fmt.Printf(tr("Detected %d duplicated %s groups, showing the top %d by %s:\n"),
+			len(report.Duplicates)+report.OmittedGroups, report.Strategy, len(report.Duplicates), ropts.Sort)
+	} else {
+		fmt.Printf(tr("Detected %d duplicated %s groups:\n"), len(report.Duplicates), report.Strategy)
+	}
+	if !ropts.Assign {
+		for _, group := range report.Duplicates {
+			printReportGroup(report, group, label, ropts)
+		}
+		return
+	}
+	for _, section := range splitByOwner(report.Duplicates) {
+		fmt.Printf("\n%s\n", colored(fmt.Sprintf(tr("== %s: %d groups =="), section.Owner, len(section.Groups)), ansiBold))
+		for _, group := range section.Groups {
+			printReportGroup(report, group, label, ropts)
+		}
+	}
+}
+
+func printReportGroup(report scanReport, group reportGroup, label string, ropts textReportOptions) {
+	fmt.Printf("\n%s\n", colored(fmt.Sprintf("%s: %s", tr(label), group.Key), ansiBold))
+	fmt.Printf(tr("  confidence: %.1f (%s)\n"), group.Confidence, tr(group.Basis))
+	if len(group.Owners) > 0 {
+		fmt.Printf(tr("  owners: %s\n"), strings.Join(group.Owners, " "))
+	}
+	if len(group.Attribution) > 0 {
+		fmt.Println(tr("  authors:"))
+		for _, attr := range group.Attribution {
+			fmt.Printf("    %s: %s\n", attr.File, describeAttribution(attr))
+		}
+	}
+	keep := group.Entries[0].unit()
+	for _, entry := range group.Entries {
+		var line strings.Builder
+		fmt.Fprintf(&line, "  - name=%q file=%s modified=%s", entry.Name, entry.FilePath, entry.ModTime.Format(time.RFC3339))
+		if entry.Docs > 1 {
+			fmt.Fprintf(&line, " doc=%d", entry.Doc)
+		}
+		if entry.Unverified {
+			line.WriteString(" unverified")
+		}
+		if report.Strategy == strategyPath && entry.Path != "" && entry.Path != group.Key {
+			fmt.Fprintf(&line, " path=%s", entry.Path)
+		}
+		writeDetail(&line, *entry.Detail)
+		if entry.unit() == keep {
+			fmt.Println(colored(line.String(), ansiGreen))
+		} else {
+			fmt.Println(colored(line.String(), ansiRed))
+		}
+	}
+	fmt.Println(colored(fmt.Sprintf(tr("  * keep: %s (reclaimable: %s)"), keep, humanBytes(group.Reclaimable)), ansiGreen, ansiBold))
+	if ropts.Diff != diffOff {
+		printGroupDiffs(group, ropts.Diff)
+	}
+}
+
+func writeDetail(w io.Writer, d pocDetail) {
+	if d.Severity != "" {
+		fmt.Fprintf(w, " severity=%s", d.Severity)
+	}
+	if len(d.CVEs) > 0 {
+		fmt.Fprintf(w, " cve=%s", strings.Join(d.CVEs, ","))
+	}
+	if d.CVSS > 0 {
+		fmt.Fprintf(w, " cvss=%.1f", d.CVSS)
+	}
+	if len(d.Tags) > 0 {
+		fmt.Fprintf(w, " tags=%s", strings.Join(d.Tags, ","))
+	}
+	if d.Reverse {
+		fmt.Fprint(w, " reverse")
+	}
+	if d.Stub != "" {
+		fmt.Fprint(w, " stub")
+	}
+}
+
+func printGroupDiffs(group reportGroup, mode string) {
+	for _, entry := range group.Entries[1:] {
+		if entry.FilePath == group.Keep {
+			continue
+		}
+		diff, err := renderFileDiff(group.Keep, entry.FilePath, mode)
+		if err != nil {
+			slog.Warn("rendering diff", "file", entry.FilePath, "err", err)
+			continue
+		}
+		fmt.Println()
+		fmt.Print(indentLines(diff, "    "))
+	}
+}
+
+func indentLines(s, prefix string) string {
+	lines := splitLines(s)
+	for i, line := range lines {
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// reverseCall matches newReverse(), which makes xray allocate an endpoint on
+// its reverse (OOB, dnslog) platform for the PoC to trigger.
+var reverseCall = regexp.MustCompile(`\bnewReverse\s*\(`)
+
+// reversePoC is a PoC that cannot run without reverse infrastructure.
+type reversePoC struct {
+	File string `json:"file"`
+	Name string `json:"name"`
+}
+
+// needsReverse reports whether any value of the document, usually a set
+// variable, calls newReverse().
+func needsReverse(node *yaml.Node) bool {
+	node = resolveAlias(node)
+	if node == nil {
+		return false
+	}
+	if node.Kind == yaml.ScalarNode {
+		return reverseCall.MatchString(node.Value)
+	}
+	for _, child := range node.Content {
+		if needsReverse(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// findReversePoCs lists the PoCs that need reverse infrastructure, by file.
+func findReversePoCs(units []pocEntry) []reversePoC {
+	seen := make(map[string]bool)
+	var out []reversePoC
+	for _, entry := range units {
+		if !entry.Detail.Reverse || seen[entry.unit()] {
+			continue
+		}
+		seen[entry.unit()] = true
+		out = append(out, reversePoC{File: entry.unit(), Name: entry.Name})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].File < out[j].File })
+	return out
+}
+
+func printReversePoCs(list []reversePoC) {
+	if len(list) == 0 {
+		return
+	}
+	fmt.Printf(tr("\n%d PoCs need a reverse (OOB) server; leave them out with -exclude-reverse:\n"), len(list))
+	for _, p := range list {
+		fmt.Printf("  - %s (%s)\n", p.File, p.Name)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+
+	ruleDuplicatePoC = "duplicate-poc"
+	ruleInvalidPoC   = "invalid-poc"
+	ruleNameClash    = "name-collision"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version,omitempty"`
+	Rules   []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Rank             float64         `json:"rank,omitempty"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	ID               int                   `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+func writeSARIFReport(w io.Writer, report scanReport) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:    "repeaterxraypoc",
+			Version: toolVersion(),
+			Rules: []sarifRule{
+				{ID: ruleDuplicatePoC, ShortDescription: sarifMessage{Text: "PoC duplicates another PoC"}},
+				{ID: ruleInvalidPoC, ShortDescription: sarifMessage{Text: "PoC file could not be parsed or validated"}},
+				{ID: ruleNameClash, ShortDescription: sarifMessage{Text: "PoC name is already used by another PoC"}},
+			},
+		}},
+		Results: []sarifResult{},
+	}
+	for _, group := range report.Duplicates {
+		for _, entry := range group.Entries[1:] {
+			run.Results = append(run.Results, sarifResult{
+				RuleID: ruleDuplicatePoC,
+				Level:  "warning",
+				Message: sarifMessage{Text: fmt.Sprintf("PoC %q duplicates %s %s already covered by %s (confidence %.1f: %s)",
+					entry.Name, report.Strategy, group.Key, group.Keep, group.Confidence, group.Basis)},
+				Rank:             group.Confidence * 100,
+				Locations:        []sarifLocation{sarifFileLocation(0, entry.FilePath)},
+				RelatedLocations: []sarifLocation{sarifFileLocation(1, group.Keep)},
+			})
+		}
+	}
+	for _, collision := range report.NameCollisions {
+		for _, file := range collision.Files[1:] {
+			run.Results = append(run.Results, sarifResult{
+				RuleID:           ruleNameClash,
+				Level:            "warning",
+				Message:          sarifMessage{Text: fmt.Sprintf("PoC name %q is also used by %s", collision.Name, collision.Files[0])},
+				Locations:        []sarifLocation{sarifFileLocation(0, file)},
+				RelatedLocations: []sarifLocation{sarifFileLocation(1, collision.Files[0])},
+			})
+		}
+	}
+	for _, rule := range scanLintRules() {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: rule.ID, ShortDescription: sarifMessage{Text: rule.Description}})
+	}
+	for _, finding := range report.Lint {
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    finding.Rule,
+			Level:     "error",
+			Message:   sarifMessage{Text: finding.Message},
+			Locations: []sarifLocation{sarifFileLocation(0, finding.File)},
+		})
+	}
+	for _, skipped := range report.Skipped {
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    ruleInvalidPoC,
+			Level:     "error",
+			Message:   sarifMessage{Text: skipped.Error},
+			Locations: []sarifLocation{sarifFileLocation(0, skipped.File)},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	})
+}
+
+func sarifFileLocation(id int, path string) sarifLocation {
+	uri := filepath.ToSlash(path)
+	if filepath.IsAbs(path) {
+		if !strings.HasPrefix(uri, "/") {
+			uri = "/" + uri
+		}
+		uri = "file://" + uri
+	} else {
+		uri = strings.TrimPrefix(uri, "./")
+	}
+	return sarifLocation{
+		ID:               id,
+		PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: uri}},
+	}
+}
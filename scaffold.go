@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const newUsage = `
+Usage:
+  go run . new -dir <path-to-pocs> -name <name> [-cve CVE-YYYY-NNNN] [-path <request-path>] [-method GET] [-out <file>]
+
+Writes an xray v2 PoC skeleton named poc-yaml-<name> to <dir>/<name>.yml, in
+the style fmt produces. Nothing is written when the corpus already has a PoC
+with that name, or one whose request path would make the new PoC a duplicate
+(pass -force to write it anyway).
+
+Flags:
+`
+
+// pocSlugPattern is the naming convention for the part after poc-yaml-:
+// lowercase words joined by dashes, e.g. thinkphp5-rce.
+var pocSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type scaffoldPoC struct {
+	Name       string                  `yaml:"name"`
+	Manual     bool                    `yaml:"manual"`
+	Transport  string                  `yaml:"transport"`
+	Rules      map[string]scaffoldRule `yaml:"rules"`
+	Expression string                  `yaml:"expression"`
+	Detail     scaffoldDetail          `yaml:"detail"`
+}
+
+type scaffoldRule struct {
+	Request struct {
+		Cache           bool   `yaml:"cache"`
+		Method          string `yaml:"method"`
+		Path            string `yaml:"path"`
+		FollowRedirects bool   `yaml:"follow_redirects"`
+	} `yaml:"request"`
+	Expression string `yaml:"expression"`
+}
+
+type scaffoldDetail struct {
+	Author string   `yaml:"author"`
+	Links  []string `yaml:"links"`
+}
+
+func runNew(args []string) int {
+	fs := flag.NewFlagSet("new", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	nameFlag := fs.String("name", "", "PoC name, with or without the poc-yaml- prefix")
+	cveFlag := fs.String("cve", "", "CVE the PoC detects, linked from detail.links")
+	pathFlag := fs.String("path", "/", "Request path of the first rule")
+	methodFlag := fs.String("method", "GET", "Request method of the first rule")
+	authorFlag := fs.String("author", "", "detail.author")
+	outFlag := fs.String("out", "", "File to write (default: <dir>/<name>.yml)")
+	forceFlag := fs.Bool("force", false, "Write the PoC even when an existing PoC has the same request path")
+	lockWaitFlag := fs.Duration("lock-wait", 0, lockWaitUsage)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(newUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	slug := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(*nameFlag)), pocNamePrefix)
+	if slug == "" {
+		slog.Error("-name is required")
+		return exitUsage
+	}
+	if !pocSlugPattern.MatchString(slug) {
+		slog.Error("invalid -name: use lowercase letters, digits and dashes, e.g. thinkphp5-rce", "name", *nameFlag)
+		return exitUsage
+	}
+	cve := strings.ToUpper(strings.TrimSpace(*cveFlag))
+	if cve != "" && !cvePattern.MatchString(cve) {
+		slog.Error("invalid -cve (want CVE-YYYY-NNNN)", "cve", *cveFlag)
+		return exitUsage
+	}
+	if !strings.HasPrefix(*pathFlag, "/") {
+		slog.Error("-path must start with /", "path", *pathFlag)
+		return exitUsage
+	}
+	out := *outFlag
+	if out == "" {
+		out = filepath.Join(opts.Root, slug+".yml")
+	}
+	raw, err := renderScaffold(pocNamePrefix+slug, cve, strings.ToUpper(*methodFlag), *pathFlag, *authorFlag)
+	if err != nil {
+		slog.Error("rendering PoC", "err", err)
+		return exitError
+	}
+
+	unlock, err := lockRoot(opts, *lockWaitFlag)
+	if err != nil {
+		slog.Error("cannot lock -dir", "err", err)
+		return exitError
+	}
+	defer unlock()
+	corpus, err := collectCorpus(context.Background(), opts, nil)
+	if err != nil {
+		slog.Error("collecting PoCs", "err", err)
+		return exitError
+	}
+	clashes, err := scaffoldClashes(raw, out, corpus, opts)
+	if err != nil {
+		slog.Error("checking the new PoC", "err", err)
+		return exitError
+	}
+	refuse := len(clashes) > 0 && (!*forceFlag || clashes[0].reason == "same name")
+	for _, c := range clashes {
+		if refuse {
+			slog.Error("new PoC clashes with the corpus", "reason", c.reason, "file", c.file)
+		} else {
+			slog.Warn("new PoC duplicates an existing one", "reason", c.reason, "file", c.file)
+		}
+	}
+	if refuse {
+		return exitDuplicates
+	}
+
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		slog.Error("writing PoC", "err", err)
+		return exitError
+	}
+	file, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		slog.Error("refusing to overwrite an existing file", "file", out)
+		return exitError
+	}
+	if err == nil {
+		_, err = file.Write(raw)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		slog.Error("writing PoC", "err", err)
+		return exitError
+	}
+	fmt.Println(out)
+	return exitOK
+}
+
+// renderScaffold builds the skeleton and runs it through formatPoC so a new
+// PoC already passes fmt -l.
+func renderScaffold(name, cve, method, path, author string) ([]byte, error) {
+	rule := scaffoldRule{Expression: `response.status == 200 && response.body.bcontains(b"TODO")`}
+	rule.Request.Cache = true
+	rule.Request.Method = method
+	rule.Request.Path = path
+	poc := scaffoldPoC{
+		Name:       name,
+		Manual:     true,
+		Transport:  transportHTTP,
+		Rules:      map[string]scaffoldRule{"r0": rule},
+		Expression: "r0()",
+		Detail:     scaffoldDetail{Author: author, Links: []string{}},
+	}
+	if cve != "" {
+		poc.Detail.Links = append(poc.Detail.Links, "https://nvd.nist.gov/vuln/detail/"+cve)
+	}
+	raw, err := yaml.Marshal(poc)
+	if err != nil {
+		return nil, err
+	}
+	return formatPoC(raw, pocLayout{indent: strings.Repeat(" ", formatIndent)})
+}
+
+type scaffoldClash struct {
+	reason string
+	file   string
+}
+
+// scaffoldClashes lists the PoCs of the corpus the new one would collide
+// with: a PoC of the same name first, since xray refuses to load both, then
+// the PoCs it would be grouped with as a duplicate under the current
+// -strategy.
+func scaffoldClashes(raw []byte, out string, corpus *pocCorpus, opts scanOptions) ([]scaffoldClash, error) {
+	docs, err := splitDocuments(raw)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := loadDocument(out, 0, &docs[0], opts)
+	if err != nil {
+		return nil, err
+	}
+	var clashes []scaffoldClash
+	for _, unit := range corpus.units {
+		if unit.HasName && unit.Name == entries[0].Name {
+			clashes = append(clashes, scaffoldClash{reason: "same name", file: unit.unit()})
+		}
+	}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		for _, other := range corpus.groups[groupKey(entry, opts)] {
+			if !other.Exempt && !seen[other.unit()] {
+				seen[other.unit()] = true
+				clashes = append(clashes, scaffoldClash{reason: "duplicate " + opts.Strategy + " key " + entry.Key, file: other.unit()})
+			}
+		}
+	}
+	return clashes, nil
+}
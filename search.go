@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const searchUsage = `
+Usage:
+  go run . search -dir <path-to-pocs> [-field <path>]... [-l] [-format text|json] <regexp>
+  go run . search -dir <path-to-pocs> [-l] [-format text|json] <structural-query>
+
+Searches the values of every PoC (names, request paths, headers, bodies,
+expressions, ...) for a regular expression and prints the matches as
+file:line: field: text. Values are read from the corpus index (see
+check-new -h), so the search matches parsed values rather than raw YAML:
+quoting, block scalars and JSON escapes make no difference. Use (?i) for a
+case-insensitive search.
+
+-field limits the search to values under a dotted path, with * matching any
+key or sequence item, e.g. -field 'rules.*.request.headers.*' or -field
+expression.
+
+A structural query selects whole PoCs by conditions on their values:
+
+  rules.*.request.method == "PUT" && rules.*.request.path contains "jmx"
+
+Conditions compare a dotted path with ==, !=, contains, startswith, endswith
+or matches (a regexp), and combine with &&, || and !, grouped by parentheses;
+a path alone tests that it exists. A condition holds when any value the path
+resolves to satisfies it. Paths sharing the part before their first * refer
+to the same item, so the query above finds one rule that is both a PUT and
+requests a jmx path. The values each match satisfied the query with are
+printed. An argument that does not parse as a structural query is searched
+as a regular expression; -regexp forces that.
+
+Flags:
+`
+
+// indexedField is one scalar value of a PoC with its dotted path, e.g.
+// rules.r0.request.path, and the line its text starts on in the file.
+type indexedField struct {
+	Path  string `json:"path"`
+	Line  int    `json:"line"`
+	Value string `json:"value"`
+}
+
+type searchMatch struct {
+	File  string `json:"file"`
+	Line  int    `json:"line"`
+	Field string `json:"field"`
+	Text  string `json:"text"`
+}
+
+// indexFields lists the scalar values under node. Map keys are part of the
+// path, not values. lineOffset shifts the lines of a later document of a
+// multi-document file to file lines.
+func indexFields(node *yaml.Node, prefix string, lineOffset int, out []indexedField) []indexedField {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			out = indexFields(child, prefix, lineOffset, out)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			out = indexFields(node.Content[i+1], joinFieldPath(prefix, node.Content[i].Value), lineOffset, out)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			out = indexFields(child, joinFieldPath(prefix, strconv.Itoa(i)), lineOffset, out)
+		}
+	case yaml.ScalarNode:
+		if node.Value != "" {
+			line := node.Line + lineOffset
+			if node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+				// Block scalars start on the line after their key.
+				line++
+			}
+			out = append(out, indexedField{Path: prefix, Line: line, Value: node.Value})
+		}
+	}
+	return out
+}
+
+func joinFieldPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// matchFieldPath matches a dotted path against a -field pattern segment by
+// segment. A pattern also matches every path below it.
+func matchFieldPath(pattern []string, path string) bool {
+	segments := strings.Split(path, ".")
+	if len(segments) < len(pattern) {
+		return false
+	}
+	for i, p := range pattern {
+		if p != "*" && p != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// searchFields returns the lines of the matching values. A value spanning
+// several lines, such as a block scalar body, reports the line of each
+// match.
+func searchFields(fields []indexedField, re *regexp.Regexp, patterns [][]string) []searchMatch {
+	var matches []searchMatch
+	for _, f := range fields {
+		if len(patterns) > 0 {
+			ok := false
+			for _, p := range patterns {
+				ok = ok || matchFieldPath(p, f.Path)
+			}
+			if !ok {
+				continue
+			}
+		}
+		if !re.MatchString(f.Value) {
+			continue
+		}
+		lines := strings.Split(strings.TrimSuffix(f.Value, "\n"), "\n")
+		if len(lines) == 1 {
+			matches = append(matches, searchMatch{Line: f.Line, Field: f.Path, Text: f.Value})
+			continue
+		}
+		for i, line := range lines {
+			if re.MatchString(line) {
+				matches = append(matches, searchMatch{Line: f.Line + i, Field: f.Path, Text: line})
+			}
+		}
+	}
+	return matches
+}
+
+// structuralMatches reports the values a matching PoC satisfied the query
+// with, in line order, or its name when the query only excluded values.
+func structuralMatches(s *structSearch, doc indexedDoc) []searchMatch {
+	hits, ok := s.match(doc.Fields)
+	if !ok {
+		return nil
+	}
+	if len(hits) == 0 {
+		for _, f := range doc.Fields {
+			if f.Path == "name" {
+				hits = append(hits, f)
+			}
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Line < hits[j].Line })
+	var matches []searchMatch
+	for i, f := range hits {
+		if i > 0 && f == hits[i-1] {
+			continue
+		}
+		text, _, _ := strings.Cut(f.Value, "\n")
+		matches = append(matches, searchMatch{Line: f.Line, Field: f.Path, Text: text})
+	}
+	if len(matches) == 0 {
+		matches = append(matches, searchMatch{Line: 1, Field: "name", Text: doc.Name})
+	}
+	return matches
+}
+
+func runSearch(args []string) int {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	var fieldFlags stringList
+	fs.Var(&fieldFlags, "field", "Only search values under this dotted path, * matching any key (repeatable)")
+	listFlag := fs.Bool("l", false, "Only print the names of files with matches")
+	regexpFlag := fs.Bool("regexp", false, "Treat the argument as a regular expression even when it parses as a structural query")
+	indexFlag := fs.String("index", "", "Corpus index file (default: under the user cache directory, one per -dir)")
+	formatFlag := fs.String("format", formatText, "Output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(searchUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	format := strings.ToLower(strings.TrimSpace(*formatFlag))
+	if format != formatText && format != formatJSON {
+		slog.Error("unsupported format (want text or json)", "format", *formatFlag)
+		return exitError
+	}
+	if fs.NArg() != 1 {
+		slog.Error("pass exactly one regular expression or structural query")
+		return exitUsage
+	}
+	var structural *structSearch
+	var re *regexp.Regexp
+	if !*regexpFlag {
+		structural, err = parseStructQuery(fs.Arg(0))
+		if err != nil && strings.ContainsAny(fs.Arg(0), "=&|") {
+			slog.Warn("not a structural query, searching as a regular expression", "err", err)
+		}
+	}
+	if structural == nil {
+		if re, err = regexp.Compile(fs.Arg(0)); err != nil {
+			slog.Error("invalid regular expression", "err", err)
+			return exitUsage
+		}
+	} else if len(fieldFlags) > 0 {
+		slog.Error("-field only applies to regular expression searches")
+		return exitUsage
+	}
+	var patterns [][]string
+	for _, field := range fieldFlags {
+		patterns = append(patterns, strings.Split(field, "."))
+	}
+	indexPath := *indexFlag
+	if indexPath == "" {
+		indexPath = defaultIndexPath(opts.Root)
+	}
+	idx, err := openIndex(indexPath, opts)
+	if err != nil {
+		slog.Error("indexing PoCs", "err", err)
+		return exitError
+	}
+
+	matches := []searchMatch{}
+	for _, rel := range idx.sortedFiles() {
+		file := filepath.Join(opts.Root, filepath.FromSlash(rel))
+		for _, doc := range idx.Files[rel].Docs {
+			var found []searchMatch
+			if structural != nil {
+				found = structuralMatches(structural, doc)
+			} else {
+				found = searchFields(doc.Fields, re, patterns)
+			}
+			for _, m := range found {
+				m.File = file
+				matches = append(matches, m)
+			}
+		}
+	}
+
+	switch {
+	case format == formatJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(matches); err != nil {
+			slog.Error("writing report", "err", err)
+			return exitError
+		}
+	case *listFlag:
+		for i, m := range matches {
+			if i == 0 || m.File != matches[i-1].File {
+				fmt.Println(m.File)
+			}
+		}
+	default:
+		for _, m := range matches {
+			fmt.Printf("%s:%d: %s: %s\n", m.File, m.Line, m.Field, m.Text)
+		}
+	}
+	return exitOK
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//go:embed dedupe.proto
+var dedupeProto string
+
+const serveUsage = `
+Usage:
+  go run . serve -dir <path-to-pocs> -tls-cert <file> -tls-key <file> [-tls-client-ca <file>] [-token-file <file>]
+                 [-listen <addr>] [-pre-delete-hook <cmd>] [-backup <dir>] [-lock-wait <duration>]
+  go run . serve -proto > dedupe.proto
+
+Serves the scanner over gRPC, so that other tools can drive deduplication
+with typed messages instead of parsing reports: Scan summarizes the corpus
+and returns the plan of its deletions, ListDuplicates returns the duplicate
+groups and ApplyPlan carries out a plan as apply does. -proto prints the
+service definition to generate clients from. Every request scans -dir under
+the flags and config file the server was started with; plans for another
+directory are refused, and so are actions a fresh scan would not take.
+ApplyPlan only deletes with the confirm token of a dry run, like -delete.
+gRPC needs HTTP/2, which the server speaks over TLS. Clients authenticate
+with a certificate signed by -tls-client-ca or the bearer token in
+-token-file; at least one is required.
+
+Flags:
+`
+
+const dedupeService = "/repeaterxraypoc.v1.Dedupe/"
+
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	listenFlag := fs.String("listen", "127.0.0.1:50051", "Address to serve gRPC on")
+	certFlag := fs.String("tls-cert", "", "TLS certificate file (PEM)")
+	keyFlag := fs.String("tls-key", "", "TLS private key file (PEM)")
+	clientCAFlag := fs.String("tls-client-ca", "", "CA certificates (PEM) that client certificates must be signed by")
+	tokenFileFlag := fs.String("token-file", "", "File holding the token clients must send as \"authorization: Bearer <token>\"")
+	preDeleteHookFlag := fs.String("pre-delete-hook", "", "Command run with the files to delete on stdin before ApplyPlan deletes; a failure aborts")
+	backupFlag := fs.String("backup", "", "Directory to write a timestamped tar.gz of the files ApplyPlan deletes or edits, with the plan as manifest, before applying it")
+	lockWaitFlag := fs.Duration("lock-wait", 0, lockWaitUsage)
+	protoFlag := fs.Bool("proto", false, "Print the gRPC service definition and exit")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(serveUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *protoFlag {
+		fmt.Print(dedupeProto)
+		return exitOK
+	}
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	if *certFlag == "" || *keyFlag == "" {
+		slog.Error("serve needs -tls-cert and -tls-key: gRPC runs over HTTP/2, which is served over TLS")
+		return exitUsage
+	}
+	if *clientCAFlag == "" && *tokenFileFlag == "" {
+		slog.Error("serve needs -tls-client-ca or -token-file: ApplyPlan deletes files, so clients must authenticate")
+		return exitUsage
+	}
+	svc := &dedupeServer{opts: opts, lockWait: *lockWaitFlag, preDeleteHook: *preDeleteHookFlag, backup: *backupFlag}
+	if *tokenFileFlag != "" {
+		raw, err := os.ReadFile(*tokenFileFlag)
+		if err != nil {
+			slog.Error("reading -token-file", "err", err)
+			return exitError
+		}
+		if svc.token = strings.TrimSpace(string(raw)); svc.token == "" {
+			slog.Error("-token-file is empty", "file", *tokenFileFlag)
+			return exitError
+		}
+	}
+	handler := grpcHandler{
+		dedupeService + "Scan":           svc.authorized(svc.scan),
+		dedupeService + "ListDuplicates": svc.authorized(svc.listDuplicates),
+		dedupeService + "ApplyPlan":      svc.authorized(svc.applyPlan),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{Addr: *listenFlag, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	if *clientCAFlag != "" {
+		raw, err := os.ReadFile(*clientCAFlag)
+		if err != nil {
+			slog.Error("reading -tls-client-ca", "err", err)
+			return exitError
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			slog.Error("no certificates in -tls-client-ca", "file", *clientCAFlag)
+			return exitError
+		}
+		server.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServeTLS(*certFlag, *keyFlag)
+	}()
+	slog.Info("gRPC server started", "listen", *listenFlag, "dir", opts.Root)
+	select {
+	case err := <-serveErr:
+		slog.Error("serving gRPC", "err", err)
+		return exitError
+	case <-ctx.Done():
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdown); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("stopping gRPC server", "err", err)
+		}
+		slog.Info("gRPC server stopped")
+		return exitOK
+	}
+}
+
+// dedupeServer implements the Dedupe service of dedupe.proto.
+type dedupeServer struct {
+	opts          scanOptions
+	lockWait      time.Duration
+	token         string
+	preDeleteHook string
+	backup        string
+}
+
+// authorized wraps a method so that it needs the bearer token, when the
+// server has one. Client certificates are checked by the TLS handshake.
+func (s *dedupeServer) authorized(method grpcMethod) grpcMethod {
+	return func(r *http.Request, req []byte) ([]byte, error) {
+		if s.token != "" {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+				return nil, grpcErrorf(grpcUnauthenticated, "missing or wrong bearer token")
+			}
+		}
+		return method(r, req)
+	}
+}
+
+// minConfidence reads the min_confidence field, number 1 of ScanRequest
+// and ListDuplicatesRequest.
+func minConfidence(req []byte) (float64, error) {
+	var min float64
+	err := readProto(req, func(f protoField) error {
+		if f.num == 1 {
+			min = f.double()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, grpcErrorf(grpcInvalidArgument, "%v", err)
+	}
+	if min < 0 || min > 1 {
+		return 0, grpcErrorf(grpcInvalidArgument, "min_confidence %g is not between 0 and 1", min)
+	}
+	return min, nil
+}
+
+// collect scans the corpus for one request.
+func (s *dedupeServer) collect(ctx context.Context) (*pocCorpus, []duplicateGroup, error) {
+	corpus, err := collectCorpus(ctx, s.opts, nil)
+	if err != nil {
+		return nil, nil, grpcErrorf(grpcAborted, "scanning %s: %v", s.opts.Root, err)
+	}
+	sortGroups(corpus.groups, s.opts)
+	return corpus, findDuplicates(corpus.groups, s.opts), nil
+}
+
+func (s *dedupeServer) scan(r *http.Request, req []byte) ([]byte, error) {
+	min, err := minConfidence(req)
+	if err != nil {
+		return nil, err
+	}
+	corpus, duplicates, err := s.collect(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	report := buildReport(s.opts, corpus.units, corpus.skipped, duplicates)
+	stats := computeStats(s.opts, corpus, 0)
+	var w protoWriter
+	w.int64(1, int64(report.Files))
+	w.int64(2, int64(stats.PoCs))
+	w.int64(3, int64(len(corpus.skipped)))
+	w.int64(4, int64(len(duplicates)))
+	w.int64(5, int64(stats.DuplicateFiles))
+	w.int64(6, report.Reclaimable)
+	w.int64(7, int64(len(findNameCollisions(corpus.units, s.opts))))
+	if removals, _ := confidentGroups(duplicates, min); len(removals) > 0 {
+		plan, err := newPlan(s.opts, removals)
+		if err != nil {
+			return nil, grpcErrorf(grpcAborted, "planning deletions: %v", err)
+		}
+		w.message(8, planMessage(plan))
+	}
+	slog.Info("gRPC scan", "pocs", stats.PoCs, "duplicate_groups", len(duplicates))
+	return w.buf, nil
+}
+
+func (s *dedupeServer) listDuplicates(r *http.Request, req []byte) ([]byte, error) {
+	min, err := minConfidence(req)
+	if err != nil {
+		return nil, err
+	}
+	_, duplicates, err := s.collect(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	groups, _ := confidentGroups(duplicates, min)
+	var w protoWriter
+	for _, group := range groups {
+		var g protoWriter
+		g.string(1, group.Key)
+		g.double(2, group.Confidence)
+		g.string(3, group.Basis)
+		for _, entry := range group.Entries {
+			var p protoWriter
+			p.string(1, entry.Name)
+			p.string(2, relativeTo(s.opts.Root, entry.FilePath))
+			p.int64(3, int64(entry.Doc))
+			p.string(4, entry.Path)
+			p.int64(5, entry.ModTime.Unix())
+			p.int64(6, entry.Size)
+			g.message(4, p.buf)
+		}
+		g.int64(5, reclaimableBytes(group.Entries, nil))
+		w.message(1, g.buf)
+	}
+	return w.buf, nil
+}
+
+func (s *dedupeServer) applyPlan(r *http.Request, req []byte) ([]byte, error) {
+	var raw []byte
+	var dryRun bool
+	var confirm string
+	err := readProto(req, func(f protoField) error {
+		switch f.num {
+		case 1:
+			raw = f.data
+		case 2:
+			dryRun = f.value != 0
+		case 3:
+			confirm = string(f.data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "%v", err)
+	}
+	plan, err := readPlanMessage(raw)
+	if err == nil {
+		err = plan.check("plan")
+	}
+	if err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "%v", err)
+	}
+	root, err := filepath.Abs(s.opts.Root)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Root != root {
+		return nil, grpcErrorf(grpcPermissionDenied, "the plan is for %s, not %s", plan.Root, root)
+	}
+	unlock, err := lockRoot(s.opts, s.lockWait)
+	if err != nil {
+		return nil, grpcErrorf(grpcFailedPrecondition, "cannot lock -dir: %v", err)
+	}
+	defer unlock()
+
+	var w protoWriter
+	if changed := plan.changedFiles(); len(changed) > 0 {
+		w.int64(2, int64(len(plan.Actions)))
+		for _, file := range changed {
+			w.string(3, file)
+		}
+		slog.Warn("refusing to apply a stale plan", "changed", len(changed))
+		return w.buf, nil
+	}
+	// The plan comes from the client: only apply what -delete would do now.
+	_, duplicates, err := s.collect(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	fresh, err := newPlan(s.opts, duplicates)
+	if err != nil {
+		return nil, grpcErrorf(grpcAborted, "planning deletions: %v", err)
+	}
+	if unplanned := plan.unplanned(fresh); len(unplanned) > 0 {
+		slog.Warn("refusing a plan that removes what a scan keeps", "files", unplanned)
+		return nil, grpcErrorf(grpcPermissionDenied, "a scan of %s does not remove %s", root, strings.Join(unplanned, ", "))
+	}
+	token := plan.confirmToken()
+	w.int64(2, int64(len(plan.Actions)))
+	if dryRun {
+		w.string(4, token)
+		return w.buf, nil
+	}
+	if confirm != token {
+		return nil, grpcErrorf(grpcFailedPrecondition, "confirm %q does not match the plan; call ApplyPlan with dry_run to review it and get the token", confirm)
+	}
+	if s.preDeleteHook != "" {
+		if err := runFileHook(s.preDeleteHook, hookPreDelete, plan.units(), plan.Root, ""); err != nil {
+			return nil, grpcErrorf(grpcAborted, "apply aborted: %v", err)
+		}
+	}
+	if s.backup != "" {
+		archive, err := writeBackup(s.backup, plan)
+		if err != nil {
+			return nil, grpcErrorf(grpcInternal, "apply aborted: writing backup: %v", err)
+		}
+		slog.Info("backup written", "archive", archive, "files", len(plan.Actions))
+	}
+	if err := plan.apply(); err != nil {
+		return nil, grpcErrorf(grpcInternal, "applying plan: %v", err)
+	}
+	slog.Info("plan applied over gRPC", "actions", len(plan.Actions), "root", plan.Root)
+	w.bool(1, true)
+	return w.buf, nil
+}
+
+// planMessage encodes a plan as the Plan message of dedupe.proto.
+func planMessage(p *dedupePlan) []byte {
+	var w protoWriter
+	w.int64(1, int64(p.Version))
+	w.string(2, p.ToolVersion)
+	w.int64(3, p.Created.Unix())
+	w.string(4, p.Root)
+	w.string(5, p.Strategy)
+	for _, a := range p.Actions {
+		var m protoWriter
+		m.string(1, a.Action)
+		m.string(2, a.File)
+		m.packed(3, a.Docs)
+		for _, kept := range a.DuplicateOf {
+			m.string(4, kept)
+		}
+		w.message(6, m.buf)
+	}
+	files := make([]string, 0, len(p.Files))
+	for file := range p.Files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		var entry protoWriter
+		entry.string(1, file)
+		entry.string(2, p.Files[file])
+		w.message(7, entry.buf)
+	}
+	return w.buf
+}
+
+// readPlanMessage decodes a Plan message. The plan still needs checking.
+func readPlanMessage(raw []byte) (*dedupePlan, error) {
+	p := &dedupePlan{Files: map[string]string{}}
+	err := readProto(raw, func(f protoField) error {
+		switch f.num {
+		case 1:
+			p.Version = int(f.value)
+		case 2:
+			p.ToolVersion = string(f.data)
+		case 3:
+			p.Created = time.Unix(int64(f.value), 0).UTC()
+		case 4:
+			p.Root = string(f.data)
+		case 5:
+			p.Strategy = string(f.data)
+		case 6:
+			var a planAction
+			err := readProto(f.data, func(f protoField) error {
+				switch f.num {
+				case 1:
+					a.Action = string(f.data)
+				case 2:
+					a.File = string(f.data)
+				case 3:
+					docs, err := f.varints()
+					for _, doc := range docs {
+						a.Docs = append(a.Docs, int(int32(doc)))
+					}
+					return err
+				case 4:
+					a.DuplicateOf = append(a.DuplicateOf, string(f.data))
+				}
+				return nil
+			})
+			p.Actions = append(p.Actions, a)
+			return err
+		case 7:
+			var file, sum string
+			err := readProto(f.data, func(f protoField) error {
+				switch f.num {
+				case 1:
+					file = string(f.data)
+				case 2:
+					sum = string(f.data)
+				}
+				return nil
+			})
+			p.Files[file] = sum
+			return err
+		}
+		return nil
+	})
+	return p, err
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+)
+
+// SFTP version 3 (draft-ietf-secsh-filexfer-02), the version OpenSSH's
+// internal-sftp speaks. Only what mirroring a directory needs is
+// implemented: listing directories, stat and reading files.
+const (
+	sftpVersion = 3
+
+	sftpInit     = 1
+	sftpVersionR = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpRead     = 5
+	sftpOpenDir  = 11
+	sftpReadDir  = 12
+	sftpStat     = 17
+	sftpStatus   = 101
+	sftpHandle   = 102
+	sftpData     = 103
+	sftpName     = 104
+	sftpAttrs    = 105
+
+	sftpStatusOK         = 0
+	sftpStatusEOF        = 1
+	sftpStatusNoSuchFile = 2
+
+	sftpOpenRead = 1
+
+	sftpAttrSize        = 0x1
+	sftpAttrUIDGID      = 0x2
+	sftpAttrPermissions = 0x4
+	sftpAttrACModTime   = 0x8
+	sftpAttrExtended    = 0x80000000
+
+	sftpModeType = 0o170000
+	sftpModeDir  = 0o040000
+	sftpModeReg  = 0o100000
+
+	// sftpReadSize is what servers return at most for one read.
+	sftpReadSize = 32 << 10
+	// sftpMaxPacket bounds the packets accepted from the server.
+	sftpMaxPacket = 1 << 20
+)
+
+type sftpFileAttrs struct {
+	size  int64
+	mode  uint32 // 0 when the server did not send permissions
+	mtime int64
+}
+
+type sftpEntry struct {
+	name  string
+	attrs sftpFileAttrs
+}
+
+// sftpClient talks to the sftp subsystem of a host through the system ssh
+// client, one request at a time.
+type sftpClient struct {
+	cmd *exec.Cmd
+	w   io.WriteCloser
+	r   *bufio.Reader
+	id  uint32
+}
+
+func dialSFTP(ctx context.Context, sshArgs []string) (*sftpClient, error) {
+	cmd := exec.CommandContext(ctx, "ssh", sshArgs...)
+	cmd.Stderr = os.Stderr
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	r, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	c := &sftpClient{cmd: cmd, w: w, r: bufio.NewReader(r)}
+	if err := c.init(); err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *sftpClient) init() error {
+	msg := binary.BigEndian.AppendUint32(nil, 5)
+	msg = append(msg, sftpInit)
+	msg = binary.BigEndian.AppendUint32(msg, sftpVersion)
+	if _, err := c.w.Write(msg); err != nil {
+		return fmt.Errorf("sftp: %w", err)
+	}
+	typ, body, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if typ != sftpVersionR {
+		return fmt.Errorf("sftp: unexpected packet %d instead of version", typ)
+	}
+	b := sftpBuffer{b: body}
+	if v := b.uint32(); b.err != nil || v < sftpVersion {
+		return fmt.Errorf("sftp: server speaks version %d, want %d", v, sftpVersion)
+	}
+	return nil
+}
+
+func (c *sftpClient) close() error {
+	c.w.Close()
+	return c.cmd.Wait()
+}
+
+func (c *sftpClient) readPacket() (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return 0, nil, fmt.Errorf("sftp: %w (is the sftp subsystem enabled?)", err)
+	}
+	n := binary.BigEndian.Uint32(hdr[:4])
+	if n < 1 || n > sftpMaxPacket {
+		return 0, nil, fmt.Errorf("sftp: bad packet length %d", n)
+	}
+	body := make([]byte, n-1)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, fmt.Errorf("sftp: %w", err)
+	}
+	return hdr[4], body, nil
+}
+
+// call sends a request and returns the type and payload, after the id, of
+// the response. A status response other than OK is returned as an error.
+func (c *sftpClient) call(typ byte, payload []byte) (byte, *sftpBuffer, error) {
+	c.id++
+	msg := binary.BigEndian.AppendUint32(nil, uint32(5+len(payload)))
+	msg = append(msg, typ)
+	msg = binary.BigEndian.AppendUint32(msg, c.id)
+	msg = append(msg, payload...)
+	if _, err := c.w.Write(msg); err != nil {
+		return 0, nil, fmt.Errorf("sftp: %w", err)
+	}
+	rtyp, body, err := c.readPacket()
+	if err != nil {
+		return 0, nil, err
+	}
+	b := &sftpBuffer{b: body}
+	if id := b.uint32(); b.err != nil || id != c.id {
+		return 0, nil, fmt.Errorf("sftp: response to request %d, want %d", id, c.id)
+	}
+	if rtyp == sftpStatus {
+		code, msg := b.uint32(), b.string()
+		switch {
+		case b.err != nil:
+			return 0, nil, b.err
+		case code == sftpStatusOK:
+		case code == sftpStatusEOF:
+			return 0, nil, io.EOF
+		case code == sftpStatusNoSuchFile:
+			return 0, nil, fmt.Errorf("sftp: %s: %w", msg, fs.ErrNotExist)
+		default:
+			return 0, nil, fmt.Errorf("sftp: %s (status %d)", msg, code)
+		}
+	}
+	return rtyp, b, nil
+}
+
+// callFor is call for requests answered with a packet of type want.
+func (c *sftpClient) callFor(typ byte, payload []byte, want byte) (*sftpBuffer, error) {
+	rtyp, b, err := c.call(typ, payload)
+	if err != nil {
+		return nil, err
+	}
+	if rtyp != want {
+		return nil, fmt.Errorf("sftp: unexpected packet %d in response to %d", rtyp, typ)
+	}
+	return b, nil
+}
+
+func (c *sftpClient) stat(name string) (sftpFileAttrs, error) {
+	b, err := c.callFor(sftpStat, sftpString(nil, name), sftpAttrs)
+	if err != nil {
+		return sftpFileAttrs{}, fmt.Errorf("stat %s: %w", name, err)
+	}
+	attrs := b.attrs()
+	return attrs, b.err
+}
+
+func (c *sftpClient) closeHandle(handle string) error {
+	_, err := c.callFor(sftpClose, sftpString(nil, handle), sftpStatus)
+	return err
+}
+
+// readDir lists a directory, including . and .. when the server sends them.
+func (c *sftpClient) readDir(dir string) ([]sftpEntry, error) {
+	b, err := c.callFor(sftpOpenDir, sftpString(nil, dir), sftpHandle)
+	if err != nil {
+		return nil, fmt.Errorf("opendir %s: %w", dir, err)
+	}
+	handle := b.string()
+	if b.err != nil {
+		return nil, b.err
+	}
+	var entries []sftpEntry
+	for {
+		b, err := c.callFor(sftpReadDir, sftpString(nil, handle), sftpName)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			c.closeHandle(handle)
+			return nil, fmt.Errorf("readdir %s: %w", dir, err)
+		}
+		for n := b.uint32(); n > 0 && b.err == nil; n-- {
+			name := b.string()
+			b.string() // longname
+			entries = append(entries, sftpEntry{name: name, attrs: b.attrs()})
+		}
+		if b.err != nil {
+			c.closeHandle(handle)
+			return nil, b.err
+		}
+	}
+	return entries, c.closeHandle(handle)
+}
+
+// open opens a file for reading.
+func (c *sftpClient) open(name string) (*sftpFile, error) {
+	payload := sftpString(nil, name)
+	payload = binary.BigEndian.AppendUint32(payload, sftpOpenRead)
+	payload = binary.BigEndian.AppendUint32(payload, 0) // no attributes
+	b, err := c.callFor(sftpOpen, payload, sftpHandle)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", name, err)
+	}
+	handle := b.string()
+	return &sftpFile{c: c, handle: handle}, b.err
+}
+
+// sftpFile reads a remote file sequentially.
+type sftpFile struct {
+	c      *sftpClient
+	handle string
+	offset uint64
+}
+
+func (f *sftpFile) Read(p []byte) (int, error) {
+	payload := sftpString(nil, f.handle)
+	payload = binary.BigEndian.AppendUint64(payload, f.offset)
+	payload = binary.BigEndian.AppendUint32(payload, uint32(min(len(p), sftpReadSize)))
+	b, err := f.c.callFor(sftpRead, payload, sftpData)
+	if err != nil {
+		return 0, err
+	}
+	data := b.bytes()
+	if b.err != nil {
+		return 0, b.err
+	}
+	n := copy(p, data)
+	f.offset += uint64(n)
+	return n, nil
+}
+
+func (f *sftpFile) Close() error {
+	return f.c.closeHandle(f.handle)
+}
+
+func sftpString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// sftpBuffer decodes a response payload. The first decoding error sticks.
+type sftpBuffer struct {
+	b   []byte
+	err error
+}
+
+func (b *sftpBuffer) take(n int) []byte {
+	if b.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(b.b) {
+		b.err = errors.New("sftp: short packet")
+		return nil
+	}
+	out := b.b[:n]
+	b.b = b.b[n:]
+	return out
+}
+
+func (b *sftpBuffer) uint32() uint32 {
+	if v := b.take(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+func (b *sftpBuffer) uint64() uint64 {
+	if v := b.take(8); v != nil {
+		return binary.BigEndian.Uint64(v)
+	}
+	return 0
+}
+
+func (b *sftpBuffer) bytes() []byte {
+	return b.take(int(b.uint32()))
+}
+
+func (b *sftpBuffer) string() string {
+	return string(b.bytes())
+}
+
+func (b *sftpBuffer) attrs() sftpFileAttrs {
+	var a sftpFileAttrs
+	flags := b.uint32()
+	if flags&sftpAttrSize != 0 {
+		a.size = int64(b.uint64())
+	}
+	if flags&sftpAttrUIDGID != 0 {
+		b.uint32()
+		b.uint32()
+	}
+	if flags&sftpAttrPermissions != 0 {
+		a.mode = b.uint32()
+	}
+	if flags&sftpAttrACModTime != 0 {
+		b.uint32() // atime
+		a.mtime = int64(b.uint32())
+	}
+	if flags&sftpAttrExtended != 0 {
+		for n := b.uint32(); n > 0 && b.err == nil; n-- {
+			b.string()
+			b.string()
+		}
+	}
+	return a
+}
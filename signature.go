@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const signatureExt = ".sig"
+
+const (
+	unverifiedSkip = "skip"
+	unverifiedWarn = "warn"
+)
+
+var (
+	errUnsigned     = errors.New("no signature")
+	errBadSignature = errors.New("invalid signature")
+)
+
+// signatureVerifier checks PoCs against ed25519 public keys. A PoC is signed
+// either by a detached <file>.sig next to it or by an entry in a signed
+// manifest (sha256sum format, signature in <manifest>.sig).
+type signatureVerifier struct {
+	keys     []ed25519.PublicKey
+	manifest map[string]string
+}
+
+func newSignatureVerifier(keysPath, manifestPath string) (*signatureVerifier, error) {
+	keys, err := loadPublicKeys(keysPath)
+	if err != nil {
+		return nil, err
+	}
+	v := &signatureVerifier{keys: keys}
+	if manifestPath != "" {
+		if v.manifest, err = v.loadManifest(manifestPath); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// loadPublicKeys reads PEM "PUBLIC KEY" blocks (as written by
+// `openssl pkey -pubout`) and lines holding a base64 raw 32-byte key.
+func loadPublicKeys(path string) ([]ed25519.PublicKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []ed25519.PublicKey
+	rest := raw
+	for {
+		block, next := pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		rest = next
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		key, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: %T keys are not supported (want ed25519)", path, parsed)
+		}
+		keys = append(keys, key)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(rest))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%s: %q is not a base64 ed25519 public key", path, line)
+		}
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no public keys", path)
+	}
+	return keys, nil
+}
+
+// loadManifest verifies the manifest signature and returns the expected
+// sha256 of each listed file, keyed by absolute path.
+func (v *signatureVerifier) loadManifest(path string) (map[string]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.check(path, raw); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", path, err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sum, file, ok := strings.Cut(line, " ")
+		file = strings.TrimPrefix(strings.TrimLeft(file, " "), "*")
+		if _, err := hex.DecodeString(sum); !ok || err != nil || len(sum) != sha256.Size*2 || file == "" {
+			return nil, fmt.Errorf("manifest %s line %d: want \"<sha256>  <file>\"", path, n)
+		}
+		sums[filepath.Join(dir, filepath.FromSlash(file))] = strings.ToLower(sum)
+	}
+	return sums, scanner.Err()
+}
+
+func (v *signatureVerifier) verify(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		if want, ok := v.manifest[abs]; ok {
+			got := sha256.Sum256(raw)
+			if hex.EncodeToString(got[:]) != want {
+				return fmt.Errorf("%w: content does not match the manifest", errBadSignature)
+			}
+			return nil
+		}
+	}
+	return v.check(path, raw)
+}
+
+// check verifies the detached signature of data stored in path+".sig",
+// either raw (openssl pkeyutl output) or base64.
+func (v *signatureVerifier) check(path string, data []byte) error {
+	sigRaw, err := os.ReadFile(path + signatureExt)
+	if errors.Is(err, os.ErrNotExist) {
+		return errUnsigned
+	}
+	if err != nil {
+		return err
+	}
+	sig := sigRaw
+	if len(sig) != ed25519.SignatureSize {
+		if sig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigRaw))); err != nil || len(sig) != ed25519.SignatureSize {
+			return fmt.Errorf("%w: malformed %s file", errBadSignature, signatureExt)
+		}
+	}
+	for _, key := range v.keys {
+		if ed25519.Verify(key, data, sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: no trusted key matches", errBadSignature)
+}
+
+const verifyUsage = `
+Usage:
+  go run . verify -dir <path-to-pocs> -keys <public-keys> [-manifest <file>] [-allow-unsigned] [-format text|json]
+
+Checks the ed25519 signature of every PoC: a detached <file>.sig next to it,
+or an entry of a signed manifest (sha256sum format, signed by <manifest>.sig).
+Exits with 4 when a signature is invalid or a PoC is unsigned.
+
+Flags:
+`
+
+type verifyResult struct {
+	File   string `json:"file"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	keysFlag := fs.String("keys", "", "File with trusted ed25519 public keys (PEM or base64, one per line)")
+	manifestFlag := fs.String("manifest", "", "Signed manifest of sha256 sums, verified with <manifest>.sig")
+	allowUnsignedFlag := fs.Bool("allow-unsigned", false, "Only fail on invalid signatures, not on unsigned PoCs")
+	formatFlag := fs.String("format", formatText, "Output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(verifyUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	if *keysFlag == "" {
+		slog.Error("-keys is required")
+		return exitUsage
+	}
+	format := strings.ToLower(strings.TrimSpace(*formatFlag))
+	if format != formatText && format != formatJSON {
+		slog.Error("unsupported format (want text or json)", "format", *formatFlag)
+		return exitError
+	}
+	verifier, err := newSignatureVerifier(*keysFlag, *manifestFlag)
+	if err != nil {
+		slog.Error("loading signature keys", "err", err)
+		return exitError
+	}
+
+	results := []verifyResult{}
+	failed := 0
+	err = walkPoCFiles(opts, func(path string) error {
+		r := verifyResult{File: path, Status: "ok"}
+		switch err := verifier.verify(path); {
+		case err == nil:
+		case errors.Is(err, errUnsigned):
+			r.Status = "unsigned"
+			if !*allowUnsignedFlag {
+				failed++
+			}
+		default:
+			r.Status, r.Error = "invalid", err.Error()
+			failed++
+		}
+		results = append(results, r)
+		return nil
+	})
+	if err != nil {
+		slog.Error("walking PoCs", "err", err)
+		return exitError
+	}
+
+	if format == formatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			slog.Error("writing report", "err", err)
+			return exitError
+		}
+	} else if !*sf.quiet {
+		counts := map[string]int{}
+		for _, r := range results {
+			counts[r.Status]++
+			if r.Status == "ok" {
+				continue
+			}
+			fmt.Printf("%-8s %s", strings.ToUpper(r.Status), r.File)
+			if r.Error != "" {
+				fmt.Printf(": %s", r.Error)
+			}
+			fmt.Println()
+		}
+		fmt.Printf("%d PoCs: %d verified, %d unsigned, %d invalid\n",
+			len(results), counts["ok"], counts["unsigned"], counts["invalid"])
+	}
+	if failed > 0 {
+		return exitInvalid
+	}
+	return exitOK
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+const statsUsage = `
+Usage:
+  go run . stats -dir <path-to-pocs> [-format text|json] [-top N]
+
+Prints corpus-wide metrics: PoCs per transport, severity and CVE year,
+duplicate rate, average rules per PoC and the most targeted paths.
+
+Flags:
+`
+
+type corpusStats struct {
+	ToolVersion     string         `json:"tool_version"`
+	Root            string         `json:"root"`
+	PoCs            int            `json:"pocs"`
+	Skipped         int            `json:"skipped"`
+	Transports      map[string]int `json:"transports"`
+	Severities      map[string]int `json:"severities"`
+	Years           map[string]int `json:"years"`
+	DuplicateGroups int            `json:"duplicate_groups"`
+	DuplicateFiles  int            `json:"duplicate_files"`
+	DuplicateRate   float64        `json:"duplicate_rate"`
+	AvgRules        float64        `json:"avg_rules"`
+	TopPaths        []pathCount    `json:"top_paths"`
+}
+
+type pathCount struct {
+	Path string `json:"path"`
+	PoCs int    `json:"pocs"`
+}
+
+const unknownBucket = "unknown"
+
+func runStats(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	formatFlag := fs.String("format", formatText, "Output format: text or json")
+	topFlag := fs.Int("top", 20, "Number of most targeted paths to list")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), strings.TrimPrefix(statsUsage, "\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := sf.setup()
+	if err != nil {
+		slog.Error("invalid options", "err", err)
+		return exitError
+	}
+	format := strings.ToLower(strings.TrimSpace(*formatFlag))
+	if format != formatText && format != formatJSON {
+		slog.Error("unsupported format (want text or json)", "format", *formatFlag)
+		return exitError
+	}
+
+	corpus, err := collectCorpus(context.Background(), opts, nil)
+	if err != nil {
+		slog.Error("collecting PoCs", "err", err)
+		return exitError
+	}
+	sortGroups(corpus.groups, opts)
+	stats := computeStats(opts, corpus, *topFlag)
+
+	if format == formatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(stats); err != nil {
+			slog.Error("writing stats", "err", err)
+			return exitError
+		}
+	} else if !*sf.quiet {
+		printStats(stats)
+	}
+	return exitOK
+}
+
+func computeStats(opts scanOptions, corpus *pocCorpus, top int) corpusStats {
+	stats := corpusStats{
+		ToolVersion: toolVersion(),
+		Root:        opts.Root,
+		Skipped:     len(corpus.skipped),
+		Transports:  map[string]int{},
+		Severities:  map[string]int{},
+		Years:       map[string]int{},
+		TopPaths:    []pathCount{},
+	}
+
+	pathFiles := map[string]map[string]bool{}
+	for _, list := range corpus.groups {
+		for _, entry := range list {
+			key := opts.Normalize.apply(entry.Path)
+			if pathFiles[key] == nil {
+				pathFiles[key] = map[string]bool{}
+			}
+			pathFiles[key][entry.unit()] = true
+		}
+	}
+
+	rules := 0
+	for _, entry := range corpus.units {
+		d := entry.Detail
+		stats.Transports[d.Transport]++
+		stats.Severities[bucket(d.Severity)]++
+		years := map[string]bool{}
+		for _, cve := range d.CVEs {
+			years[cve[len("CVE-"):len("CVE-YYYY")]] = true
+		}
+		if len(years) == 0 {
+			years[unknownBucket] = true
+		}
+		for year := range years {
+			stats.Years[year]++
+		}
+		rules += d.Rules
+	}
+	stats.PoCs = len(corpus.units)
+	if stats.PoCs > 0 {
+		stats.AvgRules = float64(rules) / float64(stats.PoCs)
+	}
+
+	duplicates := findDuplicates(corpus.groups, opts)
+	stats.DuplicateGroups = len(duplicates)
+	redundant := map[string]bool{}
+	for _, group := range duplicates {
+		for _, entry := range group.Entries[1:] {
+			redundant[entry.unit()] = true
+		}
+	}
+	stats.DuplicateFiles = len(redundant)
+	if stats.PoCs > 0 {
+		stats.DuplicateRate = float64(stats.DuplicateFiles) / float64(stats.PoCs)
+	}
+
+	for path, set := range pathFiles {
+		stats.TopPaths = append(stats.TopPaths, pathCount{Path: path, PoCs: len(set)})
+	}
+	sort.Slice(stats.TopPaths, func(i, j int) bool {
+		a, b := stats.TopPaths[i], stats.TopPaths[j]
+		if a.PoCs != b.PoCs {
+			return a.PoCs > b.PoCs
+		}
+		return a.Path < b.Path
+	})
+	if top >= 0 && len(stats.TopPaths) > top {
+		stats.TopPaths = stats.TopPaths[:top]
+	}
+	return stats
+}
+
+func bucket(value string) string {
+	if value == "" {
+		return unknownBucket
+	}
+	return value
+}
+
+func printStats(stats corpusStats) {
+	fmt.Printf("PoCs: %d (skipped %d)\n", stats.PoCs, stats.Skipped)
+	fmt.Printf("Duplicate groups: %d, redundant files: %d (%.1f%%)\n",
+		stats.DuplicateGroups, stats.DuplicateFiles, stats.DuplicateRate*100)
+	fmt.Printf("Average rules per PoC: %.2f\n", stats.AvgRules)
+	printCounts("Transport", stats.Transports)
+	printCounts("Severity", stats.Severities)
+	printCounts("CVE year", stats.Years)
+	if len(stats.TopPaths) > 0 {
+		fmt.Printf("\nTop %d targeted paths:\n", len(stats.TopPaths))
+		for _, p := range stats.TopPaths {
+			fmt.Printf("  %5d  %s\n", p.PoCs, p.Path)
+		}
+	}
+}
+
+func printCounts(title string, counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Printf("\n%s:\n", title)
+	for _, key := range keys {
+		fmt.Printf("  %-12s %d\n", key, counts[key])
+	}
+}
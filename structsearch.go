@@ -0,0 +1,360 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A structural search selects PoCs by conditions on their parsed values:
+//
+//	rules.*.request.method == "PUT" && rules.*.request.path contains "jmx"
+//
+// A selector is a dotted path in which * matches any key or sequence item.
+// Selectors sharing the part before their first * refer to the same item, so
+// the query above asks for one rule that is both a PUT and hits a jmx path.
+
+// structOperators are the comparison operators of a structural search.
+var structOperators = map[string]bool{
+	"==": true, "!=": true, "contains": true, "matches": true, "startswith": true, "endswith": true,
+}
+
+type structQuery interface {
+	eval(env *structEnv) bool
+}
+
+type structEnv struct {
+	fields  []indexedField
+	binding map[string]string
+	hits    []indexedField
+}
+
+type structAnd struct{ left, right structQuery }
+type structOr struct{ left, right structQuery }
+type structNot struct{ operand structQuery }
+
+// structCond compares the values a selector resolves to; it holds when any
+// of them satisfies the operator. Without an operator it holds when the
+// selector resolves to anything.
+type structCond struct {
+	selector []string
+	op       string
+	value    string
+	re       *regexp.Regexp
+}
+
+func (q structAnd) eval(env *structEnv) bool { return q.left.eval(env) && q.right.eval(env) }
+func (q structOr) eval(env *structEnv) bool  { return q.left.eval(env) || q.right.eval(env) }
+
+func (q structNot) eval(env *structEnv) bool {
+	hits := len(env.hits)
+	ok := !q.operand.eval(env)
+	// What the negated condition matched is not what the PoC matches on.
+	env.hits = env.hits[:hits]
+	return ok
+}
+
+func (q structCond) eval(env *structEnv) bool {
+	found := false
+	for _, f := range env.fields {
+		if !q.selects(f.Path, env.binding) || !q.compare(f.Value) {
+			continue
+		}
+		env.hits = append(env.hits, f)
+		found = true
+	}
+	return found
+}
+
+// bindingPrefix is the part of the selector before its first *, or "" when
+// it has none.
+func (q structCond) bindingPrefix() string {
+	for i, segment := range q.selector {
+		if segment == "*" {
+			return strings.Join(q.selector[:i], ".")
+		}
+	}
+	return ""
+}
+
+func (q structCond) selects(path string, binding map[string]string) bool {
+	segments := strings.Split(path, ".")
+	if q.op == "" {
+		if len(segments) < len(q.selector) {
+			return false
+		}
+	} else if len(segments) != len(q.selector) {
+		return false
+	}
+	bound := false
+	for i, s := range q.selector {
+		if s != "*" {
+			if s != segments[i] {
+				return false
+			}
+			continue
+		}
+		if !bound {
+			bound = true
+			if key, ok := binding[strings.Join(q.selector[:i], ".")]; ok && key != segments[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (q structCond) compare(value string) bool {
+	switch q.op {
+	case "":
+		return true
+	case "==":
+		return value == q.value
+	case "!=":
+		return value != q.value
+	case "contains":
+		return strings.Contains(value, q.value)
+	case "startswith":
+		return strings.HasPrefix(value, q.value)
+	case "endswith":
+		return strings.HasSuffix(value, q.value)
+	case "matches":
+		return q.re.MatchString(value)
+	}
+	return false
+}
+
+// structSearch is a parsed structural query with its binding prefixes.
+type structSearch struct {
+	query    structQuery
+	prefixes []string
+}
+
+// match evaluates the query against one PoC under every binding of the
+// prefixes and returns the values it matched on for the first binding that
+// satisfies it.
+func (s *structSearch) match(fields []indexedField) ([]indexedField, bool) {
+	keys := make([][]string, len(s.prefixes))
+	for i, prefix := range s.prefixes {
+		keys[i] = bindingKeys(fields, prefix)
+	}
+	binding := make(map[string]string, len(s.prefixes))
+	var try func(i int) ([]indexedField, bool)
+	try = func(i int) ([]indexedField, bool) {
+		if i == len(s.prefixes) {
+			env := &structEnv{fields: fields, binding: binding}
+			ok := s.query.eval(env)
+			return env.hits, ok
+		}
+		if len(keys[i]) == 0 {
+			return try(i + 1)
+		}
+		for _, key := range keys[i] {
+			binding[s.prefixes[i]] = key
+			if hits, ok := try(i + 1); ok {
+				return hits, true
+			}
+		}
+		delete(binding, s.prefixes[i])
+		return nil, false
+	}
+	return try(0)
+}
+
+// bindingKeys lists the keys or indexes found right below prefix.
+func bindingKeys(fields []indexedField, prefix string) []string {
+	var keys []string
+	for _, f := range fields {
+		rest, ok := strings.CutPrefix(f.Path, prefix+".")
+		if !ok {
+			continue
+		}
+		key, _, _ := strings.Cut(rest, ".")
+		keys = appendUnique(keys, key)
+	}
+	return keys
+}
+
+// parseStructQuery parses a structural query. It fails on anything that is
+// not one, in particular on a plain regular expression without operators.
+func parseStructQuery(input string) (*structSearch, error) {
+	tokens, err := tokenizeStructQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &structParser{tokens: tokens}
+	query, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if !p.compared {
+		return nil, errors.New("no comparison")
+	}
+	s := &structSearch{query: query}
+	for _, prefix := range p.prefixes {
+		if prefix != "" {
+			s.prefixes = appendUnique(s.prefixes, prefix)
+		}
+	}
+	sort.Strings(s.prefixes)
+	return s, nil
+}
+
+type structToken struct {
+	kind string // "op", "sym", "str" or "sel"
+	text string
+}
+
+func tokenizeStructQuery(input string) ([]structToken, error) {
+	var tokens []structToken
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(input[i:], "&&") || strings.HasPrefix(input[i:], "||") ||
+			strings.HasPrefix(input[i:], "==") || strings.HasPrefix(input[i:], "!="):
+			kind := "sym"
+			if input[i+1] == '=' {
+				kind = "op"
+			}
+			tokens = append(tokens, structToken{kind, input[i : i+2]})
+			i += 2
+		case c == '!' || c == '(' || c == ')':
+			tokens = append(tokens, structToken{"sym", string(c)})
+			i++
+		case c == '"' || c == '\'' || c == '`':
+			end := i + 1
+			for end < len(input) && input[end] != c {
+				if input[end] == '\\' && c != '`' {
+					end++
+				}
+				end++
+			}
+			if end >= len(input) {
+				return nil, errors.New("unterminated string")
+			}
+			raw := input[i : end+1]
+			if c == '\'' {
+				raw = `"` + strings.ReplaceAll(raw[1:len(raw)-1], `"`, `\"`) + `"`
+			}
+			value, err := strconv.Unquote(raw)
+			if err != nil {
+				return nil, fmt.Errorf("string %s: %w", input[i:end+1], err)
+			}
+			tokens = append(tokens, structToken{"str", value})
+			i = end + 1
+		default:
+			end := i
+			for end < len(input) && strings.IndexByte(" \t\r\n()!&|=\"'`", input[end]) < 0 {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("unexpected %q", input[i:])
+			}
+			word := input[i:end]
+			if structOperators[strings.ToLower(word)] {
+				tokens = append(tokens, structToken{"op", strings.ToLower(word)})
+			} else {
+				tokens = append(tokens, structToken{"sel", word})
+			}
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type structParser struct {
+	tokens   []structToken
+	pos      int
+	compared bool
+	prefixes []string
+}
+
+func (p *structParser) peek(kind, text string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == kind && p.tokens[p.pos].text == text
+}
+
+func (p *structParser) parseOr() (structQuery, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek("sym", "||") {
+		p.pos++
+		var right structQuery
+		if right, err = p.parseAnd(); err == nil {
+			left = structOr{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *structParser) parseAnd() (structQuery, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.peek("sym", "&&") {
+		p.pos++
+		var right structQuery
+		if right, err = p.parseUnary(); err == nil {
+			left = structAnd{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *structParser) parseUnary() (structQuery, error) {
+	switch {
+	case p.peek("sym", "!"):
+		p.pos++
+		operand, err := p.parseUnary()
+		return structNot{operand}, err
+	case p.peek("sym", "("):
+		p.pos++
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek("sym", ")") {
+			return nil, errors.New("missing )")
+		}
+		p.pos++
+		return q, nil
+	}
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("unexpected end of query")
+	}
+	tok := p.tokens[p.pos]
+	if tok.kind != "sel" {
+		return nil, fmt.Errorf("expected a field path, got %q", tok.text)
+	}
+	p.pos++
+	cond := structCond{selector: strings.Split(tok.text, ".")}
+	for _, segment := range cond.selector {
+		if segment == "" {
+			return nil, fmt.Errorf("field %q: empty path segment", tok.text)
+		}
+	}
+	p.prefixes = append(p.prefixes, cond.bindingPrefix())
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == "op" {
+		cond.op = p.tokens[p.pos].text
+		p.pos++
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind == "sym" || p.tokens[p.pos].kind == "op" {
+			return nil, fmt.Errorf("%s %s: missing value", tok.text, cond.op)
+		}
+		// Bare words compare as text too, e.g. status == 200.
+		cond.value = p.tokens[p.pos].text
+		p.pos++
+		p.compared = true
+		if cond.op == "matches" {
+			re, err := regexp.Compile(cond.value)
+			if err != nil {
+				return nil, fmt.Errorf("%s matches: %w", tok.text, err)
+			}
+			cond.re = re
+		}
+	}
+	return cond, nil
+}
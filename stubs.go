@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// stubPlaceholder matches the markers left in PoCs that were never finished.
+var stubPlaceholder = regexp.MustCompile(`\b(?:TODO|FIXME|TBD)\b`)
+
+// stubPoC is a PoC that cannot detect anything as written.
+type stubPoC struct {
+	File   string `json:"file"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// stubReason says why the document under top is a stub: it has no rules, an
+// empty expression, or a TODO placeholder in its name, set, rules or
+// expression. It is "" for a complete PoC.
+func stubReason(top *yaml.Node) string {
+	top = resolveAlias(top)
+	rules := resolveAlias(mappingValue(top, "rules"))
+	if rules == nil || len(rules.Content) == 0 {
+		return "no rules"
+	}
+	emptyExpression := func(node *yaml.Node) bool {
+		return strings.TrimSpace(scalarValue(resolveAlias(mappingValue(node, "expression")))) == ""
+	}
+	switch rules.Kind {
+	case yaml.MappingNode:
+		if emptyExpression(top) {
+			return "empty expression"
+		}
+		for i := 0; i+1 < len(rules.Content); i += 2 {
+			if emptyExpression(resolveAlias(rules.Content[i+1])) {
+				return fmt.Sprintf("empty expression in rule %s", rules.Content[i].Value)
+			}
+		}
+	case yaml.SequenceNode:
+		for i, rule := range rules.Content {
+			if emptyExpression(resolveAlias(rule)) {
+				return fmt.Sprintf("empty expression in rule %d", i)
+			}
+		}
+	}
+	for _, key := range []string{"name", "set", "rules", "expression"} {
+		if value := findPlaceholder(mappingValue(top, key)); value != "" {
+			return fmt.Sprintf("placeholder %s in %s", value, key)
+		}
+	}
+	return ""
+}
+
+// findPlaceholder returns the first TODO-like marker in the values under node.
+func findPlaceholder(node *yaml.Node) string {
+	node = resolveAlias(node)
+	if node == nil {
+		return ""
+	}
+	if node.Kind == yaml.ScalarNode {
+		return stubPlaceholder.FindString(node.Value)
+	}
+	for _, child := range node.Content {
+		if found := findPlaceholder(child); found != "" {
+			return found
+		}
+	}
+	return ""
+}
+
+// findStubPoCs lists the stub PoCs, by file.
+func findStubPoCs(units []pocEntry) []stubPoC {
+	seen := make(map[string]bool)
+	var out []stubPoC
+	for _, entry := range units {
+		if entry.Detail.Stub == "" || seen[entry.unit()] {
+			continue
+		}
+		seen[entry.unit()] = true
+		out = append(out, stubPoC{File: entry.unit(), Name: entry.Name, Reason: entry.Detail.Stub})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].File < out[j].File })
+	return out
+}
+
+func printStubPoCs(list []stubPoC) {
+	if len(list) == 0 {
+		return
+	}
+	fmt.Printf(tr("\n%d stub PoCs cannot detect anything; leave them out with -exclude-stubs:\n"), len(list))
+	for _, p := range list {
+		fmt.Printf("  - %s (%s): %s\n", p.File, p.Name, p.Reason)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// subsetFinding is a PoC whose rules all appear in another PoC that has
+// more of them, so the other PoC detects everything it does.
+type subsetFinding struct {
+	File          string `json:"file"`
+	Rules         int    `json:"rules"`
+	SupersededBy  string `json:"superseded_by"`
+	SupersetRules int    `json:"superset_rules"`
+}
+
+// ruleSet describes every rule of a document with describeRule, sorted and
+// deduplicated, for -detect-subsets.
+func ruleSet(doc *yaml.Node, normalize pathNormalizer) []string {
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	rules := resolveAlias(mappingValue(resolveAlias(doc.Content[0]), "rules"))
+	if rules == nil {
+		return nil
+	}
+	vars := parseVariables(doc.Content[0])
+	var set []string
+	switch rules.Kind {
+	case yaml.MappingNode:
+		for i := 1; i < len(rules.Content); i += 2 {
+			rule := resolveAlias(rules.Content[i])
+			set = appendUnique(set, describeRule(resolveAlias(mappingValue(rule, "request")), rule, vars, normalize))
+		}
+	case yaml.SequenceNode:
+		for _, rule := range rules.Content {
+			rule = resolveAlias(rule)
+			set = appendUnique(set, describeRule(rule, rule, vars, normalize))
+		}
+	}
+	sort.Strings(set)
+	return set
+}
+
+// findSubsets reports every PoC whose rule set is a strict subset of
+// another PoC's. PoCs in skip (duplicates about to be removed) and exempt
+// PoCs take no part. The superset named is the smallest one, ties broken by
+// path, so a chain A ⊂ B ⊂ C reports A under B and B under C.
+func findSubsets(units []pocEntry, skip map[string]bool) []subsetFinding {
+	byRule := make(map[string][]int)
+	for i, unit := range units {
+		if skip[unit.unit()] || unit.Exempt {
+			continue
+		}
+		for _, rule := range unit.RuleSet {
+			byRule[rule] = append(byRule[rule], i)
+		}
+	}
+	findings := []subsetFinding{}
+	for i, a := range units {
+		if len(a.RuleSet) == 0 || skip[a.unit()] || a.Exempt {
+			continue
+		}
+		// Every superset contains a's rarest rule.
+		rarest := byRule[a.RuleSet[0]]
+		for _, rule := range a.RuleSet[1:] {
+			if len(byRule[rule]) < len(rarest) {
+				rarest = byRule[rule]
+			}
+		}
+		best := -1
+		for _, j := range rarest {
+			b := units[j]
+			if j == i || len(b.RuleSet) <= len(a.RuleSet) || !isSubset(a.RuleSet, b.RuleSet) {
+				continue
+			}
+			if best < 0 || len(b.RuleSet) < len(units[best].RuleSet) ||
+				len(b.RuleSet) == len(units[best].RuleSet) && b.unit() < units[best].unit() {
+				best = j
+			}
+		}
+		if best >= 0 {
+			findings = append(findings, subsetFinding{
+				File:          a.unit(),
+				Rules:         len(a.RuleSet),
+				SupersededBy:  units[best].unit(),
+				SupersetRules: len(units[best].RuleSet),
+			})
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].File < findings[j].File })
+	return findings
+}
+
+// isSubset reports whether sorted a is contained in sorted b.
+func isSubset(a, b []string) bool {
+	j := 0
+	for _, rule := range a {
+		for j < len(b) && b[j] < rule {
+			j++
+		}
+		if j == len(b) || b[j] != rule {
+			return false
+		}
+		j++
+	}
+	return true
+}
+
+// subsetGroups turns findings into groups shaped like duplicate groups, the
+// superset first, so they can go through deleteDuplicateFiles.
+func subsetGroups(findings []subsetFinding, units []pocEntry) []duplicateGroup {
+	byUnit := make(map[string]pocEntry, len(units))
+	for _, unit := range units {
+		byUnit[unit.unit()] = unit
+	}
+	groups := make([]duplicateGroup, 0, len(findings))
+	for _, f := range findings {
+		groups = append(groups, duplicateGroup{
+			Key:     "rule subset",
+			Entries: []pocEntry{byUnit[f.SupersededBy], byUnit[f.File]},
+		})
+	}
+	return groups
+}
+
+func printSubsets(findings []subsetFinding) {
+	if len(findings) == 0 {
+		return
+	}
+	fmt.Printf(tr("\nDetected %d PoCs superseded by a PoC with more rules:\n"), len(findings))
+	for _, f := range findings {
+		fmt.Printf(tr("  - %s (%d rules) is covered by %s (%d rules)\n"), f.File, f.Rules, f.SupersededBy, f.SupersetRules)
+	}
+}
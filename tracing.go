@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing follows the OpenTelemetry environment variables. Spans are sent
+// over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT (or the traces-specific
+// variant) is set, or printed to stderr with OTEL_TRACES_EXPORTER=console.
+// The exporters read the endpoint, headers, TLS and timeout settings
+// themselves.
+const (
+	tracesExporterOTLP    = "otlp"
+	tracesExporterConsole = "console"
+	tracesExporterNone    = "none"
+
+	otlpProtocolGRPC         = "grpc"
+	otlpProtocolHTTPProtobuf = "http/protobuf"
+)
+
+// flushTimeout bounds the export of a trace when its root span ends.
+const flushTimeout = 10 * time.Second
+
+// tracer exports the spans of a trace when its root span ends. A nil
+// tracer disables tracing.
+type tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	// parent carries the W3C traceparent the run was started under, if any.
+	parent context.Context
+}
+
+var activeTracer = newTracerFromEnv()
+
+type span struct {
+	t    *tracer
+	ctx  context.Context
+	span trace.Span
+	root bool
+}
+
+func newTracerFromEnv() *tracer {
+	exporter := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_EXPORTER")))
+	if exporter == "" && (os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "") {
+		exporter = tracesExporterOTLP
+	}
+	ctx := context.Background()
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case tracesExporterOTLP:
+		exp, err = newOTLPExporter(ctx)
+	case tracesExporterConsole:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(stderrGuard), stdouttrace.WithPrettyPrint())
+	case "", tracesExporterNone:
+		return nil
+	default:
+		slog.Warn("unsupported OTEL_TRACES_EXPORTER; tracing disabled (want otlp, console or none)", "exporter", exporter)
+		return nil
+	}
+	if err != nil {
+		slog.Warn("tracing disabled", "exporter", exporter, "err", err)
+		return nil
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults.
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			attribute.String("service.name", "repeaterxraypoc"),
+			attribute.String("service.version", toolVersion()),
+		),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		slog.Warn("reading OTEL_RESOURCE_ATTRIBUTES", "err", err)
+	}
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("exporting trace", "err", err)
+	}))
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	// CI systems export TRACEPARENT so the scan joins the pipeline's trace.
+	carrier := propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	}
+	return &tracer{
+		provider: provider,
+		tracer:   provider.Tracer("repeaterxraypoc", trace.WithInstrumentationVersion(toolVersion())),
+		parent:   propagation.TraceContext{}.Extract(ctx, carrier),
+	}
+}
+
+// newOTLPExporter picks the OTLP transport from OTEL_EXPORTER_OTLP_PROTOCOL
+// or its traces-specific variant; the exporter reads the rest.
+func newOTLPExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	switch strings.ToLower(strings.TrimSpace(protocol)) {
+	case otlpProtocolGRPC:
+		return otlptracegrpc.New(ctx)
+	case "", otlpProtocolHTTPProtobuf:
+		return otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q (want %s or %s)", protocol, otlpProtocolHTTPProtobuf, otlpProtocolGRPC)
+	}
+}
+
+// startSpan starts a span below parent, or a new trace when parent is nil.
+// It returns nil when tracing is disabled; span methods accept a nil span.
+func startSpan(name string, parent *span) *span {
+	t := activeTracer
+	if t == nil {
+		return nil
+	}
+	ctx := t.parent
+	if parent != nil {
+		ctx = parent.ctx
+	}
+	ctx, s := t.tracer.Start(ctx, name)
+	return &span{t: t, ctx: ctx, span: s, root: parent == nil}
+}
+
+func (s *span) set(key string, value any) {
+	if s == nil {
+		return
+	}
+	switch v := value.(type) {
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, v))
+	case float64:
+		s.span.SetAttributes(attribute.Float64(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+	}
+}
+
+// end finishes the span, marking it failed when err is not nil. Ending a
+// root span exports its whole trace.
+func (s *span) end(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+	if s.root {
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		if err := s.t.provider.ForceFlush(ctx); err != nil {
+			slog.Warn("exporting trace", "err", err)
+		}
+	}
+}
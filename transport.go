@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	transportTCP = "tcp"
+	transportUDP = "udp"
+)
+
+// payloadKeyLimit is the longest payload spelled out in full in a group key;
+// longer ones are keyed by their hash.
+const payloadKeyLimit = 32
+
+// documentTransport returns the transport a PoC document declares, http when
+// it declares none.
+func documentTransport(doc *yaml.Node) string {
+	if len(doc.Content) == 0 {
+		return transportHTTP
+	}
+	if t := strings.ToLower(scalarValue(mappingValue(doc.Content[0], "transport"))); t != "" {
+		return t
+	}
+	return transportHTTP
+}
+
+// requestKeys returns what path grouping compares: the request paths of an
+// http PoC, with set variables resolved, or the payloads of a tcp or udp one.
+func requestKeys(root *yaml.Node, loose bool) ([]string, error) {
+	if transport := documentTransport(root); transport == transportTCP || transport == transportUDP {
+		payloads, err := extractPayloads(root)
+		if err != nil {
+			return nil, fmt.Errorf("%s PoC: %w", transport, err)
+		}
+		return payloads, nil
+	}
+	var paths []string
+	if loose {
+		paths = extractPathValues(root)
+	} else {
+		paths = extractRequestPaths(root)
+	}
+	if len(root.Content) > 0 {
+		vars := parseVariables(root.Content[0])
+		for i, p := range paths {
+			paths[i] = vars.template(p)
+		}
+	}
+	return paths, nil
+}
+
+// tcpRequest is the request of a tcp or udp rule: the bytes written, one
+// write per step. A rule that only reads (a banner grab) writes nothing.
+type tcpRequest struct {
+	Writes [][]byte
+}
+
+// extractPayloads returns the payloads of a tcp or udp PoC, its counterpart
+// of the request paths of an http PoC: one per rule, read from
+// rules.*.request in the v2 layout and from rules[] in v1.
+func extractPayloads(doc *yaml.Node) ([]string, error) {
+	if len(doc.Content) == 0 {
+		return nil, errors.New("empty document")
+	}
+	rules := resolveAlias(mappingValue(doc.Content[0], "rules"))
+	var requests []*yaml.Node
+	var names []string
+	switch {
+	case rules != nil && rules.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(rules.Content); i += 2 {
+			names = append(names, rules.Content[i].Value)
+			requests = append(requests, resolveAlias(mappingValue(resolveAlias(rules.Content[i+1]), "request")))
+		}
+	case rules != nil && rules.Kind == yaml.SequenceNode:
+		for i, rule := range rules.Content {
+			names = append(names, strconv.Itoa(i))
+			requests = append(requests, resolveAlias(rule))
+		}
+	}
+	if len(requests) == 0 {
+		return nil, errors.New("missing rules")
+	}
+	var out []string
+	for i, request := range requests {
+		req, err := parseTCPRequest(request)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", names[i], err)
+		}
+		out = appendUnique(out, req.key())
+	}
+	return out, nil
+}
+
+func parseTCPRequest(request *yaml.Node) (tcpRequest, error) {
+	var req tcpRequest
+	if request == nil || request.Kind != yaml.MappingNode {
+		return req, errors.New("missing request")
+	}
+	content := resolveAlias(mappingValue(request, "content"))
+	var steps []*yaml.Node
+	switch {
+	case content == nil:
+	case content.Kind == yaml.ScalarNode:
+		steps = []*yaml.Node{content}
+	case content.Kind == yaml.SequenceNode:
+		for _, step := range content.Content {
+			if step = resolveAlias(step); step.Kind != yaml.ScalarNode {
+				return req, errors.New("content steps must be strings")
+			}
+			steps = append(steps, step)
+		}
+	default:
+		return req, errors.New("content must be a string or a list of strings")
+	}
+	for _, step := range steps {
+		payload, err := decodePayload(step)
+		if err != nil {
+			return req, err
+		}
+		req.Writes = append(req.Writes, payload)
+	}
+	if timeout := scalarValue(mappingValue(request, "read_timeout")); timeout != "" {
+		if seconds, err := strconv.Atoi(timeout); err != nil || seconds <= 0 {
+			return req, fmt.Errorf("read_timeout %q is not a positive number of seconds", timeout)
+		}
+	}
+	return req, nil
+}
+
+// decodePayload returns the bytes a content scalar writes. Double-quoted
+// YAML has already turned \xNN into bytes; in other styles xray decodes the
+// escapes itself, so they are decoded here and must be well-formed.
+func decodePayload(n *yaml.Node) ([]byte, error) {
+	if n.Style&yaml.DoubleQuotedStyle != 0 {
+		return []byte(n.Value), nil
+	}
+	s := n.Value
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) || s[i+1] != 'x' {
+			out = append(out, s[i])
+			continue
+		}
+		if i+4 > len(s) {
+			return nil, fmt.Errorf("truncated hex escape %q in content", s[i:])
+		}
+		b, err := hex.DecodeString(s[i+2 : i+4])
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex escape %q in content", s[i:i+4])
+		}
+		out = append(out, b[0])
+		i += 3
+	}
+	return out, nil
+}
+
+// key identifies what the request writes, step by step. Read timeouts do
+// not change what a PoC detects and are left out.
+func (r tcpRequest) key() string {
+	if len(r.Writes) == 0 {
+		return "read-only"
+	}
+	steps := make([]string, len(r.Writes))
+	for i, payload := range r.Writes {
+		if len(payload) > payloadKeyLimit {
+			sum := sha256.Sum256(payload)
+			steps[i] = "sha256:" + hex.EncodeToString(sum[:8])
+			continue
+		}
+		steps[i] = hex.EncodeToString(payload)
+	}
+	return "payload:" + strings.Join(steps, ",")
+}
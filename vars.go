@@ -0,0 +1,144 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxVariableDepth bounds how deep set variables defined in terms of other
+// variables are resolved, so cyclic definitions terminate.
+const maxVariableDepth = 8
+
+// pocVariables maps the variables a PoC defines under set and payloads to
+// what they stand for, so requests and expressions compare the same whatever
+// the variables are called.
+type pocVariables map[string]pocVariable
+
+// pocVariable is a string literal, which stands for itself, or the canonical
+// rendering of any other definition, such as randomLowercase(8).
+type pocVariable struct {
+	value   string
+	literal bool
+}
+
+// parseVariables reads the set and payloads sections of the top-level
+// mapping. A payload variable stands for all of its values across the
+// payload sets, sorted.
+func parseVariables(top *yaml.Node) pocVariables {
+	top = resolveAlias(top)
+	defs := make(map[string]string)
+	if set := resolveAlias(mappingValue(top, "set")); set != nil && set.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(set.Content); i += 2 {
+			defs[strings.TrimSpace(set.Content[i].Value)] = scalarValue(set.Content[i+1])
+		}
+	}
+	if len(defs) == 0 && mappingValue(top, "payloads") == nil {
+		return nil
+	}
+	vars := make(pocVariables, len(defs))
+	for name := range defs {
+		vars[name] = resolveDefinition(name, defs, 0)
+	}
+	payloads := resolveAlias(mappingValue(resolveAlias(mappingValue(top, "payloads")), "payloads"))
+	if payloads == nil || payloads.Kind != yaml.MappingNode {
+		return vars
+	}
+	values := make(map[string][]string)
+	for i := 1; i < len(payloads.Content); i += 2 {
+		set := resolveAlias(payloads.Content[i])
+		if set == nil || set.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 0; j+1 < len(set.Content); j += 2 {
+			name := strings.TrimSpace(set.Content[j].Value)
+			v := resolveDefinition(name, map[string]string{name: scalarValue(set.Content[j+1])}, 0)
+			values[name] = appendUnique(values[name], v.value)
+		}
+	}
+	for name, list := range values {
+		sort.Strings(list)
+		vars[name] = pocVariable{value: "payload(" + strings.Join(list, "|") + ")"}
+	}
+	return vars
+}
+
+// resolveDefinition resolves the CEL definition of name, replacing the
+// other variables it uses by their own definitions.
+func resolveDefinition(name string, defs map[string]string, depth int) pocVariable {
+	def := defs[name]
+	tokens, err := tokenizeCEL(def)
+	if err != nil {
+		return pocVariable{value: strings.Join(strings.Fields(def), " ")}
+	}
+	if len(tokens) == 1 && tokens[0].kind == 's' {
+		return pocVariable{value: tokens[0].text, literal: true}
+	}
+	if depth < maxVariableDepth {
+		for i, t := range tokens {
+			if _, ok := defs[t.text]; ok && t.text != name && isVariableReference(tokens, i) {
+				tokens[i] = resolveDefinition(t.text, defs, depth+1).token()
+			}
+		}
+	}
+	return pocVariable{value: renderTokens(tokens)}
+}
+
+// token is the expression token the variable is replaced by.
+func (v pocVariable) token() celToken {
+	if v.literal {
+		return celToken{'s', v.value}
+	}
+	return celToken{'i', v.value}
+}
+
+// isVariableReference reports whether tokens[i] is an identifier naming a
+// variable: not a field after a dot, not a function being called.
+func isVariableReference(tokens []celToken, i int) bool {
+	if tokens[i].kind != 'i' {
+		return false
+	}
+	if i > 0 && tokens[i-1].kind == 'p' && tokens[i-1].text == "." {
+		return false
+	}
+	return i+1 >= len(tokens) || tokens[i+1].text != "("
+}
+
+// template replaces the variables in the {{...}} placeholders of s. A
+// placeholder holding just a string variable becomes its value.
+func (v pocVariables) template(s string) string {
+	if len(v) == 0 || !strings.Contains(s, "{{") {
+		return s
+	}
+	return templateToken.ReplaceAllStringFunc(s, func(token string) string {
+		inner := strings.TrimSpace(token[2 : len(token)-2])
+		if variable, ok := v[inner]; ok && variable.literal {
+			return variable.value
+		}
+		return "{{" + v.expression(inner) + "}}"
+	})
+}
+
+// expression replaces the variables an expression refers to by what they
+// stand for. An expression that does not tokenize is returned unchanged.
+func (v pocVariables) expression(expr string) string {
+	if len(v) == 0 {
+		return expr
+	}
+	tokens, err := tokenizeCEL(expr)
+	if err != nil {
+		return expr
+	}
+	changed := false
+	for i, t := range tokens {
+		if variable, ok := v[t.text]; ok && isVariableReference(tokens, i) {
+			tokens[i] = variable.token()
+			changed = true
+		}
+	}
+	if !changed {
+		return expr
+	}
+	return renderTokens(tokens)
+}
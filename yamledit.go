@@ -0,0 +1,737 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+var plainScalarSafe = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.\-/]*$`)
+
+// replaceScalarInPlace rewrites the source text of a scalar node, leaving the
+// rest of the document (comments, indentation, key order) byte-for-byte
+// untouched. The original quoting style is kept when it can represent value.
+func replaceScalarInPlace(raw []byte, node *yaml.Node, value string) ([]byte, error) {
+	if node.Kind != yaml.ScalarNode {
+		return nil, fmt.Errorf("line %d: not a scalar", node.Line)
+	}
+	start, err := valueOffset(raw, node)
+	if err != nil {
+		return nil, err
+	}
+	end, err := scalarEnd(raw, start, node)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", node.Line, err)
+	}
+
+	var text string
+	switch {
+	case node.Style&yaml.SingleQuotedStyle != 0:
+		text = "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	case node.Style == 0 && plainScalarSafe.MatchString(value):
+		text = value
+	default:
+		text, err = doubleQuoted(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]byte, 0, len(raw)-(end-start)+len(text))
+	out = append(out, raw[:start]...)
+	out = append(out, text...)
+	out = append(out, raw[end:]...)
+	return out, nil
+}
+
+// nodeOffset converts the node's 1-based line and rune column to a byte offset.
+func nodeOffset(raw []byte, node *yaml.Node) (int, error) {
+	offset := 0
+	for line := 1; line < node.Line; line++ {
+		i := bytes.IndexByte(raw[offset:], '\n')
+		if i < 0 {
+			return 0, fmt.Errorf("line %d is past the end of the document", node.Line)
+		}
+		offset += i + 1
+	}
+	for col := 1; col < node.Column; col++ {
+		if offset >= len(raw) || raw[offset] == '\n' {
+			return 0, fmt.Errorf("line %d: column %d is past the end of the line", node.Line, node.Column)
+		}
+		_, size := utf8.DecodeRune(raw[offset:])
+		offset += size
+	}
+	return offset, nil
+}
+
+// valueOffset is the offset of the node's value, past the anchor and tag
+// that nodeOffset includes.
+func valueOffset(raw []byte, node *yaml.Node) (int, error) {
+	offset, err := nodeOffset(raw, node)
+	if err != nil {
+		return 0, err
+	}
+	for offset < len(raw) && (raw[offset] == '&' || raw[offset] == '!') {
+		for offset < len(raw) && bytes.IndexByte([]byte(" \t\r\n"), raw[offset]) < 0 {
+			offset++
+		}
+		for offset < len(raw) && (raw[offset] == ' ' || raw[offset] == '\t') {
+			offset++
+		}
+	}
+	return offset, nil
+}
+
+func scalarEnd(raw []byte, start int, node *yaml.Node) (int, error) {
+	value := node.Value
+	switch style := node.Style; {
+	case style&yaml.DoubleQuotedStyle != 0:
+		for i := start + 1; i < len(raw); i++ {
+			switch raw[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1, nil
+			}
+		}
+		return 0, fmt.Errorf("unterminated double-quoted scalar")
+	case style&yaml.SingleQuotedStyle != 0:
+		for i := start + 1; i < len(raw); i++ {
+			if raw[i] != '\'' {
+				continue
+			}
+			if i+1 < len(raw) && raw[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+		return 0, fmt.Errorf("unterminated single-quoted scalar")
+	case style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		return 0, fmt.Errorf("block scalars cannot be edited in place")
+	default:
+		// A single-line plain scalar's source text is exactly its value.
+		if bytes.HasPrefix(raw[start:], []byte(value)) {
+			return start + len(value), nil
+		}
+		return 0, fmt.Errorf("multi-line plain scalars cannot be edited in place")
+	}
+}
+
+func doubleQuoted(value string) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// pocEditor edits one document of a PoC through its source text, so that
+// comments, anchors, key order and quoting outside the edited field survive.
+// Every edit is parsed back and checked before it is kept; a failed edit
+// leaves the editor as it was. JSON, which has no comments, is re-encoded in
+// the layout it was read in.
+type pocEditor struct {
+	path string
+	raw  []byte
+	root yaml.Node
+}
+
+func newPoCEditor(path string, raw []byte) (*pocEditor, error) {
+	root, err := readPoCBytes(path, raw)
+	if err != nil {
+		return nil, err
+	}
+	return &pocEditor{path: path, raw: raw, root: root}, nil
+}
+
+func (e *pocEditor) top() (*yaml.Node, error) {
+	top := e.root.Content[0]
+	if top.Kind != yaml.MappingNode {
+		return nil, errors.New("document is not a mapping")
+	}
+	if !isJSONFile(e.path) && top.Style&yaml.FlowStyle != 0 {
+		return nil, errors.New("flow-style documents cannot be edited in place")
+	}
+	return top, nil
+}
+
+// commit keeps updated once it parses and check accepts it.
+func (e *pocEditor) commit(updated []byte, check func(doc *yaml.Node) error) error {
+	root, err := readPoCBytes(e.path, updated)
+	if err == nil {
+		err = check(&root)
+	} else {
+		err = fmt.Errorf("rewritten document does not parse: %w", err)
+	}
+	if err != nil {
+		// JSON edits change the tree before encoding it.
+		e.root, _ = readPoCBytes(e.path, e.raw)
+		return err
+	}
+	e.raw, e.root = updated, root
+	return nil
+}
+
+// setName replaces the value of the name field, keeping its quoting.
+func (e *pocEditor) setName(name string) error {
+	node := findFirstScalarNode(&e.root, "name")
+	if node == nil {
+		return errors.New("no name field")
+	}
+	updated, err := replaceScalarInPlace(e.raw, node, name)
+	if err != nil {
+		return err
+	}
+	return e.commit(updated, func(doc *yaml.Node) error {
+		if got := findFirstScalar(doc, "name"); got != name {
+			return fmt.Errorf("rewritten name is %q, want %q", got, name)
+		}
+		return nil
+	})
+}
+
+// setLinks makes detail.links list links, adding the field (and detail)
+// when missing. Links the file already lists keep their place, comments and
+// quoting; the others are appended in order. A flow-style list is rewritten
+// as a whole.
+func (e *pocEditor) setLinks(links []string) error {
+	top, err := e.top()
+	if err != nil {
+		return err
+	}
+	detail := mappingValue(top, "detail")
+	current := mappingValue(detail, "links")
+	for _, node := range []*yaml.Node{detail, current} {
+		if node != nil && node.Kind == yaml.AliasNode {
+			return fmt.Errorf("line %d: aliases cannot be edited in place", node.Line)
+		}
+	}
+	if detail != nil && detail.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: detail is not a mapping", detail.Line)
+	}
+	var have []string
+	switch {
+	case current == nil || current.Tag == "!!null":
+	case current.Kind == yaml.SequenceNode:
+		for _, item := range current.Content {
+			have = append(have, item.Value)
+		}
+	default:
+		return fmt.Errorf("line %d: detail.links is not a list", current.Line)
+	}
+
+	var want, add []string
+	var drop []int
+	for i, link := range have {
+		if slices.Contains(links, link) {
+			want = append(want, link)
+		} else {
+			drop = append(drop, i)
+		}
+	}
+	for _, link := range links {
+		if !slices.Contains(have, link) && !slices.Contains(add, link) {
+			add = append(add, link)
+		}
+	}
+	if len(drop) == 0 && len(add) == 0 {
+		return nil
+	}
+	want = append(want, add...)
+
+	var updated []byte
+	if isJSONFile(e.path) {
+		list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, link := range want {
+			list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: link})
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "links"}
+		switch {
+		case detail == nil:
+			top.Content = append(top.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "detail"},
+				&yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{key, list}})
+		case current == nil:
+			detail.Content = append(detail.Content, key, list)
+		default:
+			*current = *list
+		}
+		updated, err = detectLayout(e.path, e.raw).encode(&e.root)
+	} else {
+		updated, err = e.setYAMLLinks(top, detail, current, drop, add)
+	}
+	if err != nil {
+		return err
+	}
+	return e.commit(updated, func(doc *yaml.Node) error {
+		var got []string
+		if node := mappingValue(mappingValue(doc.Content[0], "detail"), "links"); node != nil {
+			if err := node.Decode(&got); err != nil {
+				return err
+			}
+		}
+		if !slices.Equal(got, want) {
+			return errors.New("rewritten detail.links do not match")
+		}
+		return nil
+	})
+}
+
+func (e *pocEditor) setYAMLLinks(top, detail, current *yaml.Node, drop []int, add []string) ([]byte, error) {
+	edits := newLineEdits(e.raw)
+	indent := detectLayout(e.path, e.raw).indent
+	items := func(prefix string) (string, error) {
+		var b strings.Builder
+		for _, link := range add {
+			text, err := scalarText(link, false)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(prefix + text + "\n")
+		}
+		return b.String(), nil
+	}
+	last := func(mapping *yaml.Node) int { return mapping.Content[len(mapping.Content)-2].Line }
+
+	switch {
+	case detail == nil:
+		keyIndent := strings.Repeat(" ", top.Content[0].Column-1)
+		text, err := items(keyIndent + indent + indent + "- ")
+		if err != nil {
+			return nil, err
+		}
+		at := edits.end(last(top), len(edits.lines)+1)
+		edits.insert(at, keyIndent+"detail:\n"+keyIndent+indent+"links:\n"+text)
+	case detail.Style&yaml.FlowStyle != 0 || len(detail.Content) == 0:
+		return nil, errors.New("flow-style detail cannot be edited in place")
+	case current == nil:
+		keyIndent := strings.Repeat(" ", detail.Content[0].Column-1)
+		text, err := items(keyIndent + indent + "- ")
+		if err != nil {
+			return nil, err
+		}
+		at := edits.end(last(detail), nextKeyLine(top, detail, len(edits.lines)+1))
+		edits.insert(at, keyIndent+"links:\n"+text)
+	case current.Kind == yaml.ScalarNode:
+		// An empty links field: drop its null, if spelled out, and list the
+		// links under the key.
+		key := mappingKey(detail, current)
+		if current.Value != "" {
+			start, err := valueOffset(e.raw, current)
+			if err != nil {
+				return nil, err
+			}
+			end, err := scalarEnd(e.raw, start, current)
+			if err != nil {
+				return nil, err
+			}
+			edits.splice(start, end, "")
+		}
+		text, err := items(strings.Repeat(" ", key.Column-1) + indent + "- ")
+		if err != nil {
+			return nil, err
+		}
+		edits.insert(key.Line+1, text)
+	case current.Style&yaml.FlowStyle != 0:
+		start, err := valueOffset(e.raw, current)
+		if err != nil {
+			return nil, err
+		}
+		end, err := flowEnd(e.raw, start)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", current.Line, err)
+		}
+		var texts []string
+		for i, item := range current.Content {
+			if !slices.Contains(drop, i) {
+				texts = append(texts, item.Value)
+			}
+		}
+		texts = append(texts, add...)
+		for i, link := range texts {
+			if texts[i], err = scalarText(link, true); err != nil {
+				return nil, err
+			}
+		}
+		list := "[" + strings.Join(texts, ", ") + "]"
+		return append(append(append([]byte{}, e.raw[:start]...), list...), e.raw[end:]...), nil
+	default:
+		seqEnd := nextKeyLine(detail, current, nextKeyLine(top, detail, len(edits.lines)+1))
+		itemEnd := func(i int) int {
+			end := seqEnd
+			if i+1 < len(current.Content) {
+				end = current.Content[i+1].Line
+			}
+			return edits.end(current.Content[i].Line, end)
+		}
+		for _, i := range drop {
+			edits.delete(current.Content[i].Line, itemEnd(i))
+		}
+		lastItem := current.Content[len(current.Content)-1]
+		start, err := nodeOffset(e.raw, lastItem)
+		if err != nil {
+			return nil, err
+		}
+		lineStart := bytes.LastIndexByte(e.raw[:start], '\n') + 1
+		text, err := items(string(e.raw[lineStart:start]))
+		if err != nil {
+			return nil, err
+		}
+		edits.insert(itemEnd(len(current.Content)-1), text)
+		if len(add) == 0 && len(drop) == len(current.Content) {
+			// Every link is gone: leave an empty list rather than a null.
+			colon, err := keyColon(e.raw, mappingKey(detail, current))
+			if err != nil {
+				return nil, err
+			}
+			edits.splice(colon+1, colon+1, " []")
+		}
+	}
+	return edits.apply(), nil
+}
+
+// setField sets the top-level field key to the string value. A missing
+// field is added as the first one of the document, where a reader sees it.
+func (e *pocEditor) setField(key, value string) error {
+	top, err := e.top()
+	if err != nil {
+		return err
+	}
+	current := mappingValue(top, key)
+	if current != nil && current.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: %s is not a scalar", current.Line, key)
+	}
+	if current != nil && current.Value == value {
+		return nil
+	}
+	fields := len(top.Content) / 2
+	if current == nil {
+		fields++
+	}
+
+	var updated []byte
+	switch {
+	case isJSONFile(e.path):
+		node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+		if current != nil {
+			*current = *node
+		} else {
+			top.Content = append([]*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, node}, top.Content...)
+		}
+		updated, err = detectLayout(e.path, e.raw).encode(&e.root)
+	case current != nil:
+		updated, err = replaceScalarInPlace(e.raw, current, value)
+	default:
+		var text string
+		if text, err = scalarText(value, false); err == nil {
+			edits := newLineEdits(e.raw)
+			first := top.Content[0]
+			edits.insert(first.Line, strings.Repeat(" ", first.Column-1)+key+": "+text+"\n")
+			updated = edits.apply()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return e.commit(updated, func(doc *yaml.Node) error {
+		top := doc.Content[0]
+		if got := mappingValue(top, key); got == nil || got.Value != value || len(top.Content)/2 != fields {
+			return fmt.Errorf("rewritten %s does not match", key)
+		}
+		return nil
+	})
+}
+
+// removeRules deletes the rules named in renames, points the calls to them
+// in expression at the rule each is renamed to and drops the calls that
+// repeat as a result. Comment lines directly above the next key stay with
+// that key.
+func (e *pocEditor) removeRules(renames map[string]string) error {
+	top, err := e.top()
+	if err != nil {
+		return err
+	}
+	rules := mappingValue(top, "rules")
+	if rules == nil || rules.Kind != yaml.MappingNode {
+		return errors.New("rules is not a mapping")
+	}
+	var drop []int
+	for i := 0; i+1 < len(rules.Content); i += 2 {
+		if _, ok := renames[rules.Content[i].Value]; ok {
+			drop = append(drop, i)
+		}
+	}
+	if len(drop) == 0 {
+		return nil
+	}
+	wantRules := len(rules.Content)/2 - len(drop)
+	expr := mappingValue(top, "expression")
+	renamed, wantExpr := "", ""
+	if expr != nil {
+		renamed = renameRuleCalls(expr.Value, renames)
+		wantExpr = dedupeOperands(renamed)
+	}
+	lineExpr := wantExpr
+
+	var updated []byte
+	if isJSONFile(e.path) {
+		for k := len(drop) - 1; k >= 0; k-- {
+			i := drop[k]
+			rules.Content = append(rules.Content[:i], rules.Content[i+2:]...)
+		}
+		if expr != nil {
+			expr.Value = wantExpr
+		}
+		if updated, err = detectLayout(e.path, e.raw).encode(&e.root); err != nil {
+			return err
+		}
+	} else {
+		if rules.Style&yaml.FlowStyle != 0 {
+			return errors.New("flow-style rules cannot be edited in place")
+		}
+		edits := newLineEdits(e.raw)
+		rulesEnd := nextKeyLine(top, rules, len(edits.lines)+1)
+		for _, i := range drop {
+			end := rulesEnd
+			if i+2 < len(rules.Content) {
+				end = rules.Content[i+2].Line
+			}
+			edits.delete(rules.Content[i].Line, edits.end(rules.Content[i].Line, end))
+		}
+		if expr != nil {
+			// Renaming line by line keeps the layout. A one-line expression
+			// is also simplified in place; others are rewritten below.
+			simplified := wantExpr == renamed
+			from, to := strings.TrimSpace(renamed), strings.TrimSpace(wantExpr)
+			for line := expr.Line; line < nextKeyLine(top, expr, len(edits.lines)+1); line++ {
+				text := renameRuleCalls(string(edits.lines[line-1]), renames)
+				if !simplified && !strings.Contains(from, "\n") && strings.Contains(text, from) {
+					text, simplified = strings.Replace(text, from, to, 1), true
+				}
+				edits.replace[line] = text
+			}
+			// A multi-line expression becomes one line when it simplifies
+			// to one.
+			end := edits.end(expr.Line, nextKeyLine(top, expr, len(edits.lines)+1))
+			if !simplified && !strings.Contains(to, "\n") && end > expr.Line+1 {
+				switch {
+				case expr.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+					first := string(edits.lines[expr.Line])
+					indent := first[:len(first)-len(strings.TrimLeft(first, " \t"))]
+					edits.replace[expr.Line+1] = indent + to + lineEnding(first)
+					edits.delete(expr.Line+2, end)
+					simplified = true
+				case expr.Style == 0:
+					first := string(edits.lines[expr.Line-1])
+					edits.replace[expr.Line] = first[:expr.Column-1] + to + lineEnding(first)
+					edits.delete(expr.Line+1, end)
+					simplified = true
+				}
+			}
+			if !simplified {
+				lineExpr = renamed
+			}
+		}
+		updated = edits.apply()
+	}
+
+	// Check the result rather than trusting the line arithmetic.
+	err = e.commit(updated, func(doc *yaml.Node) error {
+		top := doc.Content[0]
+		if got := mappingValue(top, "rules"); got == nil || len(got.Content)/2 != wantRules {
+			return errors.New("rewritten rules do not match")
+		}
+		if expr != nil {
+			if got := mappingValue(top, "expression"); got == nil || got.Value != lineExpr {
+				return errors.New("rewritten expression does not match")
+			}
+		}
+		return nil
+	})
+	if err != nil || wantExpr == lineExpr {
+		return err
+	}
+	if err := e.setField("expression", wantExpr); err != nil {
+		// The calls are renamed; a repeat left behind does no harm.
+		slog.Debug("repeated rule calls left in expression", "file", e.path, "err", err)
+	}
+	return nil
+}
+
+// lineEdits collects edits to the lines of a document's source and applies
+// them in one pass. Lines are numbered from 1, as in yaml.Node.
+type lineEdits struct {
+	raw     []byte
+	lines   [][]byte
+	deleted map[int]bool
+	// before holds text inserted before a line; len(lines)+1 appends.
+	before  map[int]string
+	replace map[int]string
+}
+
+func newLineEdits(raw []byte) *lineEdits {
+	return &lineEdits{
+		raw:     raw,
+		lines:   bytes.SplitAfter(raw, []byte("\n")),
+		deleted: make(map[int]bool),
+		before:  make(map[int]string),
+		replace: make(map[int]string),
+	}
+}
+
+// end returns the line after the block running from start up to end,
+// leaving out the comments and blank lines at its end, which belong to
+// what follows.
+func (l *lineEdits) end(start, end int) int {
+	for end-1 > start && isBlockTrailer(l.lines[end-2]) {
+		end--
+	}
+	return end
+}
+
+// lineEnding returns the line break that ends line.
+func lineEnding(line string) string {
+	return line[len(strings.TrimRight(line, "\r\n")):]
+}
+
+func isBlockTrailer(line []byte) bool {
+	trimmed := bytes.TrimRight(line, " \t\r\n")
+	return isCommentOrBlank(line) || isDocumentStart(trimmed) || bytes.Equal(trimmed, []byte("..."))
+}
+
+func (l *lineEdits) delete(start, end int) {
+	for line := start; line < end; line++ {
+		l.deleted[line] = true
+	}
+}
+
+func (l *lineEdits) insert(line int, text string) {
+	l.before[line] += text
+}
+
+// splice replaces raw[start:end], which must lie on one line, with text.
+func (l *lineEdits) splice(start, end int, text string) {
+	line, offset := 1, 0
+	for offset+len(l.lines[line-1]) <= start {
+		offset += len(l.lines[line-1])
+		line++
+	}
+	src := l.lines[line-1]
+	before := string(src[:start-offset])
+	if text == "" {
+		before = strings.TrimRight(before, " \t")
+	}
+	l.replace[line] = before + text + string(src[end-offset:])
+}
+
+func (l *lineEdits) apply() []byte {
+	out := make([]byte, 0, len(l.raw))
+	insert := func(text string) {
+		if text != "" && len(out) > 0 && out[len(out)-1] != '\n' {
+			out = append(out, '\n')
+		}
+		out = append(out, text...)
+	}
+	for i, line := range l.lines {
+		insert(l.before[i+1])
+		if l.deleted[i+1] {
+			continue
+		}
+		if text, ok := l.replace[i+1]; ok {
+			line = []byte(text)
+		}
+		out = append(out, line...)
+	}
+	insert(l.before[len(l.lines)+1])
+	return out
+}
+
+// mappingKey returns the key node of value in mapping.
+func mappingKey(mapping, value *yaml.Node) *yaml.Node {
+	for i := 1; i < len(mapping.Content); i += 2 {
+		if mapping.Content[i] == value {
+			return mapping.Content[i-1]
+		}
+	}
+	return nil
+}
+
+// keyColon returns the offset of the colon after a block mapping key.
+func keyColon(raw []byte, key *yaml.Node) (int, error) {
+	start, err := valueOffset(raw, key)
+	if err != nil {
+		return 0, err
+	}
+	end, err := scalarEnd(raw, start, key)
+	if err != nil {
+		return 0, fmt.Errorf("line %d: %w", key.Line, err)
+	}
+	for end < len(raw) && (raw[end] == ' ' || raw[end] == '\t') {
+		end++
+	}
+	if end >= len(raw) || raw[end] != ':' {
+		return 0, fmt.Errorf("line %d: no colon after key %q", key.Line, key.Value)
+	}
+	return end, nil
+}
+
+// flowEnd returns the offset after the flow collection starting at start.
+func flowEnd(raw []byte, start int) (int, error) {
+	depth := 0
+	for i := start; i < len(raw); i++ {
+		atToken := i == start || bytes.IndexByte([]byte(" \t\r\n[{,:"), raw[i-1]) >= 0
+		switch c := raw[i]; {
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			if depth--; depth == 0 {
+				return i + 1, nil
+			}
+		case (c == '"' || c == '\'') && atToken:
+			style := yaml.DoubleQuotedStyle
+			if c == '\'' {
+				style = yaml.SingleQuotedStyle
+			}
+			end, err := scalarEnd(raw, i, &yaml.Node{Style: style})
+			if err != nil {
+				return 0, err
+			}
+			i = end - 1
+		case c == '#' && i > start && (raw[i-1] == ' ' || raw[i-1] == '\t'):
+			for i < len(raw) && raw[i] != '\n' {
+				i++
+			}
+		}
+	}
+	return 0, errors.New("unterminated flow collection")
+}
+
+// scalarText renders value as a plain scalar when it reads back as the same
+// string inside a block sequence (or, with flow, a flow sequence), and
+// double-quoted otherwise.
+func scalarText(value string, flow bool) (string, error) {
+	src := "- " + value
+	if flow {
+		src = "[" + value + "]"
+	}
+	var doc yaml.Node
+	if yaml.Unmarshal([]byte(src), &doc) == nil && len(doc.Content) == 1 {
+		if seq := doc.Content[0]; seq.Kind == yaml.SequenceNode && len(seq.Content) == 1 {
+			item := seq.Content[0]
+			if item.Kind == yaml.ScalarNode && item.Style == 0 && item.Tag == "!!str" && item.Value == value {
+				return value, nil
+			}
+		}
+	}
+	return doubleQuoted(value)
+}